@@ -138,6 +138,8 @@ func NewCloudControllerManagerCommand() *cobra.Command {
 		},
 	}
 
+	cmd.AddCommand(newPlanCommand())
+
 	fs := cmd.Flags()
 	namedFlagSets := s.Flags(KnownControllers(), ControllersDisabledByDefault.List())
 	verflag.AddFlags(namedFlagSets.FlagSet("global"))
@@ -417,7 +419,9 @@ func KnownControllers() []string {
 }
 
 // ControllersDisabledByDefault is the controller disabled default when starting cloud-controller managers.
-var ControllersDisabledByDefault = sets.NewString()
+var ControllersDisabledByDefault = sets.NewString(
+	provider.OrphanedResourceGCControllerName,
+)
 
 // newControllerInitializers is a private map of named controller groups (you can start more than one in an init func)
 // paired to their initFunc.  This allows for structured downstream composition and subdivision.
@@ -428,5 +432,7 @@ func newControllerInitializers() map[string]initFunc {
 	controllers["service"] = startServiceController
 	controllers["route"] = startRouteController
 	controllers["node-ipam"] = startNodeIpamController
+	controllers[provider.OrphanedResourceGCControllerName] = startOrphanedResourceGCController
+	controllers[provider.NatGatewayControllerName] = startNatGatewayController
 	return controllers
 }
@@ -37,10 +37,12 @@ import (
 	netutils "k8s.io/utils/net"
 
 	cloudcontrollerconfig "sigs.k8s.io/cloud-provider-azure/cmd/cloud-controller-manager/app/config"
+	"sigs.k8s.io/cloud-provider-azure/cmd/cloud-controller-manager/app/options"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	nodeipamcontroller "sigs.k8s.io/cloud-provider-azure/pkg/nodeipam"
 	nodeipamconfig "sigs.k8s.io/cloud-provider-azure/pkg/nodeipam/config"
 	"sigs.k8s.io/cloud-provider-azure/pkg/nodeipam/ipam"
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
 )
 
 func startCloudNodeController(ctx context.Context, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
@@ -82,11 +84,26 @@ func startCloudNodeLifecycleController(ctx context.Context, completedConfig *clo
 }
 
 func startServiceController(ctx context.Context, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
+	serviceInformer := completedConfig.SharedInformers.Core().V1().Services()
+	// The service controller skips the services with spec.loadBalancerClass, so the services of the named Azure
+	// load balancer classes are passed to it by a service informer removing the classes.
+	if az, ok := cloud.(*provider.Cloud); ok && len(az.LoadBalancerClasses) > 0 {
+		services := newLoadBalancerClassServices(az.LoadBalancerClasses)
+		informer, err := services.newServiceInformer(completedConfig.VersionedClient, options.ResyncPeriod(completedConfig.Config)())
+		if err != nil {
+			klog.Errorf("Failed to create the service informer of the load balancer classes: %v", err)
+			return nil, false, nil
+		}
+		go informer.Informer().Run(ctx.Done())
+		serviceInformer = informer
+		cloud = &loadBalancerClassCloud{Interface: cloud, services: services}
+	}
+
 	// Start the service controller
 	serviceController, err := servicecontroller.New(
 		cloud,
 		completedConfig.ClientBuilder.ClientOrDie("service-controller"),
-		completedConfig.SharedInformers.Core().V1().Services(),
+		serviceInformer,
 		completedConfig.SharedInformers.Core().V1().Nodes(),
 		completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
 		utilfeature.DefaultFeatureGate,
@@ -143,6 +160,35 @@ func startRouteController(ctx context.Context, completedConfig *cloudcontrollerc
 	return nil, true, nil
 }
 
+func startOrphanedResourceGCController(ctx context.Context, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
+	az, ok := cloud.(*provider.Cloud)
+	if !ok {
+		klog.Warningf("%s controller is only supported by the Azure cloud provider", provider.OrphanedResourceGCControllerName)
+		return nil, false, nil
+	}
+
+	gc := provider.NewOrphanedResourceGC(
+		az,
+		completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+		completedConfig.SharedInformers.Core().V1().Services(),
+		completedConfig.SharedInformers.Core().V1().Nodes(),
+	)
+	go gc.Run(ctx)
+
+	return nil, true, nil
+}
+
+func startNatGatewayController(ctx context.Context, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
+	az, ok := cloud.(*provider.Cloud)
+	if !ok || !az.ShouldReconcileNatGateway() {
+		return nil, false, nil
+	}
+
+	go az.RunNatGatewayReconciler(ctx, completedConfig.ComponentConfig.KubeCloudShared.ClusterName)
+
+	return nil, true, nil
+}
+
 func startNodeIpamController(ctx context.Context, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
 	var serviceCIDR *net.IPNet
 	var secondaryServiceCIDR *net.IPNet
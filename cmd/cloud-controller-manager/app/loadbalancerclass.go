@@ -0,0 +1,192 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+// loadBalancerClassServices makes the service controller of k8s.io/cloud-provider, which only handles the services
+// without spec.loadBalancerClass, handle the services selecting the named Azure load balancer classes. The classes
+// are removed from the services by the transform of the service informer of the controller, and restored by its
+// load balancer interface before the services are passed to the cloud provider.
+type loadBalancerClassServices struct {
+	classNames sets.String
+
+	lock sync.Mutex
+	// classes are the names of the classes removed from the services keyed by their UIDs. They are kept after the
+	// classes are cleared by the change of the service type, so that the resources can be deleted per the classes,
+	// and dropped after the resources are deleted or the services are deleted.
+	classes map[types.UID]string
+}
+
+func newLoadBalancerClassServices(loadBalancerClasses []provider.LoadBalancerClass) *loadBalancerClassServices {
+	classNames := sets.NewString()
+	for _, loadBalancerClass := range loadBalancerClasses {
+		classNames.Insert(loadBalancerClass.Name)
+	}
+	return &loadBalancerClassServices{
+		classNames: classNames,
+		classes:    make(map[types.UID]string),
+	}
+}
+
+// transform removes the named Azure class from the service, and records it by the UID of the service.
+func (s *loadBalancerClassServices) transform(obj interface{}) (interface{}, error) {
+	service, ok := obj.(*v1.Service)
+	if !ok || service.Spec.LoadBalancerClass == nil || !s.classNames.Has(*service.Spec.LoadBalancerClass) {
+		return obj, nil
+	}
+
+	s.lock.Lock()
+	s.classes[service.UID] = *service.Spec.LoadBalancerClass
+	s.lock.Unlock()
+
+	service = service.DeepCopy()
+	service.Spec.LoadBalancerClass = nil
+	return service, nil
+}
+
+// restore returns a copy of the service with the class removed by the transform, or the service itself.
+func (s *loadBalancerClassServices) restore(service *v1.Service) *v1.Service {
+	if service == nil || service.Spec.LoadBalancerClass != nil {
+		return service
+	}
+
+	s.lock.Lock()
+	className, found := s.classes[service.UID]
+	s.lock.Unlock()
+	if !found {
+		return service
+	}
+
+	service = service.DeepCopy()
+	service.Spec.LoadBalancerClass = &className
+	return service
+}
+
+// forget drops the class of the service whose load balancer resources have been deleted.
+func (s *loadBalancerClassServices) forget(service *v1.Service) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.classes, service.UID)
+}
+
+// onServiceUpdate drops the class of the service which is no longer a LoadBalancer service, after the service
+// controller deletes its load balancer resources and removes the cleanup finalizer.
+func (s *loadBalancerClassServices) onServiceUpdate(_, newObj interface{}) {
+	service, ok := newObj.(*v1.Service)
+	if !ok || service.Spec.Type == v1.ServiceTypeLoadBalancer || servicehelpers.HasLBFinalizer(service) {
+		return
+	}
+	s.forget(service)
+}
+
+// onServiceDelete drops the class of the deleted service.
+func (s *loadBalancerClassServices) onServiceDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if service, ok := obj.(*v1.Service); ok {
+		s.forget(service)
+	}
+}
+
+// newServiceInformer creates the service informer of the service controller, which removes the named classes.
+// It is not shared, so the other controllers get the services with their classes.
+func (s *loadBalancerClassServices) newServiceInformer(client clientset.Interface, resyncPeriod time.Duration) (coreinformers.ServiceInformer, error) {
+	informer := coreinformers.NewServiceInformer(client, metav1.NamespaceAll, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := informer.SetTransform(s.transform); err != nil {
+		return nil, err
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: s.onServiceUpdate,
+		DeleteFunc: s.onServiceDelete,
+	})
+	return &loadBalancerClassServiceInformer{informer: informer}, nil
+}
+
+// loadBalancerClassServiceInformer implements coreinformers.ServiceInformer with an informer not shared.
+type loadBalancerClassServiceInformer struct {
+	informer cache.SharedIndexInformer
+}
+
+func (i *loadBalancerClassServiceInformer) Informer() cache.SharedIndexInformer {
+	return i.informer
+}
+
+func (i *loadBalancerClassServiceInformer) Lister() corelisters.ServiceLister {
+	return corelisters.NewServiceLister(i.informer.GetIndexer())
+}
+
+// loadBalancerClassCloud passes the services with their classes restored to the load balancer of the cloud provider.
+type loadBalancerClassCloud struct {
+	cloudprovider.Interface
+	services *loadBalancerClassServices
+}
+
+func (c *loadBalancerClassCloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
+	loadBalancer, ok := c.Interface.LoadBalancer()
+	if !ok {
+		return nil, false
+	}
+	return &loadBalancerClassLoadBalancer{LoadBalancer: loadBalancer, services: c.services}, true
+}
+
+type loadBalancerClassLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	services *loadBalancerClassServices
+}
+
+func (l *loadBalancerClassLoadBalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	return l.LoadBalancer.GetLoadBalancer(ctx, clusterName, l.services.restore(service))
+}
+
+func (l *loadBalancerClassLoadBalancer) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
+	return l.LoadBalancer.GetLoadBalancerName(ctx, clusterName, l.services.restore(service))
+}
+
+func (l *loadBalancerClassLoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	return l.LoadBalancer.EnsureLoadBalancer(ctx, clusterName, l.services.restore(service), nodes)
+}
+
+func (l *loadBalancerClassLoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	return l.LoadBalancer.UpdateLoadBalancer(ctx, clusterName, l.services.restore(service), nodes)
+}
+
+func (l *loadBalancerClassLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	if err := l.LoadBalancer.EnsureLoadBalancerDeleted(ctx, clusterName, l.services.restore(service)); err != nil {
+		return err
+	}
+	l.services.forget(service)
+	return nil
+}
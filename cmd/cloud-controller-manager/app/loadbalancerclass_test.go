@@ -0,0 +1,187 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+func getTestLoadBalancerClassService(name string, loadBalancerClass *string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+		Spec: v1.ServiceSpec{
+			Type:              v1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: loadBalancerClass,
+		},
+	}
+}
+
+func TestLoadBalancerClassServicesTransform(t *testing.T) {
+	services := newLoadBalancerClassServices([]provider.LoadBalancerClass{{Name: "azure-internal"}})
+
+	for _, testCase := range []struct {
+		description       string
+		loadBalancerClass *string
+		expectedClass     *string
+	}{
+		{
+			description: "transform should keep the service without the class",
+		},
+		{
+			description:       "transform should keep the service of a class not handled by Azure",
+			loadBalancerClass: pointer.String("other"),
+			expectedClass:     pointer.String("other"),
+		},
+		{
+			description:       "transform should remove the named Azure class",
+			loadBalancerClass: pointer.String("azure-internal"),
+		},
+	} {
+		t.Run(testCase.description, func(t *testing.T) {
+			service := getTestLoadBalancerClassService("svc", testCase.loadBalancerClass)
+			obj, err := services.transform(service)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedClass, obj.(*v1.Service).Spec.LoadBalancerClass)
+			// the object of the informer is not changed
+			assert.Equal(t, testCase.loadBalancerClass, service.Spec.LoadBalancerClass)
+		})
+	}
+
+	// the tombstones are kept
+	tombstone := cache.DeletedFinalStateUnknown{Key: "default/svc", Obj: getTestLoadBalancerClassService("svc", pointer.String("azure-internal"))}
+	obj, err := services.transform(tombstone)
+	assert.NoError(t, err)
+	assert.Equal(t, tombstone, obj)
+}
+
+func TestLoadBalancerClassServicesRestore(t *testing.T) {
+	services := newLoadBalancerClassServices([]provider.LoadBalancerClass{{Name: "azure-internal"}})
+	obj, err := services.transform(getTestLoadBalancerClassService("svc1", pointer.String("azure-internal")))
+	assert.NoError(t, err)
+
+	restored := services.restore(obj.(*v1.Service))
+	assert.Equal(t, pointer.String("azure-internal"), restored.Spec.LoadBalancerClass)
+	assert.Nil(t, obj.(*v1.Service).Spec.LoadBalancerClass)
+
+	// the class is restored after it is cleared by the change of the service type
+	service := getTestLoadBalancerClassService("svc1", nil)
+	service.Spec.Type = v1.ServiceTypeClusterIP
+	assert.Equal(t, pointer.String("azure-internal"), services.restore(service).Spec.LoadBalancerClass)
+
+	other := getTestLoadBalancerClassService("svc2", nil)
+	assert.Same(t, other, services.restore(other))
+
+	services.forget(service)
+	assert.Nil(t, services.restore(service).Spec.LoadBalancerClass)
+}
+
+func TestLoadBalancerClassServicesPrune(t *testing.T) {
+	services := newLoadBalancerClassServices([]provider.LoadBalancerClass{{Name: "azure-internal"}})
+	for _, name := range []string{"svc1", "svc2", "svc3"} {
+		_, err := services.transform(getTestLoadBalancerClassService(name, pointer.String("azure-internal")))
+		assert.NoError(t, err)
+	}
+
+	// the class is kept until the load balancer resources of the service are deleted
+	service := getTestLoadBalancerClassService("svc1", nil)
+	service.Spec.Type = v1.ServiceTypeClusterIP
+	service.Finalizers = []string{servicehelpers.LoadBalancerCleanupFinalizer}
+	services.onServiceUpdate(nil, service)
+	assert.Equal(t, pointer.String("azure-internal"), services.restore(service).Spec.LoadBalancerClass)
+
+	service = service.DeepCopy()
+	service.Finalizers = nil
+	services.onServiceUpdate(nil, service)
+	assert.Nil(t, services.restore(service).Spec.LoadBalancerClass)
+
+	// the class of the LoadBalancer service is kept
+	service = getTestLoadBalancerClassService("svc2", nil)
+	services.onServiceUpdate(nil, service)
+	assert.Equal(t, pointer.String("azure-internal"), services.restore(service).Spec.LoadBalancerClass)
+
+	// the class of the deleted service is dropped
+	services.onServiceDelete(service)
+	assert.Nil(t, services.restore(service).Spec.LoadBalancerClass)
+	service = getTestLoadBalancerClassService("svc3", nil)
+	services.onServiceDelete(cache.DeletedFinalStateUnknown{Key: "default/svc3", Obj: service})
+	assert.Nil(t, services.restore(service).Spec.LoadBalancerClass)
+	assert.Empty(t, services.classes)
+}
+
+type recordingLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	classes []*string
+	err     error
+}
+
+func (l *recordingLoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	l.classes = append(l.classes, service.Spec.LoadBalancerClass)
+	return &v1.LoadBalancerStatus{}, l.err
+}
+
+func (l *recordingLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	l.classes = append(l.classes, service.Spec.LoadBalancerClass)
+	return l.err
+}
+
+type recordingCloud struct {
+	cloudprovider.Interface
+	loadBalancer *recordingLoadBalancer
+}
+
+func (c *recordingCloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
+	return c.loadBalancer, true
+}
+
+func TestLoadBalancerClassCloud(t *testing.T) {
+	services := newLoadBalancerClassServices([]provider.LoadBalancerClass{{Name: "azure-internal"}})
+	obj, err := services.transform(getTestLoadBalancerClassService("svc", pointer.String("azure-internal")))
+	assert.NoError(t, err)
+	service := obj.(*v1.Service)
+
+	loadBalancer := &recordingLoadBalancer{}
+	cloud := &loadBalancerClassCloud{Interface: &recordingCloud{loadBalancer: loadBalancer}, services: services}
+	lb, ok := cloud.LoadBalancer()
+	assert.True(t, ok)
+
+	_, err = lb.EnsureLoadBalancer(context.Background(), "kubernetes", service, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*string{pointer.String("azure-internal")}, loadBalancer.classes)
+	assert.Nil(t, service.Spec.LoadBalancerClass)
+
+	// the class is kept if the deletion fails
+	loadBalancer.err = assert.AnError
+	assert.Error(t, lb.EnsureLoadBalancerDeleted(context.Background(), "kubernetes", service))
+	assert.Equal(t, pointer.String("azure-internal"), services.restore(service).Spec.LoadBalancerClass)
+
+	loadBalancer.err = nil
+	assert.NoError(t, lb.EnsureLoadBalancerDeleted(context.Background(), "kubernetes", service))
+	assert.Nil(t, services.restore(service).Spec.LoadBalancerClass)
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+// planOptions are the options of the plan command.
+type planOptions struct {
+	cloudConfig string
+	kubeconfig  string
+	clusterName string
+	namespace   string
+	filenames   []string
+}
+
+// newPlanCommand creates the command printing the changes the reconciliation of the services would make
+// to the Azure resources without changing them.
+func newPlanCommand() *cobra.Command {
+	o := &planOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Print the changes the reconciliation of the services would make to the Azure resources",
+		Long: `Print the changes the reconciliation of the LoadBalancer services would make to the load balancers,
+public IPs, security groups and private link services in Azure, without changing them. The services and
+nodes are read from the cluster in the kubeconfig, or from the YAML files.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	fs := cmd.Flags()
+	fs.StringVar(&o.cloudConfig, "cloud-config", o.cloudConfig, "The path to the cloud provider configuration file.")
+	fs.StringVar(&o.kubeconfig, "kubeconfig", o.kubeconfig, "The path to the kubeconfig file to read the services and nodes from.")
+	fs.StringVar(&o.clusterName, "cluster-name", "kubernetes", "The instance prefix for the cluster.")
+	fs.StringVarP(&o.namespace, "namespace", "n", metav1.NamespaceAll, "The namespace of the services read from the cluster. All namespaces are read if it is empty.")
+	fs.StringArrayVarP(&o.filenames, "filename", "f", o.filenames, "The YAML files containing the services and nodes. It can be specified multiple times.")
+
+	return cmd
+}
+
+func (o *planOptions) run(ctx context.Context, out io.Writer) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if o.cloudConfig == "" {
+		return errors.New("--cloud-config is required")
+	}
+	if o.kubeconfig == "" && len(o.filenames) == 0 {
+		return errors.New("either --kubeconfig or --filename should be specified")
+	}
+
+	configFile, err := os.Open(o.cloudConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open the cloud config %s: %w", o.cloudConfig, err)
+	}
+	defer configFile.Close()
+	config, err := provider.ParseConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse the cloud config %s: %w", o.cloudConfig, err)
+	}
+
+	var services []*v1.Service
+	var nodes []*v1.Node
+	if o.kubeconfig != "" {
+		services, nodes, err = o.listObjects(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	for _, filename := range o.filenames {
+		fileServices, fileNodes, err := readObjectsFromFile(filename)
+		if err != nil {
+			return err
+		}
+		services = append(services, fileServices...)
+		nodes = append(nodes, fileNodes...)
+	}
+
+	planner, err := provider.NewLoadBalancerPlanner(config, nodes)
+	if err != nil {
+		return fmt.Errorf("failed to create the load balancer planner: %w", err)
+	}
+
+	plans := make([]*provider.ServicePlan, 0, len(services))
+	for _, service := range services {
+		plan, err := planner.PlanService(ctx, o.clusterName, service)
+		if err != nil {
+			return fmt.Errorf("failed to plan the service %s/%s: %w", service.Namespace, service.Name, err)
+		}
+		plans = append(plans, plan)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plans)
+}
+
+// listObjects lists the LoadBalancer services and the nodes in the cluster.
+func (o *planOptions) listObjects(ctx context.Context) ([]*v1.Service, []*v1.Node, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load the kubeconfig %s: %w", o.kubeconfig, err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serviceList, err := client.CoreV1().Services(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list the services: %w", err)
+	}
+	var services []*v1.Service
+	for i := range serviceList.Items {
+		if serviceList.Items[i].Spec.Type == v1.ServiceTypeLoadBalancer {
+			services = append(services, &serviceList.Items[i])
+		}
+	}
+
+	nodeList, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list the nodes: %w", err)
+	}
+	nodes := make([]*v1.Node, 0, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes = append(nodes, &nodeList.Items[i])
+	}
+
+	return services, nodes, nil
+}
+
+// readObjectsFromFile reads the services and the nodes from the YAML file, which may contain multiple documents
+// and lists. The other kinds of objects are ignored.
+func readObjectsFromFile(filename string) ([]*v1.Service, []*v1.Node, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	var services []*v1.Service
+	var nodes []*v1.Node
+	var collect func(obj interface{})
+	collect = func(obj interface{}) {
+		switch typed := obj.(type) {
+		case *v1.Service:
+			services = append(services, typed)
+		case *v1.Node:
+			nodes = append(nodes, typed)
+		case *v1.ServiceList:
+			for i := range typed.Items {
+				collect(&typed.Items[i])
+			}
+		case *v1.NodeList:
+			for i := range typed.Items {
+				collect(&typed.Items[i])
+			}
+		}
+	}
+
+	decoder := scheme.Codecs.UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(file))
+	for {
+		document, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		if len(bytes.TrimSpace(document)) == 0 {
+			continue
+		}
+		obj, _, err := decoder.Decode(document, nil, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode %s: %w", filename, err)
+		}
+		collect(obj)
+	}
+
+	return services, nodes, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadObjectsFromFile(t *testing.T) {
+	fileName := "testObjects.yaml"
+	content := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc1
+  namespace: default
+spec:
+  type: LoadBalancer
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: v1
+kind: ServiceList
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: svc2
+    namespace: default
+---
+apiVersion: v1
+kind: Node
+metadata:
+  name: node1
+`
+	err := ioutil.WriteFile(fileName, []byte(content), 0600)
+	assert.NoError(t, err)
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	services, nodes, err := readObjectsFromFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(services))
+	assert.Equal(t, "svc1", services[0].Name)
+	assert.Equal(t, int32(80), services[0].Spec.Ports[0].Port)
+	assert.Equal(t, "svc2", services[1].Name)
+	assert.Equal(t, 1, len(nodes))
+	assert.Equal(t, "node1", nodes[0].Name)
+
+	_, _, err = readObjectsFromFile("notExist.yaml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,413 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationsecuritygroupclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/util/flowcontrol"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient/mockarmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	resourceID = "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/asg1"
+)
+
+// 2065-01-24 05:20:00 +0000 UTC
+func getFutureTime() time.Time {
+	return time.Unix(3000000000, 0)
+}
+
+func TestNew(t *testing.T) {
+	config := &azclients.ClientConfig{
+		SubscriptionID:          "sub",
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:            true,
+			CloudProviderRateLimitQPS:         0.5,
+			CloudProviderRateLimitBucket:      1,
+			CloudProviderRateLimitQPSWrite:    0.5,
+			CloudProviderRateLimitBucketWrite: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	asgClient := New(config)
+	assert.Equal(t, "sub", asgClient.subscriptionID)
+	assert.NotEmpty(t, asgClient.rateLimiterReader)
+	assert.NotEmpty(t, asgClient.rateLimiterWriter)
+}
+
+func TestNewAzureStack(t *testing.T) {
+	config := &azclients.ClientConfig{
+		CloudName:               "AZURESTACKCLOUD",
+		SubscriptionID:          "sub",
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:            true,
+			CloudProviderRateLimitQPS:         0.5,
+			CloudProviderRateLimitBucket:      1,
+			CloudProviderRateLimitQPSWrite:    0.5,
+			CloudProviderRateLimitBucketWrite: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	asgClient := New(config)
+	assert.Equal(t, "AZURESTACKCLOUD", asgClient.cloudName)
+	assert.Equal(t, "sub", asgClient.subscriptionID)
+}
+
+func TestGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithExpandQuery(gomock.Any(), resourceID, "").Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	expected := network.ApplicationSecurityGroup{}
+	expected.Response = autorest.Response{Response: response}
+	result, rerr := asgClient.Get(context.TODO(), "rg", "asg1", "")
+	assert.Equal(t, expected, result)
+	assert.Nil(t, rerr)
+}
+
+func TestGetNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithExpandQuery(gomock.Any(), resourceID, "").Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	expected := network.ApplicationSecurityGroup{Response: autorest.Response{}}
+	result, rerr := asgClient.Get(context.TODO(), "rg", "asg1", "")
+	assert.Equal(t, expected, result)
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+}
+
+func TestGetInternalError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithExpandQuery(gomock.Any(), resourceID, "").Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	expected := network.ApplicationSecurityGroup{Response: autorest.Response{}}
+	result, rerr := asgClient.Get(context.TODO(), "rg", "asg1", "")
+	assert.Equal(t, expected, result)
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusInternalServerError, rerr.HTTPStatusCode)
+}
+
+func TestGetNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asgGetErr := &retry.Error{
+		RawError:  fmt.Errorf("azure cloud provider rate limited(%s) for operation %q", "read", "ApplicationSecurityGroupGet"),
+		Retriable: true,
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+
+	asgClient := getTestApplicationSecurityGroupClientWithNeverRateLimiter(armClient)
+	expected := network.ApplicationSecurityGroup{}
+	result, rerr := asgClient.Get(context.TODO(), "rg", "asg1", "")
+	assert.Equal(t, expected, result)
+	assert.Equal(t, asgGetErr, rerr)
+}
+
+func TestGetRetryAfterReader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asgGetErr := &retry.Error{
+		RawError:   fmt.Errorf("azure cloud provider throttled for operation %s with reason %q", "ApplicationSecurityGroupGet", "client throttled"),
+		Retriable:  true,
+		RetryAfter: getFutureTime(),
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+
+	asgClient := getTestApplicationSecurityGroupClientWithRetryAfterReader(armClient)
+	expected := network.ApplicationSecurityGroup{}
+	result, rerr := asgClient.Get(context.TODO(), "rg", "asg1", "")
+	assert.Equal(t, expected, result)
+	assert.Equal(t, asgGetErr, rerr)
+}
+
+func TestGetThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithExpandQuery(gomock.Any(), resourceID, "").Return(response, throttleErr).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	result, rerr := asgClient.Get(context.TODO(), "rg", "asg1", "")
+	assert.Empty(t, result)
+	assert.Equal(t, throttleErr, rerr)
+}
+
+func TestCreateOrUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asg1 := getTestApplicationSecurityGroup("asg1")
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient.EXPECT().PutResourceWithDecorators(gomock.Any(), to.String(asg1.ID), asg1, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	rerr := asgClient.CreateOrUpdate(context.TODO(), "rg", "asg1", asg1, "*")
+	assert.Nil(t, rerr)
+}
+
+func TestCreateOrUpdateWithNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rcCreateOrUpdateErr := retry.GetRateLimitError(true, "ApplicationSecurityGroupCreateOrUpdate")
+
+	asg1 := getTestApplicationSecurityGroup("asg1")
+	armClient := mockarmclient.NewMockInterface(ctrl)
+
+	asgClient := getTestApplicationSecurityGroupClientWithNeverRateLimiter(armClient)
+	rerr := asgClient.CreateOrUpdate(context.TODO(), "rg", "asg1", asg1, "")
+	assert.Equal(t, rcCreateOrUpdateErr, rerr)
+}
+
+func TestCreateOrUpdateRetryAfterReader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rcCreateOrUpdateErr := retry.GetThrottlingError("ApplicationSecurityGroupCreateOrUpdate", "client throttled", getFutureTime())
+
+	asg1 := getTestApplicationSecurityGroup("asg1")
+	armClient := mockarmclient.NewMockInterface(ctrl)
+
+	asgClient := getTestApplicationSecurityGroupClientWithRetryAfterReader(armClient)
+	rerr := asgClient.CreateOrUpdate(context.TODO(), "rg", "asg1", asg1, "")
+	assert.NotNil(t, rerr)
+	assert.Equal(t, rcCreateOrUpdateErr, rerr)
+}
+
+func TestCreateOrUpdateThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+
+	asg1 := getTestApplicationSecurityGroup("asg1")
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PutResourceWithDecorators(gomock.Any(), to.String(asg1.ID), asg1, gomock.Any()).Return(response, throttleErr).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	rerr := asgClient.CreateOrUpdate(context.TODO(), "rg", "asg1", asg1, "")
+	assert.Equal(t, throttleErr, rerr)
+}
+
+func TestCreateOrUpdateWithCreateOrUpdateResponderError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asg1 := getTestApplicationSecurityGroup("asg1")
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+
+	armClient.EXPECT().PutResourceWithDecorators(gomock.Any(), to.String(asg1.ID), asg1, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	rerr := asgClient.CreateOrUpdate(context.TODO(), "rg", "asg1", asg1, "")
+	assert.NotNil(t, rerr)
+}
+
+func TestDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asg1 := getTestApplicationSecurityGroup("asg1")
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().DeleteResource(gomock.Any(), to.String(asg1.ID), "").Return(nil).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	rerr := asgClient.Delete(context.TODO(), "rg", "asg1")
+	assert.Nil(t, rerr)
+}
+
+func TestDeleteNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asgDeleteErr := &retry.Error{
+		RawError:  fmt.Errorf("azure cloud provider rate limited(%s) for operation %q", "write", "ApplicationSecurityGroupDelete"),
+		Retriable: true,
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	asgClient := getTestApplicationSecurityGroupClientWithNeverRateLimiter(armClient)
+	rerr := asgClient.Delete(context.TODO(), "rg", "asg1")
+	assert.NotNil(t, rerr)
+	assert.Equal(t, asgDeleteErr, rerr)
+}
+
+func TestDeleteRetryAfterReader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asgDeleteErr := &retry.Error{
+		RawError:   fmt.Errorf("azure cloud provider throttled for operation %s with reason %q", "ApplicationSecurityGroupDelete", "client throttled"),
+		Retriable:  true,
+		RetryAfter: getFutureTime(),
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	asgClient := getTestApplicationSecurityGroupClientWithRetryAfterReader(armClient)
+	rerr := asgClient.Delete(context.TODO(), "rg", "asg1")
+	assert.NotNil(t, rerr)
+	assert.Equal(t, asgDeleteErr, rerr)
+}
+
+func TestDeleteThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+
+	asg1 := getTestApplicationSecurityGroup("asg1")
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().DeleteResource(gomock.Any(), to.String(asg1.ID), "").Return(throttleErr).Times(1)
+
+	asgClient := getTestApplicationSecurityGroupClient(armClient)
+	rerr := asgClient.Delete(context.TODO(), "rg", "asg1")
+	assert.NotNil(t, rerr)
+	assert.Equal(t, throttleErr, rerr)
+}
+
+func getTestApplicationSecurityGroup(name string) network.ApplicationSecurityGroup {
+	return network.ApplicationSecurityGroup{
+		ID:       to.StringPtr(fmt.Sprintf("/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/%s", name)),
+		Name:     to.StringPtr(name),
+		Location: to.StringPtr("eastus"),
+	}
+}
+
+func getTestApplicationSecurityGroupClient(armClient armclient.Interface) *Client {
+	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    "subscriptionID",
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+	}
+}
+
+func getTestApplicationSecurityGroupClientWithNeverRateLimiter(armClient armclient.Interface) *Client {
+	rateLimiterReader := flowcontrol.NewFakeNeverRateLimiter()
+	rateLimiterWriter := flowcontrol.NewFakeNeverRateLimiter()
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    "subscriptionID",
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+	}
+}
+
+func getTestApplicationSecurityGroupClientWithRetryAfterReader(armClient armclient.Interface) *Client {
+	rateLimiterReader := flowcontrol.NewFakeAlwaysRateLimiter()
+	rateLimiterWriter := flowcontrol.NewFakeAlwaysRateLimiter()
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    "subscriptionID",
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+		RetryAfterReader:  getFutureTime(),
+		RetryAfterWriter:  getFutureTime(),
+	}
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnsclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/flowcontrol"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient/mockarmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	sub0   = "sub0"
+	rg0    = "rg0"
+	zone0  = "example.com"
+	record = "www"
+
+	testResourceID = "/subscriptions/sub0/resourceGroups/rg0/providers/" + dnsZoneResourceType + "/" + zone0 + "/A/" + record
+)
+
+func TestNew(t *testing.T) {
+	config := &azclients.ClientConfig{
+		SubscriptionID:          sub0,
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:            true,
+			CloudProviderRateLimitQPS:         0.5,
+			CloudProviderRateLimitBucket:      1,
+			CloudProviderRateLimitQPSWrite:    0.5,
+			CloudProviderRateLimitBucketWrite: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	dnsClient := New(config)
+	assert.Equal(t, sub0, dnsClient.subscriptionID)
+	assert.NotEmpty(t, dnsClient.rateLimiterReader)
+	assert.NotEmpty(t, dnsClient.rateLimiterWriter)
+}
+
+func TestGetRecordSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"name":"www","properties":{"ARecords":[{"ipv4Address":"1.2.3.4"}]}}`))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	dnsClient := getTestDNSClient(armClient)
+	result, rerr := dnsClient.GetRecordSet(context.TODO(), rg0, zone0, record, dns.A)
+	assert.Nil(t, rerr)
+	assert.Equal(t, record, to.String(result.Name))
+	assert.Equal(t, "1.2.3.4", to.String((*result.ARecords)[0].Ipv4Address))
+}
+
+func TestGetRecordSetNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	dnsClient := getTestDNSClient(armClient)
+	expected := dns.RecordSet{Response: autorest.Response{}}
+	result, rerr := dnsClient.GetRecordSet(context.TODO(), rg0, zone0, record, dns.A)
+	assert.Equal(t, expected, result)
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+}
+
+func TestGetRecordSetThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, throttleErr).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	dnsClient := getTestDNSClient(armClient)
+	result, rerr := dnsClient.GetRecordSet(context.TODO(), rg0, zone0, record, dns.A)
+	assert.Empty(t, result)
+	assert.Equal(t, throttleErr, rerr)
+}
+
+func TestGetRecordSetWithNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	dnsClient := getTestDNSClientWithNeverRateLimiter(armClient)
+	_, rerr := dnsClient.GetRecordSet(context.TODO(), rg0, zone0, record, dns.A)
+	assert.Equal(t, retry.GetRateLimitError(false, "DNSRecordSetGet"), rerr)
+}
+
+func TestCreateOrUpdateRecordSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recordSet := getTestRecordSet()
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient.EXPECT().PutResourceWithDecorators(gomock.Any(), testResourceID, recordSet, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	dnsClient := getTestDNSClient(armClient)
+	rerr := dnsClient.CreateOrUpdateRecordSet(context.TODO(), rg0, zone0, record, dns.A, recordSet, "etag")
+	assert.Nil(t, rerr)
+}
+
+func TestCreateOrUpdateRecordSetWithResponderError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recordSet := getTestRecordSet()
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	response := &http.Response{
+		StatusCode: http.StatusPreconditionFailed,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient.EXPECT().PutResourceWithDecorators(gomock.Any(), testResourceID, recordSet, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	dnsClient := getTestDNSClient(armClient)
+	rerr := dnsClient.CreateOrUpdateRecordSet(context.TODO(), rg0, zone0, record, dns.A, recordSet, "etag")
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusPreconditionFailed, rerr.HTTPStatusCode)
+}
+
+func TestCreateOrUpdateRecordSetRetryAfterReader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	dnsClient := getTestDNSClientWithRetryAfterReader(armClient)
+	rerr := dnsClient.CreateOrUpdateRecordSet(context.TODO(), rg0, zone0, record, dns.A, getTestRecordSet(), "")
+	assert.Equal(t, retry.GetThrottlingError("DNSRecordSetCreateOrUpdate", "client throttled", getFutureTime()), rerr)
+}
+
+func TestDeleteRecordSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().DeleteResource(gomock.Any(), testResourceID, "etag").Return(nil).Times(1)
+
+	dnsClient := getTestDNSClient(armClient)
+	rerr := dnsClient.DeleteRecordSet(context.TODO(), rg0, zone0, record, dns.A, "etag")
+	assert.Nil(t, rerr)
+}
+
+func TestDeleteRecordSetThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().DeleteResource(gomock.Any(), testResourceID, "").Return(throttleErr).Times(1)
+
+	dnsClient := getTestDNSClient(armClient)
+	rerr := dnsClient.DeleteRecordSet(context.TODO(), rg0, zone0, record, dns.A, "")
+	assert.Equal(t, throttleErr, rerr)
+	assert.Equal(t, throttleErr.RetryAfter, dnsClient.RetryAfterWriter)
+}
+
+func TestDeleteRecordSetWithNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	dnsClient := getTestDNSClientWithNeverRateLimiter(armClient)
+	rerr := dnsClient.DeleteRecordSet(context.TODO(), rg0, zone0, record, dns.A, "")
+	assert.Equal(t, retry.GetRateLimitError(true, "DNSRecordSetDelete"), rerr)
+}
+
+func getTestRecordSet() dns.RecordSet {
+	return dns.RecordSet{
+		RecordSetProperties: &dns.RecordSetProperties{
+			TTL:      to.Int64Ptr(300),
+			ARecords: &[]dns.ARecord{{Ipv4Address: to.StringPtr("1.2.3.4")}},
+		},
+	}
+}
+
+func getTestDNSClient(armClient armclient.Interface) *Client {
+	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    sub0,
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+	}
+}
+
+func getTestDNSClientWithNeverRateLimiter(armClient armclient.Interface) *Client {
+	rateLimiterReader := flowcontrol.NewFakeNeverRateLimiter()
+	rateLimiterWriter := flowcontrol.NewFakeNeverRateLimiter()
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    sub0,
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+	}
+}
+
+func getTestDNSClientWithRetryAfterReader(armClient armclient.Interface) *Client {
+	rateLimiterReader := flowcontrol.NewFakeAlwaysRateLimiter()
+	rateLimiterWriter := flowcontrol.NewFakeAlwaysRateLimiter()
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    sub0,
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+		RetryAfterReader:  getFutureTime(),
+		RetryAfterWriter:  getFutureTime(),
+	}
+}
+
+// 2065-01-24 05:20:00 +0000 UTC
+func getFutureTime() time.Time {
+	return time.Unix(3000000000, 0)
+}
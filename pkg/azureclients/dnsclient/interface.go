@@ -0,0 +1,45 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnsclient
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// APIVersion is the API version.
+	APIVersion = "2018-05-01"
+	// AzureStackCloudName is the cloud name of Azure Stack
+	AzureStackCloudName = "AZURESTACKCLOUD"
+)
+
+// Interface is the client interface for the record sets of public DNS Zones
+// Don't forget to run "hack/update-mock-clients.sh" command to generate the mock client.
+type Interface interface {
+	// GetRecordSet gets a record set of a DNS zone.
+	GetRecordSet(ctx context.Context, resourceGroupName, zoneName, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, *retry.Error)
+
+	// CreateOrUpdateRecordSet creates or updates a record set of a DNS zone.
+	CreateOrUpdateRecordSet(ctx context.Context, resourceGroupName, zoneName, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, etag string) *retry.Error
+
+	// DeleteRecordSet deletes a record set of a DNS zone.
+	DeleteRecordSet(ctx context.Context, resourceGroupName, zoneName, relativeRecordSetName string, recordType dns.RecordType, etag string) *retry.Error
+}
@@ -231,3 +231,167 @@ func (c *Client) getPrivateDNSZone(ctx context.Context, resourceGroupName, priva
 	result.Response = autorest.Response{Response: response}
 	return result, nil
 }
+
+// getRecordSetResourceID gets the resource ID of a record set.
+func (c *Client) getRecordSetResourceID(resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType) string {
+	return armclient.GetChildResourceID(
+		c.subscriptionID,
+		resourceGroupName,
+		privateDNSZoneResourceType,
+		privateZoneName,
+		string(recordType),
+		relativeRecordSetName,
+	)
+}
+
+// GetRecordSet gets a record set of a private DNS zone.
+func (c *Client) GetRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType) (privatedns.RecordSet, *retry.Error) {
+	mc := metrics.NewMetricContext("private_dns_record_sets", "get", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterReader.TryAccept() {
+		mc.RateLimitedCount()
+		return privatedns.RecordSet{}, retry.GetRateLimitError(false, "PrivateDNSRecordSetGet")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterReader.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("PrivateDNSRecordSetGet", "client throttled", c.RetryAfterReader)
+		return privatedns.RecordSet{}, rerr
+	}
+
+	result, rerr := c.getRecordSet(ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterReader = rerr.RetryAfter
+		}
+
+		return result, rerr
+	}
+
+	return result, nil
+}
+
+// getRecordSet gets a record set of a private DNS zone.
+func (c *Client) getRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType) (privatedns.RecordSet, *retry.Error) {
+	resourceID := c.getRecordSetResourceID(resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+	result := privatedns.RecordSet{}
+
+	response, rerr := c.armClient.GetResource(ctx, resourceID)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "privatednsrecordset.get.request", resourceID, rerr.Error())
+		return result, rerr
+	}
+
+	err := autorest.Respond(
+		response,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result))
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "privatednsrecordset.get.respond", resourceID, err)
+		return result, retry.GetError(response, err)
+	}
+
+	result.Response = autorest.Response{Response: response}
+	return result, nil
+}
+
+// CreateOrUpdateRecordSet creates or updates a record set of a private DNS zone.
+func (c *Client) CreateOrUpdateRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, parameters privatedns.RecordSet, etag string) *retry.Error {
+	mc := metrics.NewMetricContext("private_dns_record_sets", "create_or_update", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "PrivateDNSRecordSetCreateOrUpdate")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("PrivateDNSRecordSetCreateOrUpdate", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	rerr := c.createOrUpdateRecordSet(ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType, parameters, etag)
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
+
+// createOrUpdateRecordSet creates or updates a record set of a private DNS zone.
+func (c *Client) createOrUpdateRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, parameters privatedns.RecordSet, etag string) *retry.Error {
+	resourceID := c.getRecordSetResourceID(resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithPathParameters("{resourceID}", map[string]interface{}{"resourceID": resourceID}),
+		autorest.WithJSON(parameters),
+	}
+	if etag != "" {
+		decorators = append(decorators, autorest.WithHeader("If-Match", autorest.String(etag)))
+	}
+
+	response, rerr := c.armClient.PutResourceWithDecorators(ctx, resourceID, parameters, decorators)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "privatednsrecordset.put.request", resourceID, rerr.Error())
+		return rerr
+	}
+
+	if response != nil && response.StatusCode != http.StatusNoContent {
+		result := &privatedns.RecordSet{}
+		err := autorest.Respond(
+			response,
+			azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated),
+			autorest.ByUnmarshallingJSON(&result))
+		if rerr = retry.GetError(response, err); rerr != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "privatednsrecordset.put.respond", resourceID, rerr.Error())
+			return rerr
+		}
+	}
+
+	return nil
+}
+
+// DeleteRecordSet deletes a record set of a private DNS zone.
+func (c *Client) DeleteRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, etag string) *retry.Error {
+	mc := metrics.NewMetricContext("private_dns_record_sets", "delete", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "PrivateDNSRecordSetDelete")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("PrivateDNSRecordSetDelete", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	resourceID := c.getRecordSetResourceID(resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+	rerr := c.armClient.DeleteResource(ctx, resourceID, etag)
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
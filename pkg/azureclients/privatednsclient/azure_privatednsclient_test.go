@@ -46,6 +46,8 @@ const (
 
 	testResourceID     = "/subscriptions/sub0/resourceGroups/rg0/providers/" + privateDNSZoneResourceType + "/" + pz0
 	testResourcePrefix = "/subscriptions/sub0/resourceGroups/rg0/providers/" + privateDNSZoneResourceType
+
+	testRecordSetResourceID = testResourceID + "/A/svc"
 )
 
 func TestNew(t *testing.T) {
@@ -266,6 +268,116 @@ func TestGetThrottle(t *testing.T) {
 	assert.Equal(t, throttleErr, rerr)
 }
 
+func TestGetRecordSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"name":"svc","properties":{"aRecords":[{"ipv4Address":"10.0.0.4"}]}}`))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testRecordSetResourceID).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	pzClient := getTestPrivateDNSZoneClient(armClient)
+	result, rerr := pzClient.GetRecordSet(context.TODO(), rg0, pz0, "svc", privatedns.A)
+	assert.Nil(t, rerr)
+	assert.Equal(t, "10.0.0.4", to.String((*result.ARecords)[0].Ipv4Address))
+}
+
+func TestGetRecordSetNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testRecordSetResourceID).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	pzClient := getTestPrivateDNSZoneClient(armClient)
+	_, rerr := pzClient.GetRecordSet(context.TODO(), rg0, pz0, "svc", privatedns.A)
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+}
+
+func TestGetRecordSetWithNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	pzClient := getTestPrivateDNSZoneClientWithNeverRateLimiter(armClient)
+	_, rerr := pzClient.GetRecordSet(context.TODO(), rg0, pz0, "svc", privatedns.A)
+	assert.Equal(t, retry.GetRateLimitError(false, "PrivateDNSRecordSetGet"), rerr)
+}
+
+func TestCreateOrUpdateRecordSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recordSet := privatedns.RecordSet{
+		RecordSetProperties: &privatedns.RecordSetProperties{
+			ARecords: &[]privatedns.ARecord{{Ipv4Address: to.StringPtr("10.0.0.4")}},
+		},
+	}
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PutResourceWithDecorators(gomock.Any(), testRecordSetResourceID, recordSet, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	pzClient := getTestPrivateDNSZoneClient(armClient)
+	rerr := pzClient.CreateOrUpdateRecordSet(context.TODO(), rg0, pz0, "svc", privatedns.A, recordSet, "etag")
+	assert.Nil(t, rerr)
+
+	response = &http.Response{
+		StatusCode: http.StatusPreconditionFailed,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient.EXPECT().PutResourceWithDecorators(gomock.Any(), testRecordSetResourceID, recordSet, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+	rerr = pzClient.CreateOrUpdateRecordSet(context.TODO(), rg0, pz0, "svc", privatedns.A, recordSet, "etag")
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusPreconditionFailed, rerr.HTTPStatusCode)
+}
+
+func TestCreateOrUpdateRecordSetRetryAfterReader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	pzClient := getTestPrivateDNSZoneClientWithRetryAfterReader(armClient)
+	rerr := pzClient.CreateOrUpdateRecordSet(context.TODO(), rg0, pz0, "svc", privatedns.A, privatedns.RecordSet{}, "")
+	assert.Equal(t, retry.GetThrottlingError("PrivateDNSRecordSetCreateOrUpdate", "client throttled", getFutureTime()), rerr)
+}
+
+func TestDeleteRecordSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().DeleteResource(gomock.Any(), testRecordSetResourceID, "etag").Return(nil).Times(1)
+
+	pzClient := getTestPrivateDNSZoneClient(armClient)
+	rerr := pzClient.DeleteRecordSet(context.TODO(), rg0, pz0, "svc", privatedns.A, "etag")
+	assert.Nil(t, rerr)
+}
+
+func TestDeleteRecordSetWithNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	pzClient := getTestPrivateDNSZoneClientWithNeverRateLimiter(armClient)
+	rerr := pzClient.DeleteRecordSet(context.TODO(), rg0, pz0, "svc", privatedns.A, "")
+	assert.Equal(t, retry.GetRateLimitError(true, "PrivateDNSRecordSetDelete"), rerr)
+}
+
 // 2065-01-24 05:20:00 +0000 UTC
 func getFutureTime() time.Time {
 	return time.Unix(3000000000, 0)
@@ -39,4 +39,13 @@ type Interface interface {
 
 	// CreateOrUpdate creates or updates a private DNS zone.
 	CreateOrUpdate(ctx context.Context, resourceGroupName, privateZoneName string, parameters privatedns.PrivateZone, etag string, waitForCompletion bool) *retry.Error
+
+	// GetRecordSet gets a record set of a private DNS zone.
+	GetRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType) (privatedns.RecordSet, *retry.Error)
+
+	// CreateOrUpdateRecordSet creates or updates a record set of a private DNS zone.
+	CreateOrUpdateRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, parameters privatedns.RecordSet, etag string) *retry.Error
+
+	// DeleteRecordSet deletes a record set of a private DNS zone.
+	DeleteRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, etag string) *retry.Error
 }
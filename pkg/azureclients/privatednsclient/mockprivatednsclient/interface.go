@@ -67,6 +67,34 @@ func (mr *MockInterfaceMockRecorder) CreateOrUpdate(ctx, resourceGroupName, priv
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrUpdate", reflect.TypeOf((*MockInterface)(nil).CreateOrUpdate), ctx, resourceGroupName, privateZoneName, parameters, etag, waitForCompletion)
 }
 
+// CreateOrUpdateRecordSet mocks base method.
+func (m *MockInterface) CreateOrUpdateRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, parameters privatedns.RecordSet, etag string) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrUpdateRecordSet", ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType, parameters, etag)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// CreateOrUpdateRecordSet indicates an expected call of CreateOrUpdateRecordSet.
+func (mr *MockInterfaceMockRecorder) CreateOrUpdateRecordSet(ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType, parameters, etag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrUpdateRecordSet", reflect.TypeOf((*MockInterface)(nil).CreateOrUpdateRecordSet), ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType, parameters, etag)
+}
+
+// DeleteRecordSet mocks base method.
+func (m *MockInterface) DeleteRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, etag string) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRecordSet", ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType, etag)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// DeleteRecordSet indicates an expected call of DeleteRecordSet.
+func (mr *MockInterfaceMockRecorder) DeleteRecordSet(ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType, etag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRecordSet", reflect.TypeOf((*MockInterface)(nil).DeleteRecordSet), ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType, etag)
+}
+
 // Get mocks base method.
 func (m *MockInterface) Get(ctx context.Context, resourceGroupName, privateZoneName string) (privatedns.PrivateZone, *retry.Error) {
 	m.ctrl.T.Helper()
@@ -81,3 +109,18 @@ func (mr *MockInterfaceMockRecorder) Get(ctx, resourceGroupName, privateZoneName
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockInterface)(nil).Get), ctx, resourceGroupName, privateZoneName)
 }
+
+// GetRecordSet mocks base method.
+func (m *MockInterface) GetRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType) (privatedns.RecordSet, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRecordSet", ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+	ret0, _ := ret[0].(privatedns.RecordSet)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// GetRecordSet indicates an expected call of GetRecordSet.
+func (mr *MockInterfaceMockRecorder) GetRecordSet(ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecordSet", reflect.TypeOf((*MockInterface)(nil).GetRecordSet), ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+}
@@ -148,6 +148,27 @@ const (
 
 	// ZoneFetchingInterval defines the interval of performing zoneClient.GetZones
 	ZoneFetchingInterval = 30 * time.Minute
+
+	// NatGatewayReconcileInterval defines the interval of reconciling the NAT gateway of the node subnets
+	NatGatewayReconcileInterval = 5 * time.Minute
+
+	// DefaultOrphanedResourceGCInterval defines the default interval of finding the orphaned load balancer resources
+	DefaultOrphanedResourceGCInterval = time.Hour
+	// DefaultOrphanedResourceGCGracePeriod defines how long the resources should stay orphaned before they are deleted by default
+	DefaultOrphanedResourceGCGracePeriod = time.Hour
+
+	// DefaultPrivateIPPoolReleaseCooldown defines how long the private IPs released by the deleted services are not
+	// allocated from the pools to other services by default
+	DefaultPrivateIPPoolReleaseCooldown = time.Hour
+	// PrivateIPPoolReleasesConfigMapNamespace and PrivateIPPoolReleasesConfigMapName define the config map recording
+	// the private IPs released to the pools during the cool-down, and PrivateIPPoolReleasesConfigMapKey is its key
+	PrivateIPPoolReleasesConfigMapNamespace = "kube-system"
+	PrivateIPPoolReleasesConfigMapName      = "azure-private-ip-pool-releases"
+	PrivateIPPoolReleasesConfigMapKey       = "releases"
+
+	// MaxETagConflictRetries is the max number of the retries re-applying the changes of a service
+	// onto the latest load balancer or security group after the etag precondition fails
+	MaxETagConflictRetries = 3
 )
 
 // azure cloud config
@@ -184,6 +205,9 @@ const (
 	// MaximumLoadBalancerRuleCount is the maximum number of load balancer rules
 	// ref: https://docs.microsoft.com/en-us/azure/azure-subscription-service-limits#load-balancer.
 	MaximumLoadBalancerRuleCount = 250
+	// MaximumSecurityRuleCount is the maximum number of security rules of a network security group
+	// ref: https://docs.microsoft.com/en-us/azure/azure-subscription-service-limits#networking-limits.
+	MaximumSecurityRuleCount = 1000
 
 	// LoadBalancerSkuBasic is the load balancer basic sku
 	LoadBalancerSkuBasic = "basic"
@@ -208,6 +232,11 @@ const (
 	//    minimum rules associated with it is selected.
 	ServiceAnnotationLoadBalancerMode = "service.beta.kubernetes.io/azure-load-balancer-mode"
 
+	// ServiceAnnotationLoadBalancerConfigurations is the annotation used on the service to pin it to the named
+	// standard load balancers declared in the multiple standard load balancer configurations, separated by comma.
+	// The service is placed on the one with the fewest load balancing rules among them.
+	ServiceAnnotationLoadBalancerConfigurations = "service.beta.kubernetes.io/azure-load-balancer-configurations"
+
 	// ServiceAnnotationLoadBalancerAutoModeValue is the annotation used on the service to specify the
 	// Azure load balancer auto selection from the availability sets
 	ServiceAnnotationLoadBalancerAutoModeValue = "__auto__"
@@ -230,6 +259,52 @@ const (
 	// ServiceAnnotationPIPName specifies the pip that will be applied to load balancer
 	ServiceAnnotationPIPName = "service.beta.kubernetes.io/azure-pip-name"
 
+	// ServiceAnnotationPIPPrefixID specifies the ID of the public IP prefix from which the public IPs
+	// of the service are allocated when they are dynamically created
+	ServiceAnnotationPIPPrefixID = "service.beta.kubernetes.io/azure-pip-prefix-id"
+
+	// ServiceAnnotationPIPRetainOnDelete specifies whether the dynamically created public IP of the service is retained
+	// instead of being deleted when the service no longer needs it. It overrides `retainPublicIPOnServiceDeletion` in
+	// the cloud config file.
+	ServiceAnnotationPIPRetainOnDelete = "service.beta.kubernetes.io/azure-pip-retain-on-delete"
+
+	// ServiceAnnotationLoadBalancerZones specifies the availability zones of the frontend IP configuration of the
+	// internal load balancer, or of the public IP of the public load balancer. The value can be "zone-redundant",
+	// "no-zone" or a zone of the region, e.g. "1". The frontend IP configuration or the managed public IP is
+	// replaced when the zones are changed because Azure doesn't support changing the zones in place.
+	ServiceAnnotationLoadBalancerZones = "service.beta.kubernetes.io/azure-load-balancer-zones"
+
+	// LoadBalancerZonesZoneRedundant makes the frontend IP configuration or the public IP zone-redundant
+	LoadBalancerZonesZoneRedundant = "zone-redundant"
+
+	// LoadBalancerZonesNoZone makes the frontend IP configuration or the public IP non-zonal
+	LoadBalancerZonesNoZone = "no-zone"
+
+	// ServiceAnnotationCrossRegionBackendPoolID specifies the resource ID of the backend pool of the cross-region (global tier)
+	// load balancer, into which the public frontend IP configurations of the service are registered
+	ServiceAnnotationCrossRegionBackendPoolID = "service.beta.kubernetes.io/azure-load-balancer-cross-region-backend-pool-id"
+
+	// ServiceAnnotationGatewayLoadBalancerFrontendIPConfigID specifies the resource ID of the frontend IP configuration of
+	// the gateway load balancer, to which the public frontend IP configurations of the service are chained
+	ServiceAnnotationGatewayLoadBalancerFrontendIPConfigID = "service.beta.kubernetes.io/azure-load-balancer-gateway-frontend-ip-config-id"
+
+	// ServiceAnnotationDNSZoneID specifies the resource ID of the public Azure DNS zone, in which the A and AAAA
+	// records pointing at the frontend IPs of the service are created
+	ServiceAnnotationDNSZoneID = "service.beta.kubernetes.io/azure-dns-zone-id"
+
+	// ServiceAnnotationDNSRecordName specifies the name of the records relative to the DNS zone, e.g. "www" or "@"
+	ServiceAnnotationDNSRecordName = "service.beta.kubernetes.io/azure-dns-record-name"
+
+	// ServiceAnnotationPrivateDNSZoneID specifies the resource ID of the private DNS zone, in which the A and AAAA
+	// records pointing at the frontend IPs of the internal service are created. It overrides the privateDNSZoneID
+	// in the cloud config file, and setting it to an empty string opts the service out of the default zone.
+	ServiceAnnotationPrivateDNSZoneID = "service.beta.kubernetes.io/azure-private-dns-zone-id"
+
+	// ServiceAnnotationPrivateIPPoolAddresses records the static private IPs allocated to the internal service from
+	// the private IP pools in the cloud config file, separated by comma. It is set by the cloud provider, and the
+	// recorded IPs are allocated to the service again when its frontend IP configurations are re-created.
+	ServiceAnnotationPrivateIPPoolAddresses = "service.beta.kubernetes.io/azure-private-ip-pool-addresses"
+
 	// ServiceAnnotationIPTagsForPublicIP specifies the iptags used when dynamically creating a public ip
 	ServiceAnnotationIPTagsForPublicIP = "service.beta.kubernetes.io/azure-pip-ip-tags"
 
@@ -250,6 +325,19 @@ const (
 	// to enable the high availability ports on the standard internal load balancer.
 	ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts = "service.beta.kubernetes.io/azure-load-balancer-enable-high-availability-ports"
 
+	// ServiceAnnotationLoadBalancerHAPortsRange is the annotation used on the service to collapse the ports of the service,
+	// which should cover the contiguous port range in the format of "<start>-<end>", into one high availability ports rule
+	// on the standard internal load balancer.
+	ServiceAnnotationLoadBalancerHAPortsRange = "service.beta.kubernetes.io/azure-load-balancer-ha-ports-range"
+
+	// ServiceAnnotationLoadBalancerConsolidateHealthProbes is the annotation used on the service to share one health probe
+	// among the ports of the service whose health probes are the same, e.g. the ones probing the same backend port.
+	ServiceAnnotationLoadBalancerConsolidateHealthProbes = "service.beta.kubernetes.io/azure-load-balancer-consolidate-health-probes"
+
+	// ServiceAnnotationDisableLoadBalancerFloatingIP is the annotation used on the service to disable the floating IP
+	// (direct server return) of the load balancing rules, in which case the traffic is sent to the node ports.
+	ServiceAnnotationDisableLoadBalancerFloatingIP = "service.beta.kubernetes.io/azure-disable-load-balancer-floating-ip"
+
 	// ServiceAnnotationLoadBalancerHealthProbeProtocol determines the network protocol that the load balancer health probe use.
 	// If not set, the local service would use the HTTP and the cluster service would use the TCP by default.
 	ServiceAnnotationLoadBalancerHealthProbeProtocol = "service.beta.kubernetes.io/azure-load-balancer-health-probe-protocol"
@@ -283,6 +371,26 @@ const (
 	// ClusterNameKey is the cluster name key applied for public IP tags.
 	ClusterNameKey       = "k8s-azure-cluster-name"
 	LegacyClusterNameKey = "kubernetes-cluster-name"
+	// RetainedServiceKey is the key of the public IP tag indicating the public IP is retained after the deletion
+	// of the service in the value, and can be reclaimed by the services of the same cluster.
+	RetainedServiceKey = "k8s-azure-retained-service"
+	// DNSZoneIDTagKey, DNSRecordNameTagKey, PrivateDNSZoneIDTagKey, CrossRegionBackendPoolIDTagKey and
+	// PIPRetainOnDeleteTagKey are the keys of the tags recording the annotations of the service on its public IP or
+	// private link service, so that the orphaned resource gc cleans up the resources of the deleted service as its
+	// deletion does.
+	DNSZoneIDTagKey                = "k8s-azure-dns-zone-id"
+	DNSRecordNameTagKey            = "k8s-azure-dns-record-name"
+	PrivateDNSZoneIDTagKey         = "k8s-azure-private-dns-zone-id"
+	CrossRegionBackendPoolIDTagKey = "k8s-azure-cross-region-backend-pool-id"
+	PIPRetainOnDeleteTagKey        = "k8s-azure-pip-retain-on-delete"
+
+	// DNSRecordServiceMetadataKey is the metadata key of the DNS records indicating the owner service. The keys of
+	// the DNS record metadata can only contain letters, digits and underscores.
+	DNSRecordServiceMetadataKey = "k8s_azure_service"
+	// DNSRecordClusterNameMetadataKey is the metadata key of the DNS records indicating the cluster of the owner service.
+	DNSRecordClusterNameMetadataKey = "k8s_azure_cluster_name"
+	// DNSRecordTTLDefault is the default TTL in seconds of the DNS records of the services.
+	DNSRecordTTLDefault = 300
 	// ServiceUsingDNSKey is the service name consuming the DNS label on the public IP
 	ServiceUsingDNSKey       = "k8s-azure-dns-label-service"
 	LegacyServiceUsingDNSKey = "kubernetes-dns-label-service"
@@ -304,10 +412,19 @@ const (
 	BackendPoolIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/%s"
 	// LoadBalancerProbeIDTemplate is the template of the load balancer probe
 	LoadBalancerProbeIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/probes/%s"
+	// ApplicationSecurityGroupIDTemplate is the template of the application security group
+	ApplicationSecurityGroupIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/applicationSecurityGroups/%s"
 
 	// InternalLoadBalancerNameSuffix is load balancer suffix
 	InternalLoadBalancerNameSuffix = "-internal"
 
+	// IPVersionIPv4String is the name suffix of the resources created for the IPv4 family
+	// of a dual-stack service whose primary IP family is IPv6
+	IPVersionIPv4String = "IPv4"
+	// IPVersionIPv6String is the name suffix of the IPv6 backend pool, and of the resources
+	// created for the IPv6 family of a dual-stack service whose primary IP family is IPv4
+	IPVersionIPv6String = "IPv6"
+
 	// FrontendIPConfigNameMaxLength is the max length of the frontend IP configuration
 	FrontendIPConfigNameMaxLength = 80
 	// LoadBalancerRuleNameMaxLength is the max length of the load balancing rule
@@ -321,6 +438,24 @@ const (
 	// TODO (nilo19): support pod IP in the future
 	LoadBalancerBackendPoolConfigurationTypePODIP = "podIP"
 
+	// OutboundTypeLoadBalancer means the outbound connectivity of the nodes is provided by the load balancer
+	OutboundTypeLoadBalancer = "loadBalancer"
+	// OutboundTypeNatGateway means the outbound connectivity of the nodes is provided by the NAT gateway of the node subnets
+	OutboundTypeNatGateway = "natGateway"
+	// DefaultNatGatewayName is the default name of the NAT gateway ensured by the cloud provider
+	DefaultNatGatewayName = "kubernetes-nat-gateway"
+	// NatGatewaySubnetsTagKey is the tag of the NAT gateway recording the names of the subnets associated by the cloud provider
+	NatGatewaySubnetsTagKey = "k8s-azure-nat-gateway-subnets"
+
+	// ApplicationSecurityGroupModeLoadBalancer means an application security group is ensured for each load balancer,
+	// which the nodes in the backend pools of the load balancer join
+	ApplicationSecurityGroupModeLoadBalancer = "loadBalancer"
+	// ApplicationSecurityGroupModeNodePool means an application security group is ensured for each node pool (VMSS or
+	// availability set), which the nodes of the node pool join
+	ApplicationSecurityGroupModeNodePool = "nodePool"
+	// ApplicationSecurityGroupNameSuffix is the suffix of the names of the application security groups
+	ApplicationSecurityGroupNameSuffix = "-asg"
+
 	// To get pip, we need both resource group name and pip name, key in cache has format: pip_rg:pip_name
 	PIPCacheKeySeparator = ":"
 )
@@ -399,6 +534,17 @@ const (
 	// `/healthz` would be configured by default.
 	HealthProbeParamsRequestPath  HealthProbeParams = "request-path"
 	HealthProbeDefaultRequestPath string            = "/"
+
+	// HealthProbeParamsProtocol determines the protocol of the load balancer health probe of the port, which is one of
+	// Tcp, Http and Https. It takes precedence over the appProtocol of the port and ServiceAnnotationLoadBalancerHealthProbeProtocol.
+	HealthProbeParamsProtocol HealthProbeParams = "protocol"
+
+	// HealthProbeParamsPort determines the port the load balancer health probe of the port is sent to. It is either the
+	// name or the number of another port of the service, whose node port is probed, or a port number listened on the nodes.
+	HealthProbeParamsPort HealthProbeParams = "port"
+
+	// HealthProbeNoProbeRuleAnnotationPattern is the annotation used on the service to disable the load balancer health probe of the port.
+	HealthProbeNoProbeRuleAnnotationPattern = "service.beta.kubernetes.io/port_%d_no_probe_rule"
 )
 
 type HealthProbeParams string
@@ -448,3 +594,28 @@ const (
 	// Default number of IP configs for PLS
 	PLSDefaultNumOfIPConfig = 1
 )
+
+// service status
+const (
+	// ServiceConditionLoadBalancerReady is the type of the service condition reporting whether the load balancer
+	// resources of the service are reconciled.
+	ServiceConditionLoadBalancerReady = "LoadBalancerReady"
+
+	// ServiceConditionReasonLoadBalancerReconciled is the reason of the service condition when the reconciliation succeeds.
+	ServiceConditionReasonLoadBalancerReconciled = "LoadBalancerReconciled"
+
+	// ServiceConditionReasonLoadBalancerReconcileFailed is the reason of the service condition when the reconciliation
+	// fails without an Azure error code.
+	ServiceConditionReasonLoadBalancerReconcileFailed = "LoadBalancerReconcileFailed"
+
+	// ServiceConditionReasonSecurityRulePrioritiesExhausted is the reason of the service condition when there is
+	// no free priority left in the security group for the security rules of the service.
+	ServiceConditionReasonSecurityRulePrioritiesExhausted = "SecurityRulePrioritiesExhausted"
+
+	// ServicePortErrorDomain is the domain of the errors of the service ports in the load balancer ingress status,
+	// which are in the format of "<domain>/<reason>".
+	ServicePortErrorDomain = "service.beta.kubernetes.io"
+
+	// ServiceConditionMessageMaxLength is the max length of the message of the service condition.
+	ServiceConditionMessageMaxLength = 32768
+)
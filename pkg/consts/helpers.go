@@ -31,11 +31,21 @@ func IsK8sServiceHasHAModeEnabled(service *v1.Service) bool {
 	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts, TrueAnnotationValue)
 }
 
+// IsK8sServiceHealthProbeConsolidationEnabled return if the health probes of the ports are consolidated in kubernetes service annotations
+func IsK8sServiceHealthProbeConsolidationEnabled(service *v1.Service) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerConsolidateHealthProbes, TrueAnnotationValue)
+}
+
 // IsK8sServiceUsingInternalLoadBalancer return if service is using an internal load balancer.
 func IsK8sServiceUsingInternalLoadBalancer(service *v1.Service) bool {
 	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerInternal, TrueAnnotationValue)
 }
 
+// IsK8sServiceDisableLoadBalancerFloatingIP return if floating IP is disabled in kubernetes service annotations
+func IsK8sServiceDisableLoadBalancerFloatingIP(service *v1.Service) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationDisableLoadBalancerFloatingIP, TrueAnnotationValue)
+}
+
 func IsK8sServiceInternalIPv6(service *v1.Service) bool {
 	return IsK8sServiceUsingInternalLoadBalancer(service) && net.IsIPv6String(service.Spec.ClusterIP)
 }
@@ -54,6 +64,11 @@ func Getint32ValueFromK8sSvcAnnotation(annotations map[string]string, key string
 	return nil, err
 }
 
+// IsHealthProbeRuleOnK8sServicePortDisabled return if the health probe of the port is disabled in kubernetes service annotations
+func IsHealthProbeRuleOnK8sServicePortDisabled(annotations map[string]string, port int32) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(annotations, fmt.Sprintf(HealthProbeNoProbeRuleAnnotationPattern, port), TrueAnnotationValue)
+}
+
 // BuildHealthProbeAnnotationKeyForPort get health probe configuration key for port
 func BuildHealthProbeAnnotationKeyForPort(port int32, key HealthProbeParams) string {
 	return fmt.Sprintf(HealthProbeAnnotationPrefixPattern, port) + string(key)
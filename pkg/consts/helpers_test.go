@@ -145,6 +145,80 @@ func TestIsK8sServiceUsingInternalLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestIsK8sServiceDisableLoadBalancerFloatingIP(t *testing.T) {
+	tests := []struct {
+		desc    string
+		service *v1.Service
+		want    bool
+	}{
+		{
+			desc: "floating IP is disabled",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{ServiceAnnotationDisableLoadBalancerFloatingIP: TrueAnnotationValue},
+				},
+			},
+			want: true,
+		},
+		{
+			desc:    "floating IP is not disabled",
+			service: &v1.Service{},
+			want:    false,
+		},
+		{
+			desc: "floating IP is not disabled with false value",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{ServiceAnnotationDisableLoadBalancerFloatingIP: "false"},
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := IsK8sServiceDisableLoadBalancerFloatingIP(tt.service); got != tt.want {
+				t.Errorf("IsK8sServiceDisableLoadBalancerFloatingIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsHealthProbeRuleOnK8sServicePortDisabled(t *testing.T) {
+	tests := []struct {
+		desc        string
+		annotations map[string]string
+		port        int32
+		want        bool
+	}{
+		{
+			desc:        "probe rule is disabled",
+			annotations: map[string]string{"service.beta.kubernetes.io/port_80_no_probe_rule": TrueAnnotationValue},
+			port:        80,
+			want:        true,
+		},
+		{
+			desc:        "probe rule of another port is disabled",
+			annotations: map[string]string{"service.beta.kubernetes.io/port_80_no_probe_rule": TrueAnnotationValue},
+			port:        443,
+			want:        false,
+		},
+		{
+			desc:        "probe rule is not disabled with false value",
+			annotations: map[string]string{"service.beta.kubernetes.io/port_80_no_probe_rule": "false"},
+			port:        80,
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := IsHealthProbeRuleOnK8sServicePortDisabled(tt.annotations, tt.port); got != tt.want {
+				t.Errorf("IsHealthProbeRuleOnK8sServicePortDisabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetHealthProbeConfigOfPortFromK8sSvcAnnotation(t *testing.T) {
 	type args struct {
 		annotations map[string]string
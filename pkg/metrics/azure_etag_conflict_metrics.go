@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"strconv"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+var etagConflictMetrics = registerETagConflictMetrics()
+
+// etagConflictCallMetrics is the metrics of the etag precondition failures when updating the shared resources.
+type etagConflictCallMetrics struct {
+	conflicts   *metrics.CounterVec
+	resolutions *metrics.CounterVec
+}
+
+// CountETagConflict increases the number of the etag precondition failures of the resource type.
+func CountETagConflict(resourceType string) {
+	etagConflictMetrics.conflicts.WithLabelValues(resourceType).Inc()
+}
+
+// CountETagConflictResolution increases the number of the etag conflicts of the resource type which are
+// resolved, or not resolved within the retries, by re-applying the changes onto the latest resource.
+func CountETagConflictResolution(resourceType string, resolved bool) {
+	etagConflictMetrics.resolutions.WithLabelValues(resourceType, strconv.FormatBool(resolved)).Inc()
+}
+
+// registerETagConflictMetrics registers the etag conflict metrics.
+func registerETagConflictMetrics() *etagConflictCallMetrics {
+	metrics := &etagConflictCallMetrics{
+		conflicts: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "etag_conflicts_count",
+				Help:           "Number of the etag precondition failures when updating the resources",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"resource_type"},
+		),
+		resolutions: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "etag_conflict_resolutions_count",
+				Help:           "Number of the etag conflicts resolved or not by re-applying the changes onto the latest resources",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"resource_type", "resolved"},
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.conflicts)
+	legacyregistry.MustRegister(metrics.resolutions)
+
+	return metrics
+}
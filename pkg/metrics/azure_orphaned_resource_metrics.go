@@ -0,0 +1,71 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+var orphanedResourceMetrics = registerOrphanedResourceMetrics()
+
+// orphanedResourceCallMetrics is the metrics of the load balancer resources left in Azure by the deleted services.
+type orphanedResourceCallMetrics struct {
+	orphanedResources *metrics.GaugeVec
+	deletedResources  *metrics.CounterVec
+}
+
+// SetOrphanedResourceCount records the number of the orphaned resources of the type found in the last collection.
+func SetOrphanedResourceCount(resourceType string, count int) {
+	orphanedResourceMetrics.orphanedResources.WithLabelValues(resourceType).Set(float64(count))
+}
+
+// CountDeletedOrphanedResources increases the number of the deleted orphaned resources of the type.
+func CountDeletedOrphanedResources(resourceType string, count int) {
+	orphanedResourceMetrics.deletedResources.WithLabelValues(resourceType).Add(float64(count))
+}
+
+// registerOrphanedResourceMetrics registers the orphaned resource metrics.
+func registerOrphanedResourceMetrics() *orphanedResourceCallMetrics {
+	metrics := &orphanedResourceCallMetrics{
+		orphanedResources: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "orphaned_resources",
+				Help:           "Number of the load balancer resources left in Azure by the deleted services",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"resource_type"},
+		),
+		deletedResources: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "orphaned_resources_deleted_count",
+				Help:           "Number of the orphaned load balancer resources deleted from Azure",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"resource_type"},
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.orphanedResources)
+	legacyregistry.MustRegister(metrics.deletedResources)
+
+	return metrics
+}
@@ -31,9 +31,12 @@ import (
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
 	"golang.org/x/time/rate"
 
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -41,25 +44,32 @@ import (
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	"k8s.io/klog/v2/klogr"
+	utilnet "k8s.io/utils/net"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/auth"
 	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationsecuritygroupclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/containerserviceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/deploymentclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/dnsclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/fileclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/natgatewayclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednsclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednszonegroupclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privateendpointclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipprefixclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/routeclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/routetableclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient"
@@ -178,6 +188,30 @@ type Config struct {
 	//   "external": for external LoadBalancer
 	//   "all": for both internal and external LoadBalancer
 	PreConfiguredBackendPoolLoadBalancerTypes string `json:"preConfiguredBackendPoolLoadBalancerTypes,omitempty" yaml:"preConfiguredBackendPoolLoadBalancerTypes,omitempty"`
+	// PublicIPPrefixID is the ID of the public IP prefix from which the dynamically created public IPs of the
+	// services are allocated, which can be overridden by the service annotation
+	// `service.beta.kubernetes.io/azure-pip-prefix-id`. It only works with the standard load balancer.
+	PublicIPPrefixID string `json:"publicIPPrefixID,omitempty" yaml:"publicIPPrefixID,omitempty"`
+	// RetainPublicIPOnServiceDeletion makes the dynamically created public IPs of the services retained instead of
+	// deleted when the services are deleted, which can be overridden by the service annotation
+	// `service.beta.kubernetes.io/azure-pip-retain-on-delete`.
+	RetainPublicIPOnServiceDeletion bool `json:"retainPublicIPOnServiceDeletion,omitempty" yaml:"retainPublicIPOnServiceDeletion,omitempty"`
+	// PrivateDNSZoneID is the ID of the private DNS zone in which the A and AAAA records of the internal services are
+	// created, which can be overridden by the service annotation `service.beta.kubernetes.io/azure-private-dns-zone-id`.
+	PrivateDNSZoneID string `json:"privateDNSZoneID,omitempty" yaml:"privateDNSZoneID,omitempty"`
+	// PrivateIPPools are the pools of the static private IPs allocated to the frontends of the internal services in
+	// the subnets, so that the addresses are stable and in the ranges known in advance. The services setting
+	// loadBalancerIP don't allocate the addresses from the pools.
+	PrivateIPPools []PrivateIPPoolConfig `json:"privateIPPools,omitempty" yaml:"privateIPPools,omitempty"`
+	// ApplicationSecurityGroupMode makes the cloud provider ensure the application security groups which the node IP
+	// configurations join, and use them as the destinations of the security rules whose traffic is destined to the
+	// nodes. Supported values are `loadBalancer` (one group per load balancer) and `nodePool` (one group per VMSS or
+	// availability set). It is disabled by default, and only works with the `nodeIPConfiguration` backend pool type.
+	ApplicationSecurityGroupMode string `json:"applicationSecurityGroupMode,omitempty" yaml:"applicationSecurityGroupMode,omitempty"`
+	// EnableSecurityRuleCompaction makes the cloud provider merge the security rules of the services sharing the
+	// security group which allow the same protocol, port and source, and renumber their priorities, when the
+	// priorities are exhausted or the number of the rules exceeds MaximumSecurityRuleCount.
+	EnableSecurityRuleCompaction bool `json:"enableSecurityRuleCompaction,omitempty" yaml:"enableSecurityRuleCompaction,omitempty"`
 
 	// DisableAvailabilitySetNodes disables VMAS nodes support when "VMType" is set to "vmss".
 	DisableAvailabilitySetNodes bool `json:"disableAvailabilitySetNodes,omitempty" yaml:"disableAvailabilitySetNodes,omitempty"`
@@ -199,6 +233,12 @@ type Config struct {
 	// NodePoolsWithoutDedicatedSLB stores the VMAS/VMSS names that share the primary standard load balancer instead
 	// of having a dedicated one. This is useful only when EnableMultipleStandardLoadBalancers is set to true.
 	NodePoolsWithoutDedicatedSLB string `json:"nodePoolsWithoutDedicatedSLB,omitempty" yaml:"nodePoolsWithoutDedicatedSLB,omitempty"`
+	// MultipleStandardLoadBalancerConfigurations declares the standard load balancers used when
+	// EnableMultipleStandardLoadBalancers is set to true. Each configuration names a load balancer, the node pools
+	// joining its backend pool and the services that can be placed on it. When it is set, the services are placed
+	// on the matching load balancer with the fewest load balancing rules, and the annotation
+	// `service.beta.kubernetes.io/azure-load-balancer-mode` is ignored.
+	MultipleStandardLoadBalancerConfigurations []MultipleStandardLoadBalancerConfiguration `json:"multipleStandardLoadBalancerConfigurations,omitempty" yaml:"multipleStandardLoadBalancerConfigurations,omitempty"`
 
 	// Backoff exponent
 	CloudProviderBackoffExponent float64 `json:"cloudProviderBackoffExponent,omitempty" yaml:"cloudProviderBackoffExponent,omitempty"`
@@ -214,6 +254,9 @@ type Config struct {
 
 	// Maximum allowed LoadBalancer Rule Count is the limit enforced by Azure Load balancer
 	MaximumLoadBalancerRuleCount int `json:"maximumLoadBalancerRuleCount,omitempty" yaml:"maximumLoadBalancerRuleCount,omitempty"`
+	// MaximumSecurityRuleCount is the number of the security rules above which the rules are compacted when
+	// EnableSecurityRuleCompaction is set. It is default to the limit enforced by Azure network security group.
+	MaximumSecurityRuleCount int `json:"maximumSecurityRuleCount,omitempty" yaml:"maximumSecurityRuleCount,omitempty"`
 	// Backoff retry limit
 	CloudProviderBackoffRetries int `json:"cloudProviderBackoffRetries,omitempty" yaml:"cloudProviderBackoffRetries,omitempty"`
 	// Backoff duration
@@ -248,13 +291,125 @@ type Config struct {
 	// are `nodeIPConfiguration`, `nodeIP` and `podIP`.
 	// `nodeIPConfiguration`: vm network interfaces will be attached to the inbound backend pool of the load balancer (default);
 	// `nodeIP`: vm private IPs will be attached to the inbound backend pool of the load balancer;
-	// `podIP`: pod IPs will be attached to the inbound backend pool of the load balancer (not supported yet).
+	// `podIP`: pod IPs will be attached to the inbound backend pool of the load balancer, which requires the pod IPs
+	// to be routable in the virtual network, e.g. Azure CNI. Each service has its own backend pools in this mode.
 	LoadBalancerBackendPoolConfigurationType string `json:"loadBalancerBackendPoolConfigurationType,omitempty" yaml:"loadBalancerBackendPoolConfigurationType,omitempty"`
 	// PutVMSSVMBatchSize defines how many requests the client send concurrently when putting the VMSS VMs.
 	// If it is smaller than or equal to zero, the request will be sent one by one in sequence (default).
 	PutVMSSVMBatchSize int `json:"putVMSSVMBatchSize" yaml:"putVMSSVMBatchSize"`
 	// PrivateLinkServiceResourceGroup determines the specific resource group of the private link services user want to use
 	PrivateLinkServiceResourceGroup string `json:"privateLinkServiceResourceGroup,omitempty" yaml:"privateLinkServiceResourceGroup,omitempty"`
+	// LoadBalancerClasses defines the named Azure load balancer classes. A service selects a class by setting its
+	// spec.loadBalancerClass to the name of the class, and the settings of the class are used as the defaults of the
+	// corresponding service annotations. The services whose spec.loadBalancerClass is set to any other value are
+	// ignored, so that they can be handled by other load balancer implementations.
+	LoadBalancerClasses []LoadBalancerClass `json:"loadBalancerClasses,omitempty" yaml:"loadBalancerClasses,omitempty"`
+	// ManagedOutboundRule makes the cloud provider own an outbound rule on the primary standard load balancer, which
+	// provides the outbound connectivity of the nodes in the cluster backend pool. The outbound SNAT of the load
+	// balancing rules is disabled by default when it is set.
+	ManagedOutboundRule *ManagedOutboundRuleConfig `json:"managedOutboundRule,omitempty" yaml:"managedOutboundRule,omitempty"`
+	// OutboundType is the outbound connectivity type of the nodes. Supported values are loadBalancer (default) and natGateway.
+	// With natGateway, the cloud provider ensures a NAT gateway associated with the node subnets.
+	OutboundType string `json:"outboundType,omitempty" yaml:"outboundType,omitempty"`
+	// NatGateway defines the NAT gateway ensured by the cloud provider when the outbound type is natGateway.
+	NatGateway *NatGatewayConfig `json:"natGateway,omitempty" yaml:"natGateway,omitempty"`
+	// OrphanedResourceGC configures the orphaned-resource-gc controller, which finds the load balancer resources left
+	// in Azure by the deleted services and deletes them. The controller is disabled by default.
+	OrphanedResourceGC *OrphanedResourceGCConfig `json:"orphanedResourceGC,omitempty" yaml:"orphanedResourceGC,omitempty"`
+}
+
+// OrphanedResourceGCConfig defines how the orphaned-resource-gc controller collects the orphaned resources.
+type OrphanedResourceGCConfig struct {
+	// IntervalInSeconds is the interval of finding the orphaned resources. Default is 3600.
+	IntervalInSeconds int `json:"intervalInSeconds,omitempty" yaml:"intervalInSeconds,omitempty"`
+	// GracePeriodInSeconds is how long the resources should stay orphaned before they are deleted. Default is 3600.
+	GracePeriodInSeconds int `json:"gracePeriodInSeconds,omitempty" yaml:"gracePeriodInSeconds,omitempty"`
+	// DryRun makes the controller only report the orphaned resources by the events and metrics without deleting them.
+	DryRun bool `json:"dryRun,omitempty" yaml:"dryRun,omitempty"`
+}
+
+// PrivateIPPoolConfig defines a pool of the static private IPs in a subnet of the cluster virtual network.
+type PrivateIPPoolConfig struct {
+	// SubnetName is the name of the subnet, which is the subnet in the cloud config or the one set by the annotation
+	// service.beta.kubernetes.io/azure-load-balancer-internal-subnet. A subnet has at most one pool per IP family.
+	SubnetName string `json:"subnetName" yaml:"subnetName"`
+	// CIDR is the range of the addresses in the pool, which should be in the address prefix of the subnet.
+	CIDR string `json:"cidr" yaml:"cidr"`
+	// ExcludedIPs are the addresses or CIDRs in the range which are not allocated.
+	ExcludedIPs []string `json:"excludedIPs,omitempty" yaml:"excludedIPs,omitempty"`
+	// ReleaseCooldownInSeconds is how long the addresses released by the deleted services are not allocated to
+	// other services. Default is 3600.
+	ReleaseCooldownInSeconds int `json:"releaseCooldownInSeconds,omitempty" yaml:"releaseCooldownInSeconds,omitempty"`
+}
+
+// ManagedOutboundRuleConfig defines the outbound rule managed by the cloud provider on the primary standard load balancer.
+// Exactly one of ManagedOutboundIPCount, OutboundIPIDs and OutboundIPPrefixIDs should be set.
+type ManagedOutboundRuleConfig struct {
+	// ManagedOutboundIPCount is the number of the public IPs created and managed by the cloud provider for the outbound rule.
+	ManagedOutboundIPCount int `json:"managedOutboundIPCount,omitempty" yaml:"managedOutboundIPCount,omitempty"`
+	// OutboundIPIDs are the IDs of the existing public IPs used by the outbound rule.
+	OutboundIPIDs []string `json:"outboundIPIDs,omitempty" yaml:"outboundIPIDs,omitempty"`
+	// OutboundIPPrefixIDs are the IDs of the existing public IP prefixes used by the outbound rule.
+	OutboundIPPrefixIDs []string `json:"outboundIPPrefixIDs,omitempty" yaml:"outboundIPPrefixIDs,omitempty"`
+	// AllocatedOutboundPorts is the number of the SNAT ports allocated to each node, which should be a multiple of 8.
+	// If it is not set, the ports are allocated by Azure automatically based on the size of the backend pool.
+	AllocatedOutboundPorts int32 `json:"allocatedOutboundPorts,omitempty" yaml:"allocatedOutboundPorts,omitempty"`
+	// IdleTimeoutInMinutes is the idle timeout of the outbound connections, between 4 and 120. Default is 30.
+	IdleTimeoutInMinutes int32 `json:"idleTimeoutInMinutes,omitempty" yaml:"idleTimeoutInMinutes,omitempty"`
+	// EnableTCPReset determines whether the TCP reset is sent on the idle timeout of the outbound connections. Default is true.
+	EnableTCPReset *bool `json:"enableTCPReset,omitempty" yaml:"enableTCPReset,omitempty"`
+}
+
+// NatGatewayConfig defines the NAT gateway ensured by the cloud provider in the cluster resource group.
+// At most one of ManagedOutboundIPCount and OutboundIPPrefixID should be set, and one public IP is created if neither is set.
+type NatGatewayConfig struct {
+	// Name is the name of the NAT gateway. Default is kubernetes-nat-gateway.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// ManagedOutboundIPCount is the number of the public IPs created and managed by the cloud provider for the NAT gateway.
+	ManagedOutboundIPCount int `json:"managedOutboundIPCount,omitempty" yaml:"managedOutboundIPCount,omitempty"`
+	// OutboundIPPrefixID is the ID of the existing public IP prefix used by the NAT gateway.
+	OutboundIPPrefixID string `json:"outboundIPPrefixID,omitempty" yaml:"outboundIPPrefixID,omitempty"`
+	// IdleTimeoutInMinutes is the idle timeout of the outbound connections, between 4 and 120. Default is 4.
+	IdleTimeoutInMinutes int32 `json:"idleTimeoutInMinutes,omitempty" yaml:"idleTimeoutInMinutes,omitempty"`
+	// SubnetNames are the names of the node subnets in the cluster virtual network, which are associated with
+	// the NAT gateway. Default is the subnet in the cloud config.
+	SubnetNames []string `json:"subnetNames,omitempty" yaml:"subnetNames,omitempty"`
+}
+
+// MultipleStandardLoadBalancerConfiguration defines one of the standard load balancers used by the cluster when
+// EnableMultipleStandardLoadBalancers is set to true.
+type MultipleStandardLoadBalancerConfiguration struct {
+	// Name is the name of the load balancer, and the internal one is named with the suffix "-internal". The
+	// configuration of the primary standard load balancer should be named after the cluster.
+	Name string `json:"name" yaml:"name"`
+	// NodePools are the VMSS/VMAS names whose nodes join the backend pool of the load balancer. A node pool
+	// can only be in one configuration.
+	NodePools []string `json:"nodePools" yaml:"nodePools"`
+	// ServiceNamespaceSelector selects the namespaces of the services that can be placed on the load balancer.
+	// All namespaces are selected if it is not set.
+	ServiceNamespaceSelector *metav1.LabelSelector `json:"serviceNamespaceSelector,omitempty" yaml:"serviceNamespaceSelector,omitempty"`
+	// ServiceLabelSelector selects the services that can be placed on the load balancer by their labels.
+	// All services are selected if it is not set.
+	ServiceLabelSelector *metav1.LabelSelector `json:"serviceLabelSelector,omitempty" yaml:"serviceLabelSelector,omitempty"`
+}
+
+// LoadBalancerClass defines a named Azure load balancer class, which selects the flavor of the load balancer
+// of the services instead of setting the equivalent annotations on each of them.
+type LoadBalancerClass struct {
+	// Name is the value of spec.loadBalancerClass of the services to select the class, e.g. "azure-internal".
+	Name string `json:"name" yaml:"name"`
+	// Internal indicates if the internal load balancer is used, the same as the annotation
+	// service.beta.kubernetes.io/azure-load-balancer-internal.
+	Internal bool `json:"internal,omitempty" yaml:"internal,omitempty"`
+	// InternalSubnet is the subnet of the frontend IPs of the internal load balancer, the same as the annotation
+	// service.beta.kubernetes.io/azure-load-balancer-internal-subnet.
+	InternalSubnet string `json:"internalSubnet,omitempty" yaml:"internalSubnet,omitempty"`
+	// PublicIPResourceGroup is the resource group of the public IPs of the services, the same as the annotation
+	// service.beta.kubernetes.io/azure-load-balancer-resource-group. The load balancers are always in the
+	// loadBalancerResourceGroup of the cloud config.
+	PublicIPResourceGroup string `json:"publicIPResourceGroup,omitempty" yaml:"publicIPResourceGroup,omitempty"`
+	// Annotations are the default values of any other service annotations.
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
 }
 
 type InitSecretConfig struct {
@@ -289,6 +444,8 @@ type Cloud struct {
 	RouteTablesClient               routetableclient.Interface
 	LoadBalancerClient              loadbalancerclient.Interface
 	PublicIPAddressesClient         publicipclient.Interface
+	PublicIPPrefixesClient          publicipprefixclient.Interface
+	NatGatewaysClient               natgatewayclient.Interface
 	SecurityGroupsClient            securitygroupclient.Interface
 	VirtualMachinesClient           vmclient.Interface
 	StorageAccountClient            storageaccountclient.Interface
@@ -307,6 +464,8 @@ type Cloud struct {
 	PrivateLinkServiceClient        privatelinkserviceclient.Interface
 	containerServiceClient          containerserviceclient.Interface
 	deploymentClient                deploymentclient.Interface
+	DNSClient                       dnsclient.Interface
+	ApplicationSecurityGroupsClient applicationsecuritygroupclient.Interface
 
 	ResourceRequestBackoff  wait.Backoff
 	Metadata                *InstanceMetadataService
@@ -334,6 +493,16 @@ type Cloud struct {
 	// nodeInformerSynced is for determining if the informer has synced.
 	nodeInformerSynced cache.InformerSynced
 
+	// serviceLister and endpointSliceLister are only set when the backend pool type is podIP,
+	// they are used for getting the pod IPs and target ports of the services.
+	serviceLister       corelisters.ServiceLister
+	endpointSliceLister discoverylisters.EndpointSliceLister
+	// endpointSliceInformerSynced is for determining if the EndpointSlice informer has synced.
+	endpointSliceInformerSynced cache.InformerSynced
+	// namespaceLister is only set when multiple standard load balancer configurations are used,
+	// it is used for matching the namespaces of the services with the configurations.
+	namespaceLister corelisters.NamespaceLister
+
 	// routeCIDRsLock holds lock for routeCIDRs cache.
 	routeCIDRsLock sync.Mutex
 	// routeCIDRs holds cache for route CIDRs.
@@ -347,6 +516,27 @@ type Cloud struct {
 	eventBroadcaster record.EventBroadcaster
 	eventRecorder    record.EventRecorder
 	routeUpdater     *delayedRouteUpdater
+	// podIPBackendPoolUpdater updates the pod IP based backend pools when the EndpointSlices are changed
+	podIPBackendPoolUpdater *podIPBackendPoolUpdater
+	// lbUpdateProcessor and nsgUpdateProcessor merge the concurrent updates of the same load balancer
+	// or security group made by the reconciliation of different services into one update.
+	lbUpdateProcessor  *batch.Processor
+	nsgUpdateProcessor *batch.Processor
+	// loadBalancerClientConfig is used for creating the load balancer clients of the subscriptions of the
+	// cross-region and gateway load balancers, which are cached in subscriptionLoadBalancerClients by the subscription ID.
+	loadBalancerClientConfig        *azclients.ClientConfig
+	subscriptionLoadBalancerClients sync.Map
+	// dnsClientConfig is used for creating the DNS clients of the subscriptions of the DNS zones,
+	// which are cached in dnsClients by the subscription ID.
+	dnsClientConfig *azclients.ClientConfig
+	dnsClients      sync.Map
+	// privateDNSClientConfig is used for creating the private DNS clients of the subscriptions of the private DNS
+	// zones of the internal services, which are cached in privateDNSClients by the subscription ID.
+	privateDNSClientConfig *azclients.ClientConfig
+	privateDNSClients      sync.Map
+	// planRecorder is set by the LoadBalancerPlanner to record the writes of the clients of the other subscriptions,
+	// which are created on demand.
+	planRecorder *planRecorder
 
 	vmCache  *azcache.TimedCache
 	lbCache  *azcache.TimedCache
@@ -355,6 +545,14 @@ type Cloud struct {
 	pipCache *azcache.TimedCache
 	// use LB frontEndIpConfiguration ID as the key and search for PLS attached to the frontEnd
 	plsCache *azcache.TimedCache
+	// asgCache caches the application security groups which the node IP configurations join by the name,
+	// applicationSecurityGroupLock serializes the creations of them.
+	asgCache                     *azcache.TimedCache
+	applicationSecurityGroupLock sync.Mutex
+	// privateIPPoolAllocator allocates the static private IPs of the internal services from the private IP pools.
+	privateIPPoolAllocator privateIPPoolAllocator
+	// publicIPPrefixLengths caches the prefix lengths of the public IP prefixes of the managed outbound rule by the IDs.
+	publicIPPrefixLengths sync.Map
 
 	*ManagedDiskController
 	*controllerCommon
@@ -538,9 +736,7 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret, callFromC
 		}
 	}
 
-	if config.LoadBalancerBackendPoolConfigurationType == "" ||
-		// TODO(nilo19): support pod IP mode in the future
-		strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypePODIP) {
+	if config.LoadBalancerBackendPoolConfigurationType == "" {
 		config.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration
 	} else {
 		supportedLoadBalancerBackendPoolConfigurationTypes := sets.NewString(
@@ -552,6 +748,54 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret, callFromC
 		}
 	}
 
+	loadBalancerClassNames := sets.NewString()
+	for _, loadBalancerClass := range config.LoadBalancerClasses {
+		if loadBalancerClass.Name == "" {
+			return fmt.Errorf("the name of the load balancer class should not be empty")
+		}
+		if loadBalancerClassNames.Has(loadBalancerClass.Name) {
+			return fmt.Errorf("the load balancer class %s is defined more than once", loadBalancerClass.Name)
+		}
+		loadBalancerClassNames.Insert(loadBalancerClass.Name)
+	}
+
+	if err := validateMultipleStandardLoadBalancerConfigurations(config); err != nil {
+		return err
+	}
+
+	if err := validateManagedOutboundRuleConfig(config); err != nil {
+		return err
+	}
+
+	if err := validateOutboundTypeConfig(config); err != nil {
+		return err
+	}
+
+	if err := validateOrphanedResourceGCConfig(config); err != nil {
+		return err
+	}
+
+	if err := validateApplicationSecurityGroupMode(config); err != nil {
+		return err
+	}
+
+	if err := validatePrivateIPPoolConfigs(config); err != nil {
+		return err
+	}
+
+	if config.PublicIPPrefixID != "" {
+		if !strings.EqualFold(config.LoadBalancerSku, consts.LoadBalancerSkuStandard) {
+			return fmt.Errorf("publicIPPrefixID is only supported with the standard load balancer")
+		}
+		if !pipPrefixIDRE.MatchString(config.PublicIPPrefixID) {
+			return fmt.Errorf("publicIPPrefixID %s is not a valid public IP prefix ID", config.PublicIPPrefixID)
+		}
+	}
+
+	if config.PrivateDNSZoneID != "" && !privateDNSZoneIDRE.MatchString(config.PrivateDNSZoneID) {
+		return fmt.Errorf("privateDNSZoneID %s is not a valid private DNS zone ID", config.PrivateDNSZoneID)
+	}
+
 	env, err := auth.ParseAzureEnvironment(config.Cloud, config.ResourceManagerEndpoint, config.IdentitySystem)
 	if err != nil {
 		return err
@@ -612,6 +856,10 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret, callFromC
 		az.MaximumLoadBalancerRuleCount = consts.MaximumLoadBalancerRuleCount
 	}
 
+	if az.MaximumSecurityRuleCount == 0 {
+		az.MaximumSecurityRuleCount = consts.MaximumSecurityRuleCount
+	}
+
 	if strings.EqualFold(consts.VMTypeVMSS, az.Config.VMType) {
 		az.VMSet, err = newScaleSet(az)
 		if err != nil {
@@ -628,6 +876,8 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret, callFromC
 		az.LoadBalancerBackendPool = newBackendPoolTypeNodeIPConfig(az)
 	} else if az.isLBBackendPoolTypeNodeIP() {
 		az.LoadBalancerBackendPool = newBackendPoolTypeNodeIP(az)
+	} else if az.isLBBackendPoolTypePodIP() {
+		az.LoadBalancerBackendPool = newBackendPoolTypePodIP(az)
 	}
 
 	err = az.initCaches()
@@ -639,12 +889,20 @@ func (az *Cloud) InitializeCloudFromConfig(config *Config, fromSecret, callFromC
 		return err
 	}
 
+	initLoadBalancerUpdateProcessors(az)
+
 	// updating routes and syncing zones only in CCM
 	if callFromCCM {
 		// start delayed route updater.
 		az.routeUpdater = newDelayedRouteUpdater(az, routeUpdateInterval)
 		go az.routeUpdater.run()
 
+		// start the updater of the pod IP based backend pools.
+		if az.isLBBackendPoolTypePodIP() {
+			az.podIPBackendPoolUpdater = newPodIPBackendPoolUpdater(az, podIPBackendPoolUpdateInterval)
+			go az.podIPBackendPoolUpdater.run()
+		}
+
 		// Azure Stack does not support zone at the moment
 		// https://docs.microsoft.com/en-us/azure-stack/user/azure-stack-network-differences?view=azs-2102
 		if !az.isStackCloud() {
@@ -670,6 +928,10 @@ func (az *Cloud) isLBBackendPoolTypeNodeIP() bool {
 	return strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypeNodeIP)
 }
 
+func (az *Cloud) isLBBackendPoolTypePodIP() bool {
+	return strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypePODIP)
+}
+
 func (az *Cloud) getPutVMSSVMBatchSize() int {
 	return az.PutVMSSVMBatchSize
 }
@@ -705,6 +967,11 @@ func (az *Cloud) initCaches() (err error) {
 		return err
 	}
 
+	az.asgCache, err = az.newApplicationSecurityGroupCache()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -715,9 +982,14 @@ func (az *Cloud) setLBDefaults(config *Config) error {
 			config.ExcludeMasterFromStandardLB = &defaultExcludeMasterFromStandardLB
 		}
 
-		// Enable outbound SNAT by default.
+		// Enable outbound SNAT by default, unless the outbound connectivity is provided by the managed outbound rule
+		// or the NAT gateway.
 		if config.DisableOutboundSNAT == nil {
-			config.DisableOutboundSNAT = &defaultDisableOutboundSNAT
+			if config.ManagedOutboundRule != nil || strings.EqualFold(config.OutboundType, consts.OutboundTypeNatGateway) {
+				config.DisableOutboundSNAT = to.BoolPtr(true)
+			} else {
+				config.DisableOutboundSNAT = &defaultDisableOutboundSNAT
+			}
 		}
 	} else {
 		if config.DisableOutboundSNAT != nil && *config.DisableOutboundSNAT {
@@ -810,6 +1082,7 @@ func (az *Cloud) configAzureClients(
 	loadBalancerClientConfig := azClientConfig.WithRateLimiter(az.Config.LoadBalancerRateLimit)
 	securityGroupClientConfig := azClientConfig.WithRateLimiter(az.Config.SecurityGroupRateLimit)
 	publicIPClientConfig := azClientConfig.WithRateLimiter(az.Config.PublicIPAddressRateLimit)
+	natGatewayClientConfig := azClientConfig.WithRateLimiter(az.Config.NatGatewayRateLimit)
 	containerServiceConfig := azClientConfig.WithRateLimiter(az.Config.ContainerServiceRateLimit)
 	deploymentConfig := azClientConfig.WithRateLimiter(az.Config.DeploymentRateLimit)
 	privateDNSConfig := azClientConfig.WithRateLimiter(az.Config.PrivateDNSRateLimit)
@@ -817,6 +1090,8 @@ func (az *Cloud) configAzureClients(
 	privateEndpointConfig := azClientConfig.WithRateLimiter(az.Config.PrivateEndpointRateLimit)
 	privateLinkServiceConfig := azClientConfig.WithRateLimiter(az.Config.PrivateLinkServiceRateLimit)
 	virtualNetworkConfig := azClientConfig.WithRateLimiter(az.Config.VirtualNetworkRateLimit)
+	dnsClientConfig := azClientConfig.WithRateLimiter(az.Config.DNSRateLimit)
+	applicationSecurityGroupClientConfig := azClientConfig.WithRateLimiter(az.Config.ApplicationSecurityGroupRateLimit)
 	// TODO(ZeroMagic): add azurefileRateLimit
 	fileClientConfig := azClientConfig.WithRateLimiter(nil)
 	vmasClientConfig := azClientConfig.WithRateLimiter(az.Config.AvailabilitySetRateLimit)
@@ -840,6 +1115,8 @@ func (az *Cloud) configAzureClients(
 		loadBalancerClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 		securityGroupClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 		publicIPClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		natGatewayClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		applicationSecurityGroupClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 
 		routeClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 		subnetClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
@@ -847,6 +1124,8 @@ func (az *Cloud) configAzureClients(
 		loadBalancerClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 		securityGroupClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 		publicIPClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		natGatewayClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		applicationSecurityGroupClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 	}
 
 	// Initialize all azure clients based on client config
@@ -862,17 +1141,24 @@ func (az *Cloud) configAzureClients(
 	az.SubnetsClient = subnetclient.New(subnetClientConfig)
 	az.RouteTablesClient = routetableclient.New(routeTableClientConfig)
 	az.LoadBalancerClient = loadbalancerclient.New(loadBalancerClientConfig)
+	az.loadBalancerClientConfig = loadBalancerClientConfig
 	az.SecurityGroupsClient = securitygroupclient.New(securityGroupClientConfig)
 	az.PublicIPAddressesClient = publicipclient.New(publicIPClientConfig)
+	az.PublicIPPrefixesClient = publicipprefixclient.New(publicIPClientConfig)
+	az.NatGatewaysClient = natgatewayclient.New(natGatewayClientConfig)
 	az.FileClient = fileclient.New(fileClientConfig)
 	az.AvailabilitySetsClient = vmasclient.New(vmasClientConfig)
 	az.privateendpointclient = privateendpointclient.New(privateEndpointConfig)
 	az.privatednsclient = privatednsclient.New(privateDNSConfig)
+	az.privateDNSClientConfig = privateDNSConfig
 	az.privatednszonegroupclient = privatednszonegroupclient.New(privateDNSZoenGroupConfig)
 	az.virtualNetworkLinksClient = virtualnetworklinksclient.New(virtualNetworkConfig)
 	az.PrivateLinkServiceClient = privatelinkserviceclient.New(privateLinkServiceConfig)
 	az.containerServiceClient = containerserviceclient.New(containerServiceConfig)
 	az.deploymentClient = deploymentclient.New(deploymentConfig)
+	az.DNSClient = dnsclient.New(dnsClientConfig)
+	az.dnsClientConfig = dnsClientConfig
+	az.ApplicationSecurityGroupsClient = applicationsecuritygroupclient.New(applicationSecurityGroupClientConfig)
 
 	if az.ZoneClient == nil {
 		az.ZoneClient = zoneclient.New(zoneClientConfig)
@@ -1116,6 +1402,62 @@ func (az *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
 		},
 	})
 	az.nodeInformerSynced = nodeInformer.HasSynced
+
+	if az.isLBBackendPoolTypePodIP() {
+		az.setPodIPBackendPoolInformers(informerFactory)
+	}
+
+	if az.useMultipleStandardLoadBalancerConfigurations() {
+		az.namespaceLister = informerFactory.Core().V1().Namespaces().Lister()
+	}
+}
+
+// setPodIPBackendPoolInformers sets the Service and EndpointSlice informers which are
+// needed to keep the pod IP based backend pools up to date.
+func (az *Cloud) setPodIPBackendPoolInformers(informerFactory informers.SharedInformerFactory) {
+	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+
+	endpointSliceInformer := informerFactory.Discovery().V1().EndpointSlices()
+	endpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			endpointSlice := obj.(*discoveryv1.EndpointSlice)
+			az.enqueueEndpointSliceService(endpointSlice)
+		},
+		UpdateFunc: func(prev, obj interface{}) {
+			endpointSlice := obj.(*discoveryv1.EndpointSlice)
+			az.enqueueEndpointSliceService(endpointSlice)
+		},
+		DeleteFunc: func(obj interface{}) {
+			endpointSlice, isEndpointSlice := obj.(*discoveryv1.EndpointSlice)
+			// We can get DeletedFinalStateUnknown instead of *discoveryv1.EndpointSlice here
+			// and we need to handle that correctly.
+			if !isEndpointSlice {
+				deletedState, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					klog.Errorf("Received unexpected object: %v", obj)
+					return
+				}
+				endpointSlice, ok = deletedState.Obj.(*discoveryv1.EndpointSlice)
+				if !ok {
+					klog.Errorf("DeletedFinalStateUnknown contained non-EndpointSlice object: %v", deletedState.Obj)
+					return
+				}
+			}
+			az.enqueueEndpointSliceService(endpointSlice)
+		},
+	})
+	az.endpointSliceLister = endpointSliceInformer.Lister()
+	az.endpointSliceInformerSynced = endpointSliceInformer.Informer().HasSynced
+}
+
+// enqueueEndpointSliceService queues the service of the EndpointSlice so that
+// its backend pools would be updated with the latest pod IPs.
+func (az *Cloud) enqueueEndpointSliceService(endpointSlice *discoveryv1.EndpointSlice) {
+	serviceName, ok := endpointSlice.Labels[discoveryv1.LabelServiceName]
+	if !ok || serviceName == "" || az.podIPBackendPoolUpdater == nil {
+		return
+	}
+	az.podIPBackendPoolUpdater.enqueue(fmt.Sprintf("%s/%s", endpointSlice.Namespace, serviceName))
 }
 
 // updateNodeCaches updates local cache for node's zones and external resource groups.
@@ -1349,6 +1691,26 @@ func (az *Cloud) ShouldNodeExcludedFromLoadBalancer(nodeName string) (bool, erro
 	return az.excludeLoadBalancerNodes.Has(nodeName), nil
 }
 
+// getNodePrivateIPs returns the sorted private IPs of the given IP family of the nodes which are not excluded from
+// the load balancers.
+func (az *Cloud) getNodePrivateIPs(isIPv6 bool) []string {
+	az.nodeCachesLock.RLock()
+	defer az.nodeCachesLock.RUnlock()
+
+	ips := sets.NewString()
+	for nodeName, nodeIPs := range az.nodePrivateIPs {
+		if az.excludeLoadBalancerNodes.Has(nodeName) {
+			continue
+		}
+		for ip := range nodeIPs {
+			if utilnet.IsIPv6String(ip) == isIPv6 {
+				ips.Insert(ip)
+			}
+		}
+	}
+	return ips.List()
+}
+
 func isNodeReady(node *v1.Node) bool {
 	for _, cond := range node.Status.Conditions {
 		if cond.Type == v1.NodeReady && cond.Status == v1.ConditionTrue {
@@ -0,0 +1,305 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-07-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func validateApplicationSecurityGroupMode(config *Config) error {
+	if config.ApplicationSecurityGroupMode == "" {
+		return nil
+	}
+
+	supportedModes := sets.NewString(
+		strings.ToLower(consts.ApplicationSecurityGroupModeLoadBalancer),
+		strings.ToLower(consts.ApplicationSecurityGroupModeNodePool))
+	if !supportedModes.Has(strings.ToLower(config.ApplicationSecurityGroupMode)) {
+		return fmt.Errorf("applicationSecurityGroupMode %s is not supported, supported values are %v", config.ApplicationSecurityGroupMode, supportedModes.List())
+	}
+	if !strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration) {
+		return fmt.Errorf("applicationSecurityGroupMode is only supported with the %s backend pool configuration type", consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration)
+	}
+	return nil
+}
+
+func (az *Cloud) useApplicationSecurityGroups() bool {
+	return az.ApplicationSecurityGroupMode != ""
+}
+
+func (az *Cloud) newApplicationSecurityGroupCache() (*azcache.TimedCache, error) {
+	getter := func(key string) (interface{}, error) {
+		ctx, cancel := getContextWithCancel()
+		defer cancel()
+		asg, err := az.ApplicationSecurityGroupsClient.Get(ctx, az.ResourceGroup, key, "")
+		exists, rerr := checkResourceExistsFromError(err)
+		if rerr != nil {
+			return nil, rerr.Error()
+		}
+
+		if !exists {
+			klog.V(2).Infof("Application security group %q not found", key)
+			return nil, nil
+		}
+
+		return &asg, nil
+	}
+	return azcache.NewTimedcache(time.Duration(applicationSecurityGroupCacheTTLDefaultInSeconds)*time.Second, getter)
+}
+
+// getApplicationSecurityGroupName returns the name of the application security group which the IP configurations of
+// the nodes in the vmSet join together with the backend pool, or an empty string if there is no such group.
+func (az *Cloud) getApplicationSecurityGroupName(backendPoolID, vmSetName string) string {
+	var prefix string
+	if strings.EqualFold(az.ApplicationSecurityGroupMode, consts.ApplicationSecurityGroupModeLoadBalancer) {
+		matches := backendPoolIDRE.FindStringSubmatch(backendPoolID)
+		if len(matches) == 2 {
+			prefix = matches[1]
+		}
+	} else if strings.EqualFold(az.ApplicationSecurityGroupMode, consts.ApplicationSecurityGroupModeNodePool) {
+		// the standalone VMs don't belong to any node pool
+		prefix = vmSetName
+	}
+	if prefix == "" {
+		return ""
+	}
+	return strings.ToLower(prefix) + consts.ApplicationSecurityGroupNameSuffix
+}
+
+func (az *Cloud) getApplicationSecurityGroupID(name string) string {
+	return fmt.Sprintf(
+		consts.ApplicationSecurityGroupIDTemplate,
+		az.getNetworkResourceSubscriptionID(),
+		az.ResourceGroup,
+		name)
+}
+
+// ensureApplicationSecurityGroup creates the application security group in the resource group of the cluster if it
+// doesn't exist, and returns its ID.
+func (az *Cloud) ensureApplicationSecurityGroup(name string) (string, error) {
+	az.applicationSecurityGroupLock.Lock()
+	defer az.applicationSecurityGroupLock.Unlock()
+
+	asg, err := az.asgCache.Get(name, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return "", err
+	}
+	if asg != nil {
+		return az.getApplicationSecurityGroupID(name), nil
+	}
+
+	klog.V(2).Infof("ensureApplicationSecurityGroup: creating the application security group %s", name)
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	rerr := az.ApplicationSecurityGroupsClient.CreateOrUpdate(ctx, az.ResourceGroup, name, network.ApplicationSecurityGroup{
+		Location: to.StringPtr(az.Location),
+		Tags:     parseTags(az.Tags, az.TagsMap),
+	}, "")
+	if rerr != nil {
+		klog.Errorf("ensureApplicationSecurityGroup: failed to create the application security group %s: %v", name, rerr.Error())
+		return "", rerr.Error()
+	}
+	_ = az.asgCache.Delete(name)
+	return az.getApplicationSecurityGroupID(name), nil
+}
+
+// ensureNodeApplicationSecurityGroup ensures the application security group which the IP configuration of the node in
+// the vmSet joins together with the backend pool, and returns its ID. An empty ID is returned if the application
+// security groups are disabled.
+func (az *Cloud) ensureNodeApplicationSecurityGroup(backendPoolID, vmSetName string) (string, error) {
+	name := az.getApplicationSecurityGroupName(backendPoolID, vmSetName)
+	if name == "" {
+		return "", nil
+	}
+	return az.ensureApplicationSecurityGroup(name)
+}
+
+// getApplicationSecurityGroupIDToLeave returns the ID of the application security group which the IP configuration of
+// the node in the vmSet leaves when it is removed from the backend pool. The group of the node pool is only left when
+// the IP configuration is not in any other backend pools.
+func (az *Cloud) getApplicationSecurityGroupIDToLeave(backendPoolID, vmSetName string, remainingBackendPools int) string {
+	if strings.EqualFold(az.ApplicationSecurityGroupMode, consts.ApplicationSecurityGroupModeNodePool) && remainingBackendPools > 0 {
+		return ""
+	}
+	name := az.getApplicationSecurityGroupName(backendPoolID, vmSetName)
+	if name == "" {
+		return ""
+	}
+	return az.getApplicationSecurityGroupID(name)
+}
+
+// reconcileInterfaceIPConfigApplicationSecurityGroup adds the application security group into the IP configuration
+// of the network interface, or removes it if wantASG is false. It reports whether the IP configuration is changed.
+func reconcileInterfaceIPConfigApplicationSecurityGroup(ipConfig *network.InterfaceIPConfiguration, asgID string, wantASG bool) bool {
+	if asgID == "" || ipConfig.InterfaceIPConfigurationPropertiesFormat == nil {
+		return false
+	}
+
+	var asgs []network.ApplicationSecurityGroup
+	var found bool
+	if ipConfig.ApplicationSecurityGroups != nil {
+		for _, asg := range *ipConfig.ApplicationSecurityGroups {
+			if strings.EqualFold(to.String(asg.ID), asgID) {
+				found = true
+				continue
+			}
+			asgs = append(asgs, asg)
+		}
+	}
+	if found == wantASG {
+		return false
+	}
+	if wantASG {
+		asgs = append(asgs, network.ApplicationSecurityGroup{ID: to.StringPtr(asgID)})
+	}
+	ipConfig.ApplicationSecurityGroups = &asgs
+	return true
+}
+
+// reconcileVMSSIPConfigApplicationSecurityGroup adds the application security group into the IP configuration of the
+// VMSS or the VMSS VM, or removes it if wantASG is false. It reports whether the IP configuration is changed.
+func reconcileVMSSIPConfigApplicationSecurityGroup(ipConfig *compute.VirtualMachineScaleSetIPConfiguration, asgID string, wantASG bool) bool {
+	if asgID == "" || ipConfig.VirtualMachineScaleSetIPConfigurationProperties == nil {
+		return false
+	}
+
+	var asgs []compute.SubResource
+	var found bool
+	if ipConfig.ApplicationSecurityGroups != nil {
+		for _, asg := range *ipConfig.ApplicationSecurityGroups {
+			if strings.EqualFold(to.String(asg.ID), asgID) {
+				found = true
+				continue
+			}
+			asgs = append(asgs, asg)
+		}
+	}
+	if found == wantASG {
+		return false
+	}
+	if wantASG {
+		asgs = append(asgs, compute.SubResource{ID: to.StringPtr(asgID)})
+	}
+	ipConfig.ApplicationSecurityGroups = &asgs
+	return true
+}
+
+// getServiceApplicationSecurityGroupIDs returns the IDs of the application security groups of the nodes behind the
+// load balancer of the service, which are the destinations of the security rules of the service when the traffic is
+// destined to the nodes instead of the frontend IPs.
+func (az *Cloud) getServiceApplicationSecurityGroupIDs(clusterName string, service *v1.Service) ([]string, error) {
+	existingLBs, err := az.ListLB(service)
+	if err != nil {
+		return nil, err
+	}
+
+	var lb *network.LoadBalancer
+	for i := range existingLBs {
+		if isInternalLoadBalancer(&existingLBs[i]) != requiresInternalLoadBalancer(service) {
+			continue
+		}
+		status, _, err := az.getServiceLoadBalancerStatus(service, &existingLBs[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			lb = &existingLBs[i]
+			break
+		}
+	}
+	if lb == nil {
+		return nil, nil
+	}
+
+	names := sets.NewString()
+	if strings.EqualFold(az.ApplicationSecurityGroupMode, consts.ApplicationSecurityGroupModeLoadBalancer) {
+		names.Insert(strings.ToLower(to.String(lb.Name)) + consts.ApplicationSecurityGroupNameSuffix)
+	} else if lb.LoadBalancerPropertiesFormat != nil && lb.BackendAddressPools != nil {
+		backendPoolNames := getBackendPoolNames(clusterName)
+		for _, backendPool := range *lb.BackendAddressPools {
+			if !strings.EqualFold(to.String(backendPool.Name), backendPoolNames[false]) && !strings.EqualFold(to.String(backendPool.Name), backendPoolNames[true]) {
+				continue
+			}
+			if backendPool.BackendAddressPoolPropertiesFormat == nil || backendPool.BackendIPConfigurations == nil {
+				continue
+			}
+			for _, ipConfig := range *backendPool.BackendIPConfigurations {
+				_, vmSetName, err := az.VMSet.GetNodeNameByIPConfigurationID(to.String(ipConfig.ID))
+				if err != nil {
+					if errors.Is(err, cloudprovider.InstanceNotFound) {
+						continue
+					}
+					return nil, err
+				}
+				if name := az.getApplicationSecurityGroupName("", vmSetName); name != "" {
+					names.Insert(name)
+				}
+			}
+		}
+	}
+
+	asgIDs := make([]string, 0, names.Len())
+	for _, name := range names.List() {
+		asgID, err := az.ensureApplicationSecurityGroup(name)
+		if err != nil {
+			return nil, err
+		}
+		asgIDs = append(asgIDs, asgID)
+	}
+	sort.Strings(asgIDs)
+	return asgIDs, nil
+}
+
+// getApplicationSecurityGroupsByIDs returns the references of the application security groups in the security rules.
+func getApplicationSecurityGroupsByIDs(asgIDs []string) *[]network.ApplicationSecurityGroup {
+	asgs := make([]network.ApplicationSecurityGroup, 0, len(asgIDs))
+	for _, asgID := range asgIDs {
+		asgs = append(asgs, network.ApplicationSecurityGroup{ID: to.StringPtr(asgID)})
+	}
+	return &asgs
+}
+
+// areApplicationSecurityGroupsEqual checks if the application security groups are the same ones regardless of the
+// order. Nil and empty groups are both equal to no groups.
+func areApplicationSecurityGroupsEqual(asgs, expectedASGs *[]network.ApplicationSecurityGroup) bool {
+	getIDs := func(asgs *[]network.ApplicationSecurityGroup) sets.String {
+		ids := sets.NewString()
+		if asgs != nil {
+			for _, asg := range *asgs {
+				ids.Insert(strings.ToLower(to.String(asg.ID)))
+			}
+		}
+		return ids
+	}
+	return getIDs(asgs).Equal(getIDs(expectedASGs))
+}
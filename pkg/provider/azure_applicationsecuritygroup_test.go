@@ -0,0 +1,216 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-07-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationsecuritygroupclient/mockapplicationsecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient/mockinterfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestValidateApplicationSecurityGroupMode(t *testing.T) {
+	for _, test := range []struct {
+		desc            string
+		mode            string
+		backendPoolType string
+		expectedErr     bool
+	}{
+		{
+			desc: "the application security groups should be disabled by default",
+		},
+		{
+			desc:            "the loadBalancer mode should be supported",
+			mode:            consts.ApplicationSecurityGroupModeLoadBalancer,
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+		},
+		{
+			desc:            "the nodePool mode should be supported regardless of the case",
+			mode:            "NodePool",
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+		},
+		{
+			desc:            "an error should be returned for an unknown mode",
+			mode:            "subnet",
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+			expectedErr:     true,
+		},
+		{
+			desc:            "an error should be returned for the nodeIP backend pool type",
+			mode:            consts.ApplicationSecurityGroupModeNodePool,
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypeNodeIP,
+			expectedErr:     true,
+		},
+	} {
+		config := &Config{
+			ApplicationSecurityGroupMode:             test.mode,
+			LoadBalancerBackendPoolConfigurationType: test.backendPoolType,
+		}
+		assert.Equal(t, test.expectedErr, validateApplicationSecurityGroupMode(config) != nil, test.desc)
+	}
+}
+
+func TestGetApplicationSecurityGroupName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	backendPoolID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/Kubernetes-Internal/backendAddressPools/kubernetes"
+	assert.Empty(t, az.getApplicationSecurityGroupName(backendPoolID, "vmss"))
+
+	az.ApplicationSecurityGroupMode = consts.ApplicationSecurityGroupModeLoadBalancer
+	assert.Equal(t, "kubernetes-internal-asg", az.getApplicationSecurityGroupName(backendPoolID, "vmss"))
+	assert.Empty(t, az.getApplicationSecurityGroupName("invalid", "vmss"))
+
+	az.ApplicationSecurityGroupMode = consts.ApplicationSecurityGroupModeNodePool
+	assert.Equal(t, "vmss-asg", az.getApplicationSecurityGroupName(backendPoolID, "VMSS"))
+	assert.Empty(t, az.getApplicationSecurityGroupName(backendPoolID, ""))
+	assert.Equal(t, "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/vmss-asg", az.getApplicationSecurityGroupID("vmss-asg"))
+
+	// the node pool is only left with no backend pools remaining
+	assert.Empty(t, az.getApplicationSecurityGroupIDToLeave(backendPoolID, "vmss", 1))
+	assert.Equal(t, az.getApplicationSecurityGroupID("vmss-asg"), az.getApplicationSecurityGroupIDToLeave(backendPoolID, "vmss", 0))
+}
+
+func TestEnsureApplicationSecurityGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	mockASGClient := az.ApplicationSecurityGroupsClient.(*mockapplicationsecuritygroupclient.MockInterface)
+	mockASGClient.EXPECT().Get(gomock.Any(), "rg", "vmss-asg", gomock.Any()).Return(network.ApplicationSecurityGroup{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+	mockASGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "vmss-asg", gomock.Any(), "").DoAndReturn(func(ctx context.Context, resourceGroupName, applicationSecurityGroupName string, parameters network.ApplicationSecurityGroup, etag string) *retry.Error {
+		assert.Equal(t, "westus", to.String(parameters.Location))
+		return nil
+	})
+	mockASGClient.EXPECT().Get(gomock.Any(), "rg", "vmss-asg", gomock.Any()).Return(network.ApplicationSecurityGroup{Name: to.StringPtr("vmss-asg")}, nil)
+
+	asgID, err := az.ensureApplicationSecurityGroup("vmss-asg")
+	assert.NoError(t, err)
+	assert.Equal(t, az.getApplicationSecurityGroupID("vmss-asg"), asgID)
+
+	// the existing application security group is not updated
+	asgID, err = az.ensureApplicationSecurityGroup("vmss-asg")
+	assert.NoError(t, err)
+	assert.Equal(t, az.getApplicationSecurityGroupID("vmss-asg"), asgID)
+
+	mockASGClient.EXPECT().Get(gomock.Any(), "rg", "lb-asg", gomock.Any()).Return(network.ApplicationSecurityGroup{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+	mockASGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb-asg", gomock.Any(), "").Return(&retry.Error{HTTPStatusCode: http.StatusForbidden})
+	_, err = az.ensureApplicationSecurityGroup("lb-asg")
+	assert.Error(t, err)
+}
+
+func TestReconcileIPConfigApplicationSecurityGroup(t *testing.T) {
+	asgID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/vmss-asg"
+	otherASGID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/other"
+
+	ipConfig := network.InterfaceIPConfiguration{
+		InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+			ApplicationSecurityGroups: &[]network.ApplicationSecurityGroup{{ID: to.StringPtr(otherASGID)}},
+		},
+	}
+	assert.False(t, reconcileInterfaceIPConfigApplicationSecurityGroup(&ipConfig, "", true))
+	assert.True(t, reconcileInterfaceIPConfigApplicationSecurityGroup(&ipConfig, asgID, true))
+	assert.Equal(t, 2, len(*ipConfig.ApplicationSecurityGroups))
+	assert.False(t, reconcileInterfaceIPConfigApplicationSecurityGroup(&ipConfig, asgID, true))
+	assert.True(t, reconcileInterfaceIPConfigApplicationSecurityGroup(&ipConfig, asgID, false))
+	assert.Equal(t, []network.ApplicationSecurityGroup{{ID: to.StringPtr(otherASGID)}}, *ipConfig.ApplicationSecurityGroups)
+	assert.False(t, reconcileInterfaceIPConfigApplicationSecurityGroup(&ipConfig, asgID, false))
+
+	vmssIPConfig := compute.VirtualMachineScaleSetIPConfiguration{
+		VirtualMachineScaleSetIPConfigurationProperties: &compute.VirtualMachineScaleSetIPConfigurationProperties{},
+	}
+	assert.True(t, reconcileVMSSIPConfigApplicationSecurityGroup(&vmssIPConfig, asgID, true))
+	assert.Equal(t, []compute.SubResource{{ID: to.StringPtr(asgID)}}, *vmssIPConfig.ApplicationSecurityGroups)
+	assert.False(t, reconcileVMSSIPConfigApplicationSecurityGroup(&vmssIPConfig, asgID, true))
+	assert.True(t, reconcileVMSSIPConfigApplicationSecurityGroup(&vmssIPConfig, asgID, false))
+	assert.Empty(t, *vmssIPConfig.ApplicationSecurityGroups)
+}
+
+func TestStandardEnsureHostInPoolWithApplicationSecurityGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.ApplicationSecurityGroupMode = consts.ApplicationSecurityGroupModeNodePool
+	backendPoolID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/backendAddressPools/backendpool"
+	nicID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic"
+	testVM := buildDefaultTestVirtualMachine(asID, []string{nicID})
+	testVM.Name = to.StringPtr("vm")
+	testNIC := buildDefaultTestInterface(true, []string{backendPoolID})
+	testNIC.Name = to.StringPtr("nic")
+	testNIC.ID = to.StringPtr(nicID)
+
+	mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().Get(gomock.Any(), "rg", "vm", gomock.Any()).Return(testVM, nil)
+	mockInterfaceClient := az.InterfacesClient.(*mockinterfaceclient.MockInterface)
+	mockInterfaceClient.EXPECT().Get(gomock.Any(), "rg", "nic", gomock.Any()).Return(testNIC, nil)
+	mockASGClient := az.ApplicationSecurityGroupsClient.(*mockapplicationsecuritygroupclient.MockInterface)
+	mockASGClient.EXPECT().Get(gomock.Any(), "rg", "myavailabilityset-asg", gomock.Any()).Return(network.ApplicationSecurityGroup{Name: to.StringPtr("myavailabilityset-asg")}, nil)
+
+	// the NIC is updated to join the application security group although it is in the backend pool
+	mockInterfaceClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nic", gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName, networkInterfaceName string, parameters network.Interface) *retry.Error {
+		ipConfig := (*parameters.IPConfigurations)[0]
+		assert.Equal(t, []network.ApplicationSecurityGroup{{ID: to.StringPtr(az.getApplicationSecurityGroupID("myavailabilityset-asg"))}}, *ipConfig.ApplicationSecurityGroups)
+		assert.Equal(t, 1, len(*ipConfig.LoadBalancerBackendAddressPools))
+		return nil
+	})
+
+	_, _, _, _, err := az.VMSet.EnsureHostInPool(&v1.Service{}, types.NodeName("vm"), backendPoolID, "myAvailabilitySet")
+	assert.NoError(t, err)
+}
+
+func TestGetExpectedSecurityRulesWithApplicationSecurityGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	asgIDs := []string{"/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/vmss-asg"}
+	rules, err := az.getExpectedSecurityRules(true, svc.Spec.Ports, []string{"Internet"}, &svc, []string{"*"}, nil, false, asgIDs)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(rules))
+	assert.Nil(t, rules[0].DestinationAddressPrefix)
+	assert.Nil(t, rules[0].DestinationAddressPrefixes)
+	assert.Equal(t, getApplicationSecurityGroupsByIDs(asgIDs), rules[0].DestinationApplicationSecurityGroups)
+
+	// the rule targeting all destinations is replaced by the one targeting the application security groups
+	existingRule := rules[0]
+	existingRule.SecurityRulePropertiesFormat = &network.SecurityRulePropertiesFormat{}
+	*existingRule.SecurityRulePropertiesFormat = *rules[0].SecurityRulePropertiesFormat
+	existingRule.DestinationApplicationSecurityGroups = nil
+	existingRule.DestinationAddressPrefix = to.StringPtr("*")
+	assert.False(t, findSecurityRule([]network.SecurityRule{existingRule}, rules[0]))
+
+	existingRule.DestinationAddressPrefix = nil
+	existingRule.DestinationApplicationSecurityGroups = &[]network.ApplicationSecurityGroup{{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/VMSS-ASG")}}
+	assert.True(t, findSecurityRule([]network.SecurityRule{existingRule}, rules[0]))
+}
@@ -38,6 +38,7 @@ import (
 
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
 	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
 )
 
@@ -149,6 +150,13 @@ func (az *Cloud) GetIPForMachineWithRetry(name types.NodeName) (string, string,
 
 // CreateOrUpdateSecurityGroup invokes az.SecurityGroupsClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateSecurityGroup(sg network.SecurityGroup) error {
+	if rerr := az.createOrUpdateSecurityGroup(sg); rerr != nil {
+		return rerr.Error()
+	}
+	return nil
+}
+
+func (az *Cloud) createOrUpdateSecurityGroup(sg network.SecurityGroup) *retry.Error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -175,7 +183,7 @@ func (az *Cloud) CreateOrUpdateSecurityGroup(sg network.SecurityGroup) error {
 		_ = az.nsgCache.Delete(*sg.Name)
 	}
 
-	return rerr.Error()
+	return rerr
 }
 
 func cleanupSubnetInFrontendIPConfigurations(lb *network.LoadBalancer) network.LoadBalancer {
@@ -207,9 +215,34 @@ func cleanupSubnetInFrontendIPConfigurations(lb *network.LoadBalancer) network.L
 
 // CreateOrUpdateLB invokes az.LoadBalancerClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer) error {
+	return az.updateLoadBalancer(&loadBalancerUpdate{service: service, lb: lb})
+}
+
+// updateLoadBalancer updates the load balancer with the changes of the service. The concurrent updates of the
+// same load balancer are merged into one update.
+func (az *Cloud) updateLoadBalancer(update *loadBalancerUpdate) error {
+	if az.lbUpdateProcessor == nil {
+		return az.createOrUpdateLBs([]*loadBalancerUpdate{update})[0]
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	// the concurrent updates of the load balancer made by other services are merged into one update
+	key := metrics.KeyFromAttributes(az.SubscriptionID, az.getLoadBalancerResourceGroup(), to.String(update.lb.Name))
+	_, err := az.lbUpdateProcessor.Do(ctx, key, update)
+	return err
+}
+
+// createOrUpdateLB merges the updates of the services into the first one, and updates the load balancer once.
+func (az *Cloud) createOrUpdateLB(updates []*loadBalancerUpdate) error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
+	service, lb := updates[0].service, updates[0].lb
+	for _, update := range updates[1:] {
+		lb = az.mergeLoadBalancerServiceChanges(update, lb)
+	}
 	lb = cleanupSubnetInFrontendIPConfigurations(&lb)
 
 	rgName := az.getLoadBalancerResourceGroup()
@@ -228,6 +261,11 @@ func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer)
 	if rerr.HTTPStatusCode == http.StatusPreconditionFailed {
 		klog.V(3).Infof("LoadBalancer cache for %s is cleanup because of http.StatusPreconditionFailed", to.String(lb.Name))
 		_ = az.lbCache.Delete(*lb.Name)
+
+		// Re-apply the changes of the service onto the latest load balancer, which may be updated by other services.
+		if rerr = az.resolveLoadBalancerConflict(updates, rerr); rerr == nil {
+			return nil
+		}
 	}
 
 	retryErrorMessage := rerr.Error().Error()
@@ -357,7 +395,8 @@ func (az *Cloud) ListManagedLBs(service *v1.Service, nodes []*v1.Node, clusterNa
 	for _, lb := range allLBs {
 		vmSetNameFromLBName := az.mapLoadBalancerNameToVMSet(to.String(lb.Name), clusterName)
 		if strings.EqualFold(strings.TrimSuffix(to.String(lb.Name), consts.InternalLoadBalancerNameSuffix), clusterName) ||
-			agentPoolVMSetNamesSet.Has(strings.ToLower(vmSetNameFromLBName)) {
+			agentPoolVMSetNamesSet.Has(strings.ToLower(vmSetNameFromLBName)) ||
+			az.getMultipleStandardLoadBalancerConfiguration(vmSetNameFromLBName) != nil {
 			agentPoolLBs = append(agentPoolLBs, lb)
 			klog.V(4).Infof("ListManagedLBs: found agent pool LB %s", to.String(lb.Name))
 		}
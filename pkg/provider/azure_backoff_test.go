@@ -248,10 +248,13 @@ func TestCreateOrUpdateLB(t *testing.T) {
 	tests := []struct {
 		clientErr   *retry.Error
 		expectedErr error
+		// the update is retried on the latest load balancer after the etag precondition fails
+		expectedRetries int
 	}{
 		{
-			clientErr:   &retry.Error{HTTPStatusCode: http.StatusPreconditionFailed},
-			expectedErr: fmt.Errorf("Retriable: false, RetryAfter: 0s, HTTPStatusCode: 412, RawError: %w", error(nil)),
+			clientErr:       &retry.Error{HTTPStatusCode: http.StatusPreconditionFailed},
+			expectedErr:     fmt.Errorf("Retriable: false, RetryAfter: 0s, HTTPStatusCode: 412, RawError: %w", error(nil)),
+			expectedRetries: consts.MaxETagConflictRetries,
 		},
 		{
 			clientErr:   &retry.Error{RawError: fmt.Errorf(consts.OperationCanceledErrorMessage)},
@@ -268,8 +271,8 @@ func TestCreateOrUpdateLB(t *testing.T) {
 		az.lbCache.Set("lb", "test")
 
 		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
-		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any(), gomock.Any()).Return(test.clientErr)
-		mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "lb", gomock.Any()).Return(network.LoadBalancer{}, nil)
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any(), gomock.Any()).Return(test.clientErr).Times(1 + test.expectedRetries)
+		mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "lb", gomock.Any()).Return(network.LoadBalancer{}, nil).Times(1 + test.expectedRetries)
 
 		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
 		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "pip", gomock.Any()).Return(nil).AnyTimes()
@@ -0,0 +1,356 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// resolveLoadBalancerConflict retries the update of the load balancer after the etag precondition fails, which
+// happens when the load balancer shared by multiple services is updated concurrently. The frontend IP
+// configurations, load balancing rules and probes of the services are re-applied onto the latest load balancer
+// before each retry. It returns the last error if the conflict is not resolved within the retries.
+func (az *Cloud) resolveLoadBalancerConflict(updates []*loadBalancerUpdate, rerr *retry.Error) *retry.Error {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	lbName := to.String(updates[0].lb.Name)
+	rgName := az.getLoadBalancerResourceGroup()
+	for i := 0; i < consts.MaxETagConflictRetries; i++ {
+		metrics.CountETagConflict(planResourceTypeLoadBalancer)
+
+		latestLB, exists, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeForceRefresh)
+		if err != nil {
+			klog.Errorf("resolveLoadBalancerConflict(%s): failed to get the latest load balancer: %v", lbName, err)
+			break
+		}
+		if !exists {
+			klog.V(2).Infof("resolveLoadBalancerConflict(%s): the load balancer has been deleted", lbName)
+			break
+		}
+
+		mergedLB := latestLB
+		for _, update := range updates {
+			mergedLB = az.mergeLoadBalancerServiceChanges(update, mergedLB)
+		}
+		mergedLB = cleanupSubnetInFrontendIPConfigurations(&mergedLB)
+		klog.V(2).Infof("resolveLoadBalancerConflict(%s): retrying the update of the load balancer for %d service(s) with etag %s (%d/%d)", lbName, len(updates), to.String(latestLB.Etag), i+1, consts.MaxETagConflictRetries)
+		rerr = az.LoadBalancerClient.CreateOrUpdate(ctx, rgName, lbName, mergedLB, to.String(latestLB.Etag))
+		_ = az.lbCache.Delete(lbName)
+		if rerr == nil {
+			metrics.CountETagConflictResolution(planResourceTypeLoadBalancer, true)
+			return nil
+		}
+		if rerr.HTTPStatusCode != http.StatusPreconditionFailed {
+			break
+		}
+	}
+
+	metrics.CountETagConflictResolution(planResourceTypeLoadBalancer, false)
+	return rerr
+}
+
+// loadBalancerSnapshot records the backend pools, outbound rules and frontend IP configurations of the load
+// balancer read by the reconciliation of a service, keyed by the lower-cased names. The changes made by the
+// service are told apart from the ones made by others by comparing its expected load balancer with the snapshot.
+type loadBalancerSnapshot struct {
+	backendPools      map[string]string
+	outboundRules     map[string]string
+	frontendIPConfigs map[string]string
+}
+
+// newLoadBalancerSnapshot records the entries of the load balancer before they are changed.
+func newLoadBalancerSnapshot(lb *network.LoadBalancer) *loadBalancerSnapshot {
+	props := network.LoadBalancerPropertiesFormat{}
+	if lb != nil && lb.LoadBalancerPropertiesFormat != nil {
+		props = *lb.LoadBalancerPropertiesFormat
+	}
+	return &loadBalancerSnapshot{
+		backendPools:      getBackendPoolFingerprints(props.BackendAddressPools),
+		outboundRules:     getOutboundRuleFingerprints(props.OutboundRules),
+		frontendIPConfigs: getFrontendIPConfigFingerprints(props.FrontendIPConfigurations),
+	}
+}
+
+// getLoadBalancerEntryFingerprint returns the serialized entry, which is compared to find the changed entries.
+func getLoadBalancerEntryFingerprint(entry interface{}) string {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func getBackendPoolFingerprints(pools *[]network.BackendAddressPool) map[string]string {
+	fingerprints := make(map[string]string)
+	if pools != nil {
+		for _, pool := range *pools {
+			fingerprints[strings.ToLower(to.String(pool.Name))] = getLoadBalancerEntryFingerprint(pool)
+		}
+	}
+	return fingerprints
+}
+
+func getOutboundRuleFingerprints(rules *[]network.OutboundRule) map[string]string {
+	fingerprints := make(map[string]string)
+	if rules != nil {
+		for _, rule := range *rules {
+			fingerprints[strings.ToLower(to.String(rule.Name))] = getLoadBalancerEntryFingerprint(rule)
+		}
+	}
+	return fingerprints
+}
+
+func getFrontendIPConfigFingerprints(fips *[]network.FrontendIPConfiguration) map[string]string {
+	fingerprints := make(map[string]string)
+	if fips != nil {
+		for _, fip := range *fips {
+			fingerprints[strings.ToLower(to.String(fip.Name))] = getLoadBalancerEntryFingerprint(fip)
+		}
+	}
+	return fingerprints
+}
+
+// getLoadBalancerEntryChanges returns the names of the entries added or updated by the service, and the ones removed
+// by it. Without the snapshot, only the expected entries missing in the latest load balancer are added.
+func getLoadBalancerEntryChanges(snapshot, expected, latest map[string]string) (sets.String, sets.String) {
+	changed, removed := sets.NewString(), sets.NewString()
+	if snapshot == nil {
+		for name := range expected {
+			if _, found := latest[name]; !found {
+				changed.Insert(name)
+			}
+		}
+		return changed, removed
+	}
+
+	for name, fingerprint := range expected {
+		if snapshotFingerprint, found := snapshot[name]; !found || snapshotFingerprint != fingerprint {
+			changed.Insert(name)
+		}
+	}
+	for name := range snapshot {
+		if _, found := expected[name]; !found {
+			removed.Insert(name)
+		}
+	}
+	return changed, removed
+}
+
+// mergeLoadBalancerServiceChanges replaces the frontend IP configurations, load balancing rules and probes owned
+// by the service in the latest load balancer with the ones in the expected load balancer. The backend pools,
+// outbound rules and the other frontend IP configurations added, updated or removed by the service, e.g. the
+// backend pools of the pod IPs and the managed outbound rule, are re-applied as well, and the other properties
+// are kept as they are.
+func (az *Cloud) mergeLoadBalancerServiceChanges(update *loadBalancerUpdate, latestLB network.LoadBalancer) network.LoadBalancer {
+	service, expectedLB := update.service, update.lb
+	owns := func(name *string) bool {
+		return az.serviceOwnsRule(service, to.String(name))
+	}
+	var snapshot loadBalancerSnapshot
+	if update.snapshot != nil {
+		snapshot = *update.snapshot
+	}
+
+	latestProps := network.LoadBalancerPropertiesFormat{}
+	if latestLB.LoadBalancerPropertiesFormat != nil {
+		latestProps = *latestLB.LoadBalancerPropertiesFormat
+	}
+	expectedProps := network.LoadBalancerPropertiesFormat{}
+	if expectedLB.LoadBalancerPropertiesFormat != nil {
+		expectedProps = *expectedLB.LoadBalancerPropertiesFormat
+	}
+	mergedProps := latestProps
+
+	var rules []network.LoadBalancingRule
+	if latestProps.LoadBalancingRules != nil {
+		for _, rule := range *latestProps.LoadBalancingRules {
+			if !owns(rule.Name) {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	// the frontend IP configurations owned by the service may be shared with the rules of the other services
+	referencedFIPIDs := sets.NewString()
+	for _, rule := range rules {
+		if rule.LoadBalancingRulePropertiesFormat != nil && rule.FrontendIPConfiguration != nil {
+			referencedFIPIDs.Insert(strings.ToLower(to.String(rule.FrontendIPConfiguration.ID)))
+		}
+	}
+	if expectedProps.LoadBalancingRules != nil {
+		for _, rule := range *expectedProps.LoadBalancingRules {
+			if owns(rule.Name) {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	mergedProps.LoadBalancingRules = &rules
+
+	var probes []network.Probe
+	if latestProps.Probes != nil {
+		for _, probe := range *latestProps.Probes {
+			if !owns(probe.Name) {
+				probes = append(probes, probe)
+			}
+		}
+	}
+	if expectedProps.Probes != nil {
+		for _, probe := range *expectedProps.Probes {
+			if owns(probe.Name) {
+				probes = append(probes, probe)
+			}
+		}
+	}
+	mergedProps.Probes = &probes
+
+	// the frontend IP configurations not owned by the service, e.g. the ones of the managed outbound rule, are
+	// only replaced if the service changes them
+	changedFIPNames, removedFIPNames := sets.NewString(), sets.NewString()
+	if snapshot.frontendIPConfigs != nil {
+		changedFIPNames, removedFIPNames = getLoadBalancerEntryChanges(snapshot.frontendIPConfigs, getFrontendIPConfigFingerprints(expectedProps.FrontendIPConfigurations), nil)
+	}
+	var fips []network.FrontendIPConfiguration
+	expectedFIPNames := sets.NewString()
+	if expectedProps.FrontendIPConfigurations != nil {
+		for _, fip := range *expectedProps.FrontendIPConfigurations {
+			fipName := strings.ToLower(to.String(fip.Name))
+			if owns(fip.Name) || changedFIPNames.Has(fipName) {
+				fips = append(fips, fip)
+				expectedFIPNames.Insert(fipName)
+			}
+		}
+	}
+	if latestProps.FrontendIPConfigurations != nil {
+		for _, fip := range *latestProps.FrontendIPConfigurations {
+			fipName := strings.ToLower(to.String(fip.Name))
+			if owns(fip.Name) {
+				if !expectedFIPNames.Has(fipName) && referencedFIPIDs.Has(strings.ToLower(to.String(fip.ID))) {
+					fips = append(fips, fip)
+				}
+				continue
+			}
+			if !expectedFIPNames.Has(fipName) && !removedFIPNames.Has(fipName) {
+				fips = append(fips, fip)
+			}
+		}
+	}
+	mergedProps.FrontendIPConfigurations = &fips
+
+	if expectedProps.BackendAddressPools != nil || snapshot.backendPools != nil {
+		changed, removed := getLoadBalancerEntryChanges(snapshot.backendPools, getBackendPoolFingerprints(expectedProps.BackendAddressPools), getBackendPoolFingerprints(latestProps.BackendAddressPools))
+		var pools []network.BackendAddressPool
+		if latestProps.BackendAddressPools != nil {
+			for _, pool := range *latestProps.BackendAddressPools {
+				poolName := strings.ToLower(to.String(pool.Name))
+				if !changed.Has(poolName) && !removed.Has(poolName) {
+					pools = append(pools, pool)
+				}
+			}
+		}
+		if expectedProps.BackendAddressPools != nil {
+			for _, pool := range *expectedProps.BackendAddressPools {
+				if changed.Has(strings.ToLower(to.String(pool.Name))) {
+					pools = append(pools, pool)
+				}
+			}
+		}
+		mergedProps.BackendAddressPools = &pools
+	}
+
+	if expectedProps.OutboundRules != nil || snapshot.outboundRules != nil {
+		changed, removed := getLoadBalancerEntryChanges(snapshot.outboundRules, getOutboundRuleFingerprints(expectedProps.OutboundRules), getOutboundRuleFingerprints(latestProps.OutboundRules))
+		var outboundRules []network.OutboundRule
+		if latestProps.OutboundRules != nil {
+			for _, rule := range *latestProps.OutboundRules {
+				ruleName := strings.ToLower(to.String(rule.Name))
+				if !changed.Has(ruleName) && !removed.Has(ruleName) {
+					outboundRules = append(outboundRules, rule)
+				}
+			}
+		}
+		if expectedProps.OutboundRules != nil {
+			for _, rule := range *expectedProps.OutboundRules {
+				if changed.Has(strings.ToLower(to.String(rule.Name))) {
+					outboundRules = append(outboundRules, rule)
+				}
+			}
+		}
+		mergedProps.OutboundRules = &outboundRules
+	}
+
+	mergedLB := latestLB
+	mergedLB.LoadBalancerPropertiesFormat = &mergedProps
+	return mergedLB
+}
+
+// resolveSecurityGroupConflict retries the update of the security group after the etag precondition fails, which
+// happens when the security group shared by multiple services is updated concurrently. The security rules of the
+// services are re-applied onto the latest security group before each retry. It returns the last error if the
+// conflict is not resolved within the retries.
+func (az *Cloud) resolveSecurityGroupConflict(updates []*securityGroupUpdate, rerr *retry.Error) (*network.SecurityGroup, *retry.Error) {
+	sgName := to.String(updates[0].sg.Name)
+	for i := 0; i < consts.MaxETagConflictRetries; i++ {
+		metrics.CountETagConflict(planResourceTypeSecurityGroup)
+
+		mergedSg, err := az.getSecurityGroup(azcache.CacheReadTypeForceRefresh)
+		if err != nil {
+			klog.Errorf("resolveSecurityGroupConflict(%s): failed to get the latest security group: %v", sgName, err)
+			break
+		}
+		dirtySg := false
+		for _, update := range updates {
+			var dirty bool
+			dirty, mergedSg, err = update.applyChanges(mergedSg)
+			if err != nil {
+				metrics.CountETagConflictResolution(planResourceTypeSecurityGroup, false)
+				return nil, retry.NewError(false, err)
+			}
+			dirtySg = dirtySg || dirty
+		}
+		if !dirtySg {
+			klog.V(2).Infof("resolveSecurityGroupConflict(%s): the latest security group is up to date", sgName)
+			metrics.CountETagConflictResolution(planResourceTypeSecurityGroup, true)
+			return &mergedSg, nil
+		}
+
+		klog.V(2).Infof("resolveSecurityGroupConflict(%s): retrying the update of the security group for %d service(s) with etag %s (%d/%d)", sgName, len(updates), to.String(mergedSg.Etag), i+1, consts.MaxETagConflictRetries)
+		rerr = az.createOrUpdateSecurityGroup(mergedSg)
+		if rerr == nil {
+			metrics.CountETagConflictResolution(planResourceTypeSecurityGroup, true)
+			return &mergedSg, nil
+		}
+		if rerr.HTTPStatusCode != http.StatusPreconditionFailed {
+			break
+		}
+	}
+
+	metrics.CountETagConflictResolution(planResourceTypeSecurityGroup, false)
+	return nil, rerr
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getNames(t *testing.T, resources interface{}) []string {
+	var names []string
+	switch typed := resources.(type) {
+	case *[]network.FrontendIPConfiguration:
+		for _, resource := range *typed {
+			names = append(names, to.String(resource.Name))
+		}
+	case *[]network.LoadBalancingRule:
+		for _, resource := range *typed {
+			names = append(names, to.String(resource.Name))
+		}
+	case *[]network.Probe:
+		for _, resource := range *typed {
+			names = append(names, to.String(resource.Name))
+		}
+	case *[]network.BackendAddressPool:
+		for _, resource := range *typed {
+			names = append(names, to.String(resource.Name))
+		}
+	default:
+		t.Fatalf("unexpected type %T", resources)
+	}
+	return names
+}
+
+func TestMergeLoadBalancerServiceChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	latestLB := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("latest"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{Name: to.StringPtr("aservice1"), ID: to.StringPtr("aservice1-id")},
+				{Name: to.StringPtr("aservice2"), ID: to.StringPtr("aservice2-id")},
+			},
+			LoadBalancingRules: &[]network.LoadBalancingRule{
+				{Name: to.StringPtr("aservice1-TCP-443")},
+				{Name: to.StringPtr("aservice2-TCP-80")},
+			},
+			Probes: &[]network.Probe{
+				{Name: to.StringPtr("aservice1-TCP-443")},
+				{Name: to.StringPtr("aservice2-TCP-80")},
+			},
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: to.StringPtr("testCluster")},
+			},
+		},
+	}
+	expectedLB := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("stale"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{Name: to.StringPtr("aservice1"), ID: to.StringPtr("aservice1-id")},
+			},
+			LoadBalancingRules: &[]network.LoadBalancingRule{
+				{Name: to.StringPtr("aservice1-TCP-80")},
+			},
+			Probes: &[]network.Probe{
+				{Name: to.StringPtr("aservice1-TCP-80")},
+			},
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: to.StringPtr("testCluster")},
+				{Name: to.StringPtr("testCluster-IPv6")},
+			},
+		},
+	}
+
+	mergedLB := az.mergeLoadBalancerServiceChanges(&loadBalancerUpdate{service: &svc, lb: expectedLB}, latestLB)
+	assert.Equal(t, "latest", to.String(mergedLB.Etag))
+	assert.Equal(t, []string{"aservice1", "aservice2"}, getNames(t, mergedLB.FrontendIPConfigurations))
+	assert.Equal(t, []string{"aservice2-TCP-80", "aservice1-TCP-80"}, getNames(t, mergedLB.LoadBalancingRules))
+	assert.Equal(t, []string{"aservice2-TCP-80", "aservice1-TCP-80"}, getNames(t, mergedLB.Probes))
+	assert.Equal(t, []string{"testCluster", "testCluster-IPv6"}, getNames(t, mergedLB.BackendAddressPools))
+	// the latest load balancer should not be changed
+	assert.Equal(t, []string{"aservice1-TCP-443", "aservice2-TCP-80"}, getNames(t, latestLB.LoadBalancingRules))
+
+	// the frontend IP configuration removed by the service is kept if it is used by the other services
+	expectedLB.FrontendIPConfigurations = &[]network.FrontendIPConfiguration{}
+	expectedLB.LoadBalancingRules = &[]network.LoadBalancingRule{}
+	(*latestLB.LoadBalancingRules)[1].LoadBalancingRulePropertiesFormat = &network.LoadBalancingRulePropertiesFormat{
+		FrontendIPConfiguration: &network.SubResource{ID: to.StringPtr("ASERVICE1-ID")},
+	}
+	mergedLB = az.mergeLoadBalancerServiceChanges(&loadBalancerUpdate{service: &svc, lb: expectedLB}, latestLB)
+	assert.Equal(t, []string{"aservice1", "aservice2"}, getNames(t, mergedLB.FrontendIPConfigurations))
+	assert.Equal(t, []string{"aservice2-TCP-80"}, getNames(t, mergedLB.LoadBalancingRules))
+}
+
+func TestResolveLoadBalancerConflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	conflictErr := &retry.Error{HTTPStatusCode: http.StatusPreconditionFailed}
+
+	lb := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("aservice1")}},
+			LoadBalancingRules:       &[]network.LoadBalancingRule{{Name: to.StringPtr("aservice1-TCP-80")}},
+		},
+	}
+	latestLB := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("2"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("aservice2")}},
+			LoadBalancingRules:       &[]network.LoadBalancingRule{{Name: to.StringPtr("aservice2-TCP-80")}},
+		},
+	}
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	gomock.InOrder(
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(conflictErr),
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "lb", gomock.Any()).Return(latestLB, nil),
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "2").DoAndReturn(func(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+			assert.Equal(t, []string{"aservice1", "aservice2"}, getNames(t, parameters.FrontendIPConfigurations))
+			assert.Equal(t, []string{"aservice2-TCP-80", "aservice1-TCP-80"}, getNames(t, parameters.LoadBalancingRules))
+			return nil
+		}),
+	)
+	assert.NoError(t, az.CreateOrUpdateLB(&svc, lb))
+
+	// the last error is returned if the conflict is not resolved within the retries
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), gomock.Any()).Return(conflictErr).Times(1 + consts.MaxETagConflictRetries)
+	mockLBClient.EXPECT().Get(gomock.Any(), "rg", "lb", gomock.Any()).Return(latestLB, nil).Times(consts.MaxETagConflictRetries)
+	assert.Equal(t, conflictErr.Error(), az.CreateOrUpdateLB(&svc, lb))
+}
+
+func TestResolveLoadBalancerConflictOutboundRule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	conflictErr := &retry.Error{HTTPStatusCode: http.StatusPreconditionFailed}
+
+	getOutboundRule := func(name string, allocatedOutboundPorts int32) network.OutboundRule {
+		return network.OutboundRule{
+			Name: to.StringPtr(name),
+			OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+				AllocatedOutboundPorts: to.Int32Ptr(allocatedOutboundPorts),
+			},
+		}
+	}
+	lb := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			OutboundRules: &[]network.OutboundRule{
+				getOutboundRule("kubernetes-outbound-rule", 1024),
+				getOutboundRule("other-outbound-rule", 1024),
+			},
+		},
+	}
+	snapshot := newLoadBalancerSnapshot(&lb)
+	// the service changes the allocated ports of the managed outbound rule
+	(*lb.OutboundRules)[0] = getOutboundRule("kubernetes-outbound-rule", 2048)
+
+	// the other outbound rule is changed by others
+	latestLB := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("2"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			OutboundRules: &[]network.OutboundRule{
+				getOutboundRule("kubernetes-outbound-rule", 1024),
+				getOutboundRule("other-outbound-rule", 512),
+			},
+		},
+	}
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	gomock.InOrder(
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(conflictErr),
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "lb", gomock.Any()).Return(latestLB, nil),
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "2").DoAndReturn(func(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+			allocatedOutboundPorts := make(map[string]int32)
+			for _, rule := range *parameters.OutboundRules {
+				allocatedOutboundPorts[to.String(rule.Name)] = to.Int32(rule.AllocatedOutboundPorts)
+			}
+			assert.Equal(t, map[string]int32{"kubernetes-outbound-rule": 2048, "other-outbound-rule": 512}, allocatedOutboundPorts)
+			return nil
+		}),
+	)
+	assert.NoError(t, az.updateLoadBalancer(&loadBalancerUpdate{service: &svc, lb: lb, snapshot: snapshot}))
+}
+
+func TestResolveLoadBalancerConflictBackendPoolRemoval(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	conflictErr := &retry.Error{HTTPStatusCode: http.StatusPreconditionFailed}
+
+	lb := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("aservice2")}},
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: to.StringPtr("kubernetes")},
+				{Name: to.StringPtr("aservice1")},
+				{Name: to.StringPtr("aservice1-IPv6")},
+			},
+		},
+	}
+	snapshot := newLoadBalancerSnapshot(&lb)
+	// the service removes its backend pools of the pod IPs
+	assert.True(t, az.removeServiceBackendPools(&lb, "kubernetes", &svc))
+
+	// another service adds its backend pool
+	latestLB := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("2"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("aservice2")}},
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: to.StringPtr("kubernetes")},
+				{Name: to.StringPtr("aservice1")},
+				{Name: to.StringPtr("aservice1-IPv6")},
+				{Name: to.StringPtr("aservice2")},
+			},
+		},
+	}
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	gomock.InOrder(
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(conflictErr),
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "lb", gomock.Any()).Return(latestLB, nil),
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "2").DoAndReturn(func(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+			assert.Equal(t, []string{"kubernetes", "aservice2"}, getNames(t, parameters.BackendAddressPools))
+			return nil
+		}),
+	)
+	assert.NoError(t, az.updateLoadBalancer(&loadBalancerUpdate{service: &svc, lb: lb, snapshot: snapshot}))
+}
+
+func TestResolveSecurityGroupConflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	conflictErr := &retry.Error{HTTPStatusCode: http.StatusPreconditionFailed}
+	applyChanges := func(sg network.SecurityGroup) (bool, network.SecurityGroup, error) {
+		if _, _, found := findSecurityRuleByName(*sg.SecurityRules, "aservice1-TCP-80-Internet"); found {
+			return false, sg, nil
+		}
+		rules := append(*sg.SecurityRules, network.SecurityRule{Name: to.StringPtr("aservice1-TCP-80-Internet")})
+		sg.SecurityRules = &rules
+		return true, sg, nil
+	}
+
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	gomock.InOrder(
+		mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(network.SecurityGroup{
+			Name: to.StringPtr("nsg"),
+			Etag: to.StringPtr("2"),
+			SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+				SecurityRules: &[]network.SecurityRule{{Name: to.StringPtr("aservice2-TCP-80-Internet")}},
+			},
+		}, nil),
+		mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), "2").Return(conflictErr),
+		mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(network.SecurityGroup{
+			Name: to.StringPtr("nsg"),
+			Etag: to.StringPtr("3"),
+			SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+				SecurityRules: &[]network.SecurityRule{{Name: to.StringPtr("aservice3-TCP-80-Internet")}},
+			},
+		}, nil),
+		mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), "3").Return(nil),
+	)
+	updates := []*securityGroupUpdate{{serviceName: "default/service1", sg: network.SecurityGroup{Name: to.StringPtr("nsg")}, applyChanges: applyChanges}}
+	sg, rerr := az.resolveSecurityGroupConflict(updates, conflictErr)
+	assert.Nil(t, rerr)
+	assert.Equal(t, "3", to.String(sg.Etag))
+	assert.Equal(t, 2, len(*sg.SecurityRules))
+
+	// no update is needed if the changes of the service are in the latest security group
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		Etag: to.StringPtr("4"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{{Name: to.StringPtr("aservice1-TCP-80-Internet")}},
+		},
+	}, nil)
+	sg, rerr = az.resolveSecurityGroupConflict(updates, conflictErr)
+	assert.Nil(t, rerr)
+	assert.Equal(t, "4", to.String(sg.Etag))
+}
@@ -19,6 +19,7 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
@@ -46,20 +47,31 @@ import (
 // GetLoadBalancer returns whether the specified load balancer and its components exist, and
 // if so, what its status is.
 func (az *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
+	service, shouldHandle := az.applyServiceLoadBalancerClass(service)
+	if !shouldHandle {
+		klog.V(4).Infof("GetLoadBalancer: skipping service %s because its load balancer class %q is not handled by azure", getServiceName(service), to.String(service.Spec.LoadBalancerClass))
+		return nil, false, nil
+	}
+
 	// Since public IP is not a part of the load balancer on Azure,
 	// there is a chance that we could orphan public IP resources while we delete the load blanacer (kubernetes/kubernetes#80571).
 	// We need to make sure the existence of the load balancer depends on the load balancer resource and public IP resource on Azure.
 	existsPip := func() bool {
-		pipName, _, err := az.determinePublicIPName(clusterName, service, nil)
-		if err != nil {
-			return false
-		}
-		pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
-		_, existsPip, err := az.getPublicIPAddress(pipResourceGroup, pipName, azcache.CacheReadTypeDefault)
-		if err != nil {
-			return false
+		for _, isIPv6 := range getServiceIPFamilies(service) {
+			pipName, _, err := az.determinePublicIPName(clusterName, service, nil, isIPv6)
+			if err != nil {
+				continue
+			}
+			pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
+			_, existsPip, err := az.getPublicIPAddress(pipResourceGroup, pipName, azcache.CacheReadTypeDefault)
+			if err != nil {
+				continue
+			}
+			if existsPip {
+				return true
+			}
 		}
-		return existsPip
+		return false
 	}()
 
 	_, status, existsLb, err := az.getServiceLoadBalancer(service, clusterName, nil, false, []network.LoadBalancer{})
@@ -78,7 +90,12 @@ func (az *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, servic
 	return status, true, nil
 }
 
-func getPublicIPDomainNameLabel(service *v1.Service) (string, bool) {
+// getPublicIPDomainNameLabel returns the DNS label of the public IP of the given IP family.
+// The DNS label is only set on the public IP of the primary IP family of the service.
+func getPublicIPDomainNameLabel(service *v1.Service, isIPv6 bool) (string, bool) {
+	if isIPv6 != getServiceIPFamilies(service)[0] {
+		return "", false
+	}
 	if labelName, found := service.Annotations[consts.ServiceAnnotationDNSLabelName]; found {
 		return labelName, found
 	}
@@ -101,11 +118,16 @@ func (az *Cloud) reconcileService(ctx context.Context, clusterName string, servi
 	}
 
 	var serviceIP *string
+	var serviceIPs *[]string
 	if lbStatus != nil && len(lbStatus.Ingress) > 0 {
 		serviceIP = &lbStatus.Ingress[0].IP
+		serviceIPs = &[]string{}
+		for _, ingress := range lbStatus.Ingress {
+			*serviceIPs = append(*serviceIPs, ingress.IP)
+		}
 	}
-	klog.V(2).Infof("reconcileService: reconciling security group for service %q with IP %q, wantLb = true", serviceName, logSafe(serviceIP))
-	if _, err := az.reconcileSecurityGroup(clusterName, service, serviceIP, true /* wantLb */); err != nil {
+	klog.V(2).Infof("reconcileService: reconciling security group for service %q with IPs %q, wantLb = true", serviceName, logSafeCollection(serviceIP, serviceIPs))
+	if _, err := az.reconcileSecurityGroup(clusterName, service, serviceIPs, true /* wantLb */); err != nil {
 		klog.Errorf("reconcileSecurityGroup(%s) failed: %#v", serviceName, err)
 		return nil, err
 	}
@@ -117,12 +139,19 @@ func (az *Cloud) reconcileService(ctx context.Context, clusterName string, servi
 		}
 	}
 
+	// the registrations in the cross-region load balancer are removed before the public frontends of an internal service
+	if err := az.reconcileCrossRegionBackendPool(service, lb, true /* wantLb */); err != nil {
+		klog.Errorf("reconcileCrossRegionBackendPool(%s) failed: %v", serviceName, err)
+		return nil, err
+	}
+
 	updateService := updateServiceLoadBalancerIP(service, to.String(serviceIP))
 	flippedService := flipServiceInternalAnnotation(updateService)
 	if _, err := az.reconcileLoadBalancer(clusterName, flippedService, nil, false /* wantLb */); err != nil {
 		klog.Errorf("reconcileLoadBalancer(%s) failed: %#v", serviceName, err)
 		return nil, err
 	}
+	az.releaseUnusedPoolPrivateIPs(service)
 
 	// lb is not reused here because the ETAG may be changed in above operations, hence reconcilePublicIP() would get lb again from cache.
 	klog.V(2).Infof("reconcileService: reconciling pip")
@@ -131,6 +160,16 @@ func (az *Cloud) reconcileService(ctx context.Context, clusterName string, servi
 		return nil, err
 	}
 
+	if err := az.reconcileDNSRecords(clusterName, service, lbStatus, true /* wantLb */); err != nil {
+		klog.Errorf("reconcileDNSRecords(%s) failed: %v", serviceName, err)
+		return nil, err
+	}
+
+	if err := az.reconcilePrivateDNSRecords(clusterName, service, lbStatus, true /* wantLb */); err != nil {
+		klog.Errorf("reconcilePrivateDNSRecords(%s) failed: %v", serviceName, err)
+		return nil, err
+	}
+
 	return lbStatus, nil
 }
 
@@ -141,6 +180,12 @@ func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 	// Here we'll firstly ensure service do not lie in the opposite LB.
 	var err error
 	serviceName := getServiceName(service)
+	service, shouldHandle := az.applyServiceLoadBalancerClass(service)
+	if !shouldHandle {
+		klog.V(4).Infof("EnsureLoadBalancer: skipping service %s because its load balancer class %q is not handled by azure", serviceName, to.String(service.Spec.LoadBalancerClass))
+		return nil, cloudprovider.ImplementedElsewhere
+	}
+
 	mc := metrics.NewMetricContext("services", "ensure_loadbalancer", az.ResourceGroup, az.SubscriptionID, serviceName)
 	klog.V(5).InfoS("EnsureLoadBalancer Start", "service", serviceName, "cluster", clusterName, "service_spec", service)
 
@@ -151,6 +196,7 @@ func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 	}()
 
 	lbStatus, err := az.reconcileService(ctx, clusterName, service, nodes)
+	az.updateServiceStatus(ctx, service, err)
 	if err != nil {
 		return nil, err
 	}
@@ -163,6 +209,12 @@ func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
 	var err error
 	serviceName := getServiceName(service)
+	service, shouldHandle := az.applyServiceLoadBalancerClass(service)
+	if !shouldHandle {
+		klog.V(4).Infof("UpdateLoadBalancer: skipping service %s because its load balancer class %q is not handled by azure", serviceName, to.String(service.Spec.LoadBalancerClass))
+		return cloudprovider.ImplementedElsewhere
+	}
+
 	mc := metrics.NewMetricContext("services", "update_loadbalancer", az.ResourceGroup, az.SubscriptionID, serviceName)
 	klog.V(5).InfoS("UpdateLoadBalancer Start", "service", serviceName, "cluster", clusterName, "service_spec", service)
 	isOperationSucceeded := false
@@ -183,6 +235,7 @@ func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, ser
 	}
 
 	_, err = az.reconcileService(ctx, clusterName, service, nodes)
+	az.updateServiceStatus(ctx, service, err)
 	if err != nil {
 		return err
 	}
@@ -199,8 +252,14 @@ func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, ser
 // doesn't exist even if some part of it is still laying around.
 func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
 	var err error
-	isInternal := requiresInternalLoadBalancer(service)
 	serviceName := getServiceName(service)
+	service, shouldHandle := az.applyServiceLoadBalancerClass(service)
+	if !shouldHandle {
+		klog.V(4).Infof("EnsureLoadBalancerDeleted: skipping service %s because its load balancer class %q is not handled by azure", serviceName, to.String(service.Spec.LoadBalancerClass))
+		return nil
+	}
+
+	isInternal := requiresInternalLoadBalancer(service)
 	mc := metrics.NewMetricContext("services", "ensure_loadbalancer_deleted", az.ResourceGroup, az.SubscriptionID, serviceName)
 	klog.V(5).InfoS("EnsureLoadBalancerDeleted Start", "service", serviceName, "cluster", clusterName, "service_spec", service)
 	isOperationSucceeded := false
@@ -209,17 +268,33 @@ func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName stri
 		klog.V(5).InfoS("EnsureLoadBalancerDeleted Finish", "service", serviceName, "cluster", clusterName, "service_spec", service, "error", err)
 	}()
 
-	serviceIPToCleanup, err := az.findServiceIPAddress(ctx, clusterName, service, isInternal)
+	serviceIPsToCleanup, err := az.findServiceIPAddresses(ctx, clusterName, service, isInternal)
 	if err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
 		return err
 	}
 
-	klog.V(2).Infof("EnsureLoadBalancerDeleted: reconciling security group for service %q with IP %q, wantLb = false", serviceName, serviceIPToCleanup)
-	_, err = az.reconcileSecurityGroup(clusterName, service, &serviceIPToCleanup, false /* wantLb */)
+	klog.V(2).Infof("EnsureLoadBalancerDeleted: reconciling security group for service %q with IPs %q, wantLb = false", serviceName, serviceIPsToCleanup)
+	_, err = az.reconcileSecurityGroup(clusterName, service, &serviceIPsToCleanup, false /* wantLb */)
 	if err != nil {
 		return err
 	}
 
+	err = az.reconcileDNSRecords(clusterName, service, nil, false /* wantLb */)
+	if err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
+		return err
+	}
+
+	err = az.reconcilePrivateDNSRecords(clusterName, service, nil, false /* wantLb */)
+	if err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
+		return err
+	}
+
+	// the frontends registered in the cross-region load balancer can't be deleted
+	err = az.reconcileCrossRegionBackendPool(service, nil, false /* wantLb */)
+	if err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
+		return err
+	}
+
 	_, err = az.reconcileLoadBalancer(clusterName, service, nil, false /* wantLb */)
 	if err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
 		return err
@@ -230,6 +305,8 @@ func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName stri
 		return err
 	}
 
+	az.releasePoolPrivateIPs(service, serviceIPsToCleanup)
+
 	klog.V(2).Infof("Delete service (%s): FINISH", serviceName)
 	isOperationSucceeded = true
 
@@ -253,6 +330,16 @@ func (az *Cloud) getLoadBalancerResourceGroup() string {
 // according to the mode annotation on the service. This could be happened when the LB selection mode of an
 // existing service is changed to another VMSS/VMAS.
 func (az *Cloud) shouldChangeLoadBalancer(service *v1.Service, currLBName, clusterName string) bool {
+	// if the services are placed by the multiple standard load balancer configurations,
+	// the current LB should be kept if the service can still be placed on it
+	if az.useMultipleStandardLoadBalancerConfigurations() {
+		if az.isLoadBalancerEligibleForService(service, currLBName) {
+			return false
+		}
+		klog.V(2).Infof("shouldChangeLoadBalancer(%s, %s, %s): change the LB to another one", service.Name, currLBName, clusterName)
+		return true
+	}
+
 	hasMode, isAuto, vmSetName := az.getServiceLoadBalancerMode(service)
 
 	// if no mode is given or the mode is `__auto__`, the current LB should be kept
@@ -295,25 +382,33 @@ func (az *Cloud) shouldChangeLoadBalancer(service *v1.Service, currLBName, clust
 	return true
 }
 
-func (az *Cloud) removeFrontendIPConfigurationFromLoadBalancer(lb *network.LoadBalancer, existingLBs []network.LoadBalancer, fip *network.FrontendIPConfiguration, clusterName string, service *v1.Service) error {
+func (az *Cloud) removeFrontendIPConfigurationFromLoadBalancer(lb *network.LoadBalancer, existingLBs []network.LoadBalancer, fips []*network.FrontendIPConfiguration, clusterName string, service *v1.Service) error {
 	if lb == nil || lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
 		return nil
 	}
 	fipConfigs := *lb.FrontendIPConfigurations
-	for i, fipConfig := range fipConfigs {
-		if strings.EqualFold(to.String(fipConfig.Name), to.String(fip.Name)) {
-			fipConfigs = append(fipConfigs[:i], fipConfigs[i+1:]...)
-			break
+	fipNames := make([]string, 0, len(fips))
+	for _, fip := range fips {
+		for i, fipConfig := range fipConfigs {
+			if strings.EqualFold(to.String(fipConfig.Name), to.String(fip.Name)) {
+				fipConfigs = append(fipConfigs[:i], fipConfigs[i+1:]...)
+				break
+			}
 		}
+		fipNames = append(fipNames, to.String(fip.Name))
 	}
 	lb.FrontendIPConfigurations = &fipConfigs
+	fipNamesStr := strings.Join(fipNames, ",")
 
 	// also remove the corresponding rules/probes
 	if lb.LoadBalancingRules != nil {
 		lbRules := *lb.LoadBalancingRules
 		for i := len(lbRules) - 1; i >= 0; i-- {
-			if strings.Contains(to.String(lbRules[i].Name), to.String(fip.Name)) {
-				lbRules = append(lbRules[:i], lbRules[i+1:]...)
+			for _, fipName := range fipNames {
+				if strings.Contains(to.String(lbRules[i].Name), fipName) {
+					lbRules = append(lbRules[:i], lbRules[i+1:]...)
+					break
+				}
 			}
 		}
 		lb.LoadBalancingRules = &lbRules
@@ -321,32 +416,37 @@ func (az *Cloud) removeFrontendIPConfigurationFromLoadBalancer(lb *network.LoadB
 	if lb.Probes != nil {
 		lbProbes := *lb.Probes
 		for i := len(lbProbes) - 1; i >= 0; i-- {
-			if strings.Contains(to.String(lbProbes[i].Name), to.String(fip.Name)) {
-				lbProbes = append(lbProbes[:i], lbProbes[i+1:]...)
+			for _, fipName := range fipNames {
+				if strings.Contains(to.String(lbProbes[i].Name), fipName) {
+					lbProbes = append(lbProbes[:i], lbProbes[i+1:]...)
+					break
+				}
 			}
 		}
 		lb.Probes = &lbProbes
 	}
 
 	// clean up any private link service associated with the frontEndIPConfig
-	err := az.reconcilePrivateLinkService(clusterName, service, fip, false /* wantPLS */)
-	if err != nil {
-		klog.Errorf("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): failed to clean up PLS: %v", to.String(lb.Name), to.String(fip.Name), clusterName, service.Name, err)
-		return err
+	for _, fip := range fips {
+		err := az.reconcilePrivateLinkService(clusterName, service, fip, false /* wantPLS */)
+		if err != nil {
+			klog.Errorf("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): failed to clean up PLS: %v", to.String(lb.Name), to.String(fip.Name), clusterName, service.Name, err)
+			return err
+		}
 	}
 
 	if len(fipConfigs) == 0 {
-		klog.V(2).Infof("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): deleting load balancer because there is no remaining frontend IP configurations", to.String(lb.Name), to.String(fip.Name), clusterName, service.Name)
+		klog.V(2).Infof("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): deleting load balancer because there is no remaining frontend IP configurations", to.String(lb.Name), fipNamesStr, clusterName, service.Name)
 		err := az.cleanOrphanedLoadBalancer(lb, existingLBs, service, clusterName)
 		if err != nil {
-			klog.Errorf("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): failed to cleanupOrphanedLoadBalancer: %v", to.String(lb.Name), to.String(fip.Name), clusterName, service.Name, err)
+			klog.Errorf("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): failed to cleanupOrphanedLoadBalancer: %v", to.String(lb.Name), fipNamesStr, clusterName, service.Name, err)
 			return err
 		}
 	} else {
-		klog.V(2).Infof("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): updating the load balancer", to.String(lb.Name), to.String(fip.Name), clusterName, service.Name)
+		klog.V(2).Infof("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): updating the load balancer", to.String(lb.Name), fipNamesStr, clusterName, service.Name)
 		err := az.CreateOrUpdateLB(service, *lb)
 		if err != nil {
-			klog.Errorf("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): failed to CreateOrUpdateLB: %v", to.String(lb.Name), to.String(fip.Name), clusterName, service.Name, err)
+			klog.Errorf("removeFrontendIPConfigurationFromLoadBalancer(%s, %s, %s, %s): failed to CreateOrUpdateLB: %v", to.String(lb.Name), fipNamesStr, clusterName, service.Name, err)
 			return err
 		}
 		_ = az.lbCache.Delete(to.String(lb.Name))
@@ -359,8 +459,7 @@ func (az *Cloud) cleanOrphanedLoadBalancer(lb *network.LoadBalancer, existingLBs
 	serviceName := getServiceName(service)
 	isBackendPoolPreConfigured := az.isBackendPoolPreConfigured(service)
 	lbResourceGroup := az.getLoadBalancerResourceGroup()
-	lbBackendPoolName := getBackendPoolName(clusterName, service)
-	lbBackendPoolID := az.getBackendPoolID(lbName, lbResourceGroup, lbBackendPoolName)
+	lbBackendPoolIDs := az.getBackendPoolIDsOfLoadBalancer(lb, lbResourceGroup, clusterName)
 	if isBackendPoolPreConfigured {
 		klog.V(2).Infof("cleanOrphanedLoadBalancer(%s, %s, %s): ignore cleanup of dirty lb because the lb is pre-configured", lbName, serviceName, clusterName)
 	} else {
@@ -412,10 +511,12 @@ func (az *Cloud) cleanOrphanedLoadBalancer(lb *network.LoadBalancer, existingLBs
 			}
 
 			vmssNamesMap := map[string]bool{vmssName: true}
-			err := az.VMSet.EnsureBackendPoolDeletedFromVMSets(vmssNamesMap, lbBackendPoolID)
-			if err != nil {
-				klog.Errorf("cleanOrphanedLoadBalancer(%s, %s, %s): failed to EnsureBackendPoolDeletedFromVMSets: %v", lbName, serviceName, clusterName, err)
-				return err
+			for _, lbBackendPoolID := range lbBackendPoolIDs {
+				err := az.VMSet.EnsureBackendPoolDeletedFromVMSets(vmssNamesMap, lbBackendPoolID)
+				if err != nil {
+					klog.Errorf("cleanOrphanedLoadBalancer(%s, %s, %s): failed to EnsureBackendPoolDeletedFromVMSets: %v", lbName, serviceName, clusterName, err)
+					return err
+				}
 			}
 
 			deleteErr := az.DeleteLB(service, lbName)
@@ -429,13 +530,29 @@ func (az *Cloud) cleanOrphanedLoadBalancer(lb *network.LoadBalancer, existingLBs
 	return nil
 }
 
+// getBackendPoolIDsOfLoadBalancer returns the IDs of the cluster backend pools of both IP families
+// that exist in the load balancer. The IPv4 backend pool is always included.
+func (az *Cloud) getBackendPoolIDsOfLoadBalancer(lb *network.LoadBalancer, lbResourceGroup, clusterName string) []string {
+	lbBackendPoolNames := getBackendPoolNames(clusterName)
+	lbBackendPoolIDs := []string{az.getBackendPoolID(to.String(lb.Name), lbResourceGroup, lbBackendPoolNames[false])}
+	if lb.LoadBalancerPropertiesFormat != nil && lb.BackendAddressPools != nil {
+		for _, bp := range *lb.BackendAddressPools {
+			if strings.EqualFold(to.String(bp.Name), lbBackendPoolNames[true]) {
+				lbBackendPoolIDs = append(lbBackendPoolIDs, az.getBackendPoolID(to.String(lb.Name), lbResourceGroup, lbBackendPoolNames[true]))
+			}
+		}
+	}
+	return lbBackendPoolIDs
+}
+
 // safeDeleteLoadBalancer deletes the load balancer after decoupling it from the vmSet
 func (az *Cloud) safeDeleteLoadBalancer(lb network.LoadBalancer, clusterName, vmSetName string, service *v1.Service) *retry.Error {
 	if isLBBackendPoolTypeIPConfig(service, &lb, clusterName) {
-		lbBackendPoolID := az.getBackendPoolID(to.String(lb.Name), az.getLoadBalancerResourceGroup(), getBackendPoolName(clusterName, service))
-		err := az.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, lb.BackendAddressPools, true)
-		if err != nil {
-			return retry.NewError(false, fmt.Errorf("safeDeleteLoadBalancer: failed to EnsureBackendPoolDeleted: %w", err))
+		for _, lbBackendPoolID := range az.getBackendPoolIDsOfLoadBalancer(&lb, az.getLoadBalancerResourceGroup(), clusterName) {
+			err := az.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, lb.BackendAddressPools, true)
+			if err != nil {
+				return retry.NewError(false, fmt.Errorf("safeDeleteLoadBalancer: failed to EnsureBackendPoolDeleted: %w", err))
+			}
 		}
 	}
 
@@ -565,6 +682,12 @@ func (az *Cloud) getServiceLoadBalancer(service *v1.Service, clusterName string,
 		// for the primary standard load balancer (internal or external), when enabled multiple slbs
 		if strings.EqualFold(existingLBNamePrefix, clusterName) && useMultipleSLBs {
 			shouldRemoveVMSetFromSLB := func(vmSetName string) bool {
+				// not removing the vmSet from the primary SLB if it is
+				// in the configuration of the primary SLB.
+				if lbConfig := az.getMultipleStandardLoadBalancerConfiguration(primaryVMSetName); lbConfig != nil {
+					return !lbConfig.hasNodePool(vmSetName) && vmSetName != ""
+				}
+
 				// not removing the vmSet from the primary SLB
 				// if it is supposed to share the primary SLB.
 				if az.getVMSetNamesSharingPrimarySLB().Has(strings.ToLower(vmSetName)) {
@@ -592,8 +715,7 @@ func (az *Cloud) getServiceLoadBalancer(service *v1.Service, clusterName string,
 		if isInternalLoadBalancer(&existingLB) != isInternal {
 			continue
 		}
-		var fipConfig *network.FrontendIPConfiguration
-		status, fipConfig, err = az.getServiceLoadBalancerStatus(service, &existingLB, pips)
+		status, _, err = az.getServiceLoadBalancerStatus(service, &existingLB, pips)
 		if err != nil {
 			return nil, nil, false, err
 		}
@@ -606,7 +728,11 @@ func (az *Cloud) getServiceLoadBalancer(service *v1.Service, clusterName string,
 		// select another load balancer instead of returning
 		// the current one if the change is needed
 		if wantLb && az.shouldChangeLoadBalancer(service, to.String(existingLB.Name), clusterName) {
-			if err := az.removeFrontendIPConfigurationFromLoadBalancer(&existingLB, existingLBs, fipConfig, clusterName, service); err != nil {
+			fipConfigs, err := az.findFrontendIPConfigsOfService(existingLB.FrontendIPConfigurations, service, pips)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			if err := az.removeFrontendIPConfigurationFromLoadBalancer(&existingLB, existingLBs, fipConfigs, clusterName, service); err != nil {
 				klog.Errorf("getServiceLoadBalancer(%s, %s, %v): failed to remove frontend IP configuration from load balancer: %v", service.Name, clusterName, wantLb, err)
 				return nil, nil, false, err
 			}
@@ -658,6 +784,10 @@ func (az *Cloud) getServiceLoadBalancer(service *v1.Service, clusterName string,
 // the minimum lb rules. If there are multiple LBs with same number of rules,
 // then selects the first one (sorted based on name).
 func (az *Cloud) selectLoadBalancer(clusterName string, service *v1.Service, existingLBs *[]network.LoadBalancer, nodes []*v1.Node) (selectedLB *network.LoadBalancer, existsLb bool, err error) {
+	if az.useMultipleStandardLoadBalancerConfigurations() {
+		return az.selectLoadBalancerByConfigurations(clusterName, service, existingLBs)
+	}
+
 	isInternal := requiresInternalLoadBalancer(service)
 	serviceName := getServiceName(service)
 	klog.V(2).Infof("selectLoadBalancer for service (%s): isInternal(%v) - start", serviceName, isInternal)
@@ -678,27 +808,7 @@ func (az *Cloud) selectLoadBalancer(clusterName string, service *v1.Service, exi
 		lb, exists := mapExistingLBs[currLBName]
 		if !exists {
 			// select this LB as this is a new LB and will have minimum rules
-			// create tmp lb struct to hold metadata for the new load-balancer
-			var loadBalancerSKU network.LoadBalancerSkuName
-			if az.useStandardLoadBalancer() {
-				loadBalancerSKU = network.LoadBalancerSkuNameStandard
-			} else {
-				loadBalancerSKU = network.LoadBalancerSkuNameBasic
-			}
-			selectedLB = &network.LoadBalancer{
-				Name:                         &currLBName,
-				Location:                     &az.Location,
-				Sku:                          &network.LoadBalancerSku{Name: loadBalancerSKU},
-				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
-			}
-			if az.HasExtendedLocation() {
-				selectedLB.ExtendedLocation = &network.ExtendedLocation{
-					Name: &az.ExtendedLocationName,
-					Type: getExtendedLocationTypeFromString(az.ExtendedLocationType),
-				}
-			}
-
-			return selectedLB, false, nil
+			return az.newLoadBalancerWithMetadata(currLBName), false, nil
 		}
 
 		lbRules := *lb.LoadBalancingRules
@@ -718,7 +828,7 @@ func (az *Cloud) selectLoadBalancer(clusterName string, service *v1.Service, exi
 		return nil, false, err
 	}
 	// validate if the selected LB has not exceeded the MaximumLoadBalancerRuleCount
-	if az.Config.MaximumLoadBalancerRuleCount != 0 && selectedLBRuleCount >= az.Config.MaximumLoadBalancerRuleCount {
+	if az.Config.MaximumLoadBalancerRuleCount != 0 && selectedLBRuleCount+az.getExpectedLBRuleCount(service) > az.Config.MaximumLoadBalancerRuleCount {
 		err = fmt.Errorf("selectLoadBalancer: cluster(%s) service(%s) isInternal(%t) -  all available load balancers have exceeded maximum rule limit %d, vmSetNames (%v)", clusterName, serviceName, isInternal, selectedLBRuleCount, *vmSetNames)
 		klog.Error(err)
 		return selectedLB, existsLb, err
@@ -727,6 +837,31 @@ func (az *Cloud) selectLoadBalancer(clusterName string, service *v1.Service, exi
 	return selectedLB, existsLb, nil
 }
 
+// newLoadBalancerWithMetadata creates a tmp lb struct to hold metadata for the new load-balancer.
+func (az *Cloud) newLoadBalancerWithMetadata(lbName string) *network.LoadBalancer {
+	var loadBalancerSKU network.LoadBalancerSkuName
+	if az.useStandardLoadBalancer() {
+		loadBalancerSKU = network.LoadBalancerSkuNameStandard
+	} else {
+		loadBalancerSKU = network.LoadBalancerSkuNameBasic
+	}
+	lb := &network.LoadBalancer{
+		Name:                         &lbName,
+		Location:                     &az.Location,
+		Sku:                          &network.LoadBalancerSku{Name: loadBalancerSKU},
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+	if az.HasExtendedLocation() {
+		lb.ExtendedLocation = &network.ExtendedLocation{
+			Name: &az.ExtendedLocationName,
+			Type: getExtendedLocationTypeFromString(az.ExtendedLocationType),
+		}
+	}
+	return lb
+}
+
+// getServiceLoadBalancerStatus returns the ingress IPs of all the IP families of the service, with the
+// ones of the primary IP family first, and the frontend IP config of the primary IP family.
 func (az *Cloud) getServiceLoadBalancerStatus(service *v1.Service, lb *network.LoadBalancer, pips *[]network.PublicIPAddress) (status *v1.LoadBalancerStatus, fipConfig *network.FrontendIPConfiguration, err error) {
 	if lb == nil {
 		klog.V(10).Info("getServiceLoadBalancerStatus: lb is nil")
@@ -738,75 +873,82 @@ func (az *Cloud) getServiceLoadBalancerStatus(service *v1.Service, lb *network.L
 	}
 	isInternal := requiresInternalLoadBalancer(service)
 	serviceName := getServiceName(service)
-	for _, ipConfiguration := range *lb.FrontendIPConfigurations {
-		owns, isPrimaryService, err := az.serviceOwnsFrontendIP(ipConfiguration, service, pips)
+	var lbIngress []v1.LoadBalancerIngress
+	for _, isIPv6 := range getServiceIPFamilies(service) {
+		ipConfiguration, err := az.findFrontendIPConfigOfService(lb.FrontendIPConfigurations, service, pips, isIPv6)
 		if err != nil {
 			return nil, nil, fmt.Errorf("get(%s): lb(%s) - failed to filter frontend IP configs with error: %w", serviceName, to.String(lb.Name), err)
 		}
-		if owns {
-			klog.V(2).Infof("get(%s): lb(%s) - found frontend IP config, primary service: %v", serviceName, to.String(lb.Name), isPrimaryService)
+		if ipConfiguration == nil {
+			continue
+		}
+		klog.V(2).Infof("get(%s): lb(%s) - found frontend IP config %s", serviceName, to.String(lb.Name), to.String(ipConfiguration.Name))
 
-			var lbIP *string
-			if isInternal {
-				lbIP = ipConfiguration.PrivateIPAddress
-			} else {
-				if ipConfiguration.PublicIPAddress == nil {
-					return nil, nil, fmt.Errorf("get(%s): lb(%s) - failed to get LB PublicIPAddress is Nil", serviceName, *lb.Name)
-				}
-				pipID := ipConfiguration.PublicIPAddress.ID
-				if pipID == nil {
-					return nil, nil, fmt.Errorf("get(%s): lb(%s) - failed to get LB PublicIPAddress ID is Nil", serviceName, *lb.Name)
-				}
-				pipName, err := getLastSegment(*pipID, "/")
-				if err != nil {
-					return nil, nil, fmt.Errorf("get(%s): lb(%s) - failed to get LB PublicIPAddress Name from ID(%s)", serviceName, *lb.Name, *pipID)
-				}
-				pip, existsPip, err := az.getPublicIPAddress(az.getPublicIPAddressResourceGroup(service), pipName, azcache.CacheReadTypeDefault)
-				if err != nil {
-					return nil, nil, err
-				}
-				if existsPip {
-					lbIP = pip.IPAddress
-				}
+		var lbIP *string
+		if isInternal {
+			lbIP = ipConfiguration.PrivateIPAddress
+		} else {
+			if ipConfiguration.PublicIPAddress == nil {
+				return nil, nil, fmt.Errorf("get(%s): lb(%s) - failed to get LB PublicIPAddress is Nil", serviceName, *lb.Name)
 			}
-
-			klog.V(2).Infof("getServiceLoadBalancerStatus gets ingress IP %q from frontendIPConfiguration %q for service %q", to.String(lbIP), to.String(ipConfiguration.Name), serviceName)
-
-			// set additional public IPs to LoadBalancerStatus, so that kube-proxy would create their iptables rules.
-			lbIngress := []v1.LoadBalancerIngress{{IP: to.String(lbIP)}}
-			additionalIPs, err := getServiceAdditionalPublicIPs(service)
+			pipID := ipConfiguration.PublicIPAddress.ID
+			if pipID == nil {
+				return nil, nil, fmt.Errorf("get(%s): lb(%s) - failed to get LB PublicIPAddress ID is Nil", serviceName, *lb.Name)
+			}
+			pipName, err := getLastSegment(*pipID, "/")
 			if err != nil {
-				return &v1.LoadBalancerStatus{Ingress: lbIngress}, &ipConfiguration, err
+				return nil, nil, fmt.Errorf("get(%s): lb(%s) - failed to get LB PublicIPAddress Name from ID(%s)", serviceName, *lb.Name, *pipID)
 			}
-			if len(additionalIPs) > 0 {
-				for _, pip := range additionalIPs {
-					lbIngress = append(lbIngress, v1.LoadBalancerIngress{
-						IP: pip,
-					})
-				}
+			pip, existsPip, err := az.getPublicIPAddress(az.getPublicIPAddressResourceGroup(service), pipName, azcache.CacheReadTypeDefault)
+			if err != nil {
+				return nil, nil, err
+			}
+			if existsPip {
+				lbIP = pip.IPAddress
 			}
+		}
 
-			return &v1.LoadBalancerStatus{Ingress: lbIngress}, &ipConfiguration, nil
+		klog.V(2).Infof("getServiceLoadBalancerStatus gets ingress IP %q from frontendIPConfiguration %q for service %q", to.String(lbIP), to.String(ipConfiguration.Name), serviceName)
+		lbIngress = append(lbIngress, v1.LoadBalancerIngress{IP: to.String(lbIP)})
+		if fipConfig == nil {
+			fipConfig = ipConfiguration
 		}
 	}
+	if fipConfig == nil {
+		return nil, nil, nil
+	}
 
-	return nil, nil, nil
+	// set additional public IPs to LoadBalancerStatus, so that kube-proxy would create their iptables rules.
+	additionalIPs, err := getServiceAdditionalPublicIPs(service)
+	if err != nil {
+		return &v1.LoadBalancerStatus{Ingress: lbIngress}, fipConfig, err
+	}
+	if len(additionalIPs) > 0 {
+		for _, pip := range additionalIPs {
+			lbIngress = append(lbIngress, v1.LoadBalancerIngress{
+				IP: pip,
+			})
+		}
+	}
+
+	return &v1.LoadBalancerStatus{Ingress: lbIngress}, fipConfig, nil
 }
 
-func (az *Cloud) determinePublicIPName(clusterName string, service *v1.Service, pips *[]network.PublicIPAddress) (string, bool, error) {
+func (az *Cloud) determinePublicIPName(clusterName string, service *v1.Service, pips *[]network.PublicIPAddress, isIPv6 bool) (string, bool, error) {
 	var shouldPIPExisted bool
-	if name, found := service.Annotations[consts.ServiceAnnotationPIPName]; found && name != "" {
+	// the public IP name annotation only applies to the primary IP family of the service
+	if name, found := service.Annotations[consts.ServiceAnnotationPIPName]; found && name != "" && isIPv6 == getServiceIPFamilies(service)[0] {
 		shouldPIPExisted = true
 		return name, shouldPIPExisted, nil
 	}
 
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
-	loadBalancerIP := service.Spec.LoadBalancerIP
+	loadBalancerIP := getServiceLoadBalancerIP(service, isIPv6)
 
 	// Assume that the service without loadBalancerIP set is a primary service.
 	// If a secondary service doesn't set the loadBalancerIP, it is not allowed to share the IP.
 	if len(loadBalancerIP) == 0 {
-		return az.getPublicIPName(clusterName, service), shouldPIPExisted, nil
+		return az.getPublicIPName(clusterName, service, isIPv6), shouldPIPExisted, nil
 	}
 
 	// For the services with loadBalancerIP set, an existing public IP is required, primary
@@ -864,32 +1006,41 @@ func updateServiceLoadBalancerIP(service *v1.Service, serviceIP string) *v1.Serv
 	return copyService
 }
 
-func (az *Cloud) findServiceIPAddress(ctx context.Context, clusterName string, service *v1.Service, isInternalLb bool) (string, error) {
+// findServiceIPAddresses returns the IP addresses of all the IP families of the service.
+func (az *Cloud) findServiceIPAddresses(ctx context.Context, clusterName string, service *v1.Service, isInternalLb bool) ([]string, error) {
+	var serviceIPs []string
 	if len(service.Spec.LoadBalancerIP) > 0 {
-		return service.Spec.LoadBalancerIP, nil
+		serviceIPs = append(serviceIPs, service.Spec.LoadBalancerIP)
 	}
-
-	if len(service.Status.LoadBalancer.Ingress) > 0 && len(service.Status.LoadBalancer.Ingress[0].IP) > 0 {
-		return service.Status.LoadBalancer.Ingress[0].IP, nil
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if _, found := findIndex(serviceIPs, ingress.IP); len(ingress.IP) > 0 && !found {
+			serviceIPs = append(serviceIPs, ingress.IP)
+		}
+	}
+	if len(serviceIPs) > 0 {
+		return serviceIPs, nil
 	}
 
 	_, lbStatus, existsLb, err := az.getServiceLoadBalancer(service, clusterName, nil, false, []network.LoadBalancer{})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if !existsLb {
 		klog.V(2).Infof("Expected to find an IP address for service %s but did not. Assuming it has been removed", service.Name)
-		return "", nil
+		return nil, nil
 	}
 	if len(lbStatus.Ingress) < 1 {
 		klog.V(2).Infof("Expected to find an IP address for service %s but it had no ingresses. Assuming it has been removed", service.Name)
-		return "", nil
+		return nil, nil
 	}
 
-	return lbStatus.Ingress[0].IP, nil
+	for _, ingress := range lbStatus.Ingress {
+		serviceIPs = append(serviceIPs, ingress.IP)
+	}
+	return serviceIPs, nil
 }
 
-func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domainNameLabel, clusterName string, shouldPIPExisted, foundDNSLabelAnnotation bool) (*network.PublicIPAddress, error) {
+func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domainNameLabel, clusterName string, shouldPIPExisted, foundDNSLabelAnnotation, isIPv6 bool) (*network.PublicIPAddress, error) {
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
 	pip, existsPip, err := az.getPublicIPAddress(pipResourceGroup, pipName, azcache.CacheReadTypeDefault)
 	if err != nil {
@@ -902,12 +1053,24 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 	if existsPip {
 		// ensure that the service tag is good for managed pips
 		owns, isUserAssignedPIP := serviceOwnsPublicIP(service, &pip, clusterName)
+		var reclaimed bool
+		if isRetainedPublicIP(&pip) {
+			// the retained pip can only be reclaimed by the services of the same cluster. The one of the default
+			// name is reclaimed by the service retaining it, e.g. after its type is changed back to LoadBalancer.
+			if clusterTag := getClusterFromPIPClusterTags(pip.Tags); clusterTag != clusterName {
+				return nil, fmt.Errorf("ensurePublicIPExists for service(%s): pip(%s) is retained by cluster %s", serviceName, pipName, clusterTag)
+			}
+			klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - reclaiming the retained pip", serviceName, pipName)
+			reclaimed = reclaimRetainedPublicIP(&pip)
+			owns, isUserAssignedPIP = true, false
+		}
 		if owns && !isUserAssignedPIP {
 			changed, err = bindServicesToPIP(&pip, []string{serviceName}, false)
 			if err != nil {
 				return nil, err
 			}
 		}
+		changed = changed || reclaimed
 
 		if pip.Tags == nil {
 			pip.Tags = make(map[string]*string)
@@ -979,16 +1142,39 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 				Name: network.PublicIPAddressSkuNameStandard,
 			}
 
+			// the zones requested by the service take precedence
+			zones, requested, err := az.getServiceZones(service)
+			if err != nil {
+				return nil, err
+			}
 			// skip adding zone info since edge zones doesn't support multiple availability zones.
-			if !az.HasExtendedLocation() {
+			if !requested && !az.HasExtendedLocation() {
 				// only add zone information for the new standard pips
-				zones, err := az.getRegionZonesBackoff(to.String(pip.Location))
+				zones, err = az.getRegionZonesBackoff(to.String(pip.Location))
 				if err != nil {
 					return nil, err
 				}
-				if len(zones) > 0 {
-					pip.Zones = &zones
+			}
+			if len(zones) > 0 {
+				pip.Zones = &zones
+			}
+		}
+
+		if pipPrefixID := az.getServicePIPPrefixID(service); pipPrefixID != "" {
+			if !az.useStandardLoadBalancer() {
+				return nil, fmt.Errorf("ensurePublicIPExists for service(%s): public IP prefix %s is only supported with the standard load balancer", serviceName, pipPrefixID)
+			}
+			pipPrefix, err := az.getPublicIPPrefixForNewPIP(service, pipPrefixID, isIPv6)
+			if err != nil {
+				return nil, err
+			}
+			if pipPrefix != nil {
+				// the public IPs allocated from the prefix must be in the same zones as the prefix
+				if _, requested, _ := az.getServiceZones(service); requested && !areZonesEqual(pip.Zones, to.StringSlice(pipPrefix.Zones)) {
+					return nil, fmt.Errorf("ensurePublicIPExists for service(%s): the zones requested by the service don't match the zones of the public IP prefix %s", serviceName, pipPrefixID)
 				}
+				pip.PublicIPAddressPropertiesFormat.PublicIPPrefix = &network.SubResource{ID: pipPrefix.ID}
+				pip.Zones = pipPrefix.Zones
 			}
 		}
 		klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - creating", serviceName, *pip.Name)
@@ -1005,9 +1191,9 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 		}
 	}
 
-	// use the same family as the clusterIP as we support IPv6 single stack as well
-	// as dual-stack clusters
-	updatedIPSettings := az.reconcileIPSettings(&pip, service)
+	// use the IP family of the frontend as we support IPv6 single stack as well
+	// as dual-stack services
+	updatedIPSettings := az.reconcileIPSettings(&pip, service, isIPv6)
 	if updatedIPSettings {
 		changed = true
 	}
@@ -1032,12 +1218,88 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 	return &pip, nil
 }
 
-func (az *Cloud) reconcileIPSettings(pip *network.PublicIPAddress, service *v1.Service) bool {
+// getServicePIPPrefixID returns the ID of the public IP prefix from which the public IPs of the service are
+// allocated. The annotation on the service takes precedence over the default one in the cloud config, and
+// setting the annotation to an empty string opts the service out of the default public IP prefix.
+func (az *Cloud) getServicePIPPrefixID(service *v1.Service) string {
+	if pipPrefixID, found := service.Annotations[consts.ServiceAnnotationPIPPrefixID]; found {
+		return strings.TrimSpace(pipPrefixID)
+	}
+	return az.PublicIPPrefixID
+}
+
+// getPublicIPPrefixForNewPIP gets the public IP prefix from which a new public IP of the service is allocated,
+// and makes sure that there are still free IPs in it. Nil would be returned if the IP version of the prefix
+// doesn't match the new public IP, e.g. the IPv6 public IP of a dual-stack service with an IPv4 prefix, in which
+// case the public IP is not allocated from the prefix.
+func (az *Cloud) getPublicIPPrefixForNewPIP(service *v1.Service, pipPrefixID string, isIPv6 bool) (*network.PublicIPPrefix, error) {
+	serviceName := getServiceName(service)
+	matches := pipPrefixIDRE.FindStringSubmatch(pipPrefixID)
+	if len(matches) != 4 {
+		return nil, fmt.Errorf("getPublicIPPrefixForNewPIP for service(%s): %s is not a valid public IP prefix ID", serviceName, pipPrefixID)
+	}
+	subscriptionID, resourceGroup, pipPrefixName := matches[1], matches[2], matches[3]
+	if !strings.EqualFold(subscriptionID, az.getNetworkResourceSubscriptionID()) {
+		return nil, fmt.Errorf("getPublicIPPrefixForNewPIP for service(%s): public IP prefix %s should be in the subscription %s", serviceName, pipPrefixID, az.getNetworkResourceSubscriptionID())
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	pipPrefix, rerr := az.PublicIPPrefixesClient.Get(ctx, resourceGroup, pipPrefixName, "")
+	if rerr != nil {
+		klog.Errorf("PublicIPPrefixesClient.Get(%s, %s) failed: %s", resourceGroup, pipPrefixName, rerr.Error().Error())
+		az.Event(service, v1.EventTypeWarning, "GetPublicIPPrefix", rerr.Error().Error())
+		return nil, rerr.Error()
+	}
+	if pipPrefix.PublicIPPrefixPropertiesFormat == nil || pipPrefix.PrefixLength == nil {
+		return nil, fmt.Errorf("getPublicIPPrefixForNewPIP for service(%s): public IP prefix %s has no prefix length", serviceName, pipPrefixID)
+	}
+	if pipPrefix.Location != nil && !strings.EqualFold(to.String(pipPrefix.Location), az.Location) {
+		return nil, fmt.Errorf("getPublicIPPrefixForNewPIP for service(%s): public IP prefix %s is in the location %s instead of %s", serviceName, pipPrefixID, to.String(pipPrefix.Location), az.Location)
+	}
+
+	isPIPPrefixIPv6 := strings.EqualFold(string(pipPrefix.PublicIPAddressVersion), string(network.IPVersionIPv6))
+	if isPIPPrefixIPv6 != isIPv6 {
+		klog.V(2).Infof("getPublicIPPrefixForNewPIP for service(%s): skipping public IP prefix %s because its IP version %s doesn't match the public IP", serviceName, pipPrefixID, pipPrefix.PublicIPAddressVersion)
+		return nil, nil
+	}
+
+	maxPrefixLength := int32(32)
+	if isPIPPrefixIPv6 {
+		maxPrefixLength = 128
+	}
+	capacity := getPublicIPPrefixCapacity(to.Int32(pipPrefix.PrefixLength), maxPrefixLength)
+	var allocated int
+	if pipPrefix.PublicIPAddresses != nil {
+		allocated = len(*pipPrefix.PublicIPAddresses)
+	}
+	if allocated >= capacity {
+		message := fmt.Sprintf("public IP prefix %s is exhausted: all of its %d public IPs have been allocated", pipPrefixID, capacity)
+		az.Event(service, v1.EventTypeWarning, "PublicIPPrefixExhausted", message)
+		return nil, fmt.Errorf("getPublicIPPrefixForNewPIP for service(%s): %s", serviceName, message)
+	}
+
+	klog.V(2).Infof("getPublicIPPrefixForNewPIP for service(%s): allocating the public IP from prefix %s, %d of %d public IPs allocated", serviceName, pipPrefixID, allocated, capacity)
+	return &pipPrefix, nil
+}
+
+// getPublicIPPrefixCapacity returns the number of public IPs in a public IP prefix.
+func getPublicIPPrefixCapacity(prefixLength, maxPrefixLength int32) int {
+	hostBits := maxPrefixLength - prefixLength
+	if hostBits < 0 {
+		return 0
+	}
+	if hostBits >= 30 {
+		return math.MaxInt32
+	}
+	return 1 << hostBits
+}
+
+func (az *Cloud) reconcileIPSettings(pip *network.PublicIPAddress, service *v1.Service, isIPv6 bool) bool {
 	var changed bool
 
 	serviceName := getServiceName(service)
-	ipv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
-	if ipv6 {
+	if isIPv6 {
 		klog.V(2).Infof("service(%s): pip(%s) - creating as ipv6 for clusterIP:%v", serviceName, *pip.Name, service.Spec.ClusterIP)
 
 		if !strings.EqualFold(string(pip.PublicIPAddressVersion), string(network.IPVersionIPv6)) {
@@ -1239,7 +1501,7 @@ func getDomainNameLabel(pip *network.PublicIPAddress) string {
 	return to.String(pip.PublicIPAddressPropertiesFormat.DNSSettings.DomainNameLabel)
 }
 
-func (az *Cloud) isFrontendIPChanged(clusterName string, config network.FrontendIPConfiguration, service *v1.Service, lbFrontendIPConfigName string, pips *[]network.PublicIPAddress) (bool, error) {
+func (az *Cloud) isFrontendIPChanged(clusterName string, config network.FrontendIPConfiguration, service *v1.Service, lbFrontendIPConfigName string, pips *[]network.PublicIPAddress, isIPv6 bool) (bool, error) {
 	isServiceOwnsFrontendIP, isPrimaryService, err := az.serviceOwnsFrontendIP(config, service, pips)
 	if err != nil {
 		return false, err
@@ -1250,7 +1512,7 @@ func (az *Cloud) isFrontendIPChanged(clusterName string, config network.Frontend
 	if !strings.EqualFold(to.String(config.Name), lbFrontendIPConfigName) {
 		return false, nil
 	}
-	loadBalancerIP := service.Spec.LoadBalancerIP
+	loadBalancerIP := getServiceLoadBalancerIP(service, isIPv6)
 	isInternal := requiresInternalLoadBalancer(service)
 	if isInternal {
 		// Judge subnet
@@ -1268,11 +1530,19 @@ func (az *Cloud) isFrontendIPChanged(clusterName string, config network.Frontend
 			}
 		}
 		if loadBalancerIP == "" {
+			// the static private IP allocated from the private IP pool of the subnet is kept
+			poolSubnetName := az.SubnetName
+			if subnetName != nil {
+				poolSubnetName = *subnetName
+			}
+			if config.PrivateIPAllocationMethod == network.IPAllocationMethodStatic && az.isPrivateIPInPool(poolSubnetName, to.String(config.PrivateIPAddress)) {
+				return false, nil
+			}
 			return config.PrivateIPAllocationMethod == network.IPAllocationMethodStatic, nil
 		}
 		return config.PrivateIPAllocationMethod != network.IPAllocationMethodStatic || !strings.EqualFold(loadBalancerIP, to.String(config.PrivateIPAddress)), nil
 	}
-	pipName, _, err := az.determinePublicIPName(clusterName, service, pips)
+	pipName, _, err := az.determinePublicIPName(clusterName, service, pips, isIPv6)
 	if err != nil {
 		return false, err
 	}
@@ -1284,7 +1554,11 @@ func (az *Cloud) isFrontendIPChanged(clusterName string, config network.Frontend
 	if !existsPip {
 		return true, nil
 	}
-	return config.PublicIPAddress != nil && !strings.EqualFold(to.String(pip.ID), to.String(config.PublicIPAddress.ID)), nil
+	if config.PublicIPAddress != nil && !strings.EqualFold(to.String(pip.ID), to.String(config.PublicIPAddress.ID)) {
+		return true, nil
+	}
+	// the frontend is re-created when it is chained to another gateway load balancer, or the chain is removed
+	return !strings.EqualFold(getFrontendIPConfigGatewayLoadBalancerID(config), getServiceGatewayLoadBalancerFrontendIPConfigID(service)), nil
 }
 
 // isFrontendIPConfigUnsafeToDelete checks if a frontend IP config is safe to be deleted.
@@ -1398,22 +1672,47 @@ func findMatchedOutboundRuleFIPConfig(fipConfigID *string, outboundRuleFIPConfig
 	return found
 }
 
+// findFrontendIPConfigsOfService returns the frontend IP configs of all the IP families owned by the service.
+func (az *Cloud) findFrontendIPConfigsOfService(
+	fipConfigs *[]network.FrontendIPConfiguration,
+	service *v1.Service,
+	pips *[]network.PublicIPAddress,
+) ([]*network.FrontendIPConfiguration, error) {
+	var ownedFIPConfigs []*network.FrontendIPConfiguration
+	if fipConfigs == nil {
+		return ownedFIPConfigs, nil
+	}
+	for _, isIPv6 := range []bool{false, true} {
+		fipConfig, err := az.findFrontendIPConfigOfService(fipConfigs, service, pips, isIPv6)
+		if err != nil {
+			return nil, err
+		}
+		if fipConfig != nil {
+			ownedFIPConfigs = append(ownedFIPConfigs, fipConfig)
+		}
+	}
+
+	return ownedFIPConfigs, nil
+}
+
+// findFrontendIPConfigOfService returns the frontend IP config of the given IP family owned by the service.
 func (az *Cloud) findFrontendIPConfigOfService(
 	fipConfigs *[]network.FrontendIPConfiguration,
 	service *v1.Service,
 	pips *[]network.PublicIPAddress,
-) (*network.FrontendIPConfiguration, bool, error) {
+	isIPv6 bool,
+) (*network.FrontendIPConfiguration, error) {
 	for _, config := range *fipConfigs {
-		owns, isPrimaryService, err := az.serviceOwnsFrontendIP(config, service, pips)
+		owns, _, err := az.serviceOwnsFrontendIP(config, service, pips)
 		if err != nil {
-			return nil, false, err
+			return nil, err
 		}
-		if owns {
-			return &config, isPrimaryService, nil
+		if owns && az.isFrontendIPConfigIPv6(config, service) == isIPv6 {
+			return &config, nil
 		}
 	}
 
-	return nil, false, nil
+	return nil, nil
 }
 
 // reconcileLoadBalancer ensures load balancer exists and the frontend ip config is setup.
@@ -1436,13 +1735,20 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		klog.Errorf("reconcileLoadBalancer: failed to get load balancer for service %q, error: %v", serviceName, err)
 		return nil, err
 	}
+	// the changes of the service are told apart from the ones of others by the snapshot when they are re-applied
+	snapshot := newLoadBalancerSnapshot(lb)
 
 	lbName := *lb.Name
 	lbResourceGroup := az.getLoadBalancerResourceGroup()
-	lbBackendPoolID := az.getBackendPoolID(lbName, az.getLoadBalancerResourceGroup(), getBackendPoolName(clusterName, service))
 	klog.V(2).Infof("reconcileLoadBalancer for service(%s): lb(%s/%s) wantLb(%t) resolved load balancer name", serviceName, lbResourceGroup, lbName, wantLb)
-	defaultLBFrontendIPConfigName := az.getDefaultFrontendIPConfigName(service)
-	defaultLBFrontendIPConfigID := az.getFrontendIPConfigID(lbName, lbResourceGroup, defaultLBFrontendIPConfigName)
+	lbBackendPoolIDs := make(map[bool]string)
+	defaultLBFrontendIPConfigNames := make(map[bool]string)
+	lbFrontendIPConfigIDs := make(map[bool]string)
+	for _, isIPv6 := range []bool{false, true} {
+		lbBackendPoolIDs[isIPv6] = az.getBackendPoolID(lbName, lbResourceGroup, az.getServiceBackendPoolName(clusterName, service, isIPv6))
+		defaultLBFrontendIPConfigNames[isIPv6] = az.getDefaultFrontendIPConfigName(service, isIPv6)
+		lbFrontendIPConfigIDs[isIPv6] = az.getFrontendIPConfigID(lbName, lbResourceGroup, defaultLBFrontendIPConfigNames[isIPv6])
+	}
 	dirtyLb := false
 
 	// reconcile the load balancer's backend pool configuration.
@@ -1455,10 +1761,18 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 			dirtyLb = true
 		}
 		isBackendPoolPreConfigured = preConfig
+	} else if az.isLBBackendPoolTypePodIP() {
+		// the backend pools of the pod IPs are owned by the service, so they are removed together with the service.
+		if changed := az.removeServiceBackendPools(lb, clusterName, service); changed {
+			dirtyLb = true
+		}
+		if az.podIPBackendPoolUpdater != nil {
+			az.podIPBackendPoolUpdater.untrack(serviceName)
+		}
 	}
 
 	// reconcile the load balancer's frontend IP configurations.
-	ownedFIPConfig, toDeleteConfigs, changed, err := az.reconcileFrontendIPConfigs(clusterName, service, lb, lbStatus, wantLb, defaultLBFrontendIPConfigName)
+	ownedFIPConfigs, toDeleteConfigs, changed, err := az.reconcileFrontendIPConfigs(clusterName, service, lb, lbStatus, wantLb, defaultLBFrontendIPConfigNames)
 	if err != nil {
 		return lb, err
 	}
@@ -1467,27 +1781,33 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 	}
 
 	// update probes/rules
-	if ownedFIPConfig != nil {
-		if ownedFIPConfig.ID != nil {
-			defaultLBFrontendIPConfigID = *ownedFIPConfig.ID
-		} else {
-			return nil, fmt.Errorf("reconcileLoadBalancer for service (%s)(%t): nil ID for frontend IP config", serviceName, wantLb)
-		}
-	}
-
-	if wantLb {
-		err = az.checkLoadBalancerResourcesConflicts(lb, defaultLBFrontendIPConfigID, service)
-		if err != nil {
-			return nil, err
+	for isIPv6, ownedFIPConfig := range ownedFIPConfigs {
+		if ownedFIPConfig != nil {
+			if ownedFIPConfig.ID != nil {
+				lbFrontendIPConfigIDs[isIPv6] = *ownedFIPConfig.ID
+			} else {
+				return nil, fmt.Errorf("reconcileLoadBalancer for service (%s)(%t): nil ID for frontend IP config", serviceName, wantLb)
+			}
 		}
 	}
 
 	var expectedProbes []network.Probe
 	var expectedRules []network.LoadBalancingRule
 	if wantLb {
-		expectedProbes, expectedRules, err = az.getExpectedLBRules(service, defaultLBFrontendIPConfigID, lbBackendPoolID, lbName)
-		if err != nil {
-			return nil, err
+		// the probes and rules of all the IP families of the service are expected,
+		// so that the ones of a removed IP family are cleaned up
+		for _, isIPv6 := range getServiceIPFamilies(service) {
+			err = az.checkLoadBalancerResourcesConflicts(lb, lbFrontendIPConfigIDs[isIPv6], service)
+			if err != nil {
+				return nil, err
+			}
+
+			probes, rules, err := az.getExpectedLBRules(service, lbFrontendIPConfigIDs[isIPv6], lbBackendPoolIDs[isIPv6], lbName, isIPv6)
+			if err != nil {
+				return nil, err
+			}
+			expectedProbes = append(expectedProbes, probes...)
+			expectedRules = append(expectedRules, rules...)
 		}
 	}
 
@@ -1499,6 +1819,15 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		dirtyLb = true
 	}
 
+	// reconcile the outbound rule managed by the cloud provider on the primary standard load balancer.
+	changed, outboundPIPsToDelete, err := az.reconcileManagedOutboundRule(clusterName, service, lb, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		dirtyLb = true
+	}
+
 	if changed := az.ensureLoadBalancerTagged(lb); changed {
 		dirtyLb = true
 	}
@@ -1531,7 +1860,7 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 			}
 		} else {
 			klog.V(2).Infof("reconcileLoadBalancer: reconcileLoadBalancer for service(%s): lb(%s) - updating", serviceName, lbName)
-			err := az.CreateOrUpdateLB(service, *lb)
+			err := az.updateLoadBalancer(&loadBalancerUpdate{service: service, lb: *lb, snapshot: snapshot})
 			if err != nil {
 				klog.Errorf("reconcileLoadBalancer for service(%s) abort backoff: lb(%s) - updating: %s", serviceName, lbName, err.Error())
 				return nil, err
@@ -1548,6 +1877,14 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 			}
 			lb = &newLB
 		}
+
+		// the managed public IPs can only be deleted after they are dereferenced by the load balancer.
+		for _, pipName := range outboundPIPsToDelete {
+			klog.V(2).Infof("reconcileLoadBalancer for service(%s): deleting the managed outbound public IP %s", serviceName, pipName)
+			if err := az.DeletePublicIP(service, az.ResourceGroup, pipName); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if wantLb && nodes != nil && !isBackendPoolPreConfigured {
@@ -1561,9 +1898,11 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		if lb.LoadBalancerPropertiesFormat != nil && lb.BackendAddressPools != nil {
 			backendPools := *lb.BackendAddressPools
 			for _, backendPool := range backendPools {
-				if strings.EqualFold(to.String(backendPool.Name), getBackendPoolName(clusterName, service)) {
-					if err := az.LoadBalancerBackendPool.EnsureHostsInPool(service, nodes, lbBackendPoolID, vmSetName, clusterName, lbName, backendPool); err != nil {
-						return nil, err
+				for _, isIPv6 := range getServiceIPFamilies(service) {
+					if strings.EqualFold(to.String(backendPool.Name), az.getServiceBackendPoolName(clusterName, service, isIPv6)) {
+						if err := az.LoadBalancerBackendPool.EnsureHostsInPool(service, nodes, lbBackendPoolIDs[isIPv6], vmSetName, clusterName, lbName, backendPool); err != nil {
+							return nil, err
+						}
 					}
 				}
 			}
@@ -1664,7 +2003,7 @@ func (az *Cloud) reconcileLBRules(lb *network.LoadBalancer, service *v1.Service,
 	return dirtyRules
 }
 
-func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Service, lb *network.LoadBalancer, status *v1.LoadBalancerStatus, wantLb bool, defaultLBFrontendIPConfigName string) (*network.FrontendIPConfiguration, []network.FrontendIPConfiguration, bool, error) {
+func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Service, lb *network.LoadBalancer, status *v1.LoadBalancerStatus, wantLb bool, lbFrontendIPConfigNames map[bool]string) (map[bool]*network.FrontendIPConfiguration, []network.FrontendIPConfiguration, bool, error) {
 	var err error
 	lbName := *lb.Name
 	serviceName := getServiceName(service)
@@ -1672,151 +2011,184 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Serv
 	dirtyConfigs := false
 	var newConfigs []network.FrontendIPConfiguration
 	var toDeleteConfigs []network.FrontendIPConfiguration
+	if wantLb {
+		// the frontend IP configurations with the changed zones are removed from the load balancer before being re-created
+		if err := az.reconcileFrontendZones(clusterName, service, lb); err != nil {
+			return nil, toDeleteConfigs, false, err
+		}
+		if isInternal && strings.TrimSpace(service.Annotations[consts.ServiceAnnotationGatewayLoadBalancerFrontendIPConfigID]) != "" {
+			az.Event(service, v1.EventTypeWarning, "GatewayLoadBalancerIgnored", "Only the public frontends can be chained to the gateway load balancer")
+		}
+	}
 	if lb.FrontendIPConfigurations != nil {
 		newConfigs = *lb.FrontendIPConfigurations
 	}
 
 	// Save pip list so it can be reused in loop
 	var pips *[]network.PublicIPAddress
-	var ownedFIPConfig *network.FrontendIPConfiguration
-	if !wantLb {
-		for i := len(newConfigs) - 1; i >= 0; i-- {
-			config := newConfigs[i]
-			isServiceOwnsFrontendIP, _, err := az.serviceOwnsFrontendIP(config, service, pips)
-			if err != nil {
-				return nil, toDeleteConfigs, false, err
+	ownedFIPConfigs := make(map[bool]*network.FrontendIPConfiguration)
+	for i := len(newConfigs) - 1; i >= 0; i-- {
+		config := newConfigs[i]
+		isServiceOwnsFrontendIP, _, err := az.serviceOwnsFrontendIP(config, service, pips)
+		if err != nil {
+			return nil, toDeleteConfigs, false, err
+		}
+		// the frontend IP configurations of the disabled IP family are removed as well,
+		// e.g., when the service is switched from dual-stack to single-stack
+		if !isServiceOwnsFrontendIP || (wantLb && isServiceIPFamilyEnabled(service, az.isFrontendIPConfigIPv6(config, service))) {
+			continue
+		}
+		unsafe, err := az.isFrontendIPConfigUnsafeToDelete(lb, service, config.ID)
+		if err != nil {
+			return nil, toDeleteConfigs, false, err
+		}
+
+		// If the frontend IP configuration is not being referenced by:
+		// 1. loadBalancing rules of other services with different ports;
+		// 2. outbound rules;
+		// 3. inbound NAT rules;
+		// 4. inbound NAT pools,
+		// do the deletion, or skip it.
+		if !unsafe {
+			var configNameToBeDeleted string
+			if newConfigs[i].Name != nil {
+				configNameToBeDeleted = *newConfigs[i].Name
+				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - dropping", serviceName, wantLb, configNameToBeDeleted)
+			} else {
+				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): nil name of lb frontendconfig", serviceName, wantLb)
 			}
-			if isServiceOwnsFrontendIP {
-				unsafe, err := az.isFrontendIPConfigUnsafeToDelete(lb, service, config.ID)
+
+			toDeleteConfigs = append(toDeleteConfigs, newConfigs[i])
+			newConfigs = append(newConfigs[:i], newConfigs[i+1:]...)
+			dirtyConfigs = true
+		}
+	}
+
+	if wantLb {
+		for _, isIPv6 := range getServiceIPFamilies(service) {
+			lbFrontendIPConfigName := lbFrontendIPConfigNames[isIPv6]
+			var (
+				previousZone *[]string
+				isFipChanged bool
+			)
+			for i := len(newConfigs) - 1; i >= 0; i-- {
+				config := newConfigs[i]
+				isServiceOwnsFrontendIP, _, _ := az.serviceOwnsFrontendIP(config, service, pips)
+				if !isServiceOwnsFrontendIP || az.isFrontendIPConfigIPv6(config, service) != isIPv6 {
+					klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): the frontend IP configuration %s does not belong to the service", serviceName, to.String(config.Name))
+					continue
+				}
+				klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): checking owned frontend IP cofiguration %s", serviceName, to.String(config.Name))
+				isFipChanged, err = az.isFrontendIPChanged(clusterName, config, service, lbFrontendIPConfigName, pips, isIPv6)
 				if err != nil {
 					return nil, toDeleteConfigs, false, err
 				}
-
-				// If the frontend IP configuration is not being referenced by:
-				// 1. loadBalancing rules of other services with different ports;
-				// 2. outbound rules;
-				// 3. inbound NAT rules;
-				// 4. inbound NAT pools,
-				// do the deletion, or skip it.
-				if !unsafe {
-					var configNameToBeDeleted string
-					if newConfigs[i].Name != nil {
-						configNameToBeDeleted = *newConfigs[i].Name
-						klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - dropping", serviceName, wantLb, configNameToBeDeleted)
-					} else {
-						klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): nil name of lb frontendconfig", serviceName, wantLb)
-					}
-
+				if isFipChanged {
+					klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - dropping", serviceName, wantLb, *config.Name)
 					toDeleteConfigs = append(toDeleteConfigs, newConfigs[i])
 					newConfigs = append(newConfigs[:i], newConfigs[i+1:]...)
 					dirtyConfigs = true
+					previousZone = config.Zones
 				}
+				break
 			}
-		}
-	} else {
-		var (
-			previousZone *[]string
-			isFipChanged bool
-		)
-		for i := len(newConfigs) - 1; i >= 0; i-- {
-			config := newConfigs[i]
-			isServiceOwnsFrontendIP, _, _ := az.serviceOwnsFrontendIP(config, service, pips)
-			if !isServiceOwnsFrontendIP {
-				klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): the frontend IP configuration %s does not belong to the service", serviceName, to.String(config.Name))
-				continue
-			}
-			klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): checking owned frontend IP cofiguration %s", serviceName, to.String(config.Name))
-			isFipChanged, err = az.isFrontendIPChanged(clusterName, config, service, defaultLBFrontendIPConfigName, pips)
+
+			ownedFIPConfig, err := az.findFrontendIPConfigOfService(&newConfigs, service, pips, isIPv6)
 			if err != nil {
 				return nil, toDeleteConfigs, false, err
 			}
-			if isFipChanged {
-				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - dropping", serviceName, wantLb, *config.Name)
-				toDeleteConfigs = append(toDeleteConfigs, newConfigs[i])
-				newConfigs = append(newConfigs[:i], newConfigs[i+1:]...)
-				dirtyConfigs = true
-				previousZone = config.Zones
-			}
-			break
-		}
 
-		ownedFIPConfig, _, err = az.findFrontendIPConfigOfService(&newConfigs, service, pips)
-		if err != nil {
-			return nil, toDeleteConfigs, false, err
-		}
+			if ownedFIPConfig == nil {
+				klog.V(4).Infof("ensure(%s): lb(%s) - creating a new frontend IP config", serviceName, lbName)
 
-		if ownedFIPConfig == nil {
-			klog.V(4).Infof("ensure(%s): lb(%s) - creating a new frontend IP config", serviceName, lbName)
+				// construct FrontendIPConfigurationPropertiesFormat
+				var fipConfigurationProperties *network.FrontendIPConfigurationPropertiesFormat
+				if isInternal {
+					subnetName := subnet(service)
+					if subnetName == nil {
+						subnetName = &az.SubnetName
+					}
+					subnet, existsSubnet, err := az.getSubnet(az.VnetName, *subnetName)
+					if err != nil {
+						return nil, toDeleteConfigs, false, err
+					}
 
-			// construct FrontendIPConfigurationPropertiesFormat
-			var fipConfigurationProperties *network.FrontendIPConfigurationPropertiesFormat
-			if isInternal {
-				subnetName := subnet(service)
-				if subnetName == nil {
-					subnetName = &az.SubnetName
-				}
-				subnet, existsSubnet, err := az.getSubnet(az.VnetName, *subnetName)
-				if err != nil {
-					return nil, toDeleteConfigs, false, err
-				}
+					if !existsSubnet {
+						return nil, toDeleteConfigs, false, fmt.Errorf("ensure(%s): lb(%s) - failed to get subnet: %s/%s", serviceName, lbName, az.VnetName, az.SubnetName)
+					}
 
-				if !existsSubnet {
-					return nil, toDeleteConfigs, false, fmt.Errorf("ensure(%s): lb(%s) - failed to get subnet: %s/%s", serviceName, lbName, az.VnetName, az.SubnetName)
-				}
+					configProperties := network.FrontendIPConfigurationPropertiesFormat{
+						Subnet: &subnet,
+					}
 
-				configProperties := network.FrontendIPConfigurationPropertiesFormat{
-					Subnet: &subnet,
-				}
+					if isIPv6 {
+						configProperties.PrivateIPAddressVersion = network.IPVersionIPv6
+					}
 
-				if utilnet.IsIPv6String(service.Spec.ClusterIP) {
-					configProperties.PrivateIPAddressVersion = network.IPVersionIPv6
-				}
+					loadBalancerIP := getServiceLoadBalancerIP(service, isIPv6)
+					privateIP := getIngressIPByIPFamily(status, isIPv6)
+					if loadBalancerIP != "" {
+						configProperties.PrivateIPAllocationMethod = network.IPAllocationMethodStatic
+						configProperties.PrivateIPAddress = &loadBalancerIP
+					} else if privateIP != "" {
+						klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): keep the original private IP %s", serviceName, privateIP)
+						configProperties.PrivateIPAllocationMethod = network.IPAllocationMethodStatic
+						configProperties.PrivateIPAddress = to.StringPtr(privateIP)
+					} else if poolIP, err := az.allocatePoolPrivateIP(service, *subnetName, subnet, isIPv6); err != nil {
+						return nil, toDeleteConfigs, false, err
+					} else if poolIP != "" {
+						klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): use the private IP %s allocated from the pool", serviceName, poolIP)
+						configProperties.PrivateIPAllocationMethod = network.IPAllocationMethodStatic
+						configProperties.PrivateIPAddress = to.StringPtr(poolIP)
+					} else {
+						// We'll need to call GetLoadBalancer later to retrieve allocated IP.
+						klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): dynamically allocate the private IP", serviceName)
+						configProperties.PrivateIPAllocationMethod = network.IPAllocationMethodDynamic
+					}
 
-				loadBalancerIP := service.Spec.LoadBalancerIP
-				if loadBalancerIP != "" {
-					configProperties.PrivateIPAllocationMethod = network.IPAllocationMethodStatic
-					configProperties.PrivateIPAddress = &loadBalancerIP
-				} else if status != nil && len(status.Ingress) > 0 {
-					klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): keep the original private IP %s", serviceName, status.Ingress[0].IP)
-					configProperties.PrivateIPAllocationMethod = network.IPAllocationMethodStatic
-					configProperties.PrivateIPAddress = to.StringPtr(status.Ingress[0].IP)
+					fipConfigurationProperties = &configProperties
 				} else {
-					// We'll need to call GetLoadBalancer later to retrieve allocated IP.
-					klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): dynamically allocate the private IP", serviceName)
-					configProperties.PrivateIPAllocationMethod = network.IPAllocationMethodDynamic
+					gatewayLBFrontendIPConfigID := getServiceGatewayLoadBalancerFrontendIPConfigID(service)
+					if gatewayLBFrontendIPConfigID != "" {
+						if err := az.validateGatewayLoadBalancerFrontendIPConfig(service, gatewayLBFrontendIPConfigID); err != nil {
+							return nil, toDeleteConfigs, false, err
+						}
+					}
+					pipName, shouldPIPExisted, err := az.determinePublicIPName(clusterName, service, pips, isIPv6)
+					if err != nil {
+						return nil, toDeleteConfigs, false, err
+					}
+					domainNameLabel, found := getPublicIPDomainNameLabel(service, isIPv6)
+					pip, err := az.ensurePublicIPExists(service, pipName, domainNameLabel, clusterName, shouldPIPExisted, found, isIPv6)
+					if err != nil {
+						return nil, toDeleteConfigs, false, err
+					}
+					fipConfigurationProperties = &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: pip.ID},
+					}
+					// the traffic to the frontend is forwarded to the NVAs behind the gateway load balancer first
+					if gatewayLBFrontendIPConfigID != "" {
+						fipConfigurationProperties.GatewayLoadBalancer = &network.SubResource{ID: to.StringPtr(gatewayLBFrontendIPConfigID)}
+					}
 				}
 
-				fipConfigurationProperties = &configProperties
-			} else {
-				pipName, shouldPIPExisted, err := az.determinePublicIPName(clusterName, service, pips)
-				if err != nil {
-					return nil, toDeleteConfigs, false, err
-				}
-				domainNameLabel, found := getPublicIPDomainNameLabel(service)
-				pip, err := az.ensurePublicIPExists(service, pipName, domainNameLabel, clusterName, shouldPIPExisted, found)
-				if err != nil {
-					return nil, toDeleteConfigs, false, err
-				}
-				fipConfigurationProperties = &network.FrontendIPConfigurationPropertiesFormat{
-					PublicIPAddress: &network.PublicIPAddress{ID: pip.ID},
+				newConfig := network.FrontendIPConfiguration{
+					Name:                                    to.StringPtr(lbFrontendIPConfigName),
+					ID:                                      to.StringPtr(fmt.Sprintf(consts.FrontendIPConfigIDTemplate, az.SubscriptionID, az.ResourceGroup, *lb.Name, lbFrontendIPConfigName)),
+					FrontendIPConfigurationPropertiesFormat: fipConfigurationProperties,
 				}
-			}
-
-			newConfig := network.FrontendIPConfiguration{
-				Name:                                    to.StringPtr(defaultLBFrontendIPConfigName),
-				ID:                                      to.StringPtr(fmt.Sprintf(consts.FrontendIPConfigIDTemplate, az.SubscriptionID, az.ResourceGroup, *lb.Name, defaultLBFrontendIPConfigName)),
-				FrontendIPConfigurationPropertiesFormat: fipConfigurationProperties,
-			}
 
-			if isInternal {
-				if err := az.getFrontendZones(&newConfig, previousZone, isFipChanged, serviceName, defaultLBFrontendIPConfigName); err != nil {
-					klog.Errorf("reconcileLoadBalancer for service (%s)(%t): failed to getFrontendZones: %s", serviceName, wantLb, err.Error())
-					return nil, toDeleteConfigs, false, err
+				if isInternal {
+					if err := az.getFrontendZones(&newConfig, previousZone, isFipChanged, service, lbFrontendIPConfigName); err != nil {
+						klog.Errorf("reconcileLoadBalancer for service (%s)(%t): failed to getFrontendZones: %s", serviceName, wantLb, err.Error())
+						return nil, toDeleteConfigs, false, err
+					}
 				}
+				newConfigs = append(newConfigs, newConfig)
+				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - adding", serviceName, wantLb, lbFrontendIPConfigName)
+				dirtyConfigs = true
 			}
-			newConfigs = append(newConfigs, newConfig)
-			klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - adding", serviceName, wantLb, defaultLBFrontendIPConfigName)
-			dirtyConfigs = true
+			ownedFIPConfigs[isIPv6] = ownedFIPConfig
 		}
 	}
 
@@ -1824,14 +2196,29 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Serv
 		lb.FrontendIPConfigurations = &newConfigs
 	}
 
-	return ownedFIPConfig, toDeleteConfigs, dirtyConfigs, err
+	return ownedFIPConfigs, toDeleteConfigs, dirtyConfigs, err
 }
 
 func (az *Cloud) getFrontendZones(
 	fipConfig *network.FrontendIPConfiguration,
 	previousZone *[]string,
 	isFipChanged bool,
-	serviceName, defaultLBFrontendIPConfigName string) error {
+	service *v1.Service,
+	defaultLBFrontendIPConfigName string) error {
+	serviceName := getServiceName(service)
+	// the zones requested by the service take precedence
+	zones, requested, err := az.getServiceZones(service)
+	if err != nil {
+		return err
+	}
+	if requested {
+		klog.V(2).Infof("getFrontendZones for service (%s): lb frontendconfig(%s): setting zone to [%s] requested by the service", serviceName, defaultLBFrontendIPConfigName, strings.Join(zones, ","))
+		if len(zones) > 0 {
+			fipConfig.Zones = &zones
+		}
+		return nil
+	}
+
 	if !isFipChanged { // fetch zone information from API for new frontends
 		// only add zone information for new internal frontend IP configurations for standard load balancer not deployed to an edge zone.
 		location := az.Location
@@ -1958,15 +2345,29 @@ func lbRuleConflictsWithPort(rule network.LoadBalancingRule, frontendIPConfigID
 // buildHealthProbeRulesForPort
 // for following sku: basic loadbalancer vs standard load balancer
 // for following protocols: TCP HTTP HTTPS(SLB only)
-func (az *Cloud) buildHealthProbeRulesForPort(annotations map[string]string, port v1.ServicePort, lbrule string) (*network.Probe, error) {
-	if port.Protocol == v1.ProtocolUDP || port.Protocol == v1.ProtocolSCTP {
+func (az *Cloud) buildHealthProbeRulesForPort(service *v1.Service, port v1.ServicePort, lbrule string) (*network.Probe, error) {
+	annotations := service.Annotations
+	if consts.IsHealthProbeRuleOnK8sServicePortDisabled(annotations, port.Port) {
+		return nil, nil
+	}
+
+	portProtocol, err := consts.GetHealthProbeConfigOfPortFromK8sSvcAnnotation(annotations, port.Port, consts.HealthProbeParamsProtocol, validateHealthProbeProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.BuildHealthProbeAnnotationKeyForPort(port.Port, consts.HealthProbeParamsProtocol), err)
+	}
+	probePortValue, err := consts.GetHealthProbeConfigOfPortFromK8sSvcAnnotation(annotations, port.Port, consts.HealthProbeParamsPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.BuildHealthProbeAnnotationKeyForPort(port.Port, consts.HealthProbeParamsPort), err)
+	}
+	// the UDP and SCTP ports are only probed if the probe is configured for the port explicitly
+	if (port.Protocol == v1.ProtocolUDP || port.Protocol == v1.ProtocolSCTP) && portProtocol == nil && probePortValue == nil {
 		return nil, nil
 	}
-	// protocol should be tcp, because sctp is handled in outer loop
 
 	properties := &network.ProbePropertiesFormat{}
-	var err error
-	if port.AppProtocol == nil {
+	if portProtocol != nil {
+		port.AppProtocol = portProtocol
+	} else if port.AppProtocol == nil {
 		if port.AppProtocol, err = consts.GetAttributeValueInSvcAnnotation(annotations, consts.ServiceAnnotationLoadBalancerHealthProbeProtocol); err != nil {
 			return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.ServiceAnnotationLoadBalancerHealthProbeProtocol, err)
 		}
@@ -2064,9 +2465,13 @@ func (az *Cloud) buildHealthProbeRulesForPort(annotations map[string]string, por
 	if (*probeInterval)*(*numberOfProbes) >= 120 {
 		return nil, fmt.Errorf("total probe should be less than 120, please adjust interval and number of probe accordingly")
 	}
+	probePort, err := az.getHealthProbePort(service, port, probePortValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.BuildHealthProbeAnnotationKeyForPort(port.Port, consts.HealthProbeParamsPort), err)
+	}
 	properties.IntervalInSeconds = probeInterval
 	properties.NumberOfProbes = numberOfProbes
-	properties.Port = &port.NodePort
+	properties.Port = &probePort
 	probe := &network.Probe{
 		Name:                  &lbrule,
 		ProbePropertiesFormat: properties,
@@ -2074,6 +2479,46 @@ func (az *Cloud) buildHealthProbeRulesForPort(annotations map[string]string, por
 	return probe, nil
 }
 
+// validateHealthProbeProtocol validates the protocol of the health probe set for a port.
+func validateHealthProbeProtocol(protocol *string) error {
+	for _, supported := range []network.ProbeProtocol{network.ProbeProtocolTCP, network.ProbeProtocolHTTP, network.ProbeProtocolHTTPS} {
+		if strings.EqualFold(strings.TrimSpace(*protocol), string(supported)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the health probe protocol %q is not one of %s, %s and %s", *protocol, network.ProbeProtocolTCP, network.ProbeProtocolHTTP, network.ProbeProtocolHTTPS)
+}
+
+// getHealthProbePort returns the port the health probe of the service port is sent to. By default it is the backend
+// port of the service port. If the probe port is set by the name or the number of another port of the service, the
+// backend port of that port is probed instead, otherwise the number is used as it is.
+func (az *Cloud) getHealthProbePort(service *v1.Service, port v1.ServicePort, probePortValue *string) (int32, error) {
+	targetPort := port
+	if probePortValue != nil {
+		value := strings.TrimSpace(*probePortValue)
+		found := false
+		for _, servicePort := range service.Spec.Ports {
+			if (servicePort.Name != "" && servicePort.Name == value) || strconv.Itoa(int(servicePort.Port)) == value {
+				targetPort = servicePort
+				found = true
+				break
+			}
+		}
+		if !found {
+			number, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || number < 1 || number > 65535 {
+				return 0, fmt.Errorf("the health probe port %q is neither a port of the service nor a valid port number", value)
+			}
+			return int32(number), nil
+		}
+	}
+
+	if az.isLBBackendPoolTypePodIP() {
+		return az.getServicePortBackendPort(service, targetPort)
+	}
+	return targetPort.NodePort, nil
+}
+
 // buildLBRules
 // for following sku: basic loadbalancer vs standard load balancer
 // for following scenario: internal vs external
@@ -2081,7 +2526,8 @@ func (az *Cloud) getExpectedLBRules(
 	service *v1.Service,
 	lbFrontendIPConfigID string,
 	lbBackendPoolID string,
-	lbName string) ([]network.Probe, []network.LoadBalancingRule, error) {
+	lbName string,
+	isIPv6 bool) ([]network.Probe, []network.LoadBalancingRule, error) {
 
 	var expectedRules []network.LoadBalancingRule
 	var expectedProbes []network.Probe
@@ -2090,10 +2536,11 @@ func (az *Cloud) getExpectedLBRules(
 	// take precedence over user defined probe configuration
 	// healthcheck proxy server serves http requests
 	// https://github.com/kubernetes/kubernetes/blob/7c013c3f64db33cf19f38bb2fc8d9182e42b0b7b/pkg/proxy/healthcheck/service_health.go#L236
+	// the pods are probed directly instead when the pod IPs are attached to the backend pools
 	var nodeEndpointHealthprobe *network.Probe
-	if servicehelpers.NeedsHealthCheck(service) {
+	if servicehelpers.NeedsHealthCheck(service) && !az.isLBBackendPoolTypePodIP() {
 		podPresencePath, podPresencePort := servicehelpers.GetServiceHealthCheckPathPort(service)
-		lbRuleName := az.getLoadBalancerRuleName(service, v1.ProtocolTCP, podPresencePort)
+		lbRuleName := az.getLoadBalancerRuleName(service, v1.ProtocolTCP, podPresencePort, isIPv6)
 
 		nodeEndpointHealthprobe = &network.Probe{
 			Name: &lbRuleName,
@@ -2110,14 +2557,16 @@ func (az *Cloud) getExpectedLBRules(
 
 	// In HA mode, lb forward traffic of all port to backend
 	// HA mode is only supported on standard loadbalancer SKU in internal mode
-	if consts.IsK8sServiceUsingInternalLoadBalancer(service) &&
-		az.useStandardLoadBalancer() &&
-		consts.IsK8sServiceHasHAModeEnabled(service) {
+	useHAPortsRule, err := az.useHAPortsRule(service)
+	if err != nil {
+		return nil, nil, err
+	}
+	if useHAPortsRule {
 
-		lbRuleName := az.getloadbalancerHAmodeRuleName(service)
+		lbRuleName := az.getloadbalancerHAmodeRuleName(service, isIPv6)
 		klog.V(2).Infof("getExpectedLBRules lb name (%s) rule name (%s)", lbName, lbRuleName)
 
-		props, err := az.getExpectedHAModeLoadBalancingRuleProperties(service, lbFrontendIPConfigID, lbBackendPoolID)
+		props, err := az.getExpectedHAModeLoadBalancingRuleProperties(service, lbFrontendIPConfigID, lbBackendPoolID, isIPv6)
 		if err != nil {
 			return nil, nil, fmt.Errorf("error generate lb rule for ha mod loadbalancer. err: %w", err)
 		}
@@ -2125,10 +2574,11 @@ func (az *Cloud) getExpectedLBRules(
 		if nodeEndpointHealthprobe == nil {
 			// use user customized health probe rule if any
 			for _, port := range service.Spec.Ports {
-				portprobe, err := az.buildHealthProbeRulesForPort(service.Annotations, port, lbRuleName)
+				portprobe, err := az.buildHealthProbeRulesForPort(service, port, lbRuleName)
 				if err != nil {
 					klog.V(2).ErrorS(err, "error occurred when buildHealthProbeRulesForPort", "service", service.Name, "namespace", service.Namespace,
 						"rule-name", lbRuleName, "port", port.Port)
+					az.Event(service, v1.EventTypeWarning, "InvalidHealthProbeConfiguration", err.Error())
 					//ignore error because we only need one correct rule
 				}
 				if portprobe != nil {
@@ -2154,7 +2604,7 @@ func (az *Cloud) getExpectedLBRules(
 		// generate lb rule for each port defined in svc object
 
 		for _, port := range service.Spec.Ports {
-			lbRuleName := az.getLoadBalancerRuleName(service, port.Protocol, port.Port)
+			lbRuleName := az.getLoadBalancerRuleName(service, port.Protocol, port.Port, isIPv6)
 			klog.V(2).Infof("getExpectedLBRules lb name (%s) rule name (%s)", lbName, lbRuleName)
 
 			if port.Protocol == v1.ProtocolSCTP && !(az.useStandardLoadBalancer() && consts.IsK8sServiceUsingInternalLoadBalancer(service)) {
@@ -2165,20 +2615,26 @@ func (az *Cloud) getExpectedLBRules(
 			if err != nil {
 				return expectedProbes, expectedRules, fmt.Errorf("failed to parse transport protocol: %w", err)
 			}
-			props, err := az.getExpectedLoadBalancingRulePropertiesForPort(service, lbFrontendIPConfigID, lbBackendPoolID, port, *transportProto)
+			props, err := az.getExpectedLoadBalancingRulePropertiesForPort(service, lbFrontendIPConfigID, lbBackendPoolID, port, *transportProto, isIPv6)
 			if err != nil {
 				return expectedProbes, expectedRules, fmt.Errorf("error generate lb rule for ha mod loadbalancer. err: %w", err)
 			}
 
 			if nodeEndpointHealthprobe == nil {
-				portprobe, err := az.buildHealthProbeRulesForPort(service.Annotations, port, lbRuleName)
+				portprobe, err := az.buildHealthProbeRulesForPort(service, port, lbRuleName)
 				if err != nil {
 					klog.V(2).ErrorS(err, "error occurred when buildHealthProbeRulesForPort", "service", service.Name, "namespace", service.Namespace,
 						"rule-name", lbRuleName, "port", port.Port)
+					az.Event(service, v1.EventTypeWarning, "InvalidHealthProbeConfiguration", err.Error())
 					return expectedProbes, expectedRules, err
 				}
 				if portprobe != nil {
-					expectedProbes = append(expectedProbes, *portprobe)
+					// the ports with the same health probe share one probe if the consolidation is enabled
+					if sharedProbe := findEquivalentProbe(expectedProbes, portprobe); sharedProbe != nil && consts.IsK8sServiceHealthProbeConsolidationEnabled(service) {
+						portprobe = sharedProbe
+					} else {
+						expectedProbes = append(expectedProbes, *portprobe)
+					}
 					props.Probe = &network.SubResource{
 						ID: to.StringPtr(az.getLoadBalancerProbeID(lbName, az.getLoadBalancerResourceGroup(), *portprobe.Name)),
 					}
@@ -2203,7 +2659,7 @@ func (az *Cloud) getExpectedLBRules(
 func (az *Cloud) getExpectedLoadBalancingRulePropertiesForPort(
 	service *v1.Service,
 	lbFrontendIPConfigID string,
-	lbBackendPoolID string, servicePort v1.ServicePort, transportProto network.TransportProtocol) (*network.LoadBalancingRulePropertiesFormat, error) {
+	lbBackendPoolID string, servicePort v1.ServicePort, transportProto network.TransportProtocol, isIPv6 bool) (*network.LoadBalancingRulePropertiesFormat, error) {
 	var err error
 
 	loadDistribution := network.LoadDistributionDefault
@@ -2227,10 +2683,15 @@ func (az *Cloud) getExpectedLoadBalancingRulePropertiesForPort(
 		lbIdleTimeout = to.Int32Ptr(4)
 	}
 
+	backendPort, err := az.getServicePortBackendPort(service, servicePort)
+	if err != nil {
+		return nil, err
+	}
+
 	props := &network.LoadBalancingRulePropertiesFormat{
 		Protocol:            transportProto,
 		FrontendPort:        to.Int32Ptr(servicePort.Port),
-		BackendPort:         to.Int32Ptr(servicePort.Port),
+		BackendPort:         to.Int32Ptr(backendPort),
 		DisableOutboundSnat: to.BoolPtr(az.disableLoadBalancerOutboundSNAT()),
 		EnableFloatingIP:    to.BoolPtr(true),
 		LoadDistribution:    loadDistribution,
@@ -2246,31 +2707,110 @@ func (az *Cloud) getExpectedLoadBalancingRulePropertiesForPort(
 		props.EnableTCPReset = to.BoolPtr(true)
 	}
 
+	props.EnableFloatingIP = to.BoolPtr(az.useFloatingIP(service, isIPv6))
 	// Azure ILB does not support secondary IPs as floating IPs on the LB. Therefore, floating IP needs to be turned
 	// off and the rule should point to the nodeIP:nodePort.
-	if consts.IsK8sServiceInternalIPv6(service) {
+	if !az.isLBBackendPoolTypePodIP() && !consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) &&
+		consts.IsK8sServiceUsingInternalLoadBalancer(service) && isIPv6 {
 		props.BackendPort = to.Int32Ptr(servicePort.NodePort)
-		props.EnableFloatingIP = to.BoolPtr(false)
 	}
 	return props, nil
 }
 
+// useFloatingIP returns whether the floating IP of the load balancing rules of the service is enabled.
+func (az *Cloud) useFloatingIP(service *v1.Service, isIPv6 bool) bool {
+	// The traffic is sent to the pods directly with the podIP backend pool type, which don't have the frontend IP
+	// configured, so floating IP needs to be turned off and the rule points to the podIP:targetPort.
+	if az.isLBBackendPoolTypePodIP() {
+		return false
+	}
+	// The nodes don't have the frontend IP configured when floating IP is disabled, so the rule points to the
+	// nodeIP:nodePort, which is chosen by getServicePortBackendPort.
+	if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
+		return false
+	}
+	return !(consts.IsK8sServiceUsingInternalLoadBalancer(service) && isIPv6)
+}
+
+// findEquivalentProbe returns the probe whose properties are the same as the given probe.
+func findEquivalentProbe(probes []network.Probe, probe *network.Probe) *network.Probe {
+	for i := range probes {
+		if reflect.DeepEqual(probes[i].ProbePropertiesFormat, probe.ProbePropertiesFormat) {
+			return &probes[i]
+		}
+	}
+	return nil
+}
+
+// useHAPortsRule returns whether the traffic of all the ports of the service is forwarded by one high availability
+// ports rule, which is only supported on the standard internal load balancer. It is the case if the HA ports are
+// enabled, or the ports of the service cover the port range set by the annotation.
+func (az *Cloud) useHAPortsRule(service *v1.Service) (bool, error) {
+	if !consts.IsK8sServiceUsingInternalLoadBalancer(service) || !az.useStandardLoadBalancer() {
+		return false, nil
+	}
+	if consts.IsK8sServiceHasHAModeEnabled(service) {
+		return true, nil
+	}
+
+	portRange, err := consts.GetAttributeValueInSvcAnnotation(service.Annotations, consts.ServiceAnnotationLoadBalancerHAPortsRange)
+	if err != nil || portRange == nil {
+		return false, err
+	}
+	bounds := strings.Split(strings.TrimSpace(*portRange), "-")
+	if len(bounds) != 2 {
+		return false, fmt.Errorf("invalid port range %q in the annotation %s, it should be in the format of <start>-<end>", *portRange, consts.ServiceAnnotationLoadBalancerHAPortsRange)
+	}
+	start, startErr := strconv.ParseInt(strings.TrimSpace(bounds[0]), 10, 32)
+	end, endErr := strconv.ParseInt(strings.TrimSpace(bounds[1]), 10, 32)
+	if startErr != nil || endErr != nil || start < 1 || end > 65535 || start > end {
+		return false, fmt.Errorf("invalid port range %q in the annotation %s, it should be in the format of <start>-<end>", *portRange, consts.ServiceAnnotationLoadBalancerHAPortsRange)
+	}
+
+	coveredPorts := sets.NewInt64()
+	for _, port := range service.Spec.Ports {
+		if int64(port.Port) < start || int64(port.Port) > end {
+			return false, fmt.Errorf("the port %d of the service is out of the port range %q in the annotation %s", port.Port, *portRange, consts.ServiceAnnotationLoadBalancerHAPortsRange)
+		}
+		coveredPorts.Insert(int64(port.Port))
+	}
+	if int64(coveredPorts.Len()) != end-start+1 {
+		return false, fmt.Errorf("the port range %q in the annotation %s is not covered by the ports of the service", *portRange, consts.ServiceAnnotationLoadBalancerHAPortsRange)
+	}
+	return true, nil
+}
+
+// getExpectedLBRuleCount returns the number of the load balancing rules the service would add to the load balancer.
+func (az *Cloud) getExpectedLBRuleCount(service *v1.Service) int {
+	count := len(service.Spec.Ports)
+	if useHAPortsRule, err := az.useHAPortsRule(service); err == nil && useHAPortsRule {
+		count = 1
+	}
+	return count * len(getServiceIPFamilies(service))
+}
+
 //getExpectedHAModeLoadBalancingRuleProperties build load balancing rule for lb in HA mode
 func (az *Cloud) getExpectedHAModeLoadBalancingRuleProperties(
 	service *v1.Service,
 	lbFrontendIPConfigID string,
-	lbBackendPoolID string) (*network.LoadBalancingRulePropertiesFormat, error) {
-	props, err := az.getExpectedLoadBalancingRulePropertiesForPort(service, lbFrontendIPConfigID, lbBackendPoolID, v1.ServicePort{}, network.TransportProtocolAll)
+	lbBackendPoolID string,
+	isIPv6 bool) (*network.LoadBalancingRulePropertiesFormat, error) {
+	props, err := az.getExpectedLoadBalancingRulePropertiesForPort(service, lbFrontendIPConfigID, lbBackendPoolID, v1.ServicePort{}, network.TransportProtocolAll, isIPv6)
 	if err != nil {
 		return nil, fmt.Errorf("error generate lb rule for ha mod loadbalancer. err: %w", err)
 	}
+	// The HA ports rule forwards the traffic of all the ports without translating them, so the backend port is 0
+	// even if the floating IP is disabled, and the traffic is sent to the service ports of the backends.
+	props.FrontendPort = to.Int32Ptr(0)
+	props.BackendPort = to.Int32Ptr(0)
+	props.EnableFloatingIP = to.BoolPtr(az.useFloatingIP(service, isIPv6))
 	props.EnableTCPReset = to.BoolPtr(true)
 	return props, nil
 }
 
 // This reconciles the Network Security Group similar to how the LB is reconciled.
 // This entails adding required, missing SecurityRules and removing stale rules.
-func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service, lbIP *string, wantLb bool) (*network.SecurityGroup, error) {
+func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service, lbIPs *[]string, wantLb bool) (*network.SecurityGroup, error) {
 	serviceName := getServiceName(service)
 	klog.V(5).Infof("reconcileSecurityGroup(%s): START clusterName=%q", serviceName, clusterName)
 
@@ -2288,28 +2828,15 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 		return nil, err
 	}
 
-	destinationIPAddress := ""
-	if wantLb && lbIP == nil {
+	if wantLb && lbIPs == nil {
 		return nil, fmt.Errorf("no load balancer IP for setting up security rules for service %s", service.Name)
 	}
-	if lbIP != nil {
-		destinationIPAddress = *lbIP
-	}
-
-	if destinationIPAddress == "" {
-		destinationIPAddress = "*"
-	}
 
 	additionalIPs, err := getServiceAdditionalPublicIPs(service)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get additional public IPs, error=%v", err)
 	}
 
-	destinationIPAddresses := []string{destinationIPAddress}
-	if destinationIPAddress != "*" {
-		destinationIPAddresses = append(destinationIPAddresses, additionalIPs...)
-	}
-
 	sourceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(service)
 	if err != nil {
 		return nil, err
@@ -2319,50 +2846,114 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 		delete(sourceRanges, consts.DefaultLoadBalancerSourceRanges)
 	}
 
-	var sourceAddressPrefixes []string
-	if (sourceRanges == nil || servicehelpers.IsAllowAll(sourceRanges)) && len(serviceTags) == 0 {
-		if !requiresInternalLoadBalancer(service) || len(service.Spec.LoadBalancerSourceRanges) > 0 {
-			sourceAddressPrefixes = []string{"Internet"}
-		}
-	} else {
-		for _, ip := range sourceRanges {
-			sourceAddressPrefixes = append(sourceAddressPrefixes, ip.String())
+	// the application security groups which the node IP configurations join replace the node IP destinations when
+	// the traffic is destined to the node IPs, so the rules don't change with the IPs of the nodes. They can't be the
+	// destinations of the shared rules, or the ones matching the frontend IPs with the floating IP turned on.
+	var destinationASGIDs []string
+	if wantLb && az.useApplicationSecurityGroups() && !az.isLBBackendPoolTypePodIP() && consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) && !useSharedSecurityRule(service) {
+		destinationASGIDs, err = az.getServiceApplicationSecurityGroupIDs(clusterName, service)
+		if err != nil {
+			return nil, err
 		}
-		sourceAddressPrefixes = append(sourceAddressPrefixes, serviceTags...)
 	}
 
-	expectedSecurityRules, err := az.getExpectedSecurityRules(wantLb, ports, sourceAddressPrefixes, service, destinationIPAddresses, sourceRanges)
-	if err != nil {
-		return nil, err
+	// the security rules are generated for each IP family of the service, since the
+	// IPv4 and IPv6 addresses cannot be mixed in a single security rule.
+	destinationIPAddresses := make(map[bool][]string)
+	sourceAddressPrefixes := make(map[bool][]string)
+	expectedSecurityRules := []network.SecurityRule{}
+	for _, isIPv6 := range getServiceIPFamilies(service) {
+		var destinationIPAddressesOfFamily []string
+		if lbIPs != nil {
+			for _, ip := range *lbIPs {
+				if ip != "" && utilnet.IsIPv6String(ip) == isIPv6 {
+					destinationIPAddressesOfFamily = append(destinationIPAddressesOfFamily, ip)
+				}
+			}
+		}
+		// the destination of the traffic is the pod IPs or node IPs instead of the load balancer IPs when
+		// the floating IP is turned off, e.g. the pod IPs are attached to the backend pools.
+		if az.isLBBackendPoolTypePodIP() {
+			destinationIPAddressesOfFamily = az.getServiceSecurityRulePodIPs(service, isIPv6)
+			if wantLb && len(destinationIPAddressesOfFamily) == 0 {
+				return nil, fmt.Errorf("no pod or node IP for setting up security rules for service %s", service.Name)
+			}
+		} else if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
+			destinationIPAddressesOfFamily = az.getNodePrivateIPs(isIPv6)
+			if wantLb && len(destinationASGIDs) == 0 && len(destinationIPAddressesOfFamily) == 0 {
+				return nil, fmt.Errorf("no node IP for setting up security rules for service %s", service.Name)
+			}
+		} else if len(destinationIPAddressesOfFamily) == 0 {
+			destinationIPAddressesOfFamily = []string{"*"}
+		} else {
+			for _, ip := range additionalIPs {
+				if _, found := findIndex(destinationIPAddressesOfFamily, ip); !found && utilnet.IsIPv6String(ip) == isIPv6 {
+					destinationIPAddressesOfFamily = append(destinationIPAddressesOfFamily, ip)
+				}
+			}
+		}
+		destinationIPAddresses[isIPv6] = destinationIPAddressesOfFamily
+
+		var sourceAddressPrefixesOfFamily []string
+		if (sourceRanges == nil || servicehelpers.IsAllowAll(sourceRanges)) && len(serviceTags) == 0 {
+			if !requiresInternalLoadBalancer(service) || len(service.Spec.LoadBalancerSourceRanges) > 0 {
+				sourceAddressPrefixesOfFamily = []string{"Internet"}
+			}
+		} else {
+			for _, ip := range sourceRanges {
+				if utilnet.IsIPv6CIDR(ip) == isIPv6 {
+					sourceAddressPrefixesOfFamily = append(sourceAddressPrefixesOfFamily, ip.String())
+				}
+			}
+			sourceAddressPrefixesOfFamily = append(sourceAddressPrefixesOfFamily, serviceTags...)
+		}
+		sourceAddressPrefixes[isIPv6] = sourceAddressPrefixesOfFamily
+
+		expectedSecurityRulesOfFamily, err := az.getExpectedSecurityRules(wantLb, ports, sourceAddressPrefixesOfFamily, service, destinationIPAddressesOfFamily, sourceRanges, isIPv6, destinationASGIDs)
+		if err != nil {
+			return nil, err
+		}
+		expectedSecurityRules = append(expectedSecurityRules, expectedSecurityRulesOfFamily...)
 	}
 
 	// update security rules
-	dirtySg, updatedRules, err := az.reconcileSecurityRules(sg, service, serviceName, wantLb, expectedSecurityRules, ports, sourceAddressPrefixes, destinationIPAddresses)
+	applyChanges := func(sg network.SecurityGroup) (bool, network.SecurityGroup, error) {
+		dirtySg, updatedRules, err := az.reconcileSecurityRules(sg, service, serviceName, wantLb, expectedSecurityRules, ports, sourceAddressPrefixes, destinationIPAddresses)
+		if err != nil {
+			return false, sg, err
+		}
+
+		changed := az.ensureSecurityGroupTagged(&sg)
+		if changed {
+			dirtySg = true
+		}
+
+		if dirtySg {
+			sg.SecurityRules = &updatedRules
+		}
+		return dirtySg, sg, nil
+	}
+	dirtySg, sg, err := applyChanges(sg)
 	if err != nil {
 		return nil, err
 	}
 
-	changed := az.ensureSecurityGroupTagged(&sg)
-	if changed {
-		dirtySg = true
-	}
-
 	if dirtySg {
-		sg.SecurityRules = &updatedRules
 		klog.V(2).Infof("reconcileSecurityGroup for service(%s): sg(%s) - updating", serviceName, *sg.Name)
 		klog.V(10).Infof("CreateOrUpdateSecurityGroup(%q): start", *sg.Name)
-		err := az.CreateOrUpdateSecurityGroup(sg)
+		updatedSg, err := az.updateSecurityGroup(&securityGroupUpdate{serviceName: serviceName, sg: sg, applyChanges: applyChanges})
 		if err != nil {
 			klog.V(2).Infof("ensure(%s) abort backoff: sg(%s) - updating", serviceName, *sg.Name)
 			return nil, err
 		}
+		sg = *updatedSg
 		klog.V(10).Infof("CreateOrUpdateSecurityGroup(%q): end", *sg.Name)
 		_ = az.nsgCache.Delete(to.String(sg.Name))
 	}
 	return &sg, nil
 }
 
-func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Service, serviceName string, wantLb bool, expectedSecurityRules []network.SecurityRule, ports []v1.ServicePort, sourceAddressPrefixes []string, destinationIPAddresses []string) (bool, []network.SecurityRule, error) {
+func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Service, serviceName string, wantLb bool, expectedSecurityRules []network.SecurityRule, ports []v1.ServicePort, sourceAddressPrefixes, destinationIPAddresses map[bool][]string) (bool, []network.SecurityRule, error) {
 	dirtySg := false
 	var updatedRules []network.SecurityRule
 	if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityGroupPropertiesFormat.SecurityRules != nil {
@@ -2395,39 +2986,51 @@ func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Se
 	// update security rules: if the service uses a shared rule and is being deleted,
 	// then remove it from the shared rule
 	if useSharedSecurityRule(service) && !wantLb {
-		for _, port := range ports {
-			for _, sourceAddressPrefix := range sourceAddressPrefixes {
-				sharedRuleName := az.getSecurityRuleName(service, port, sourceAddressPrefix)
-				sharedIndex, sharedRule, sharedRuleFound := findSecurityRuleByName(updatedRules, sharedRuleName)
-				if !sharedRuleFound {
-					klog.V(4).Infof("Didn't find shared rule %s for service %s", sharedRuleName, service.Name)
-					continue
-				}
-				if sharedRule.DestinationAddressPrefixes == nil {
-					klog.V(4).Infof("Didn't find DestinationAddressPrefixes in shared rule for service %s", service.Name)
-					continue
-				}
-				existingPrefixes := *sharedRule.DestinationAddressPrefixes
-				for _, destinationIPAddress := range destinationIPAddresses {
-					addressIndex, found := findIndex(existingPrefixes, destinationIPAddress)
-					if !found {
-						klog.Warningf("Didn't find destination address %v in shared rule %s for service %s", destinationIPAddress, sharedRuleName, service.Name)
+		for isIPv6, sourceAddressPrefixesOfFamily := range sourceAddressPrefixes {
+			for _, port := range ports {
+				for _, sourceAddressPrefix := range sourceAddressPrefixesOfFamily {
+					sharedRuleName := az.getSecurityRuleName(service, port, sourceAddressPrefix, isIPv6)
+					sharedIndex, sharedRule, sharedRuleFound := findSecurityRuleByName(updatedRules, sharedRuleName)
+					if !sharedRuleFound {
+						klog.V(4).Infof("Didn't find shared rule %s for service %s", sharedRuleName, service.Name)
 						continue
 					}
-					if len(existingPrefixes) == 1 {
-						updatedRules = append(updatedRules[:sharedIndex], updatedRules[sharedIndex+1:]...)
-					} else {
-						newDestinations := append(existingPrefixes[:addressIndex], existingPrefixes[addressIndex+1:]...)
-						sharedRule.DestinationAddressPrefixes = &newDestinations
-						updatedRules[sharedIndex] = sharedRule
+					if sharedRule.DestinationAddressPrefixes == nil {
+						klog.V(4).Infof("Didn't find DestinationAddressPrefixes in shared rule for service %s", service.Name)
+						continue
+					}
+					existingPrefixes := *sharedRule.DestinationAddressPrefixes
+					for _, destinationIPAddress := range destinationIPAddresses[isIPv6] {
+						addressIndex, found := findIndex(existingPrefixes, destinationIPAddress)
+						if !found {
+							klog.Warningf("Didn't find destination address %v in shared rule %s for service %s", destinationIPAddress, sharedRuleName, service.Name)
+							continue
+						}
+						if len(existingPrefixes) == 1 {
+							updatedRules = append(updatedRules[:sharedIndex], updatedRules[sharedIndex+1:]...)
+						} else {
+							newDestinations := append(existingPrefixes[:addressIndex], existingPrefixes[addressIndex+1:]...)
+							sharedRule.DestinationAddressPrefixes = &newDestinations
+							updatedRules[sharedIndex] = sharedRule
+						}
+						dirtySg = true
 					}
-					dirtySg = true
-				}
 
+				}
 			}
 		}
 	}
 
+	// update security rules: update the destinations of the service in the compacted rules
+	servicePorts, err := az.getServiceSecurityRulePorts(service)
+	if err != nil {
+		return false, nil, err
+	}
+	updatedRules, expectedSecurityRules, compactedRulesChanged := reconcileCompactedSecurityRules(servicePorts, updatedRules, expectedSecurityRules, getServiceSecurityRuleIPs(service, destinationIPAddresses))
+	if compactedRulesChanged {
+		dirtySg = true
+	}
+
 	// update security rules: prepare rules for consolidation
 	for index, rule := range updatedRules {
 		if allowsConsolidation(rule) {
@@ -2440,6 +3043,7 @@ func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Se
 		}
 	}
 	// update security rules: add needed
+	needsCompaction := false
 	for _, expectedRule := range expectedSecurityRules {
 		foundRule := false
 		if findSecurityRule(updatedRules, expectedRule) {
@@ -2454,24 +3058,43 @@ func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Se
 		if !foundRule {
 			klog.V(10).Infof("reconcile(%s)(%t): sg rule(%s) - adding", serviceName, wantLb, *expectedRule.Name)
 
-			nextAvailablePriority, err := getNextAvailablePriority(updatedRules)
+			nextAvailablePriority, err := getNextAvailablePriorityFrom(updatedRules, getDenyRuleMinimumPriority(updatedRules, expectedRule))
 			if err != nil {
-				return false, nil, err
+				if !az.EnableSecurityRuleCompaction || !errors.Is(err, errSecurityGroupPrioritiesExhausted) {
+					return false, nil, fmt.Errorf("failed to add the security rule %s: %w", to.String(expectedRule.Name), err)
+				}
+				// the priority is given when the rules are compacted
+				klog.V(2).Infof("reconcile(%s)(%t): sg rule(%s) - priorities are exhausted, compacting the rules", serviceName, wantLb, *expectedRule.Name)
+				needsCompaction = true
+				expectedRule.Priority = nil
+			} else {
+				expectedRule.Priority = to.Int32Ptr(nextAvailablePriority)
 			}
-
-			expectedRule.Priority = to.Int32Ptr(nextAvailablePriority)
 			updatedRules = append(updatedRules, expectedRule)
 			dirtySg = true
 		}
 	}
 
+	// update security rules: merge the rules of all services when the priorities or the rules run out
+	if az.EnableSecurityRuleCompaction && (needsCompaction || (az.MaximumSecurityRuleCount > 0 && len(updatedRules) > az.MaximumSecurityRuleCount)) {
+		compactedRules, err := compactSecurityRules(updatedRules)
+		if err != nil {
+			return false, nil, fmt.Errorf("failed to compact the security rules: %w", err)
+		}
+		if !reflect.DeepEqual(compactedRules, updatedRules) {
+			klog.V(2).Infof("reconcile(%s)(%t): compacted %d security rules into %d", serviceName, wantLb, len(updatedRules), len(compactedRules))
+			updatedRules = compactedRules
+			dirtySg = true
+		}
+	}
+
 	for _, r := range updatedRules {
 		klog.V(10).Infof("Updated security rule while processing %s: %s:%s -> %s:%s", service.Name, logSafe(r.SourceAddressPrefix), logSafe(r.SourcePortRange), logSafeCollection(r.DestinationAddressPrefix, r.DestinationAddressPrefixes), logSafe(r.DestinationPortRange))
 	}
 	return dirtySg, updatedRules, nil
 }
 
-func (az *Cloud) getExpectedSecurityRules(wantLb bool, ports []v1.ServicePort, sourceAddressPrefixes []string, service *v1.Service, destinationIPAddresses []string, sourceRanges utilnet.IPNetSet) ([]network.SecurityRule, error) {
+func (az *Cloud) getExpectedSecurityRules(wantLb bool, ports []v1.ServicePort, sourceAddressPrefixes []string, service *v1.Service, destinationIPAddresses []string, sourceRanges utilnet.IPNetSet, isIPv6 bool, destinationASGIDs []string) ([]network.SecurityRule, error) {
 	expectedSecurityRules := []network.SecurityRule{}
 
 	if wantLb {
@@ -2482,21 +3105,27 @@ func (az *Cloud) getExpectedSecurityRules(wantLb bool, ports []v1.ServicePort, s
 			if err != nil {
 				return nil, err
 			}
+			destinationPort, err := az.getServicePortBackendPort(service, port)
+			if err != nil {
+				return nil, err
+			}
 			for j := range sourceAddressPrefixes {
 				ix := i*len(sourceAddressPrefixes) + j
-				securityRuleName := az.getSecurityRuleName(service, port, sourceAddressPrefixes[j])
+				securityRuleName := az.getSecurityRuleName(service, port, sourceAddressPrefixes[j], isIPv6)
 				nsgRule := network.SecurityRule{
 					Name: to.StringPtr(securityRuleName),
 					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
 						Protocol:             *securityProto,
 						SourcePortRange:      to.StringPtr("*"),
-						DestinationPortRange: to.StringPtr(strconv.Itoa(int(port.Port))),
+						DestinationPortRange: to.StringPtr(strconv.Itoa(int(destinationPort))),
 						SourceAddressPrefix:  to.StringPtr(sourceAddressPrefixes[j]),
 						Access:               network.SecurityRuleAccessAllow,
 						Direction:            network.SecurityRuleDirectionInbound,
 					},
 				}
-				if len(destinationIPAddresses) == 1 {
+				if len(destinationASGIDs) > 0 {
+					nsgRule.DestinationApplicationSecurityGroups = getApplicationSecurityGroupsByIDs(destinationASGIDs)
+				} else if len(destinationIPAddresses) == 1 {
 					// continue to use DestinationAddressPrefix to avoid NSG updates for existing rules.
 					nsgRule.DestinationAddressPrefix = to.StringPtr(destinationIPAddresses[0])
 				} else {
@@ -2518,19 +3147,25 @@ func (az *Cloud) getExpectedSecurityRules(wantLb bool, ports []v1.ServicePort, s
 				if err != nil {
 					return nil, err
 				}
-				securityRuleName := az.getSecurityRuleName(service, port, "deny_all")
+				destinationPort, err := az.getServicePortBackendPort(service, port)
+				if err != nil {
+					return nil, err
+				}
+				securityRuleName := az.getSecurityRuleName(service, port, "deny_all", isIPv6)
 				nsgRule := network.SecurityRule{
 					Name: to.StringPtr(securityRuleName),
 					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
 						Protocol:             *securityProto,
 						SourcePortRange:      to.StringPtr("*"),
-						DestinationPortRange: to.StringPtr(strconv.Itoa(int(port.Port))),
+						DestinationPortRange: to.StringPtr(strconv.Itoa(int(destinationPort))),
 						SourceAddressPrefix:  to.StringPtr("*"),
 						Access:               network.SecurityRuleAccessDeny,
 						Direction:            network.SecurityRuleDirectionInbound,
 					},
 				}
-				if len(destinationIPAddresses) == 1 {
+				if len(destinationASGIDs) > 0 {
+					nsgRule.DestinationApplicationSecurityGroups = getApplicationSecurityGroupsByIDs(destinationASGIDs)
+				} else if len(destinationIPAddresses) == 1 {
 					// continue to use DestinationAddressPrefix to avoid NSG updates for existing rules.
 					nsgRule.DestinationAddressPrefix = to.StringPtr(destinationIPAddresses[0])
 				} else {
@@ -2702,6 +3337,11 @@ func shouldReleaseExistingOwnedPublicIP(existingPip *network.PublicIPAddress, lb
 		return false
 	}
 
+	// skip deleting the pip retained after the deletion of its service until it is reclaimed
+	if isRetainedPublicIP(existingPip) {
+		return false
+	}
+
 	// Latch some variables for readability purposes.
 	pipName := *(*existingPip).Name
 
@@ -2768,11 +3408,18 @@ func (az *Cloud) ensurePIPTagged(service *v1.Service, pip *network.PublicIPAddre
 	if serviceNames != nil {
 		configTags[consts.ServiceTagKey] = serviceNames
 	}
+	if found, key := findKeyInMapCaseInsensitive(pip.Tags, consts.RetainedServiceKey); found {
+		configTags[key] = pip.Tags[key]
+	}
+	// the pip owned by the service alone records the annotations required to clean up the service
+	ownerServiceNames := parsePIPServiceTag(serviceNames)
+	ownedAlone := len(ownerServiceNames) == 1 && strings.EqualFold(ownerServiceNames[0], getServiceName(service))
+	deleted := addServiceCleanupTags(service, ownedAlone, pip.Tags, configTags)
 
 	tags, changed := az.reconcileTags(pip.Tags, configTags)
 	pip.Tags = tags
 
-	return changed
+	return changed || deleted
 }
 
 // This reconciles the PublicIP resources similar to how the LB is reconciled.
@@ -2782,11 +3429,11 @@ func (az *Cloud) reconcilePublicIP(clusterName string, service *v1.Service, lbNa
 	serviceIPTagRequest := getServiceIPTagRequestForPublicIP(service)
 
 	var (
-		lb               *network.LoadBalancer
-		desiredPipName   string
-		err              error
-		shouldPIPExisted bool
+		lb  *network.LoadBalancer
+		err error
 	)
+	desiredPipNames := make(map[bool]string)
+	shouldPIPExisted := make(map[bool]bool)
 
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
 
@@ -2796,9 +3443,11 @@ func (az *Cloud) reconcilePublicIP(clusterName string, service *v1.Service, lbNa
 	}
 
 	if !isInternal && wantLb {
-		desiredPipName, shouldPIPExisted, err = az.determinePublicIPName(clusterName, service, &pips)
-		if err != nil {
-			return nil, err
+		for _, isIPv6 := range getServiceIPFamilies(service) {
+			desiredPipNames[isIPv6], shouldPIPExisted[isIPv6], err = az.determinePublicIPName(clusterName, service, &pips, isIPv6)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -2810,7 +3459,7 @@ func (az *Cloud) reconcilePublicIP(clusterName string, service *v1.Service, lbNa
 		lb = &loadBalancer
 	}
 
-	discoveredDesiredPublicIP, pipsToBeDeleted, deletedDesiredPublicIP, pipsToBeUpdated, err := az.getPublicIPUpdates(clusterName, service, pips, wantLb, isInternal, desiredPipName, serviceName, serviceIPTagRequest, shouldPIPExisted)
+	discoveredDesiredPublicIPs, pipsToBeDeleted, deletedDesiredPublicIPs, pipsToBeUpdated, err := az.getPublicIPUpdates(clusterName, service, pips, wantLb, isInternal, desiredPipNames, serviceName, serviceIPTagRequest, shouldPIPExisted)
 	if err != nil {
 		return nil, err
 	}
@@ -2841,33 +3490,48 @@ func (az *Cloud) reconcilePublicIP(clusterName string, service *v1.Service, lbNa
 	}
 
 	if !isInternal && wantLb {
-		// Confirm desired public ip resource exists
-		var pip *network.PublicIPAddress
-		domainNameLabel, found := getPublicIPDomainNameLabel(service)
-		errorIfPublicIPDoesNotExist := shouldPIPExisted && discoveredDesiredPublicIP && !deletedDesiredPublicIP
-		if pip, err = az.ensurePublicIPExists(service, desiredPipName, domainNameLabel, clusterName, errorIfPublicIPDoesNotExist, found); err != nil {
-			return nil, err
+		// Confirm desired public ip resources exist, and return the one of the primary IP family
+		var primaryPIP *network.PublicIPAddress
+		for _, isIPv6 := range getServiceIPFamilies(service) {
+			domainNameLabel, found := getPublicIPDomainNameLabel(service, isIPv6)
+			errorIfPublicIPDoesNotExist := shouldPIPExisted[isIPv6] && discoveredDesiredPublicIPs[isIPv6] && !deletedDesiredPublicIPs[isIPv6]
+			pip, err := az.ensurePublicIPExists(service, desiredPipNames[isIPv6], domainNameLabel, clusterName, errorIfPublicIPDoesNotExist, found, isIPv6)
+			if err != nil {
+				return nil, err
+			}
+			if primaryPIP == nil {
+				primaryPIP = pip
+			}
 		}
-		return pip, nil
+		return primaryPIP, nil
 	}
 	return nil, nil
 }
 
-func (az *Cloud) getPublicIPUpdates(clusterName string, service *v1.Service, pips []network.PublicIPAddress, wantLb bool, isInternal bool, desiredPipName string, serviceName string, serviceIPTagRequest serviceIPTagRequest, serviceAnnotationRequestsNamedPublicIP bool) (bool, []*network.PublicIPAddress, bool, []*network.PublicIPAddress, error) {
+// getPublicIPUpdates returns the public IPs to be deleted and updated. The desired public IP names
+// and whether the named public IPs are requested by the service annotation are keyed by isIPv6.
+func (az *Cloud) getPublicIPUpdates(clusterName string, service *v1.Service, pips []network.PublicIPAddress, wantLb bool, isInternal bool, desiredPipNames map[bool]string, serviceName string, serviceIPTagRequest serviceIPTagRequest, serviceAnnotationRequestsNamedPublicIP map[bool]bool) (map[bool]bool, []*network.PublicIPAddress, map[bool]bool, []*network.PublicIPAddress, error) {
 	var (
-		err                       error
-		discoveredDesiredPublicIP bool
-		deletedDesiredPublicIP    bool
-		pipsToBeDeleted           []*network.PublicIPAddress
-		pipsToBeUpdated           []*network.PublicIPAddress
+		err             error
+		pipsToBeDeleted []*network.PublicIPAddress
+		pipsToBeUpdated []*network.PublicIPAddress
 	)
+	discoveredDesiredPublicIPs := make(map[bool]bool)
+	deletedDesiredPublicIPs := make(map[bool]bool)
 	for i := range pips {
 		pip := pips[i]
 		pipName := *pip.Name
 
 		// If we've been told to use a specific public ip by the client, let's track whether or not it actually existed
 		// when we inspect the set in Azure.
-		discoveredDesiredPublicIP = discoveredDesiredPublicIP || wantLb && !isInternal && pipName == desiredPipName
+		isIPv6 := pip.PublicIPAddressPropertiesFormat != nil && strings.EqualFold(string(pip.PublicIPAddressVersion), string(network.IPVersionIPv6))
+		desiredPipName := desiredPipNames[isIPv6]
+		for isIPv6, name := range desiredPipNames {
+			if pipName == name {
+				desiredPipName = name
+				discoveredDesiredPublicIPs[isIPv6] = discoveredDesiredPublicIPs[isIPv6] || wantLb && !isInternal
+			}
+		}
 
 		// Now, let's perform additional analysis to determine if we should release the public ips we have found.
 		// We can only let them go if (a) they are owned by this service and (b) they meet the criteria for deletion.
@@ -2878,9 +3542,15 @@ func (az *Cloud) getPublicIPUpdates(clusterName string, service *v1.Service, pip
 				klog.V(2).Infof("reconcilePublicIP for service(%s): unbinding the service from pip %s", serviceName, *pip.Name)
 				err = unbindServiceFromPIP(&pip, service, serviceName, clusterName)
 				if err != nil {
-					return false, nil, false, nil, err
+					return nil, nil, nil, nil, err
 				}
 				dirtyPIP = true
+
+				// keep the pip no longer used by any service instead of deleting it if it should be retained
+				if az.shouldRetainPublicIP(service) && len(parsePIPServiceTag(to.StringPtr(getServiceFromPIPServiceTags(pip.Tags)))) == 0 {
+					klog.V(2).Infof("reconcilePublicIP for service(%s): retaining pip %s", serviceName, *pip.Name)
+					retainPublicIP(&pip, serviceName, clusterName)
+				}
 			}
 			if !isUserAssignedPIP {
 				changed := az.ensurePIPTagged(service, &pip)
@@ -2893,7 +3563,9 @@ func (az *Cloud) getPublicIPUpdates(clusterName string, service *v1.Service, pip
 				pipsToBeDeleted = append(pipsToBeDeleted, &pip)
 
 				// Flag if we deleted the desired public ip
-				deletedDesiredPublicIP = deletedDesiredPublicIP || pipName == desiredPipName
+				for isIPv6, name := range desiredPipNames {
+					deletedDesiredPublicIPs[isIPv6] = deletedDesiredPublicIPs[isIPv6] || pipName == name
+				}
 
 				// An aside: It would be unusual, but possible, for us to delete a public ip referred to explicitly by name
 				// in Service annotations (which is usually reserved for non-service-owned externals), if that IP is tagged as
@@ -2910,10 +3582,12 @@ func (az *Cloud) getPublicIPUpdates(clusterName string, service *v1.Service, pip
 		}
 	}
 
-	if !isInternal && serviceAnnotationRequestsNamedPublicIP && !discoveredDesiredPublicIP && wantLb {
-		return false, nil, false, nil, fmt.Errorf("reconcilePublicIP for service(%s): pip(%s) not found", serviceName, desiredPipName)
+	for isIPv6, requestsNamedPublicIP := range serviceAnnotationRequestsNamedPublicIP {
+		if !isInternal && requestsNamedPublicIP && !discoveredDesiredPublicIPs[isIPv6] && wantLb {
+			return nil, nil, nil, nil, fmt.Errorf("reconcilePublicIP for service(%s): pip(%s) not found", serviceName, desiredPipNames[isIPv6])
+		}
 	}
-	return discoveredDesiredPublicIP, pipsToBeDeleted, deletedDesiredPublicIP, pipsToBeUpdated, err
+	return discoveredDesiredPublicIPs, pipsToBeDeleted, deletedDesiredPublicIPs, pipsToBeUpdated, err
 }
 
 // safeDeletePublicIP deletes public IP by removing its reference first.
@@ -3040,7 +3714,7 @@ func equalLoadBalancingRulePropertiesFormat(s *network.LoadBalancingRuleProperti
 		reflect.DeepEqual(s.FrontendPort, t.FrontendPort) &&
 		reflect.DeepEqual(s.BackendPort, t.BackendPort) &&
 		reflect.DeepEqual(s.Probe, t.Probe) &&
-		reflect.DeepEqual(s.EnableFloatingIP, t.EnableFloatingIP) &&
+		reflect.DeepEqual(to.Bool(s.EnableFloatingIP), to.Bool(t.EnableFloatingIP)) &&
 		reflect.DeepEqual(to.Bool(s.DisableOutboundSnat), to.Bool(t.DisableOutboundSnat))
 
 	if wantLB && s.IdleTimeoutInMinutes != nil && t.IdleTimeoutInMinutes != nil {
@@ -3050,7 +3724,7 @@ func equalLoadBalancingRulePropertiesFormat(s *network.LoadBalancingRuleProperti
 }
 
 // This compares rule's Name, Protocol, SourcePortRange, DestinationPortRange, SourceAddressPrefix, Access, and Direction.
-// Note that it compares rule's DestinationAddressPrefix only when it's not consolidated rule as such rule does not have DestinationAddressPrefix defined.
+// Note that it compares rule's DestinationAddressPrefix and DestinationApplicationSecurityGroups only when it's not consolidated rule as such rule does not have DestinationAddressPrefix defined.
 // We intentionally do not compare DestinationAddressPrefixes in consolidated case because reconcileSecurityRule has to consider the two rules equal,
 // despite different DestinationAddressPrefixes, in order to give it a chance to consolidate the two rules.
 func findSecurityRule(rules []network.SecurityRule, rule network.SecurityRule) bool {
@@ -3077,6 +3751,9 @@ func findSecurityRule(rules []network.SecurityRule, rule network.SecurityRule) b
 			if !reflect.DeepEqual(to.StringSlice(existingRule.DestinationAddressPrefixes), to.StringSlice(rule.DestinationAddressPrefixes)) {
 				continue
 			}
+			if !areApplicationSecurityGroupsEqual(existingRule.DestinationApplicationSecurityGroups, rule.DestinationApplicationSecurityGroups) {
+				continue
+			}
 		}
 		if !strings.EqualFold(string(existingRule.Access), string(rule.Access)) {
 			continue
@@ -3117,6 +3794,56 @@ func (az *Cloud) isBackendPoolPreConfigured(service *v1.Service) bool {
 	return preConfigured
 }
 
+// getServiceLoadBalancerClass returns the Azure load balancer class selected by spec.loadBalancerClass of the service,
+// and whether the service should be handled by the Azure cloud provider. The services without spec.loadBalancerClass
+// are handled without a class, and the ones selecting an unknown class are left to other load balancer implementations.
+func (az *Cloud) getServiceLoadBalancerClass(service *v1.Service) (*LoadBalancerClass, bool) {
+	if service.Spec.LoadBalancerClass == nil {
+		return nil, true
+	}
+	for i := range az.LoadBalancerClasses {
+		if az.LoadBalancerClasses[i].Name == *service.Spec.LoadBalancerClass {
+			return &az.LoadBalancerClasses[i], true
+		}
+	}
+	return nil, false
+}
+
+// applyServiceLoadBalancerClass returns a copy of the service with the settings of its load balancer class applied
+// to the annotations that are not set on the service, or the service itself if it doesn't select a class. It also
+// returns false if the service selects an unknown class and should not be handled by the Azure cloud provider.
+func (az *Cloud) applyServiceLoadBalancerClass(service *v1.Service) (*v1.Service, bool) {
+	loadBalancerClass, shouldHandle := az.getServiceLoadBalancerClass(service)
+	if !shouldHandle || loadBalancerClass == nil {
+		return service, shouldHandle
+	}
+
+	annotations := make(map[string]string)
+	for key, value := range loadBalancerClass.Annotations {
+		annotations[key] = value
+	}
+	if loadBalancerClass.Internal {
+		annotations[consts.ServiceAnnotationLoadBalancerInternal] = consts.TrueAnnotationValue
+	}
+	if loadBalancerClass.InternalSubnet != "" {
+		annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = loadBalancerClass.InternalSubnet
+	}
+	if loadBalancerClass.PublicIPResourceGroup != "" {
+		annotations[consts.ServiceAnnotationLoadBalancerResourceGroup] = loadBalancerClass.PublicIPResourceGroup
+	}
+
+	copyService := service.DeepCopy()
+	if copyService.Annotations == nil {
+		copyService.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		if _, found := copyService.Annotations[key]; !found {
+			copyService.Annotations[key] = value
+		}
+	}
+	return copyService, true
+}
+
 // Check if service requires an internal load balancer.
 func requiresInternalLoadBalancer(service *v1.Service) bool {
 	if l, found := service.Annotations[consts.ServiceAnnotationLoadBalancerInternal]; found {
@@ -3185,6 +3912,7 @@ func getServiceTags(service *v1.Service) []string {
 // The service owns the pip if:
 // 1. The serviceName is included in the service tags of a system-created pip.
 // 2. The service.Spec.LoadBalancerIP matches the IP address of a user-created pip.
+// 3. The service requests a system-created pip retained by the same cluster by its name or IP address.
 func serviceOwnsPublicIP(service *v1.Service, pip *network.PublicIPAddress, clusterName string) (bool, bool) {
 	if service == nil || pip == nil {
 		klog.Warningf("serviceOwnsPublicIP: nil service or public IP")
@@ -3203,7 +3931,15 @@ func serviceOwnsPublicIP(service *v1.Service, pip *network.PublicIPAddress, clus
 		clusterTag := getClusterFromPIPClusterTags(pip.Tags)
 
 		// if there is no service tag on the pip, it is user-created pip
+		// unless it is retained after the deletion of its service
 		if serviceTag == "" {
+			if isRetainedPublicIP(pip) {
+				if clusterTag != clusterName {
+					return false, false
+				}
+				return serviceRequestsPublicIP(service, pip), false
+			}
+
 			return strings.EqualFold(to.String(pip.IPAddress), service.Spec.LoadBalancerIP), true
 		}
 
@@ -66,58 +66,66 @@ func (bc *backendPoolTypeNodeIPConfig) EnsureHostsInPool(service *v1.Service, no
 }
 
 func (bc *backendPoolTypeNodeIPConfig) CleanupVMSetFromBackendPoolByCondition(slb *network.LoadBalancer, service *v1.Service, nodes []*v1.Node, clusterName string, shouldRemoveVMSetFromSLB func(string) bool) (*network.LoadBalancer, error) {
-	lbBackendPoolName := getBackendPoolName(clusterName, service)
+	lbBackendPoolNames := getBackendPoolNames(clusterName)
 	lbResourceGroup := bc.getLoadBalancerResourceGroup()
-	lbBackendPoolID := bc.getBackendPoolID(to.String(slb.Name), lbResourceGroup, lbBackendPoolName)
 	newBackendPools := make([]network.BackendAddressPool, 0)
 	if slb.LoadBalancerPropertiesFormat != nil && slb.BackendAddressPools != nil {
 		newBackendPools = *slb.BackendAddressPools
 	}
-	vmSetNameToBackendIPConfigurationsToBeDeleted := make(map[string][]network.InterfaceIPConfiguration)
+	// lbBackendPoolID -> vmSetName -> IP configurations to be deleted
+	backendPoolIDToBackendIPConfigurationsToBeDeleted := make(map[string]map[string][]network.InterfaceIPConfiguration)
 
 	for j, bp := range newBackendPools {
-		if strings.EqualFold(to.String(bp.Name), lbBackendPoolName) {
-			klog.V(2).Infof("bc.CleanupVMSetFromBackendPoolByCondition: checking the backend pool %s from standard load balancer %s", to.String(bp.Name), to.String(slb.Name))
-			if bp.BackendAddressPoolPropertiesFormat != nil && bp.BackendIPConfigurations != nil {
-				for i := len(*bp.BackendIPConfigurations) - 1; i >= 0; i-- {
-					ipConf := (*bp.BackendIPConfigurations)[i]
-					ipConfigID := to.String(ipConf.ID)
-					_, vmSetName, err := bc.VMSet.GetNodeNameByIPConfigurationID(ipConfigID)
-					if err != nil && !errors.Is(err, cloudprovider.InstanceNotFound) {
-						return nil, err
-					}
+		found, isIPv6 := isLBBackendPoolsExisting(lbBackendPoolNames, bp.Name)
+		if !found {
+			continue
+		}
+		lbBackendPoolID := bc.getBackendPoolID(to.String(slb.Name), lbResourceGroup, lbBackendPoolNames[isIPv6])
+		klog.V(2).Infof("bc.CleanupVMSetFromBackendPoolByCondition: checking the backend pool %s from standard load balancer %s", to.String(bp.Name), to.String(slb.Name))
+		if bp.BackendAddressPoolPropertiesFormat != nil && bp.BackendIPConfigurations != nil {
+			for i := len(*bp.BackendIPConfigurations) - 1; i >= 0; i-- {
+				ipConf := (*bp.BackendIPConfigurations)[i]
+				ipConfigID := to.String(ipConf.ID)
+				_, vmSetName, err := bc.VMSet.GetNodeNameByIPConfigurationID(ipConfigID)
+				if err != nil && !errors.Is(err, cloudprovider.InstanceNotFound) {
+					return nil, err
+				}
 
-					if shouldRemoveVMSetFromSLB(vmSetName) {
-						klog.V(2).Infof("bc.CleanupVMSetFromBackendPoolByCondition: found unwanted vmSet %s, decouple it from the LB", vmSetName)
-						// construct a backendPool that only contains the IP config of the node to be deleted
-						interfaceIPConfigToBeDeleted := network.InterfaceIPConfiguration{
-							ID: to.StringPtr(ipConfigID),
-						}
-						vmSetNameToBackendIPConfigurationsToBeDeleted[vmSetName] = append(vmSetNameToBackendIPConfigurationsToBeDeleted[vmSetName], interfaceIPConfigToBeDeleted)
-						*bp.BackendIPConfigurations = append((*bp.BackendIPConfigurations)[:i], (*bp.BackendIPConfigurations)[i+1:]...)
+				if shouldRemoveVMSetFromSLB(vmSetName) {
+					klog.V(2).Infof("bc.CleanupVMSetFromBackendPoolByCondition: found unwanted vmSet %s, decouple it from the LB", vmSetName)
+					// construct a backendPool that only contains the IP config of the node to be deleted
+					interfaceIPConfigToBeDeleted := network.InterfaceIPConfiguration{
+						ID: to.StringPtr(ipConfigID),
+					}
+					if backendPoolIDToBackendIPConfigurationsToBeDeleted[lbBackendPoolID] == nil {
+						backendPoolIDToBackendIPConfigurationsToBeDeleted[lbBackendPoolID] = make(map[string][]network.InterfaceIPConfiguration)
 					}
+					vmSetNameToBackendIPConfigurationsToBeDeleted := backendPoolIDToBackendIPConfigurationsToBeDeleted[lbBackendPoolID]
+					vmSetNameToBackendIPConfigurationsToBeDeleted[vmSetName] = append(vmSetNameToBackendIPConfigurationsToBeDeleted[vmSetName], interfaceIPConfigToBeDeleted)
+					*bp.BackendIPConfigurations = append((*bp.BackendIPConfigurations)[:i], (*bp.BackendIPConfigurations)[i+1:]...)
 				}
 			}
-
-			newBackendPools[j] = bp
-			break
 		}
+
+		newBackendPools[j] = bp
 	}
 
-	for vmSetName := range vmSetNameToBackendIPConfigurationsToBeDeleted {
-		backendIPConfigurationsToBeDeleted := vmSetNameToBackendIPConfigurationsToBeDeleted[vmSetName]
-		backendpoolToBeDeleted := &[]network.BackendAddressPool{
-			{
-				ID: to.StringPtr(lbBackendPoolID),
-				BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
-					BackendIPConfigurations: &backendIPConfigurationsToBeDeleted,
+	for lbBackendPoolID, vmSetNameToBackendIPConfigurationsToBeDeleted := range backendPoolIDToBackendIPConfigurationsToBeDeleted {
+		for vmSetName := range vmSetNameToBackendIPConfigurationsToBeDeleted {
+			backendIPConfigurationsToBeDeleted := vmSetNameToBackendIPConfigurationsToBeDeleted[vmSetName]
+			backendpoolToBeDeleted := &[]network.BackendAddressPool{
+				{
+					ID: to.StringPtr(lbBackendPoolID),
+					BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+						BackendIPConfigurations: &backendIPConfigurationsToBeDeleted,
+					},
 				},
-			},
-		}
-		// decouple the backendPool from the node
-		err := bc.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, backendpoolToBeDeleted, true)
-		if err != nil {
-			return nil, err
+			}
+			// decouple the backendPool from the node
+			err := bc.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, backendpoolToBeDeleted, true)
+			if err != nil {
+				return nil, err
+			}
 		}
 		slb.BackendAddressPools = &newBackendPools
 		// Proactively disable the etag to prevent etag mismatch error when putting lb later.
@@ -136,25 +144,27 @@ func (bc *backendPoolTypeNodeIPConfig) ReconcileBackendPools(clusterName string,
 		newBackendPools = *lb.BackendAddressPools
 	}
 
-	foundBackendPool := false
+	foundBackendPools := map[bool]bool{}
 	changed := false
 	lbName := *lb.Name
 
 	serviceName := getServiceName(service)
-	lbBackendPoolName := getBackendPoolName(clusterName, service)
-	lbBackendPoolID := bc.getBackendPoolID(lbName, bc.getLoadBalancerResourceGroup(), lbBackendPoolName)
+	lbBackendPoolNames := getBackendPoolNames(clusterName)
 	vmSetName := bc.mapLoadBalancerNameToVMSet(lbName, clusterName)
 	isBackendPoolPreConfigured := bc.isBackendPoolPreConfigured(service)
 
 	for i := len(newBackendPools) - 1; i >= 0; i-- {
 		bp := newBackendPools[i]
-		if strings.EqualFold(*bp.Name, lbBackendPoolName) {
-			klog.V(10).Infof("bc.ReconcileBackendPools for service (%s): lb backendpool - found wanted backendpool. not adding anything", serviceName)
-			foundBackendPool = true
+		found, isIPv6 := isLBBackendPoolsExisting(lbBackendPoolNames, bp.Name)
+		if found {
+			lbBackendPoolName := lbBackendPoolNames[isIPv6]
+			lbBackendPoolID := bc.getBackendPoolID(lbName, bc.getLoadBalancerResourceGroup(), lbBackendPoolName)
+			klog.V(10).Infof("bc.ReconcileBackendPools for service (%s): lb backendpool - found wanted backendpool %s. not adding anything", serviceName, lbBackendPoolName)
+			foundBackendPools[isIPv6] = true
 
 			// Don't bother to remove unused nodeIPConfiguration if backend pool is pre configured
 			if isBackendPoolPreConfigured {
-				break
+				continue
 			}
 
 			// If the LB backend pool type is configured from nodeIP or podIP
@@ -215,15 +225,16 @@ func (bc *backendPoolTypeNodeIPConfig) ReconcileBackendPools(clusterName string,
 					return false, false, err
 				}
 			}
-			break
 		} else {
 			klog.V(10).Infof("bc.ReconcileBackendPools for service (%s): lb backendpool - found unmanaged backendpool %s", serviceName, *bp.Name)
 		}
 	}
 
-	if !foundBackendPool {
-		isBackendPoolPreConfigured = newBackendPool(lb, isBackendPoolPreConfigured, bc.PreConfiguredBackendPoolLoadBalancerTypes, getServiceName(service), getBackendPoolName(clusterName, service))
-		changed = true
+	for _, isIPv6 := range getServiceIPFamilies(service) {
+		if !foundBackendPools[isIPv6] {
+			isBackendPoolPreConfigured = newBackendPool(lb, isBackendPoolPreConfigured, bc.PreConfiguredBackendPoolLoadBalancerTypes, serviceName, lbBackendPoolNames[isIPv6])
+			changed = true
+		}
 	}
 
 	return isBackendPoolPreConfigured, changed, err
@@ -238,15 +249,12 @@ func newBackendPoolTypeNodeIP(c *Cloud) BackendPool {
 }
 
 func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName, clusterName, lbName string, backendPool network.BackendAddressPool) error {
-	vnetResourceGroup := bi.ResourceGroup
-	if len(bi.VnetResourceGroup) > 0 {
-		vnetResourceGroup = bi.VnetResourceGroup
-	}
-	vnetID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s", bi.SubscriptionID, vnetResourceGroup, bi.VnetName)
+	vnetID := bi.getVirtualNetworkID()
 
 	changed := false
 	numOfAdd := 0
-	lbBackendPoolName := getBackendPoolName(clusterName, service)
+	isIPv6 := isBackendPoolIPv6(to.String(backendPool.Name))
+	lbBackendPoolName := getBackendPoolName(clusterName, isIPv6)
 	if strings.EqualFold(to.String(backendPool.Name), lbBackendPoolName) &&
 		backendPool.BackendAddressPoolPropertiesFormat != nil {
 		if backendPool.LoadBalancerBackendAddresses == nil {
@@ -279,7 +287,10 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 					return err
 				}
 
-				if !strings.EqualFold(vmSetName, bi.mapLoadBalancerNameToVMSet(lbName, clusterName)) {
+				vmSetNameOfLB := bi.mapLoadBalancerNameToVMSet(lbName, clusterName)
+				if lbConfig := bi.getMultipleStandardLoadBalancerConfiguration(vmSetNameOfLB); lbConfig != nil {
+					shouldSkip = !lbConfig.hasNodePool(vmSetName)
+				} else if !strings.EqualFold(vmSetName, vmSetNameOfLB) {
 					shouldSkip = true
 
 					lbNamePrefix := strings.TrimSuffix(lbName, consts.InternalLoadBalancerNameSuffix)
@@ -296,7 +307,11 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 				continue
 			}
 
-			privateIP := getNodePrivateIPAddress(service, node)
+			privateIP := getNodePrivateIPAddress(node, isIPv6)
+			if privateIP == "" {
+				klog.V(4).Infof("bi.EnsureHostsInPool: skipping attaching node %s to the backend pool %s, because it has no private IP of the same family", node.Name, lbBackendPoolName)
+				continue
+			}
 			if !existingIPs.Has(privateIP) {
 				name := node.Name
 				if utilnet.IsIPv6String(privateIP) {
@@ -327,52 +342,54 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 }
 
 func (bi *backendPoolTypeNodeIP) CleanupVMSetFromBackendPoolByCondition(slb *network.LoadBalancer, service *v1.Service, nodes []*v1.Node, clusterName string, shouldRemoveVMSetFromSLB func(string) bool) (*network.LoadBalancer, error) {
-	lbBackendPoolName := getBackendPoolName(clusterName, service)
+	lbBackendPoolNames := getBackendPoolNames(clusterName)
 	newBackendPools := make([]network.BackendAddressPool, 0)
 	if slb.LoadBalancerPropertiesFormat != nil && slb.BackendAddressPools != nil {
 		newBackendPools = *slb.BackendAddressPools
 	}
 
-	var updatedPrivateIPs bool
+	updatedBackendPoolNames := sets.NewString()
 	for j, bp := range newBackendPools {
-		if strings.EqualFold(to.String(bp.Name), lbBackendPoolName) {
-			klog.V(2).Infof("bi.CleanupVMSetFromBackendPoolByCondition: checking the backend pool %s from standard load balancer %s", to.String(bp.Name), to.String(slb.Name))
-			vmIPsToBeDeleted := sets.NewString()
-			for _, node := range nodes {
-				vmSetName, err := bi.VMSet.GetNodeVMSetName(node)
-				if err != nil {
-					return nil, err
-				}
+		found, isIPv6 := isLBBackendPoolsExisting(lbBackendPoolNames, bp.Name)
+		if !found {
+			continue
+		}
+		lbBackendPoolName := lbBackendPoolNames[isIPv6]
+		klog.V(2).Infof("bi.CleanupVMSetFromBackendPoolByCondition: checking the backend pool %s from standard load balancer %s", to.String(bp.Name), to.String(slb.Name))
+		vmIPsToBeDeleted := sets.NewString()
+		for _, node := range nodes {
+			vmSetName, err := bi.VMSet.GetNodeVMSetName(node)
+			if err != nil {
+				return nil, err
+			}
 
-				if shouldRemoveVMSetFromSLB(vmSetName) {
-					privateIP := getNodePrivateIPAddress(service, node)
-					klog.V(4).Infof("bi.CleanupVMSetFromBackendPoolByCondition: removing ip %s from the backend pool %s", privateIP, lbBackendPoolName)
-					vmIPsToBeDeleted.Insert(privateIP)
-				}
+			if shouldRemoveVMSetFromSLB(vmSetName) {
+				privateIP := getNodePrivateIPAddress(node, isIPv6)
+				klog.V(4).Infof("bi.CleanupVMSetFromBackendPoolByCondition: removing ip %s from the backend pool %s", privateIP, lbBackendPoolName)
+				vmIPsToBeDeleted.Insert(privateIP)
 			}
+		}
 
-			if bp.BackendAddressPoolPropertiesFormat != nil && bp.LoadBalancerBackendAddresses != nil {
-				for i := len(*bp.LoadBalancerBackendAddresses) - 1; i >= 0; i-- {
-					if (*bp.LoadBalancerBackendAddresses)[i].LoadBalancerBackendAddressPropertiesFormat != nil &&
-						vmIPsToBeDeleted.Has(to.String((*bp.LoadBalancerBackendAddresses)[i].IPAddress)) {
-						*bp.LoadBalancerBackendAddresses = append((*bp.LoadBalancerBackendAddresses)[:i], (*bp.LoadBalancerBackendAddresses)[i+1:]...)
-						updatedPrivateIPs = true
-					}
+		if bp.BackendAddressPoolPropertiesFormat != nil && bp.LoadBalancerBackendAddresses != nil {
+			for i := len(*bp.LoadBalancerBackendAddresses) - 1; i >= 0; i-- {
+				if (*bp.LoadBalancerBackendAddresses)[i].LoadBalancerBackendAddressPropertiesFormat != nil &&
+					vmIPsToBeDeleted.Has(to.String((*bp.LoadBalancerBackendAddresses)[i].IPAddress)) {
+					*bp.LoadBalancerBackendAddresses = append((*bp.LoadBalancerBackendAddresses)[:i], (*bp.LoadBalancerBackendAddresses)[i+1:]...)
+					updatedBackendPoolNames.Insert(strings.ToLower(lbBackendPoolName))
 				}
 			}
-
-			newBackendPools[j] = bp
-			break
 		}
+
+		newBackendPools[j] = bp
 	}
-	if updatedPrivateIPs {
+	if updatedBackendPoolNames.Len() > 0 {
 		klog.V(2).Infof("bi.CleanupVMSetFromBackendPoolByCondition: updating lb %s since there are private IP updates", to.String(slb.Name))
 		slb.BackendAddressPools = &newBackendPools
 
 		for _, backendAddressPool := range *slb.BackendAddressPools {
-			if strings.EqualFold(lbBackendPoolName, to.String(backendAddressPool.Name)) {
+			if updatedBackendPoolNames.Has(strings.ToLower(to.String(backendAddressPool.Name))) {
 				if err := bi.CreateOrUpdateLBBackendPool(to.String(slb.Name), backendAddressPool); err != nil {
-					return nil, fmt.Errorf("bi.CleanupVMSetFromBackendPoolByCondition: failed to create or update backend pool %s: %w", lbBackendPoolName, err)
+					return nil, fmt.Errorf("bi.CleanupVMSetFromBackendPoolByCondition: failed to create or update backend pool %s: %w", to.String(backendAddressPool.Name), err)
 				}
 			}
 		}
@@ -387,24 +404,26 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 		newBackendPools = *lb.BackendAddressPools
 	}
 
-	foundBackendPool := false
+	foundBackendPools := map[bool]bool{}
 	changed := false
 	lbName := *lb.Name
 	serviceName := getServiceName(service)
-	lbBackendPoolName := getBackendPoolName(clusterName, service)
+	lbBackendPoolNames := getBackendPoolNames(clusterName)
 	vmSetName := bi.mapLoadBalancerNameToVMSet(lbName, clusterName)
-	lbBackendPoolID := bi.getBackendPoolID(to.String(lb.Name), bi.getLoadBalancerResourceGroup(), getBackendPoolName(clusterName, service))
 	isBackendPoolPreConfigured := bi.isBackendPoolPreConfigured(service)
 
 	for i := len(newBackendPools) - 1; i >= 0; i-- {
 		bp := newBackendPools[i]
-		if strings.EqualFold(*bp.Name, lbBackendPoolName) {
-			klog.V(10).Infof("bi.ReconcileBackendPools for service (%s): found wanted backendpool. not adding anything", serviceName)
-			foundBackendPool = true
+		found, isIPv6 := isLBBackendPoolsExisting(lbBackendPoolNames, bp.Name)
+		if found {
+			lbBackendPoolName := lbBackendPoolNames[isIPv6]
+			lbBackendPoolID := bi.getBackendPoolID(to.String(lb.Name), bi.getLoadBalancerResourceGroup(), lbBackendPoolName)
+			klog.V(10).Infof("bi.ReconcileBackendPools for service (%s): found wanted backendpool %s. not adding anything", serviceName, lbBackendPoolName)
+			foundBackendPools[isIPv6] = true
 
 			// Don't bother to remove unused nodeIP if backend pool is pre configured
 			if isBackendPoolPreConfigured {
-				break
+				continue
 			}
 
 			// If the LB backend pool type is configured from nodeIPConfiguration
@@ -422,7 +441,7 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 				newBackendPools[i].BackendAddressPoolPropertiesFormat.BackendIPConfigurations = &[]network.InterfaceIPConfiguration{}
 				newBackendPools[i].Etag = nil
 				lb.Etag = nil
-				break
+				continue
 			}
 
 			var nodeIPAddressesToBeDeleted []string
@@ -441,15 +460,16 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 					}
 				}
 			}
-			break
 		} else {
 			klog.V(10).Infof("bi.ReconcileBackendPools for service (%s): found unmanaged backendpool %s", serviceName, *bp.Name)
 		}
 	}
 
-	if !foundBackendPool {
-		isBackendPoolPreConfigured = newBackendPool(lb, isBackendPoolPreConfigured, bi.PreConfiguredBackendPoolLoadBalancerTypes, getServiceName(service), getBackendPoolName(clusterName, service))
-		changed = true
+	for _, isIPv6 := range getServiceIPFamilies(service) {
+		if !foundBackendPools[isIPv6] {
+			isBackendPoolPreConfigured = newBackendPool(lb, isBackendPoolPreConfigured, bi.PreConfiguredBackendPoolLoadBalancerTypes, serviceName, lbBackendPoolNames[isIPv6])
+			changed = true
+		}
 	}
 
 	return isBackendPoolPreConfigured, changed, nil
@@ -0,0 +1,445 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+var (
+	// podIPBackendPoolUpdateInterval defines the interval of updating the pod IP based backend pools.
+	podIPBackendPoolUpdateInterval = 5 * time.Second
+)
+
+type backendPoolTypePodIP struct {
+	*Cloud
+}
+
+func newBackendPoolTypePodIP(c *Cloud) BackendPool {
+	return &backendPoolTypePodIP{c}
+}
+
+// EnsureHostsInPool makes the IP addresses in the backend pool of the service the same as the ready pod IPs
+// of the service. The nodes are not used since the load balancer sends the traffic to the pods directly.
+func (bpi *backendPoolTypePodIP) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName, clusterName, lbName string, backendPool network.BackendAddressPool) error {
+	isIPv6 := isBackendPoolIPv6(to.String(backendPool.Name))
+	lbBackendPoolName := bpi.getServiceBackendPoolName(clusterName, service, isIPv6)
+	if !strings.EqualFold(to.String(backendPool.Name), lbBackendPoolName) ||
+		backendPool.BackendAddressPoolPropertiesFormat == nil {
+		return nil
+	}
+
+	serviceName := getServiceName(service)
+	if bpi.podIPBackendPoolUpdater != nil {
+		bpi.podIPBackendPoolUpdater.track(serviceName, clusterName, lbName)
+	}
+
+	podIPs, err := bpi.getServicePodIPs(service, isIPv6)
+	if err != nil {
+		return fmt.Errorf("bpi.EnsureHostsInPool: failed to get the pod IPs of service %s: %w", serviceName, err)
+	}
+
+	numOfAdd, numOfRemove := 0, 0
+	existingIPs := sets.NewString()
+	lbBackendPoolAddresses := make([]network.LoadBalancerBackendAddress, 0)
+	if backendPool.LoadBalancerBackendAddresses != nil {
+		for _, loadBalancerBackendAddress := range *backendPool.LoadBalancerBackendAddresses {
+			var ipAddress string
+			if loadBalancerBackendAddress.LoadBalancerBackendAddressPropertiesFormat != nil {
+				ipAddress = to.String(loadBalancerBackendAddress.IPAddress)
+			}
+			if _, ok := podIPs[ipAddress]; !ok {
+				klog.V(4).Infof("bpi.EnsureHostsInPool: removing IP %s from the backend pool %s", ipAddress, lbBackendPoolName)
+				numOfRemove++
+				continue
+			}
+			existingIPs.Insert(ipAddress)
+			lbBackendPoolAddresses = append(lbBackendPoolAddresses, loadBalancerBackendAddress)
+		}
+	}
+
+	vnetID := bpi.getVirtualNetworkID()
+	for _, podIP := range sets.StringKeySet(podIPs).List() {
+		if existingIPs.Has(podIP) {
+			continue
+		}
+		klog.V(6).Infof("bpi.EnsureHostsInPool: adding %s with ip address %s", podIPs[podIP], podIP)
+		lbBackendPoolAddresses = append(lbBackendPoolAddresses, network.LoadBalancerBackendAddress{
+			Name: to.StringPtr(podIPs[podIP]),
+			LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+				IPAddress:      to.StringPtr(podIP),
+				VirtualNetwork: &network.SubResource{ID: to.StringPtr(vnetID)},
+			},
+		})
+		numOfAdd++
+	}
+
+	if numOfAdd > 0 || numOfRemove > 0 {
+		backendPool.LoadBalancerBackendAddresses = &lbBackendPoolAddresses
+		klog.V(2).Infof("bpi.EnsureHostsInPool: updating backend pool %s of load balancer %s to add %d pods and remove %d pods", lbBackendPoolName, lbName, numOfAdd, numOfRemove)
+		if err := bpi.CreateOrUpdateLBBackendPool(lbName, backendPool); err != nil {
+			return fmt.Errorf("bpi.EnsureHostsInPool: failed to update backend pool %s: %w", lbBackendPoolName, err)
+		}
+	}
+
+	return nil
+}
+
+// CleanupVMSetFromBackendPoolByCondition does nothing since there are no nodes in the backend pools of the services.
+func (bpi *backendPoolTypePodIP) CleanupVMSetFromBackendPoolByCondition(slb *network.LoadBalancer, service *v1.Service, nodes []*v1.Node, clusterName string, shouldRemoveVMSetFromSLB func(string) bool) (*network.LoadBalancer, error) {
+	return slb, nil
+}
+
+// ReconcileBackendPools creates the backend pools of the enabled IP families of the service,
+// and removes the ones of the disabled IP families.
+func (bpi *backendPoolTypePodIP) ReconcileBackendPools(clusterName string, service *v1.Service, lb *network.LoadBalancer) (bool, bool, error) {
+	var newBackendPools []network.BackendAddressPool
+	if lb.BackendAddressPools != nil {
+		newBackendPools = *lb.BackendAddressPools
+	}
+
+	foundBackendPools := map[bool]bool{}
+	changed := false
+	serviceName := getServiceName(service)
+	for i := len(newBackendPools) - 1; i >= 0; i-- {
+		bp := newBackendPools[i]
+		for _, isIPv6 := range []bool{false, true} {
+			if !strings.EqualFold(to.String(bp.Name), bpi.getServiceBackendPoolName(clusterName, service, isIPv6)) {
+				continue
+			}
+			if !isServiceIPFamilyEnabled(service, isIPv6) {
+				klog.V(2).Infof("bpi.ReconcileBackendPools for service (%s): removing the backend pool %s of the disabled IP family", serviceName, to.String(bp.Name))
+				newBackendPools = append(newBackendPools[:i], newBackendPools[i+1:]...)
+				changed = true
+				break
+			}
+			klog.V(10).Infof("bpi.ReconcileBackendPools for service (%s): found wanted backendpool %s. not adding anything", serviceName, to.String(bp.Name))
+			foundBackendPools[isIPv6] = true
+		}
+	}
+	if changed {
+		lb.BackendAddressPools = &newBackendPools
+	}
+
+	for _, isIPv6 := range getServiceIPFamilies(service) {
+		if !foundBackendPools[isIPv6] {
+			_ = newBackendPool(lb, false, bpi.PreConfiguredBackendPoolLoadBalancerTypes, serviceName, bpi.getServiceBackendPoolName(clusterName, service, isIPv6))
+			changed = true
+		}
+	}
+
+	// the backend pools owned by the services are never pre-configured
+	return false, changed, nil
+}
+
+// removeServiceBackendPools removes the backend pools owned by the service from the load balancer.
+// It is only needed for the podIP backend pool configuration type, in which each service has its own backend pools.
+func (az *Cloud) removeServiceBackendPools(lb *network.LoadBalancer, clusterName string, service *v1.Service) bool {
+	if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return false
+	}
+
+	changed := false
+	newBackendPools := *lb.BackendAddressPools
+	for i := len(newBackendPools) - 1; i >= 0; i-- {
+		for _, isIPv6 := range []bool{false, true} {
+			if strings.EqualFold(to.String(newBackendPools[i].Name), az.getServiceBackendPoolName(clusterName, service, isIPv6)) {
+				klog.V(2).Infof("removeServiceBackendPools for service (%s): removing the backend pool %s", getServiceName(service), to.String(newBackendPools[i].Name))
+				newBackendPools = append(newBackendPools[:i], newBackendPools[i+1:]...)
+				changed = true
+				break
+			}
+		}
+	}
+	if changed {
+		lb.BackendAddressPools = &newBackendPools
+	}
+	return changed
+}
+
+// listServiceEndpointSlices lists the EndpointSlices of the service from the EndpointSlice informer.
+func (az *Cloud) listServiceEndpointSlices(service *v1.Service) ([]*discoveryv1.EndpointSlice, error) {
+	if az.endpointSliceLister == nil {
+		return nil, fmt.Errorf("azure cloud provider doesn't have the EndpointSlice informer set")
+	}
+	if az.endpointSliceInformerSynced != nil && !az.endpointSliceInformerSynced() {
+		return nil, fmt.Errorf("EndpointSlice informer is not synced when trying to list the EndpointSlices of service %s", getServiceName(service))
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service.Name})
+	return az.endpointSliceLister.EndpointSlices(service.Namespace).List(selector)
+}
+
+// getServicePodIPs returns the IP addresses of the ready endpoints of the service in the given IP family,
+// which are mapped to the names of the backend addresses in the backend pool.
+func (az *Cloud) getServicePodIPs(service *v1.Service, isIPv6 bool) (map[string]string, error) {
+	endpointSlices, err := az.listServiceEndpointSlices(service)
+	if err != nil {
+		return nil, err
+	}
+
+	addressType := discoveryv1.AddressTypeIPv4
+	if isIPv6 {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+
+	podIPs := make(map[string]string)
+	for _, endpointSlice := range endpointSlices {
+		if endpointSlice.AddressType != addressType {
+			continue
+		}
+		for _, endpoint := range endpointSlice.Endpoints {
+			// a nil ready condition should be interpreted as ready
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				name := strings.ReplaceAll(address, ":", "-")
+				if endpoint.TargetRef != nil && endpoint.TargetRef.Name != "" {
+					name = endpoint.TargetRef.Name
+				}
+				podIPs[address] = name
+			}
+		}
+	}
+
+	return podIPs, nil
+}
+
+// getServicePortBackendPort returns the port of the backends which the traffic to the service port is sent to.
+// It is the service port itself if the floating IP is enabled, or the node port if the floating IP is disabled
+// by the service annotation, because only kube-proxy listens on the nodes and the target port is only served by
+// the pods. For the podIP backend pool configuration type, the traffic is sent to the target port of the pods
+// directly.
+func (az *Cloud) getServicePortBackendPort(service *v1.Service, port v1.ServicePort) (int32, error) {
+	if !az.isLBBackendPoolTypePodIP() {
+		if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
+			return port.NodePort, nil
+		}
+		return port.Port, nil
+	}
+
+	if port.TargetPort.Type == intstr.String && port.TargetPort.StrVal != "" {
+		endpointSlices, err := az.listServiceEndpointSlices(service)
+		if err != nil {
+			return 0, err
+		}
+		for _, endpointSlice := range endpointSlices {
+			for _, endpointPort := range endpointSlice.Ports {
+				protocol := v1.ProtocolTCP
+				if endpointPort.Protocol != nil {
+					protocol = *endpointPort.Protocol
+				}
+				if to.String(endpointPort.Name) == port.Name && protocol == port.Protocol && endpointPort.Port != nil {
+					return *endpointPort.Port, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("failed to find the target port %q of service %s in its EndpointSlices", port.TargetPort.StrVal, getServiceName(service))
+	}
+
+	if port.TargetPort.IntVal != 0 {
+		return port.TargetPort.IntVal, nil
+	}
+	return port.Port, nil
+}
+
+// getServiceSecurityRulePodIPs returns the sorted destination IPs of the security rules of the service with the
+// podIP backend pool configuration type, which are the ready pod IPs of the service in the given IP family. The
+// private IPs of the nodes are used instead when the pod IPs are not available, e.g. there are no ready pods.
+func (az *Cloud) getServiceSecurityRulePodIPs(service *v1.Service, isIPv6 bool) []string {
+	podIPs, err := az.getServicePodIPs(service, isIPv6)
+	if err != nil {
+		klog.Warningf("getServiceSecurityRulePodIPs: failed to get the pod IPs of service %s, using the node IPs instead: %v", getServiceName(service), err)
+	}
+	if len(podIPs) > 0 {
+		return sets.StringKeySet(podIPs).List()
+	}
+	return az.getNodePrivateIPs(isIPv6)
+}
+
+// podIPBackendPoolUpdater updates the backend pools and security rules of the services with their latest
+// pod IPs when the EndpointSlices of the services are changed, so that the changes of the pods take effect
+// without waiting for the next reconciliation of the services.
+type podIPBackendPoolUpdater struct {
+	az       *Cloud
+	interval time.Duration
+
+	lock sync.Mutex
+	// services is a mapping from the service to the cluster and load balancer names of its backend pools,
+	// it is updated when the backend pools of the service are reconciled.
+	services map[string]podIPBackendPoolService
+	// servicesToUpdate holds the services whose EndpointSlices have been changed.
+	servicesToUpdate sets.String
+}
+
+// podIPBackendPoolService is the service tracked by the podIPBackendPoolUpdater.
+type podIPBackendPoolService struct {
+	clusterName string
+	lbName      string
+}
+
+// newPodIPBackendPoolUpdater creates a new podIPBackendPoolUpdater.
+func newPodIPBackendPoolUpdater(az *Cloud, interval time.Duration) *podIPBackendPoolUpdater {
+	return &podIPBackendPoolUpdater{
+		az:               az,
+		interval:         interval,
+		services:         make(map[string]podIPBackendPoolService),
+		servicesToUpdate: sets.NewString(),
+	}
+}
+
+// run starts the updater reconciling loop.
+func (u *podIPBackendPoolUpdater) run() {
+	err := wait.PollImmediateInfinite(u.interval, func() (bool, error) {
+		u.updateBackendPools()
+		return false, nil
+	})
+	if err != nil { // this should never happen, if it does, panic
+		panic(err)
+	}
+}
+
+// track records the cluster and load balancer of the service.
+func (u *podIPBackendPoolUpdater) track(serviceName, clusterName, lbName string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.services[serviceName] = podIPBackendPoolService{clusterName: clusterName, lbName: lbName}
+}
+
+// untrack forgets the service, which is called when the service no longer has a load balancer.
+func (u *podIPBackendPoolUpdater) untrack(serviceName string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	delete(u.services, serviceName)
+	u.servicesToUpdate.Delete(serviceName)
+}
+
+// enqueue queues the service to have its backend pools updated in the next round.
+func (u *podIPBackendPoolUpdater) enqueue(serviceName string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.servicesToUpdate.Insert(serviceName)
+}
+
+// updateBackendPools updates the backend pools of the queued services.
+// The services failed to be updated are queued again to be retried in the next round.
+func (u *podIPBackendPoolUpdater) updateBackendPools() {
+	u.lock.Lock()
+	servicesToUpdate := u.servicesToUpdate
+	u.servicesToUpdate = sets.NewString()
+	u.lock.Unlock()
+
+	for _, serviceName := range servicesToUpdate.List() {
+		if err := u.updateBackendPoolsOfService(serviceName); err != nil {
+			klog.Errorf("updateBackendPools: failed to update the backend pools of service %s: %v", serviceName, err)
+			u.enqueue(serviceName)
+		}
+	}
+}
+
+func (u *podIPBackendPoolUpdater) updateBackendPoolsOfService(serviceName string) error {
+	u.lock.Lock()
+	tracked, ok := u.services[serviceName]
+	u.lock.Unlock()
+	if !ok {
+		klog.V(4).Infof("updateBackendPoolsOfService: the load balancer of service %s has not been reconciled, skipping", serviceName)
+		return nil
+	}
+
+	if u.az.serviceLister == nil {
+		return fmt.Errorf("azure cloud provider doesn't have the Service informer set")
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(serviceName)
+	if err != nil {
+		return err
+	}
+	service, err := u.az.serviceLister.Services(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		klog.V(4).Infof("updateBackendPoolsOfService: service %s has been deleted, skipping", serviceName)
+		u.untrack(serviceName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+		klog.V(4).Infof("updateBackendPoolsOfService: service %s is not a LoadBalancer service, skipping", serviceName)
+		return nil
+	}
+	service, shouldHandle := u.az.applyServiceLoadBalancerClass(service)
+	if !shouldHandle {
+		klog.V(4).Infof("updateBackendPoolsOfService: service %s selects a load balancer class not handled by Azure, skipping", serviceName)
+		return nil
+	}
+
+	lbName := tracked.lbName
+	lb, exist, err := u.az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return err
+	}
+	if !exist || lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		klog.V(4).Infof("updateBackendPoolsOfService: no backend pools found in the load balancer %s of service %s, skipping", lbName, serviceName)
+		return nil
+	}
+
+	for _, backendPool := range *lb.BackendAddressPools {
+		for _, isIPv6 := range getServiceIPFamilies(service) {
+			if strings.EqualFold(to.String(backendPool.Name), u.az.getServiceBackendPoolName("", service, isIPv6)) {
+				if err := u.az.LoadBalancerBackendPool.EnsureHostsInPool(service, nil, "", "", tracked.clusterName, lbName, backendPool); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// the pod IPs are the destinations of the security rules of the service
+	var lbIPs []string
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			lbIPs = append(lbIPs, ingress.IP)
+		}
+	}
+	if len(lbIPs) == 0 {
+		klog.V(4).Infof("updateBackendPoolsOfService: service %s has no load balancer IP, skipping updating its security rules", serviceName)
+		return nil
+	}
+	if _, err := u.az.reconcileSecurityGroup(tracked.clusterName, service, &lbIPs, true /* wantLb */); err != nil {
+		return err
+	}
+
+	return nil
+}
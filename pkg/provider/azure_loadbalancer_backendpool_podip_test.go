@@ -0,0 +1,568 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func buildTestEndpointSlice(serviceName string, addressType discoveryv1.AddressType, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%s", serviceName, addressType),
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: serviceName},
+		},
+		AddressType: addressType,
+		Endpoints:   endpoints,
+		Ports: []discoveryv1.EndpointPort{
+			{
+				Name: to.StringPtr("http"),
+				Port: to.Int32Ptr(8080),
+			},
+		},
+	}
+}
+
+func setTestEndpointSliceLister(az *Cloud, endpointSlices ...*discoveryv1.EndpointSlice) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, endpointSlice := range endpointSlices {
+		_ = indexer.Add(endpointSlice)
+	}
+	az.endpointSliceLister = discoverylisters.NewEndpointSliceLister(indexer)
+}
+
+func TestEnsureHostsInPoolPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	bpi := newBackendPoolTypePodIP(az)
+
+	setTestEndpointSliceLister(az,
+		buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv4,
+			discoveryv1.Endpoint{
+				Addresses:  []string{"10.244.0.2"},
+				Conditions: discoveryv1.EndpointConditions{Ready: to.BoolPtr(true)},
+				TargetRef:  &v1.ObjectReference{Kind: "Pod", Name: "pod-2"},
+			},
+			discoveryv1.Endpoint{
+				Addresses:  []string{"10.244.0.3"},
+				Conditions: discoveryv1.EndpointConditions{Ready: to.BoolPtr(false)},
+				TargetRef:  &v1.ObjectReference{Kind: "Pod", Name: "pod-3"},
+			},
+			discoveryv1.Endpoint{
+				Addresses: []string{"10.244.0.4"},
+			},
+		),
+		buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv6,
+			discoveryv1.Endpoint{
+				Addresses: []string{"fd00::2"},
+			},
+		),
+		buildTestEndpointSlice("svc-2", discoveryv1.AddressTypeIPv4,
+			discoveryv1.Endpoint{
+				Addresses: []string{"10.244.0.5"},
+			},
+		),
+	)
+
+	backendPool := network.BackendAddressPool{
+		Name: to.StringPtr("asvc1"),
+		BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+			LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{
+				{
+					Name: to.StringPtr("pod-2"),
+					LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+						IPAddress: to.StringPtr("10.244.0.2"),
+					},
+				},
+				{
+					Name: to.StringPtr("pod-9"),
+					LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+						IPAddress: to.StringPtr("10.244.0.9"),
+					},
+				},
+			},
+		},
+	}
+	expectedBackendPool := network.BackendAddressPool{
+		Name: to.StringPtr("asvc1"),
+		BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+			LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{
+				{
+					Name: to.StringPtr("pod-2"),
+					LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+						IPAddress: to.StringPtr("10.244.0.2"),
+					},
+				},
+				{
+					Name: to.StringPtr("10.244.0.4"),
+					LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+						IPAddress:      to.StringPtr("10.244.0.4"),
+						VirtualNetwork: &network.SubResource{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet")},
+					},
+				},
+			},
+		},
+	}
+
+	lbClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	lbClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), "lb", "asvc1", expectedBackendPool, gomock.Any()).Return(nil)
+	az.LoadBalancerClient = lbClient
+
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	err := bpi.EnsureHostsInPool(&service, nil, "", "", "kubernetes", "lb", backendPool)
+	assert.NoError(t, err)
+
+	// the backend pool is not updated if there are no changes
+	err = bpi.EnsureHostsInPool(&service, nil, "", "", "kubernetes", "lb", expectedBackendPool)
+	assert.NoError(t, err)
+
+	// the backend pools of other services are ignored
+	err = bpi.EnsureHostsInPool(&service, nil, "", "", "kubernetes", "lb", network.BackendAddressPool{Name: to.StringPtr("kubernetes")})
+	assert.NoError(t, err)
+
+	// the EndpointSlice informer is required
+	az.endpointSliceLister = nil
+	err = bpi.EnsureHostsInPool(&service, nil, "", "", "kubernetes", "lb", backendPool)
+	assert.EqualError(t, err, "bpi.EnsureHostsInPool: failed to get the pod IPs of service default/svc-1: azure cloud provider doesn't have the EndpointSlice informer set")
+}
+
+func TestReconcileBackendPoolsPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	bpi := newBackendPoolTypePodIP(az)
+
+	lb := &network.LoadBalancer{
+		Name: to.StringPtr("kubernetes"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: to.StringPtr("kubernetes")},
+				{Name: to.StringPtr("asvc1-IPv6")},
+			},
+		},
+	}
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	preConfigured, changed, err := bpi.ReconcileBackendPools("kubernetes", &service, lb)
+	assert.NoError(t, err)
+	assert.False(t, preConfigured)
+	assert.True(t, changed)
+	assert.Equal(t, []network.BackendAddressPool{
+		{Name: to.StringPtr("kubernetes")},
+		{Name: to.StringPtr("asvc1"), BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{}},
+	}, *lb.BackendAddressPools)
+
+	service.Spec.IPFamilies = []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}
+	_, changed, err = bpi.ReconcileBackendPools("kubernetes", &service, lb)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 3, len(*lb.BackendAddressPools))
+	assert.Equal(t, "asvc1-IPv6", to.String((*lb.BackendAddressPools)[2].Name))
+
+	_, changed, err = bpi.ReconcileBackendPools("kubernetes", &service, lb)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	assert.True(t, az.removeServiceBackendPools(lb, "kubernetes", &service))
+	assert.Equal(t, []network.BackendAddressPool{{Name: to.StringPtr("kubernetes")}}, *lb.BackendAddressPools)
+	assert.False(t, az.removeServiceBackendPools(lb, "kubernetes", &service))
+}
+
+func TestGetServicePortBackendPort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	setTestEndpointSliceLister(az, buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv4))
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+
+	for _, testCase := range []struct {
+		description          string
+		backendPoolType      string
+		annotations          map[string]string
+		targetPort           intstr.IntOrString
+		portName             string
+		expectedBackendPort  int32
+		expectedErrorMessage string
+	}{
+		{
+			description:         "the service port should be used if the backend pool type is not podIP",
+			backendPoolType:     consts.LoadBalancerBackendPoolConfigurationTypeNodeIP,
+			targetPort:          intstr.FromInt(8080),
+			expectedBackendPort: 80,
+		},
+		{
+			description:         "the node port should be used if the floating IP is disabled",
+			backendPoolType:     consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+			annotations:         map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: consts.TrueAnnotationValue},
+			targetPort:          intstr.FromInt(8080),
+			expectedBackendPort: 10080,
+		},
+		{
+			description:         "the target port should be used if the backend pool type is podIP even if the floating IP is disabled",
+			backendPoolType:     consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			annotations:         map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: consts.TrueAnnotationValue},
+			targetPort:          intstr.FromInt(8081),
+			expectedBackendPort: 8081,
+		},
+		{
+			description:         "the service port should be used if the target port is not set",
+			backendPoolType:     consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			expectedBackendPort: 80,
+		},
+		{
+			description:         "the target port should be used if the backend pool type is podIP",
+			backendPoolType:     consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			targetPort:          intstr.FromInt(8081),
+			expectedBackendPort: 8081,
+		},
+		{
+			description:         "the named target port should be resolved from the EndpointSlices",
+			backendPoolType:     consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			targetPort:          intstr.FromString("web"),
+			portName:            "http",
+			expectedBackendPort: 8080,
+		},
+		{
+			description:          "an error should be returned if the named target port cannot be resolved",
+			backendPoolType:      consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			targetPort:           intstr.FromString("web"),
+			portName:             "https",
+			expectedErrorMessage: "failed to find the target port \"web\" of service default/svc-1 in its EndpointSlices",
+		},
+	} {
+		t.Run(testCase.description, func(t *testing.T) {
+			az.LoadBalancerBackendPoolConfigurationType = testCase.backendPoolType
+			service.Annotations = testCase.annotations
+			port := service.Spec.Ports[0]
+			port.Name = testCase.portName
+			port.TargetPort = testCase.targetPort
+
+			backendPort, err := az.getServicePortBackendPort(&service, port)
+			if testCase.expectedErrorMessage != "" {
+				assert.EqualError(t, err, testCase.expectedErrorMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, testCase.expectedBackendPort, backendPort)
+		})
+	}
+}
+
+func TestGetExpectedLBRulesPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	setTestEndpointSliceLister(az, buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv4))
+
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	service.Spec.Ports[0].Name = "http"
+	service.Spec.Ports[0].TargetPort = intstr.FromString("web")
+	service.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	service.Spec.HealthCheckNodePort = 32456
+
+	probes, rules, err := az.getExpectedLBRules(&service, "fipID", "bpID", "lb", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(probes))
+	assert.Equal(t, int32(8080), to.Int32(probes[0].Port))
+	assert.Equal(t, network.ProbeProtocolTCP, probes[0].Protocol)
+	assert.Equal(t, 1, len(rules))
+	assert.Equal(t, int32(80), to.Int32(rules[0].FrontendPort))
+	assert.Equal(t, int32(8080), to.Int32(rules[0].BackendPort))
+	assert.False(t, to.Bool(rules[0].EnableFloatingIP))
+}
+
+func TestPodIPBackendPoolUpdater(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	_ = indexer.Add(&service)
+	az.serviceLister = corelisters.NewServiceLister(indexer)
+
+	backendPool := network.BackendAddressPool{
+		Name:                               to.StringPtr("asvc1"),
+		BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{},
+	}
+	lb := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: to.StringPtr("kubernetes")},
+				backendPool,
+			},
+		},
+	}
+	lbClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	lbClient.EXPECT().Get(gomock.Any(), gomock.Any(), "lb", gomock.Any()).Return(lb, nil).Times(2)
+	az.LoadBalancerClient = lbClient
+
+	mockBackendPool := NewMockBackendPool(ctrl)
+	gomock.InOrder(
+		mockBackendPool.EXPECT().EnsureHostsInPool(gomock.Any(), gomock.Any(), "", "", "kubernetes", "lb", backendPool).Return(fmt.Errorf("error")),
+		mockBackendPool.EXPECT().EnsureHostsInPool(gomock.Any(), gomock.Any(), "", "", "kubernetes", "lb", backendPool).Return(nil),
+	)
+	az.LoadBalancerBackendPool = mockBackendPool
+
+	updater := newPodIPBackendPoolUpdater(az, podIPBackendPoolUpdateInterval)
+	az.podIPBackendPoolUpdater = updater
+
+	// the services which have not been reconciled are skipped
+	az.enqueueEndpointSliceService(buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv4))
+	updater.updateBackendPools()
+	assert.Equal(t, 0, updater.servicesToUpdate.Len())
+
+	// the services failed to be updated are retried
+	updater.track("default/svc-1", "kubernetes", "lb")
+	az.enqueueEndpointSliceService(buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv4))
+	updater.updateBackendPools()
+	assert.True(t, updater.servicesToUpdate.Has("default/svc-1"))
+	_ = az.lbCache.Delete("lb")
+	updater.updateBackendPools()
+	assert.Equal(t, 0, updater.servicesToUpdate.Len())
+
+	// the deleted services are untracked
+	_ = indexer.Delete(&service)
+	updater.enqueue("default/svc-1")
+	updater.updateBackendPools()
+	_, tracked := updater.services["default/svc-1"]
+	assert.False(t, tracked)
+}
+
+func TestPodIPBackendPoolUpdaterLoadBalancerClass(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	az.LoadBalancerClasses = []LoadBalancerClass{{Name: "azure-internal", Internal: true}}
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	service.Spec.LoadBalancerClass = to.StringPtr("azure-internal")
+	other := getTestService("svc-2", v1.ProtocolTCP, nil, false, 80)
+	other.Spec.LoadBalancerClass = to.StringPtr("other")
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	_ = indexer.Add(&service)
+	_ = indexer.Add(&other)
+	az.serviceLister = corelisters.NewServiceLister(indexer)
+
+	backendPool := network.BackendAddressPool{
+		Name:                               to.StringPtr("asvc1"),
+		BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{},
+	}
+	lb := network.LoadBalancer{
+		Name: to.StringPtr("lb-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{backendPool},
+		},
+	}
+	lbClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	lbClient.EXPECT().Get(gomock.Any(), gomock.Any(), "lb-internal", gomock.Any()).Return(lb, nil).Times(1)
+	az.LoadBalancerClient = lbClient
+
+	// the settings of the class are applied to the service
+	mockBackendPool := NewMockBackendPool(ctrl)
+	mockBackendPool.EXPECT().EnsureHostsInPool(gomock.Any(), gomock.Any(), "", "", "kubernetes", "lb-internal", backendPool).DoAndReturn(
+		func(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName, clusterName, lbName string, backendPool network.BackendAddressPool) error {
+			assert.True(t, requiresInternalLoadBalancer(service))
+			return nil
+		})
+	az.LoadBalancerBackendPool = mockBackendPool
+
+	updater := newPodIPBackendPoolUpdater(az, podIPBackendPoolUpdateInterval)
+	updater.track("default/svc-1", "kubernetes", "lb-internal")
+	updater.track("default/svc-2", "kubernetes", "lb-internal")
+	// the service of a class not handled by Azure is skipped
+	assert.NoError(t, updater.updateBackendPoolsOfService("default/svc-2"))
+	assert.NoError(t, updater.updateBackendPoolsOfService("default/svc-1"))
+}
+
+func TestEnsureHostsInPoolPodIPUpdateError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	az.podIPBackendPoolUpdater = newPodIPBackendPoolUpdater(az, podIPBackendPoolUpdateInterval)
+	bpi := newBackendPoolTypePodIP(az)
+	setTestEndpointSliceLister(az, buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv4, discoveryv1.Endpoint{Addresses: []string{"10.244.0.2"}}))
+
+	lbClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	lbClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&retry.Error{HTTPStatusCode: http.StatusInternalServerError, RawError: fmt.Errorf("error")})
+	az.LoadBalancerClient = lbClient
+
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	backendPool := network.BackendAddressPool{
+		Name:                               to.StringPtr("asvc1"),
+		BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{},
+	}
+	err := bpi.EnsureHostsInPool(&service, nil, "", "", "kubernetes", "lb", backendPool)
+	assert.Error(t, err)
+	assert.Equal(t, podIPBackendPoolService{clusterName: "kubernetes", lbName: "lb"}, az.podIPBackendPoolUpdater.services["default/svc-1"])
+}
+
+func TestReconcileSecurityGroupPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc                 string
+		endpoints            []discoveryv1.Endpoint
+		nodePrivateIPs       map[string]sets.String
+		expectedDestinations []string
+		expectedErr          bool
+	}{
+		{
+			desc: "the ready pod IPs should be the destinations",
+			endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.244.0.3"}},
+				{Addresses: []string{"10.244.0.2"}},
+				{Addresses: []string{"10.244.0.4"}, Conditions: discoveryv1.EndpointConditions{Ready: to.BoolPtr(false)}},
+			},
+			nodePrivateIPs:       map[string]sets.String{"node-0": sets.NewString("10.0.0.4")},
+			expectedDestinations: []string{"10.244.0.2", "10.244.0.3"},
+		},
+		{
+			desc:                 "the node IPs should be the destinations if there are no ready pods",
+			nodePrivateIPs:       map[string]sets.String{"node-0": sets.NewString("10.0.0.4", "fd00::4"), "node-1": sets.NewString("10.0.0.5")},
+			expectedDestinations: []string{"10.0.0.4", "10.0.0.5"},
+		},
+		{
+			desc:        "an error should be returned if there are no pod or node IPs",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+			setTestEndpointSliceLister(az, buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv4, tc.endpoints...))
+			if tc.nodePrivateIPs != nil {
+				az.nodePrivateIPs = tc.nodePrivateIPs
+			}
+			service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+			service.Spec.Ports[0].TargetPort = intstr.FromInt(8080)
+
+			mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+			mockSGClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, az.SecurityGroupName, gomock.Any()).Return(network.SecurityGroup{
+				Name:                          to.StringPtr(az.SecurityGroupName),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{SecurityRules: &[]network.SecurityRule{}},
+			}, nil).MaxTimes(1)
+			if !tc.expectedErr {
+				mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, az.SecurityGroupName, gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName, networkSecurityGroupName string, parameters network.SecurityGroup, etag string) *retry.Error {
+						assert.Equal(t, 1, len(*parameters.SecurityRules))
+						rule := (*parameters.SecurityRules)[0]
+						assert.Equal(t, "8080", to.String(rule.DestinationPortRange))
+						assert.Nil(t, rule.DestinationAddressPrefix)
+						assert.Equal(t, tc.expectedDestinations, to.StringSlice(rule.DestinationAddressPrefixes))
+						return nil
+					})
+			}
+
+			_, err := az.reconcileSecurityGroup(testClusterName, &service, &[]string{"1.2.3.4"}, true /* wantLb */)
+			assert.Equal(t, tc.expectedErr, err != nil)
+		})
+	}
+}
+
+func TestPodIPBackendPoolUpdaterSecurityGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	service.Spec.Ports[0].TargetPort = intstr.FromInt(8080)
+	service.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	_ = indexer.Add(&service)
+	az.serviceLister = corelisters.NewServiceLister(indexer)
+	setTestEndpointSliceLister(az, buildTestEndpointSlice("svc-1", discoveryv1.AddressTypeIPv4, discoveryv1.Endpoint{Addresses: []string{"10.244.0.3"}}))
+
+	lbClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	lbClient.EXPECT().Get(gomock.Any(), gomock.Any(), "lb", gomock.Any()).Return(network.LoadBalancer{
+		Name:                         to.StringPtr("lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{BackendAddressPools: &[]network.BackendAddressPool{}},
+	}, nil)
+	az.LoadBalancerClient = lbClient
+
+	// the security rule of the service is updated with the new pod IP
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, az.SecurityGroupName, gomock.Any()).Return(network.SecurityGroup{
+		Name: to.StringPtr(az.SecurityGroupName),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{
+					Name: to.StringPtr("asvc1-TCP-80-Internet"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Protocol:                 network.SecurityRuleProtocolTCP,
+						SourcePortRange:          to.StringPtr("*"),
+						SourceAddressPrefix:      to.StringPtr("Internet"),
+						DestinationPortRange:     to.StringPtr("8080"),
+						DestinationAddressPrefix: to.StringPtr("10.244.0.2"),
+						Access:                   network.SecurityRuleAccessAllow,
+						Priority:                 to.Int32Ptr(500),
+						Direction:                network.SecurityRuleDirectionInbound,
+					},
+				},
+			},
+		},
+	}, nil)
+	mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, az.SecurityGroupName, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, networkSecurityGroupName string, parameters network.SecurityGroup, etag string) *retry.Error {
+			assert.Equal(t, 1, len(*parameters.SecurityRules))
+			assert.Equal(t, "10.244.0.3", to.String((*parameters.SecurityRules)[0].DestinationAddressPrefix))
+			return nil
+		})
+
+	updater := newPodIPBackendPoolUpdater(az, podIPBackendPoolUpdateInterval)
+	updater.track("default/svc-1", "kubernetes", "lb")
+	assert.NoError(t, updater.updateBackendPoolsOfService("default/svc-1"))
+}
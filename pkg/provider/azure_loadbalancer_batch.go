@@ -0,0 +1,187 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/klogr"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/batch"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+// loadBalancerUpdate is the load balancer expected by the reconciliation of a service. The snapshot records the
+// load balancer read by the reconciliation, and it is nil if the update doesn't come from the reconciliation.
+type loadBalancerUpdate struct {
+	service  *v1.Service
+	lb       network.LoadBalancer
+	snapshot *loadBalancerSnapshot
+}
+
+// securityGroupUpdate is the security group expected by the reconciliation of a service. The applyChanges
+// re-applies the security rules of the service onto another security group, and reports whether it is changed.
+type securityGroupUpdate struct {
+	serviceName  string
+	sg           network.SecurityGroup
+	applyChanges func(sg network.SecurityGroup) (bool, network.SecurityGroup, error)
+}
+
+func initLoadBalancerUpdateProcessors(az *Cloud) {
+	logger := klogr.NewWithOptions(klogr.WithFormat(klogr.FormatKlog)).WithName("cloud-provider-azure").WithValues("type", "batch")
+
+	processorOptions := []batch.ProcessorOption{
+		batch.WithVerboseLogLevel(3),
+	}
+
+	lbBatchFn := func(ctx context.Context, key string, values []interface{}) ([]interface{}, error) {
+		updates := make([]*loadBalancerUpdate, len(values))
+		for i, value := range values {
+			updates[i] = value.(*loadBalancerUpdate)
+		}
+
+		errs := az.createOrUpdateLBs(updates)
+		results := make([]interface{}, len(errs))
+		for i, err := range errs {
+			if err != nil {
+				results[i] = err
+			}
+		}
+		return results, nil
+	}
+
+	lbProcessorOptions := append(processorOptions,
+		batch.WithLogger(logger.WithValues("operation", "update_load_balancer")),
+		batch.WithMetricsRecorder(metrics.NewBatchProcessorMetricsRecorder("batch", "update", "load_balancer")))
+
+	nsgBatchFn := func(ctx context.Context, key string, values []interface{}) ([]interface{}, error) {
+		updates := make([]*securityGroupUpdate, len(values))
+		for i, value := range values {
+			updates[i] = value.(*securityGroupUpdate)
+		}
+
+		sgs, errs := az.createOrUpdateSecurityGroups(updates)
+		results := make([]interface{}, len(errs))
+		for i, err := range errs {
+			if err != nil {
+				results[i] = err
+			} else {
+				results[i] = sgs[i]
+			}
+		}
+		return results, nil
+	}
+
+	nsgProcessorOptions := append(processorOptions,
+		batch.WithLogger(logger.WithValues("operation", "update_security_group")),
+		batch.WithMetricsRecorder(metrics.NewBatchProcessorMetricsRecorder("batch", "update", "security_group")))
+
+	az.lbUpdateProcessor = batch.NewProcessor(lbBatchFn, lbProcessorOptions...)
+	az.nsgUpdateProcessor = batch.NewProcessor(nsgBatchFn, nsgProcessorOptions...)
+}
+
+// createOrUpdateLBs updates the load balancer once with the merged changes of the services, and returns the
+// result of each service. If the merged update fails, each service updates the load balancer on its own so
+// that the error of one service does not fail the others.
+func (az *Cloud) createOrUpdateLBs(updates []*loadBalancerUpdate) []error {
+	errs := make([]error, len(updates))
+	err := az.createOrUpdateLB(updates)
+	if err == nil || len(updates) == 1 {
+		errs[0] = err
+		return errs
+	}
+
+	klog.Warningf("createOrUpdateLBs(%s): failed to update the load balancer for %d services: %v, updating them one by one", to.String(updates[0].lb.Name), len(updates), err)
+	for i, update := range updates {
+		errs[i] = az.createOrUpdateLB([]*loadBalancerUpdate{update})
+	}
+	return errs
+}
+
+// updateSecurityGroup updates the security group with the changes of the service. The concurrent updates of the
+// same security group are merged into one update. It returns the security group after the update.
+func (az *Cloud) updateSecurityGroup(update *securityGroupUpdate) (*network.SecurityGroup, error) {
+	if az.nsgUpdateProcessor == nil {
+		sgs, errs := az.createOrUpdateSecurityGroups([]*securityGroupUpdate{update})
+		return sgs[0], errs[0]
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	key := metrics.KeyFromAttributes(az.SubscriptionID, az.SecurityGroupResourceGroup, to.String(update.sg.Name))
+	result, err := az.nsgUpdateProcessor.Do(ctx, key, update)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*network.SecurityGroup), nil
+}
+
+// createOrUpdateSecurityGroups applies the changes of the other services onto the security group of the first
+// one, updates it once and returns the result of each service. If the merged update fails, each service updates
+// the security group on its own so that the error of one service does not fail the others.
+func (az *Cloud) createOrUpdateSecurityGroups(updates []*securityGroupUpdate) ([]*network.SecurityGroup, []error) {
+	sgs := make([]*network.SecurityGroup, len(updates))
+	errs := make([]error, len(updates))
+
+	// the services failed to apply their changes are excluded from the update
+	var merged []*securityGroupUpdate
+	var mergedIndexes []int
+	sg := updates[0].sg
+	for i, update := range updates {
+		if i > 0 {
+			var err error
+			if _, sg, err = update.applyChanges(sg); err != nil {
+				klog.Errorf("createOrUpdateSecurityGroups(%s): failed to apply the changes of service(%s): %v", to.String(sg.Name), update.serviceName, err)
+				errs[i] = err
+				continue
+			}
+		}
+		merged = append(merged, update)
+		mergedIndexes = append(mergedIndexes, i)
+	}
+
+	updatedSg, rerr := &sg, az.createOrUpdateSecurityGroup(sg)
+	if rerr != nil && rerr.HTTPStatusCode == http.StatusPreconditionFailed {
+		// Re-apply the changes of the services onto the latest security group, which may be updated by other services.
+		updatedSg, rerr = az.resolveSecurityGroupConflict(merged, rerr)
+	}
+	if rerr == nil {
+		for _, i := range mergedIndexes {
+			sgs[i] = updatedSg
+		}
+		return sgs, errs
+	}
+	if len(merged) == 1 {
+		errs[mergedIndexes[0]] = rerr.Error()
+		return sgs, errs
+	}
+
+	klog.Warningf("createOrUpdateSecurityGroups(%s): failed to update the security group for %d services: %v, updating them one by one", to.String(sg.Name), len(merged), rerr.Error())
+	for j, update := range merged {
+		i := mergedIndexes[j]
+		updatedSgs, updateErrs := az.createOrUpdateSecurityGroups([]*securityGroupUpdate{update})
+		sgs[i], errs[i] = updatedSgs[0], updateErrs[0]
+	}
+	return sgs, errs
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestLoadBalancerUpdate(serviceName string) *loadBalancerUpdate {
+	svc := getTestService(serviceName, v1.ProtocolTCP, nil, false, 80)
+	return &loadBalancerUpdate{
+		service: &svc,
+		lb: network.LoadBalancer{
+			Name: to.StringPtr("lb"),
+			Etag: to.StringPtr("1"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr("a" + serviceName)}},
+				LoadBalancingRules:       &[]network.LoadBalancingRule{{Name: to.StringPtr("a" + serviceName + "-TCP-80")}},
+			},
+		},
+	}
+}
+
+func TestCreateOrUpdateLBs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	updates := []*loadBalancerUpdate{
+		getTestLoadBalancerUpdate("service1"),
+		getTestLoadBalancerUpdate("service2"),
+	}
+
+	// the changes of the services are merged into one update
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").DoAndReturn(func(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+		assert.Equal(t, []string{"aservice2", "aservice1"}, getNames(t, parameters.FrontendIPConfigurations))
+		assert.Equal(t, []string{"aservice1-TCP-80", "aservice2-TCP-80"}, getNames(t, parameters.LoadBalancingRules))
+		return nil
+	})
+	assert.Equal(t, []error{nil, nil}, az.createOrUpdateLBs(updates))
+
+	// the services update the load balancer one by one if the merged update fails
+	gomock.InOrder(
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(&retry.Error{HTTPStatusCode: http.StatusBadRequest, RawError: fmt.Errorf("invalid")}),
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(&retry.Error{HTTPStatusCode: http.StatusBadRequest, RawError: fmt.Errorf("invalid")}),
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(nil),
+	)
+	errs := az.createOrUpdateLBs(updates)
+	assert.Error(t, errs[0])
+	assert.NoError(t, errs[1])
+}
+
+func TestCreateOrUpdateLBWithProcessor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	update := getTestLoadBalancerUpdate("service1")
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(nil)
+	assert.NoError(t, az.CreateOrUpdateLB(update.service, update.lb))
+
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(&retry.Error{HTTPStatusCode: http.StatusBadRequest, RawError: fmt.Errorf("invalid")})
+	assert.Error(t, az.CreateOrUpdateLB(update.service, update.lb))
+}
+
+func TestCreateOrUpdateSecurityGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	getUpdate := func(serviceName string, applyErr error) *securityGroupUpdate {
+		ruleName := "a" + serviceName + "-TCP-80-Internet"
+		applyChanges := func(sg network.SecurityGroup) (bool, network.SecurityGroup, error) {
+			if applyErr != nil {
+				return false, sg, applyErr
+			}
+			if _, _, found := findSecurityRuleByName(*sg.SecurityRules, ruleName); found {
+				return false, sg, nil
+			}
+			rules := append([]network.SecurityRule{}, *sg.SecurityRules...)
+			rules = append(rules, network.SecurityRule{Name: to.StringPtr(ruleName)})
+			sg.SecurityGroupPropertiesFormat = &network.SecurityGroupPropertiesFormat{SecurityRules: &rules}
+			return true, sg, nil
+		}
+		_, sg, _ := applyChanges(network.SecurityGroup{
+			Name:                          to.StringPtr("nsg"),
+			Etag:                          to.StringPtr("1"),
+			SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{SecurityRules: &[]network.SecurityRule{}},
+		})
+		return &securityGroupUpdate{serviceName: "default/" + serviceName, sg: sg, applyChanges: applyChanges}
+	}
+	updates := []*securityGroupUpdate{
+		getUpdate("service1", nil),
+		getUpdate("service2", nil),
+		getUpdate("service3", fmt.Errorf("invalid")),
+	}
+
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), "1").DoAndReturn(func(ctx context.Context, resourceGroupName, networkSecurityGroupName string, parameters network.SecurityGroup, etag string) *retry.Error {
+		assert.Equal(t, 2, len(*parameters.SecurityRules))
+		return nil
+	})
+	sgs, errs := az.createOrUpdateSecurityGroups(updates)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Error(t, errs[2])
+	assert.Equal(t, 2, len(*sgs[0].SecurityRules))
+	assert.Equal(t, sgs[0], sgs[1])
+	assert.Nil(t, sgs[2])
+
+	// the services update the security group one by one if the merged update fails
+	gomock.InOrder(
+		mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), "1").Return(&retry.Error{HTTPStatusCode: http.StatusBadRequest, RawError: fmt.Errorf("invalid")}),
+		mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), "1").Return(nil),
+		mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), "1").Return(&retry.Error{HTTPStatusCode: http.StatusBadRequest, RawError: fmt.Errorf("invalid")}),
+	)
+	sgs, errs = az.createOrUpdateSecurityGroups(updates[:2])
+	assert.NoError(t, errs[0])
+	assert.Equal(t, 1, len(*sgs[0].SecurityRules))
+	assert.Error(t, errs[1])
+}
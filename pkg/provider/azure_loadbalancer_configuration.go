@@ -0,0 +1,268 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// validateMultipleStandardLoadBalancerConfigurations checks the multiple standard load balancer configurations in the cloud config.
+func validateMultipleStandardLoadBalancerConfigurations(config *Config) error {
+	if len(config.MultipleStandardLoadBalancerConfigurations) == 0 {
+		return nil
+	}
+
+	if !strings.EqualFold(config.LoadBalancerSku, consts.LoadBalancerSkuStandard) || !config.EnableMultipleStandardLoadBalancers {
+		return fmt.Errorf("multipleStandardLoadBalancerConfigurations is only supported with the standard load balancer when enableMultipleStandardLoadBalancers is true")
+	}
+
+	names := make(map[string]bool)
+	nodePoolOwners := make(map[string]string)
+	for _, lbConfig := range config.MultipleStandardLoadBalancerConfigurations {
+		if lbConfig.Name == "" {
+			return fmt.Errorf("the name of the load balancer configuration should not be empty")
+		}
+		name := strings.ToLower(lbConfig.Name)
+		if strings.HasSuffix(name, consts.InternalLoadBalancerNameSuffix) {
+			return fmt.Errorf("the name of the load balancer configuration %s should not end with %s", lbConfig.Name, consts.InternalLoadBalancerNameSuffix)
+		}
+		if names[name] {
+			return fmt.Errorf("the load balancer configuration %s is defined more than once", lbConfig.Name)
+		}
+		names[name] = true
+
+		if len(lbConfig.NodePools) == 0 {
+			return fmt.Errorf("the node pools of the load balancer configuration %s should not be empty", lbConfig.Name)
+		}
+		for _, nodePool := range lbConfig.NodePools {
+			if owner, found := nodePoolOwners[strings.ToLower(nodePool)]; found {
+				return fmt.Errorf("the node pool %s is in both load balancer configurations %s and %s", nodePool, owner, lbConfig.Name)
+			}
+			nodePoolOwners[strings.ToLower(nodePool)] = lbConfig.Name
+		}
+
+		if _, err := metav1.LabelSelectorAsSelector(lbConfig.ServiceNamespaceSelector); err != nil {
+			return fmt.Errorf("invalid serviceNamespaceSelector of the load balancer configuration %s: %w", lbConfig.Name, err)
+		}
+		if _, err := metav1.LabelSelectorAsSelector(lbConfig.ServiceLabelSelector); err != nil {
+			return fmt.Errorf("invalid serviceLabelSelector of the load balancer configuration %s: %w", lbConfig.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// useMultipleStandardLoadBalancerConfigurations returns true if the services are placed
+// by the multiple standard load balancer configurations.
+func (az *Cloud) useMultipleStandardLoadBalancerConfigurations() bool {
+	return az.useStandardLoadBalancer() && az.EnableMultipleStandardLoadBalancers && len(az.MultipleStandardLoadBalancerConfigurations) > 0
+}
+
+// hasNodePool returns true if the nodes of the VMSet join the backend pool of the configured load balancer.
+func (lbConfig *MultipleStandardLoadBalancerConfiguration) hasNodePool(vmSetName string) bool {
+	for _, nodePool := range lbConfig.NodePools {
+		if strings.EqualFold(nodePool, vmSetName) {
+			return true
+		}
+	}
+	return false
+}
+
+// getMultipleStandardLoadBalancerConfiguration returns the configuration of the load balancer the VMSet name
+// is mapped from, or nil if it is not configured. The primary standard load balancer is mapped to the primary
+// VMSet, so its configuration is the one containing the primary VMSet if it is not named after the VMSet.
+func (az *Cloud) getMultipleStandardLoadBalancerConfiguration(vmSetNameOfLB string) *MultipleStandardLoadBalancerConfiguration {
+	if !az.useMultipleStandardLoadBalancerConfigurations() || vmSetNameOfLB == "" {
+		return nil
+	}
+
+	for i := range az.MultipleStandardLoadBalancerConfigurations {
+		if strings.EqualFold(az.MultipleStandardLoadBalancerConfigurations[i].Name, vmSetNameOfLB) {
+			return &az.MultipleStandardLoadBalancerConfigurations[i]
+		}
+	}
+	if strings.EqualFold(vmSetNameOfLB, az.VMSet.GetPrimaryVMSetName()) {
+		for i := range az.MultipleStandardLoadBalancerConfigurations {
+			if az.MultipleStandardLoadBalancerConfigurations[i].hasNodePool(vmSetNameOfLB) {
+				return &az.MultipleStandardLoadBalancerConfigurations[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// getEligibleLoadBalancerConfigurations returns the configurations of the load balancers the service can be placed on.
+// The ones named by the service annotation are returned if it is set, or the ones whose selectors match the service.
+func (az *Cloud) getEligibleLoadBalancerConfigurations(service *v1.Service) ([]*MultipleStandardLoadBalancerConfiguration, error) {
+	var eligibleConfigs []*MultipleStandardLoadBalancerConfiguration
+
+	if value, found := service.Annotations[consts.ServiceAnnotationLoadBalancerConfigurations]; found {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			var lbConfig *MultipleStandardLoadBalancerConfiguration
+			for i := range az.MultipleStandardLoadBalancerConfigurations {
+				if strings.EqualFold(az.MultipleStandardLoadBalancerConfigurations[i].Name, name) {
+					lbConfig = &az.MultipleStandardLoadBalancerConfigurations[i]
+					break
+				}
+			}
+			if lbConfig == nil {
+				return nil, fmt.Errorf("the load balancer configuration %s in the annotation %s is not found", name, consts.ServiceAnnotationLoadBalancerConfigurations)
+			}
+			eligibleConfigs = append(eligibleConfigs, lbConfig)
+		}
+		if len(eligibleConfigs) == 0 {
+			return nil, fmt.Errorf("no load balancer configuration is specified in the annotation %s", consts.ServiceAnnotationLoadBalancerConfigurations)
+		}
+		return eligibleConfigs, nil
+	}
+
+	var namespaceLabels labels.Set
+	for i := range az.MultipleStandardLoadBalancerConfigurations {
+		lbConfig := &az.MultipleStandardLoadBalancerConfigurations[i]
+
+		serviceSelector, err := metav1.LabelSelectorAsSelector(lbConfig.ServiceLabelSelector)
+		if err != nil {
+			return nil, err
+		}
+		if lbConfig.ServiceLabelSelector != nil && !serviceSelector.Matches(labels.Set(service.Labels)) {
+			continue
+		}
+
+		if lbConfig.ServiceNamespaceSelector != nil {
+			if namespaceLabels == nil {
+				namespaceLabels, err = az.getNamespaceLabels(service.Namespace)
+				if err != nil {
+					return nil, err
+				}
+			}
+			namespaceSelector, err := metav1.LabelSelectorAsSelector(lbConfig.ServiceNamespaceSelector)
+			if err != nil {
+				return nil, err
+			}
+			if !namespaceSelector.Matches(namespaceLabels) {
+				continue
+			}
+		}
+
+		eligibleConfigs = append(eligibleConfigs, lbConfig)
+	}
+
+	return eligibleConfigs, nil
+}
+
+// getNamespaceLabels returns the labels of the namespace from the namespace informer.
+func (az *Cloud) getNamespaceLabels(namespace string) (labels.Set, error) {
+	if az.namespaceLister == nil {
+		return nil, fmt.Errorf("the namespace informer is not set")
+	}
+	ns, err := az.namespaceLister.Get(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+	return labels.Set(ns.Labels), nil
+}
+
+// isLoadBalancerEligibleForService returns true if the service can stay on the load balancer
+// when the multiple standard load balancer configurations are used.
+func (az *Cloud) isLoadBalancerEligibleForService(service *v1.Service, lbName string) bool {
+	eligibleConfigs, err := az.getEligibleLoadBalancerConfigurations(service)
+	if err != nil {
+		klog.Warningf("isLoadBalancerEligibleForService(%s, %s): keeping the current load balancer because of error: %v", service.Name, lbName, err)
+		return true
+	}
+
+	lbName = strings.TrimSuffix(lbName, consts.InternalLoadBalancerNameSuffix)
+	for _, lbConfig := range eligibleConfigs {
+		if strings.EqualFold(lbConfig.Name, lbName) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectLoadBalancerByConfigurations selects the load balancer with the fewest load balancing rules among the ones
+// the service can be placed on. If several of them have the same number of rules, the first configured one is selected.
+func (az *Cloud) selectLoadBalancerByConfigurations(clusterName string, service *v1.Service, existingLBs *[]network.LoadBalancer) (selectedLB *network.LoadBalancer, existsLb bool, err error) {
+	isInternal := requiresInternalLoadBalancer(service)
+	serviceName := getServiceName(service)
+
+	eligibleConfigs, err := az.getEligibleLoadBalancerConfigurations(service)
+	if err != nil {
+		klog.Errorf("selectLoadBalancerByConfigurations: cluster(%s) service(%s) isInternal(%t) - failed to get eligible load balancer configurations: %v", clusterName, serviceName, isInternal, err)
+		return nil, false, err
+	}
+	if len(eligibleConfigs) == 0 {
+		err = fmt.Errorf("selectLoadBalancerByConfigurations: cluster(%s) service(%s) isInternal(%t) - no load balancer configuration matches the service", clusterName, serviceName, isInternal)
+		klog.Error(err)
+		return nil, false, err
+	}
+
+	mapExistingLBs := map[string]network.LoadBalancer{}
+	for _, lb := range *existingLBs {
+		mapExistingLBs[strings.ToLower(to.String(lb.Name))] = lb
+	}
+	selectedLBRuleCount := math.MaxInt32
+	for _, lbConfig := range eligibleConfigs {
+		currLBName := lbConfig.Name
+		if isInternal {
+			currLBName = fmt.Sprintf("%s%s", currLBName, consts.InternalLoadBalancerNameSuffix)
+		}
+
+		lb, exists := mapExistingLBs[strings.ToLower(currLBName)]
+		currLBRuleCount := 0
+		if exists && lb.LoadBalancerPropertiesFormat != nil && lb.LoadBalancingRules != nil {
+			currLBRuleCount = len(*lb.LoadBalancingRules)
+		}
+		if currLBRuleCount >= selectedLBRuleCount {
+			continue
+		}
+
+		selectedLBRuleCount = currLBRuleCount
+		existsLb = exists
+		if exists {
+			selectedLB = &lb
+		} else {
+			selectedLB = az.newLoadBalancerWithMetadata(currLBName)
+		}
+	}
+	klog.V(2).Infof("selectLoadBalancerByConfigurations: cluster(%s) service(%s) isInternal(%t) - selected load balancer %s with %d rules", clusterName, serviceName, isInternal, to.String(selectedLB.Name), selectedLBRuleCount)
+
+	if az.Config.MaximumLoadBalancerRuleCount != 0 && selectedLBRuleCount+az.getExpectedLBRuleCount(service) > az.Config.MaximumLoadBalancerRuleCount {
+		err = fmt.Errorf("selectLoadBalancerByConfigurations: cluster(%s) service(%s) isInternal(%t) - all eligible load balancers have exceeded maximum rule limit %d", clusterName, serviceName, isInternal, az.Config.MaximumLoadBalancerRuleCount)
+		klog.Error(err)
+		return selectedLB, existsLb, err
+	}
+
+	return selectedLB, existsLb, nil
+}
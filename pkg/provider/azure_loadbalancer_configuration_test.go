@@ -0,0 +1,322 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestValidateMultipleStandardLoadBalancerConfigurations(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		loadBalancerSku string
+		disableMultiple bool
+		configs         []MultipleStandardLoadBalancerConfiguration
+		expectedErr     string
+	}{
+		{
+			desc: "empty configurations should be valid",
+		},
+		{
+			desc:            "the configurations should be valid",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			configs: []MultipleStandardLoadBalancerConfiguration{
+				{Name: "kubernetes", NodePools: []string{"as"}},
+				{
+					Name:                     "lb1",
+					NodePools:                []string{"pool1", "pool2"},
+					ServiceLabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					ServiceNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				},
+			},
+		},
+		{
+			desc:            "the basic load balancer should not be supported",
+			configs:         []MultipleStandardLoadBalancerConfiguration{{Name: "lb1", NodePools: []string{"pool1"}}},
+			expectedErr:     "multipleStandardLoadBalancerConfigurations is only supported with the standard load balancer when enableMultipleStandardLoadBalancers is true",
+			disableMultiple: true,
+		},
+		{
+			desc:            "the multiple standard load balancers should be enabled",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			disableMultiple: true,
+			configs:         []MultipleStandardLoadBalancerConfiguration{{Name: "lb1", NodePools: []string{"pool1"}}},
+			expectedErr:     "multipleStandardLoadBalancerConfigurations is only supported with the standard load balancer when enableMultipleStandardLoadBalancers is true",
+		},
+		{
+			desc:            "the name should not be empty",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			configs:         []MultipleStandardLoadBalancerConfiguration{{NodePools: []string{"pool1"}}},
+			expectedErr:     "the name of the load balancer configuration should not be empty",
+		},
+		{
+			desc:            "the name should not end with the internal suffix",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			configs:         []MultipleStandardLoadBalancerConfiguration{{Name: "lb1-internal", NodePools: []string{"pool1"}}},
+			expectedErr:     "the name of the load balancer configuration lb1-internal should not end with -internal",
+		},
+		{
+			desc:            "the names should be unique",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			configs: []MultipleStandardLoadBalancerConfiguration{
+				{Name: "lb1", NodePools: []string{"pool1"}},
+				{Name: "LB1", NodePools: []string{"pool2"}},
+			},
+			expectedErr: "the load balancer configuration LB1 is defined more than once",
+		},
+		{
+			desc:            "the node pools should not be empty",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			configs:         []MultipleStandardLoadBalancerConfiguration{{Name: "lb1"}},
+			expectedErr:     "the node pools of the load balancer configuration lb1 should not be empty",
+		},
+		{
+			desc:            "a node pool should only be in one configuration",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			configs: []MultipleStandardLoadBalancerConfiguration{
+				{Name: "lb1", NodePools: []string{"pool1"}},
+				{Name: "lb2", NodePools: []string{"Pool1"}},
+			},
+			expectedErr: "the node pool Pool1 is in both load balancer configurations lb1 and lb2",
+		},
+		{
+			desc:            "the selectors should be valid",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			configs: []MultipleStandardLoadBalancerConfiguration{
+				{
+					Name:                 "lb1",
+					NodePools:            []string{"pool1"},
+					ServiceLabelSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "bad"}}},
+				},
+			},
+			expectedErr: "invalid serviceLabelSelector of the load balancer configuration lb1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config := &Config{
+				LoadBalancerSku:                            tc.loadBalancerSku,
+				EnableMultipleStandardLoadBalancers:        !tc.disableMultiple,
+				MultipleStandardLoadBalancerConfigurations: tc.configs,
+			}
+			err := validateMultipleStandardLoadBalancerConfigurations(config)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestGetMultipleStandardLoadBalancerConfiguration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.EnableMultipleStandardLoadBalancers = true
+	assert.Nil(t, az.getMultipleStandardLoadBalancerConfiguration("lb1"))
+
+	az.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{
+		{Name: "kubernetes", NodePools: []string{"as", "pool0"}},
+		{Name: "lb1", NodePools: []string{"pool1", "pool2"}},
+	}
+	lbConfig := az.getMultipleStandardLoadBalancerConfiguration("LB1")
+	assert.Equal(t, "lb1", lbConfig.Name)
+	assert.True(t, lbConfig.hasNodePool("Pool2"))
+	assert.False(t, lbConfig.hasNodePool("pool0"))
+
+	// the primary SLB is mapped to the primary vmSet
+	lbConfig = az.getMultipleStandardLoadBalancerConfiguration("as")
+	assert.Equal(t, "kubernetes", lbConfig.Name)
+	assert.Nil(t, az.getMultipleStandardLoadBalancerConfiguration("pool0"))
+	assert.Nil(t, az.getMultipleStandardLoadBalancerConfiguration(""))
+}
+
+func TestSelectLoadBalancerByConfigurations(t *testing.T) {
+	getLB := func(name string, ruleCount int) network.LoadBalancer {
+		rules := make([]network.LoadBalancingRule, ruleCount)
+		return network.LoadBalancer{
+			Name: to.StringPtr(name),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				LoadBalancingRules: &rules,
+			},
+		}
+	}
+	configs := []MultipleStandardLoadBalancerConfiguration{
+		{Name: "kubernetes", NodePools: []string{"as"}},
+		{
+			Name:                 "lb1",
+			NodePools:            []string{"pool1"},
+			ServiceLabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		},
+		{
+			Name:                     "lb2",
+			NodePools:                []string{"pool2"},
+			ServiceNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+		},
+	}
+
+	testCases := []struct {
+		desc           string
+		labels         map[string]string
+		namespace      string
+		annotations    map[string]string
+		ports          []int32
+		existingLBs    []network.LoadBalancer
+		maxRuleCount   int
+		expectedLBName string
+		expectedExists bool
+		expectedErr    string
+	}{
+		{
+			desc:           "the first configured LB should be selected if no LB exists",
+			namespace:      "default",
+			expectedLBName: "kubernetes",
+		},
+		{
+			desc:           "the internal LB should be selected for the internal service",
+			namespace:      "default",
+			annotations:    map[string]string{consts.ServiceAnnotationLoadBalancerInternal: consts.TrueAnnotationValue},
+			expectedLBName: "kubernetes-internal",
+		},
+		{
+			desc:           "the LB with the fewest rules should be selected among the ones matching the service labels",
+			labels:         map[string]string{"app": "web"},
+			namespace:      "default",
+			existingLBs:    []network.LoadBalancer{getLB("kubernetes", 3), getLB("lb1", 2)},
+			expectedLBName: "lb1",
+			expectedExists: true,
+		},
+		{
+			desc:           "the LB should be selected by the namespace labels",
+			namespace:      "ns-a",
+			existingLBs:    []network.LoadBalancer{getLB("kubernetes", 3), getLB("lb1", 0)},
+			expectedLBName: "lb2",
+		},
+		{
+			desc:           "the LB named by the annotation should be selected even if the selectors don't match",
+			namespace:      "default",
+			annotations:    map[string]string{consts.ServiceAnnotationLoadBalancerConfigurations: "kubernetes, lb1"},
+			existingLBs:    []network.LoadBalancer{getLB("kubernetes", 3), getLB("lb1", 1)},
+			expectedLBName: "lb1",
+			expectedExists: true,
+		},
+		{
+			desc:        "the unknown LB in the annotation should be reported",
+			namespace:   "default",
+			annotations: map[string]string{consts.ServiceAnnotationLoadBalancerConfigurations: "lb3"},
+			expectedErr: "the load balancer configuration lb3 in the annotation service.beta.kubernetes.io/azure-load-balancer-configurations is not found",
+		},
+		{
+			desc:           "an error should be reported if all eligible LBs exceed the maximum rule count",
+			namespace:      "default",
+			existingLBs:    []network.LoadBalancer{getLB("kubernetes", 2)},
+			maxRuleCount:   2,
+			expectedLBName: "kubernetes",
+			expectedExists: true,
+			expectedErr:    "all eligible load balancers have exceeded maximum rule limit 2",
+		},
+		{
+			desc:           "an error should be reported if the rules of the service exceed the maximum rule count",
+			namespace:      "default",
+			ports:          []int32{80, 443},
+			existingLBs:    []network.LoadBalancer{getLB("kubernetes", 1)},
+			maxRuleCount:   2,
+			expectedLBName: "kubernetes",
+			expectedExists: true,
+			expectedErr:    "all eligible load balancers have exceeded maximum rule limit 2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			az.EnableMultipleStandardLoadBalancers = true
+			az.MultipleStandardLoadBalancerConfigurations = configs
+			az.MaximumLoadBalancerRuleCount = tc.maxRuleCount
+			namespaceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			_ = namespaceIndexer.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+			_ = namespaceIndexer.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-a", Labels: map[string]string{"team": "a"}}})
+			az.namespaceLister = corelisters.NewNamespaceLister(namespaceIndexer)
+
+			ports := tc.ports
+			if len(ports) == 0 {
+				ports = []int32{80}
+			}
+			service := getTestService("service1", v1.ProtocolTCP, nil, false, ports...)
+			service.Namespace = tc.namespace
+			service.Labels = tc.labels
+			for key, value := range tc.annotations {
+				service.Annotations[key] = value
+			}
+
+			lb, exists, err := az.selectLoadBalancer(testClusterName, &service, &tc.existingLBs, nil)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			}
+			if tc.expectedLBName != "" {
+				assert.Equal(t, tc.expectedLBName, to.String(lb.Name))
+				assert.Equal(t, tc.expectedExists, exists)
+			}
+		})
+	}
+}
+
+func TestShouldChangeLoadBalancerWithConfigurations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.EnableMultipleStandardLoadBalancers = true
+	az.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{
+		{Name: "kubernetes", NodePools: []string{"as"}},
+		{Name: "lb1", NodePools: []string{"pool1"}},
+	}
+
+	service := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	assert.False(t, az.shouldChangeLoadBalancer(&service, "kubernetes", testClusterName))
+	assert.False(t, az.shouldChangeLoadBalancer(&service, "lb1-internal", testClusterName))
+	assert.True(t, az.shouldChangeLoadBalancer(&service, "pool2", testClusterName))
+
+	service.Annotations[consts.ServiceAnnotationLoadBalancerConfigurations] = "lb1"
+	assert.True(t, az.shouldChangeLoadBalancer(&service, "kubernetes", testClusterName))
+	assert.False(t, az.shouldChangeLoadBalancer(&service, "lb1", testClusterName))
+}
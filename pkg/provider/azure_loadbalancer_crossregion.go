@@ -0,0 +1,203 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+var crossRegionBackendPoolIDRE = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.Network/loadBalancers/([^/]+)/backendAddressPools/([^/]+)$`)
+
+// getSubscriptionLoadBalancerClient returns the load balancer client of the subscription of the cross-region or
+// gateway load balancer. The client of the cluster is reused if the load balancer is in the same subscription.
+func (az *Cloud) getSubscriptionLoadBalancerClient(subscriptionID string) loadbalancerclient.Interface {
+	if az.loadBalancerClientConfig == nil || strings.EqualFold(subscriptionID, az.loadBalancerClientConfig.SubscriptionID) {
+		return az.LoadBalancerClient
+	}
+
+	key := strings.ToLower(subscriptionID)
+	if client, ok := az.subscriptionLoadBalancerClients.Load(key); ok {
+		return client.(loadbalancerclient.Interface)
+	}
+	config := *az.loadBalancerClientConfig
+	config.SubscriptionID = subscriptionID
+	client, _ := az.subscriptionLoadBalancerClients.LoadOrStore(key, az.wrapPlanLoadBalancerClient(loadbalancerclient.New(&config)))
+	return client.(loadbalancerclient.Interface)
+}
+
+// reconcileCrossRegionBackendPool registers the public frontend IP configurations of the service on the regional
+// load balancer into the backend pool of the cross-region load balancer specified by the service annotation, or
+// removes the registrations if the load balancer of the service is not wanted. The registrations are named after the
+// frontend IP configurations of the service, so the ones of the other services and clusters are kept as they are.
+func (az *Cloud) reconcileCrossRegionBackendPool(service *v1.Service, lb *network.LoadBalancer, wantLb bool) error {
+	backendPoolID := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationCrossRegionBackendPoolID])
+	if backendPoolID == "" {
+		return nil
+	}
+
+	serviceName := getServiceName(service)
+	matches := crossRegionBackendPoolIDRE.FindStringSubmatch(backendPoolID)
+	if len(matches) != 5 {
+		return fmt.Errorf("reconcileCrossRegionBackendPool for service(%s): %s is not a valid backend pool ID", serviceName, backendPoolID)
+	}
+	if wantLb && !az.useStandardLoadBalancer() {
+		return fmt.Errorf("reconcileCrossRegionBackendPool for service(%s): the cross-region load balancer is only supported with the standard load balancer", serviceName)
+	}
+	if wantLb && requiresInternalLoadBalancer(service) {
+		// the frontends of the internal load balancers can't be registered, and the previous registrations are removed
+		az.Event(service, v1.EventTypeWarning, "CrossRegionBackendPoolIgnored", "Only the public frontends can be registered into the cross-region load balancer")
+		wantLb = false
+	}
+
+	var expectedAddresses []network.LoadBalancerBackendAddress
+	if wantLb && lb != nil && lb.LoadBalancerPropertiesFormat != nil && lb.FrontendIPConfigurations != nil {
+		for _, fipConfig := range *lb.FrontendIPConfigurations {
+			owns, isPrimaryService, err := az.serviceOwnsFrontendIP(fipConfig, service, nil)
+			if err != nil {
+				return err
+			}
+			// the frontend IP configurations shared by the secondary services are registered by the primary service
+			if !owns || !isPrimaryService || fipConfig.FrontendIPConfigurationPropertiesFormat == nil || fipConfig.PublicIPAddress == nil {
+				continue
+			}
+			expectedAddresses = append(expectedAddresses, network.LoadBalancerBackendAddress{
+				Name: fipConfig.Name,
+				LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+					LoadBalancerFrontendIPConfiguration: &network.SubResource{ID: fipConfig.ID},
+				},
+			})
+		}
+	}
+
+	subscriptionID, resourceGroup, lbName, backendPoolName := matches[1], matches[2], matches[3], matches[4]
+	client := az.getSubscriptionLoadBalancerClient(subscriptionID)
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	for i := 0; ; i++ {
+		crossRegionLB, rerr := client.Get(ctx, resourceGroup, lbName, "")
+		if rerr != nil {
+			if !wantLb && rerr.HTTPStatusCode == http.StatusNotFound {
+				klog.V(2).Infof("reconcileCrossRegionBackendPool for service(%s): the cross-region load balancer %s has been deleted", serviceName, lbName)
+				return nil
+			}
+			return rerr.Error()
+		}
+		if crossRegionLB.Sku == nil || crossRegionLB.Sku.Tier != network.LoadBalancerSkuTierGlobal {
+			if !wantLb {
+				return nil
+			}
+			return fmt.Errorf("reconcileCrossRegionBackendPool for service(%s): the load balancer %s is not a cross-region load balancer", serviceName, lbName)
+		}
+
+		backendPool := findBackendPoolByName(crossRegionLB, backendPoolName)
+		if backendPool == nil {
+			if !wantLb {
+				return nil
+			}
+			return fmt.Errorf("reconcileCrossRegionBackendPool for service(%s): the backend pool %s of the cross-region load balancer %s is not found", serviceName, backendPoolName, lbName)
+		}
+
+		addresses, changed := az.getCrossRegionBackendAddresses(service, backendPool, expectedAddresses)
+		if !changed {
+			return nil
+		}
+		backendPoolProperties := network.BackendAddressPoolPropertiesFormat{}
+		if backendPool.BackendAddressPoolPropertiesFormat != nil {
+			backendPoolProperties = *backendPool.BackendAddressPoolPropertiesFormat
+		}
+		backendPoolProperties.LoadBalancerBackendAddresses = &addresses
+		backendPool.BackendAddressPoolPropertiesFormat = &backendPoolProperties
+
+		klog.V(2).Infof("reconcileCrossRegionBackendPool for service(%s): updating the backend pool %s of the cross-region load balancer %s with %d frontend(s) of the service", serviceName, backendPoolName, lbName, len(expectedAddresses))
+		rerr = client.CreateOrUpdateBackendPools(ctx, resourceGroup, lbName, to.String(backendPool.Name), *backendPool, to.String(backendPool.Etag))
+		if rerr == nil {
+			return nil
+		}
+		// the backend pool may be updated by the services of the other clusters concurrently
+		if rerr.HTTPStatusCode != http.StatusPreconditionFailed || i >= consts.MaxETagConflictRetries {
+			az.Event(service, v1.EventTypeWarning, "UpdateCrossRegionBackendPool", rerr.Error().Error())
+			return rerr.Error()
+		}
+		klog.V(2).Infof("reconcileCrossRegionBackendPool for service(%s): the backend pool %s has been changed, retrying", serviceName, backendPoolName)
+	}
+}
+
+// getCrossRegionBackendAddresses replaces the registrations of the service in the backend pool with the expected
+// ones, and reports whether the registrations are changed.
+func (az *Cloud) getCrossRegionBackendAddresses(service *v1.Service, backendPool *network.BackendAddressPool, expectedAddresses []network.LoadBalancerBackendAddress) ([]network.LoadBalancerBackendAddress, bool) {
+	baseName := strings.ToLower(az.GetLoadBalancerName(context.TODO(), "", service))
+	expectedFIPConfigIDs := make(map[string]string)
+	for _, address := range expectedAddresses {
+		expectedFIPConfigIDs[strings.ToLower(to.String(address.Name))] = strings.ToLower(to.String(address.LoadBalancerFrontendIPConfiguration.ID))
+	}
+
+	var addresses []network.LoadBalancerBackendAddress
+	var changed bool
+	var ownedCount int
+	if backendPool.BackendAddressPoolPropertiesFormat != nil && backendPool.LoadBalancerBackendAddresses != nil {
+		for _, address := range *backendPool.LoadBalancerBackendAddresses {
+			name := strings.ToLower(to.String(address.Name))
+			if !strings.HasPrefix(name, baseName) {
+				addresses = append(addresses, address)
+				continue
+			}
+
+			ownedCount++
+			var fipConfigID string
+			if address.LoadBalancerBackendAddressPropertiesFormat != nil && address.LoadBalancerFrontendIPConfiguration != nil {
+				fipConfigID = strings.ToLower(to.String(address.LoadBalancerFrontendIPConfiguration.ID))
+			}
+			if expectedFIPConfigID, found := expectedFIPConfigIDs[name]; !found || expectedFIPConfigID != fipConfigID {
+				changed = true
+			}
+		}
+	}
+	if ownedCount != len(expectedAddresses) {
+		changed = true
+	}
+
+	addresses = append(addresses, expectedAddresses...)
+	return addresses, changed
+}
+
+// findBackendPoolByName returns the backend pool of the load balancer with the name, or nil if it is not found.
+func findBackendPoolByName(lb network.LoadBalancer, backendPoolName string) *network.BackendAddressPool {
+	if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return nil
+	}
+	for _, backendPool := range *lb.BackendAddressPools {
+		if strings.EqualFold(to.String(backendPool.Name), backendPoolName) {
+			backendPool := backendPool
+			return &backendPool
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestReconcileCrossRegionBackendPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fipConfigID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/kubernetes/frontendIPConfigurations/aservice1"
+	regionalLB := &network.LoadBalancer{
+		Name: to.StringPtr("kubernetes"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: to.StringPtr("aservice1"),
+					ID:   to.StringPtr(fipConfigID),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr("pip")},
+					},
+				},
+			},
+		},
+	}
+	otherAddress := network.LoadBalancerBackendAddress{
+		Name: to.StringPtr("aservice2"),
+		LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+			LoadBalancerFrontendIPConfiguration: &network.SubResource{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg2/providers/Microsoft.Network/loadBalancers/kubernetes/frontendIPConfigurations/aservice2")},
+		},
+	}
+	serviceAddress := network.LoadBalancerBackendAddress{
+		Name: to.StringPtr("aservice1"),
+		LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+			LoadBalancerFrontendIPConfiguration: &network.SubResource{ID: to.StringPtr(fipConfigID)},
+		},
+	}
+	getCrossRegionLB := func(addresses ...network.LoadBalancerBackendAddress) network.LoadBalancer {
+		return network.LoadBalancer{
+			Name: to.StringPtr("global"),
+			Sku:  &network.LoadBalancerSku{Name: network.LoadBalancerSkuNameStandard, Tier: network.LoadBalancerSkuTierGlobal},
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				BackendAddressPools: &[]network.BackendAddressPool{
+					{
+						Name: to.StringPtr("pool"),
+						Etag: to.StringPtr("1"),
+						BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+							LoadBalancerBackendAddresses: &addresses,
+						},
+					},
+				},
+			},
+		}
+	}
+	annotations := map[string]string{
+		consts.ServiceAnnotationCrossRegionBackendPoolID: "/subscriptions/subscription/resourceGroups/global-rg/providers/Microsoft.Network/loadBalancers/global/backendAddressPools/pool",
+	}
+
+	for _, test := range []struct {
+		desc              string
+		annotations       map[string]string
+		wantLb            bool
+		crossRegionLB     network.LoadBalancer
+		getErr            *retry.Error
+		updateErrs        []*retry.Error
+		expectedAddresses []network.LoadBalancerBackendAddress
+		expectedErr       bool
+	}{
+		{
+			desc:          "nothing should be done without the annotation",
+			wantLb:        true,
+			crossRegionLB: getCrossRegionLB(),
+		},
+		{
+			desc:              "the frontend of the service should be registered",
+			annotations:       annotations,
+			wantLb:            true,
+			crossRegionLB:     getCrossRegionLB(otherAddress),
+			updateErrs:        []*retry.Error{nil},
+			expectedAddresses: []network.LoadBalancerBackendAddress{otherAddress, serviceAddress},
+		},
+		{
+			desc:              "the registration should be retried if the backend pool is changed concurrently",
+			annotations:       annotations,
+			wantLb:            true,
+			crossRegionLB:     getCrossRegionLB(),
+			updateErrs:        []*retry.Error{{HTTPStatusCode: http.StatusPreconditionFailed}, nil},
+			expectedAddresses: []network.LoadBalancerBackendAddress{serviceAddress},
+		},
+		{
+			desc:          "nothing should be done if the frontend has been registered",
+			annotations:   annotations,
+			wantLb:        true,
+			crossRegionLB: getCrossRegionLB(serviceAddress, otherAddress),
+		},
+		{
+			desc:              "the registration should be removed if the load balancer is not wanted",
+			annotations:       annotations,
+			crossRegionLB:     getCrossRegionLB(serviceAddress, otherAddress),
+			updateErrs:        []*retry.Error{nil},
+			expectedAddresses: []network.LoadBalancerBackendAddress{otherAddress},
+		},
+		{
+			desc:        "nothing should be done if the cross-region load balancer has been deleted",
+			annotations: annotations,
+			getErr:      &retry.Error{HTTPStatusCode: http.StatusNotFound},
+		},
+		{
+			desc:          "an error should be returned if the load balancer is not a cross-region one",
+			annotations:   annotations,
+			wantLb:        true,
+			crossRegionLB: network.LoadBalancer{Name: to.StringPtr("global")},
+			expectedErr:   true,
+		},
+		{
+			desc:        "an error should be returned if the backend pool ID is invalid",
+			annotations: map[string]string{consts.ServiceAnnotationCrossRegionBackendPoolID: "pool"},
+			wantLb:      true,
+			expectedErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			svc := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+
+			mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+			mockLBClient.EXPECT().Get(gomock.Any(), "global-rg", "global", gomock.Any()).Return(test.crossRegionLB, test.getErr).MaxTimes(len(test.updateErrs) + 1)
+			for _, updateErr := range test.updateErrs {
+				updateErr := updateErr
+				mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), "global-rg", "global", "pool", gomock.Any(), "1").DoAndReturn(func(ctx context.Context, resourceGroupName, loadBalancerName, backendPoolName string, parameters network.BackendAddressPool, etag string) *retry.Error {
+					assert.Equal(t, test.expectedAddresses, *parameters.LoadBalancerBackendAddresses)
+					return updateErr
+				})
+			}
+			err := az.reconcileCrossRegionBackendPool(&svc, regionalLB, test.wantLb)
+			assert.Equal(t, test.expectedErr, err != nil)
+		})
+	}
+}
+
+func TestGetSubscriptionLoadBalancerClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	assert.Equal(t, az.LoadBalancerClient, az.getSubscriptionLoadBalancerClient("subscription2"))
+
+	az.loadBalancerClientConfig = &azclients.ClientConfig{SubscriptionID: "subscription", Backoff: &retry.Backoff{Steps: 1}}
+	assert.Equal(t, az.LoadBalancerClient, az.getSubscriptionLoadBalancerClient("Subscription"))
+	client := az.getSubscriptionLoadBalancerClient("subscription2")
+	assert.NotEqual(t, az.LoadBalancerClient, client)
+	assert.Equal(t, client, az.getSubscriptionLoadBalancerClient("subscription2"))
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/dnsclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednsclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+var (
+	dnsZoneIDRE        = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.Network/dnsZones/([^/]+)$`)
+	privateDNSZoneIDRE = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.Network/privateDnsZones/([^/]+)$`)
+)
+
+// getDNSClient returns the DNS client of the subscription of the DNS zone. The client of the cluster is reused if
+// the DNS zone is in the same subscription.
+func (az *Cloud) getDNSClient(subscriptionID string) dnsclient.Interface {
+	if az.dnsClientConfig == nil || strings.EqualFold(subscriptionID, az.dnsClientConfig.SubscriptionID) {
+		return az.DNSClient
+	}
+
+	key := strings.ToLower(subscriptionID)
+	if client, ok := az.dnsClients.Load(key); ok {
+		return client.(dnsclient.Interface)
+	}
+	config := *az.dnsClientConfig
+	config.SubscriptionID = subscriptionID
+	client, _ := az.dnsClients.LoadOrStore(key, az.wrapPlanDNSClient(dnsclient.New(&config)))
+	return client.(dnsclient.Interface)
+}
+
+// getServiceDNSRecordIPs returns the sorted IPv4 and IPv6 addresses of the ingresses of the service.
+func getServiceDNSRecordIPs(lbStatus *v1.LoadBalancerStatus) ([]string, []string) {
+	ipv4s, ipv6s := sets.NewString(), sets.NewString()
+	if lbStatus == nil {
+		return nil, nil
+	}
+	for _, ingress := range lbStatus.Ingress {
+		if ingress.IP == "" {
+			continue
+		}
+		if utilnet.IsIPv6String(ingress.IP) {
+			ipv6s.Insert(ingress.IP)
+		} else {
+			ipv4s.Insert(ingress.IP)
+		}
+	}
+	return ipv4s.List(), ipv6s.List()
+}
+
+// isDNSRecordOwnedByService checks if the DNS record is created by the service according to its metadata.
+func isDNSRecordOwnedByService(metadata map[string]*string, clusterName, serviceName string) bool {
+	return strings.EqualFold(to.String(metadata[consts.DNSRecordServiceMetadataKey]), serviceName) &&
+		strings.EqualFold(to.String(metadata[consts.DNSRecordClusterNameMetadataKey]), clusterName)
+}
+
+// dnsRecordSet is the part of the A or AAAA record set in the public or private DNS zone managed for the services.
+type dnsRecordSet struct {
+	etag     string
+	ttl      *int64
+	metadata map[string]*string
+	ips      []string
+}
+
+// dnsRecordSetClient manages the record sets of a name in a public or private DNS zone.
+type dnsRecordSetClient interface {
+	// getRecordSet returns nil if the record set doesn't exist.
+	getRecordSet(ctx context.Context, recordType string) (*dnsRecordSet, *retry.Error)
+	// createOrUpdateRecordSet updates the record set if its etag matches, or creates it if the etag is empty.
+	createOrUpdateRecordSet(ctx context.Context, recordType string, recordSet dnsRecordSet) *retry.Error
+	deleteRecordSet(ctx context.Context, recordType, etag string) *retry.Error
+}
+
+// publicDNSRecordSetClient manages the record sets of a name in a public DNS zone.
+type publicDNSRecordSetClient struct {
+	client        dnsclient.Interface
+	resourceGroup string
+	zoneName      string
+	recordName    string
+}
+
+func (c *publicDNSRecordSetClient) getRecordSet(ctx context.Context, recordType string) (*dnsRecordSet, *retry.Error) {
+	recordSet, rerr := c.client.GetRecordSet(ctx, c.resourceGroup, c.zoneName, c.recordName, dns.RecordType(recordType))
+	if rerr != nil {
+		if rerr.HTTPStatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, rerr
+	}
+
+	result := &dnsRecordSet{etag: to.String(recordSet.Etag)}
+	if recordSet.RecordSetProperties == nil {
+		return result, nil
+	}
+	result.ttl = recordSet.TTL
+	result.metadata = recordSet.Metadata
+	if recordSet.ARecords != nil {
+		for _, record := range *recordSet.ARecords {
+			result.ips = append(result.ips, to.String(record.Ipv4Address))
+		}
+	}
+	if recordSet.AaaaRecords != nil {
+		for _, record := range *recordSet.AaaaRecords {
+			result.ips = append(result.ips, to.String(record.Ipv6Address))
+		}
+	}
+	return result, nil
+}
+
+func (c *publicDNSRecordSetClient) createOrUpdateRecordSet(ctx context.Context, recordType string, recordSet dnsRecordSet) *retry.Error {
+	properties := dns.RecordSetProperties{
+		TTL:      recordSet.ttl,
+		Metadata: recordSet.metadata,
+	}
+	for _, ip := range recordSet.ips {
+		if recordType == string(dns.AAAA) {
+			if properties.AaaaRecords == nil {
+				properties.AaaaRecords = &[]dns.AaaaRecord{}
+			}
+			*properties.AaaaRecords = append(*properties.AaaaRecords, dns.AaaaRecord{Ipv6Address: to.StringPtr(ip)})
+		} else {
+			if properties.ARecords == nil {
+				properties.ARecords = &[]dns.ARecord{}
+			}
+			*properties.ARecords = append(*properties.ARecords, dns.ARecord{Ipv4Address: to.StringPtr(ip)})
+		}
+	}
+	return c.client.CreateOrUpdateRecordSet(ctx, c.resourceGroup, c.zoneName, c.recordName, dns.RecordType(recordType), dns.RecordSet{RecordSetProperties: &properties}, recordSet.etag)
+}
+
+func (c *publicDNSRecordSetClient) deleteRecordSet(ctx context.Context, recordType, etag string) *retry.Error {
+	return c.client.DeleteRecordSet(ctx, c.resourceGroup, c.zoneName, c.recordName, dns.RecordType(recordType), etag)
+}
+
+// reconcileDNSRecords creates or updates the A and AAAA records in the public DNS zone specified by the service
+// annotations to point at the frontend IPs of the service, or deletes them if the load balancer of the service is
+// not wanted. The owner service and cluster are recorded in the metadata of the records, and the records not created
+// by the service are never changed.
+func (az *Cloud) reconcileDNSRecords(clusterName string, service *v1.Service, lbStatus *v1.LoadBalancerStatus, wantLb bool) error {
+	zoneID := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationDNSZoneID])
+	if zoneID == "" {
+		return nil
+	}
+
+	serviceName := getServiceName(service)
+	matches := dnsZoneIDRE.FindStringSubmatch(zoneID)
+	if len(matches) != 4 {
+		return fmt.Errorf("reconcileDNSRecords for service(%s): %s is not a valid DNS zone ID", serviceName, zoneID)
+	}
+	recordName := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationDNSRecordName])
+	if recordName == "" {
+		return fmt.Errorf("reconcileDNSRecords for service(%s): the annotation %s is required by the annotation %s", serviceName, consts.ServiceAnnotationDNSRecordName, consts.ServiceAnnotationDNSZoneID)
+	}
+
+	client := &publicDNSRecordSetClient{
+		client:        az.getDNSClient(matches[1]),
+		resourceGroup: matches[2],
+		zoneName:      matches[3],
+		recordName:    recordName,
+	}
+	return az.reconcileDNSRecordSets(client, clusterName, service, "DNS zone "+matches[3], recordName, lbStatus, wantLb)
+}
+
+// reconcileDNSRecordSets makes the A and AAAA record sets point at the IPv4 and IPv6 frontend IPs of the service,
+// or deletes them if the load balancer of the service is not wanted.
+func (az *Cloud) reconcileDNSRecordSets(client dnsRecordSetClient, clusterName string, service *v1.Service, zoneDesc, recordName string, lbStatus *v1.LoadBalancerStatus, wantLb bool) error {
+	var ipv4s, ipv6s []string
+	if wantLb {
+		ipv4s, ipv6s = getServiceDNSRecordIPs(lbStatus)
+	}
+	if err := az.reconcileDNSRecordSet(client, clusterName, service, zoneDesc, recordName, string(dns.A), ipv4s); err != nil {
+		return err
+	}
+	return az.reconcileDNSRecordSet(client, clusterName, service, zoneDesc, recordName, string(dns.AAAA), ipv6s)
+}
+
+// reconcileDNSRecordSet makes the record set of the type point at the IPs, or deletes it if there are no IPs.
+func (az *Cloud) reconcileDNSRecordSet(client dnsRecordSetClient, clusterName string, service *v1.Service, zoneDesc, recordName, recordType string, ips []string) error {
+	serviceName := getServiceName(service)
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	recordSet, rerr := client.getRecordSet(ctx, recordType)
+	if rerr != nil {
+		return rerr.Error()
+	}
+
+	if recordSet != nil && !isDNSRecordOwnedByService(recordSet.metadata, clusterName, serviceName) {
+		if len(ips) == 0 {
+			klog.V(4).Infof("reconcileDNSRecordSet for service(%s): skip deleting the %s record %s in the %s because it is not created by the service", serviceName, recordType, recordName, zoneDesc)
+			return nil
+		}
+		az.Event(service, v1.EventTypeWarning, "DNSRecordConflict", fmt.Sprintf("The %s record %s in the %s exists but is not created by the service", recordType, recordName, zoneDesc))
+		return fmt.Errorf("reconcileDNSRecordSet for service(%s): the %s record %s in the %s is not created by the service", serviceName, recordType, recordName, zoneDesc)
+	}
+
+	if len(ips) == 0 {
+		if recordSet == nil {
+			return nil
+		}
+		klog.V(2).Infof("reconcileDNSRecordSet for service(%s): deleting the %s record %s in the %s", serviceName, recordType, recordName, zoneDesc)
+		rerr = client.deleteRecordSet(ctx, recordType, recordSet.etag)
+		if rerr != nil && rerr.HTTPStatusCode != http.StatusNotFound {
+			return rerr.Error()
+		}
+		return nil
+	}
+
+	expected := dnsRecordSet{
+		ttl: to.Int64Ptr(consts.DNSRecordTTLDefault),
+		metadata: map[string]*string{
+			consts.DNSRecordServiceMetadataKey:     to.StringPtr(serviceName),
+			consts.DNSRecordClusterNameMetadataKey: to.StringPtr(clusterName),
+		},
+		ips: ips,
+	}
+	if recordSet != nil {
+		currentIPs := append([]string{}, recordSet.ips...)
+		sort.Strings(currentIPs)
+		if strings.Join(currentIPs, ",") == strings.Join(ips, ",") {
+			return nil
+		}
+		expected.etag = recordSet.etag
+		// the TTL changed out of the cluster is kept
+		if recordSet.ttl != nil {
+			expected.ttl = recordSet.ttl
+		}
+	}
+
+	klog.V(2).Infof("reconcileDNSRecordSet for service(%s): updating the %s record %s in the %s with IPs %v", serviceName, recordType, recordName, zoneDesc, ips)
+	rerr = client.createOrUpdateRecordSet(ctx, recordType, expected)
+	if rerr != nil {
+		az.Event(service, v1.EventTypeWarning, "UpdateDNSRecord", rerr.Error().Error())
+		return rerr.Error()
+	}
+	return nil
+}
+
+// getPrivateDNSClient returns the private DNS client of the subscription of the private DNS zone. The client of the
+// cluster is reused if the private DNS zone is in the same subscription.
+func (az *Cloud) getPrivateDNSClient(subscriptionID string) privatednsclient.Interface {
+	if az.privateDNSClientConfig == nil || strings.EqualFold(subscriptionID, az.privateDNSClientConfig.SubscriptionID) {
+		return az.privatednsclient
+	}
+
+	key := strings.ToLower(subscriptionID)
+	if client, ok := az.privateDNSClients.Load(key); ok {
+		return client.(privatednsclient.Interface)
+	}
+	config := *az.privateDNSClientConfig
+	config.SubscriptionID = subscriptionID
+	client, _ := az.privateDNSClients.LoadOrStore(key, az.wrapPlanPrivateDNSClient(privatednsclient.New(&config)))
+	return client.(privatednsclient.Interface)
+}
+
+// privateDNSRecordSetClient manages the record sets of a name in a private DNS zone.
+type privateDNSRecordSetClient struct {
+	client        privatednsclient.Interface
+	resourceGroup string
+	zoneName      string
+	recordName    string
+}
+
+func (c *privateDNSRecordSetClient) getRecordSet(ctx context.Context, recordType string) (*dnsRecordSet, *retry.Error) {
+	recordSet, rerr := c.client.GetRecordSet(ctx, c.resourceGroup, c.zoneName, c.recordName, privatedns.RecordType(recordType))
+	if rerr != nil {
+		if rerr.HTTPStatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, rerr
+	}
+
+	result := &dnsRecordSet{etag: to.String(recordSet.Etag)}
+	if recordSet.RecordSetProperties == nil {
+		return result, nil
+	}
+	result.ttl = recordSet.TTL
+	result.metadata = recordSet.Metadata
+	if recordSet.ARecords != nil {
+		for _, record := range *recordSet.ARecords {
+			result.ips = append(result.ips, to.String(record.Ipv4Address))
+		}
+	}
+	if recordSet.AaaaRecords != nil {
+		for _, record := range *recordSet.AaaaRecords {
+			result.ips = append(result.ips, to.String(record.Ipv6Address))
+		}
+	}
+	return result, nil
+}
+
+func (c *privateDNSRecordSetClient) createOrUpdateRecordSet(ctx context.Context, recordType string, recordSet dnsRecordSet) *retry.Error {
+	properties := privatedns.RecordSetProperties{
+		TTL:      recordSet.ttl,
+		Metadata: recordSet.metadata,
+	}
+	for _, ip := range recordSet.ips {
+		if recordType == string(privatedns.AAAA) {
+			if properties.AaaaRecords == nil {
+				properties.AaaaRecords = &[]privatedns.AaaaRecord{}
+			}
+			*properties.AaaaRecords = append(*properties.AaaaRecords, privatedns.AaaaRecord{Ipv6Address: to.StringPtr(ip)})
+		} else {
+			if properties.ARecords == nil {
+				properties.ARecords = &[]privatedns.ARecord{}
+			}
+			*properties.ARecords = append(*properties.ARecords, privatedns.ARecord{Ipv4Address: to.StringPtr(ip)})
+		}
+	}
+	return c.client.CreateOrUpdateRecordSet(ctx, c.resourceGroup, c.zoneName, c.recordName, privatedns.RecordType(recordType), privatedns.RecordSet{RecordSetProperties: &properties}, recordSet.etag)
+}
+
+func (c *privateDNSRecordSetClient) deleteRecordSet(ctx context.Context, recordType, etag string) *retry.Error {
+	return c.client.DeleteRecordSet(ctx, c.resourceGroup, c.zoneName, c.recordName, privatedns.RecordType(recordType), etag)
+}
+
+// getServicePrivateDNSZoneID returns the ID of the private DNS zone of the service. The service annotation
+// overrides the default zone in the cloud config.
+func (az *Cloud) getServicePrivateDNSZoneID(service *v1.Service) string {
+	if zoneID, found := service.Annotations[consts.ServiceAnnotationPrivateDNSZoneID]; found {
+		return strings.TrimSpace(zoneID)
+	}
+	return az.PrivateDNSZoneID
+}
+
+// reconcilePrivateDNSRecords creates or updates the A and AAAA records in the private DNS zone of the internal
+// service to point at its frontend IPs, or deletes them if the load balancer of the service is not wanted or the
+// service is not internal. The records are named by the annotation service.beta.kubernetes.io/azure-dns-record-name,
+// which defaults to "<name>.<namespace>" of the service. Like the records in the public DNS zones, the owner service
+// and cluster are recorded in the metadata, so the clusters sharing the private DNS zone never change the records
+// of each other.
+func (az *Cloud) reconcilePrivateDNSRecords(clusterName string, service *v1.Service, lbStatus *v1.LoadBalancerStatus, wantLb bool) error {
+	zoneID := az.getServicePrivateDNSZoneID(service)
+	if zoneID == "" {
+		return nil
+	}
+
+	serviceName := getServiceName(service)
+	matches := privateDNSZoneIDRE.FindStringSubmatch(zoneID)
+	if len(matches) != 4 {
+		return fmt.Errorf("reconcilePrivateDNSRecords for service(%s): %s is not a valid private DNS zone ID", serviceName, zoneID)
+	}
+	if wantLb && !requiresInternalLoadBalancer(service) {
+		if _, found := service.Annotations[consts.ServiceAnnotationPrivateDNSZoneID]; found {
+			az.Event(service, v1.EventTypeWarning, "PrivateDNSRecordIgnored", "Only the frontend IPs of the internal services are registered in the private DNS zone")
+		}
+		// the records created when the service was internal are removed
+		wantLb = false
+	}
+
+	recordName := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationDNSRecordName])
+	if recordName == "" {
+		recordName = fmt.Sprintf("%s.%s", service.Name, service.Namespace)
+	}
+	client := &privateDNSRecordSetClient{
+		client:        az.getPrivateDNSClient(matches[1]),
+		resourceGroup: matches[2],
+		zoneName:      matches[3],
+		recordName:    recordName,
+	}
+	return az.reconcileDNSRecordSets(client, clusterName, service, "private DNS zone "+matches[3], recordName, lbStatus, wantLb)
+}
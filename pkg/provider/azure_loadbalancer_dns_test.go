@@ -0,0 +1,311 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/dnsclient/mockdnsclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednsclient/mockprivatednsclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestGetServiceDNSRecordIPs(t *testing.T) {
+	ipv4s, ipv6s := getServiceDNSRecordIPs(&v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.5"}, {IP: "fd00::1"}, {IP: "1.2.3.4"}, {IP: "1.2.3.4"}, {Hostname: "host"}},
+	})
+	assert.Equal(t, []string{"1.2.3.4", "1.2.3.5"}, ipv4s)
+	assert.Equal(t, []string{"fd00::1"}, ipv6s)
+
+	ipv4s, ipv6s = getServiceDNSRecordIPs(nil)
+	assert.Empty(t, ipv4s)
+	assert.Empty(t, ipv6s)
+}
+
+func TestReconcileDNSRecords(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	annotations := map[string]string{
+		consts.ServiceAnnotationDNSZoneID:     "/subscriptions/subscription/resourceGroups/dns-rg/providers/Microsoft.Network/dnszones/example.com",
+		consts.ServiceAnnotationDNSRecordName: "www",
+	}
+	lbStatus := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}}
+	ownedMetadata := map[string]*string{
+		consts.DNSRecordServiceMetadataKey:     to.StringPtr("default/service1"),
+		consts.DNSRecordClusterNameMetadataKey: to.StringPtr("kubernetes"),
+	}
+	getRecordSet := func(metadata map[string]*string, ips ...string) *dns.RecordSet {
+		records := []dns.ARecord{}
+		for _, ip := range ips {
+			records = append(records, dns.ARecord{Ipv4Address: to.StringPtr(ip)})
+		}
+		return &dns.RecordSet{
+			Etag: to.StringPtr("1"),
+			RecordSetProperties: &dns.RecordSetProperties{
+				TTL:      to.Int64Ptr(60),
+				Metadata: metadata,
+				ARecords: &records,
+			},
+		}
+	}
+
+	for _, test := range []struct {
+		desc               string
+		annotations        map[string]string
+		wantLb             bool
+		existingA          *dns.RecordSet
+		existingAAAA       *dns.RecordSet
+		expectedA          *dns.RecordSet
+		expectedDeleteA    bool
+		expectedDeleteAAAA bool
+		expectedErr        bool
+	}{
+		{
+			desc:   "nothing should be done without the annotation",
+			wantLb: true,
+		},
+		{
+			desc:        "the A record should be created",
+			annotations: annotations,
+			wantLb:      true,
+			expectedA: &dns.RecordSet{
+				RecordSetProperties: &dns.RecordSetProperties{
+					TTL:      to.Int64Ptr(consts.DNSRecordTTLDefault),
+					Metadata: ownedMetadata,
+					ARecords: &[]dns.ARecord{{Ipv4Address: to.StringPtr("1.2.3.4")}},
+				},
+			},
+		},
+		{
+			desc:        "the A record should be updated with its TTL kept",
+			annotations: annotations,
+			wantLb:      true,
+			existingA:   getRecordSet(ownedMetadata, "1.2.3.5"),
+			expectedA: &dns.RecordSet{
+				RecordSetProperties: &dns.RecordSetProperties{
+					TTL:      to.Int64Ptr(60),
+					Metadata: ownedMetadata,
+					ARecords: &[]dns.ARecord{{Ipv4Address: to.StringPtr("1.2.3.4")}},
+				},
+			},
+		},
+		{
+			desc:        "nothing should be done if the A record is up to date",
+			annotations: annotations,
+			wantLb:      true,
+			existingA:   getRecordSet(ownedMetadata, "1.2.3.4"),
+		},
+		{
+			desc:               "the records should be deleted if the load balancer is not wanted",
+			annotations:        annotations,
+			existingA:          getRecordSet(ownedMetadata, "1.2.3.4"),
+			existingAAAA:       &dns.RecordSet{Etag: to.StringPtr("1"), RecordSetProperties: &dns.RecordSetProperties{Metadata: ownedMetadata}},
+			expectedDeleteA:    true,
+			expectedDeleteAAAA: true,
+		},
+		{
+			desc:        "the record not created by the service should not be deleted",
+			annotations: annotations,
+			existingA:   getRecordSet(map[string]*string{consts.DNSRecordServiceMetadataKey: to.StringPtr("default/service2")}, "1.2.3.4"),
+		},
+		{
+			desc:        "an error should be returned if the record is not created by the service",
+			annotations: annotations,
+			wantLb:      true,
+			existingA:   getRecordSet(nil, "1.2.3.5"),
+			expectedErr: true,
+		},
+		{
+			desc:        "an error should be returned without the record name",
+			annotations: map[string]string{consts.ServiceAnnotationDNSZoneID: annotations[consts.ServiceAnnotationDNSZoneID]},
+			wantLb:      true,
+			expectedErr: true,
+		},
+		{
+			desc: "an error should be returned if the DNS zone ID is invalid",
+			annotations: map[string]string{
+				consts.ServiceAnnotationDNSZoneID:     "example.com",
+				consts.ServiceAnnotationDNSRecordName: "www",
+			},
+			wantLb:      true,
+			expectedErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			svc := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+
+			mockDNSClient := az.DNSClient.(*mockdnsclient.MockInterface)
+			for recordType, existing := range map[dns.RecordType]*dns.RecordSet{dns.A: test.existingA, dns.AAAA: test.existingAAAA} {
+				if existing != nil {
+					mockDNSClient.EXPECT().GetRecordSet(gomock.Any(), "dns-rg", "example.com", "www", recordType).Return(*existing, nil).MaxTimes(1)
+				} else {
+					mockDNSClient.EXPECT().GetRecordSet(gomock.Any(), "dns-rg", "example.com", "www", recordType).Return(dns.RecordSet{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).MaxTimes(1)
+				}
+			}
+			if test.expectedA != nil {
+				mockDNSClient.EXPECT().CreateOrUpdateRecordSet(gomock.Any(), "dns-rg", "example.com", "www", dns.A, gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName, zoneName, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, etag string) *retry.Error {
+					assert.Equal(t, *test.expectedA, parameters)
+					if test.existingA != nil {
+						assert.Equal(t, "1", etag)
+					}
+					return nil
+				})
+			}
+			if test.expectedDeleteA {
+				mockDNSClient.EXPECT().DeleteRecordSet(gomock.Any(), "dns-rg", "example.com", "www", dns.A, "1").Return(nil)
+			}
+			if test.expectedDeleteAAAA {
+				mockDNSClient.EXPECT().DeleteRecordSet(gomock.Any(), "dns-rg", "example.com", "www", dns.AAAA, "1").Return(nil)
+			}
+
+			err := az.reconcileDNSRecords("kubernetes", &svc, lbStatus, test.wantLb)
+			assert.Equal(t, test.expectedErr, err != nil)
+		})
+	}
+}
+
+func TestGetDNSClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	assert.Equal(t, az.DNSClient, az.getDNSClient("subscription2"))
+
+	az.dnsClientConfig = &azclients.ClientConfig{SubscriptionID: "subscription", Backoff: &retry.Backoff{Steps: 1}}
+	assert.Equal(t, az.DNSClient, az.getDNSClient("Subscription"))
+	client := az.getDNSClient("subscription2")
+	assert.NotEqual(t, az.DNSClient, client)
+	assert.Equal(t, client, az.getDNSClient("subscription2"))
+}
+
+func TestReconcilePrivateDNSRecords(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	zoneID := "/subscriptions/subscription/resourceGroups/dns-rg/providers/Microsoft.Network/privateDnsZones/internal.example.com"
+	lbStatus := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.4"}}}
+	ownedMetadata := map[string]*string{
+		consts.DNSRecordServiceMetadataKey:     to.StringPtr("default/service1"),
+		consts.DNSRecordClusterNameMetadataKey: to.StringPtr("kubernetes"),
+	}
+	notFoundErr := &retry.Error{HTTPStatusCode: http.StatusNotFound}
+
+	t.Run("the record of the internal service should be created in the default zone", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		az.PrivateDNSZoneID = zoneID
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerInternal: consts.TrueAnnotationValue}, false, 80)
+
+		mockPrivateDNSClient := az.privatednsclient.(*mockprivatednsclient.MockInterface)
+		mockPrivateDNSClient.EXPECT().GetRecordSet(gomock.Any(), "dns-rg", "internal.example.com", "service1.default", privatedns.A).Return(privatedns.RecordSet{}, notFoundErr)
+		mockPrivateDNSClient.EXPECT().GetRecordSet(gomock.Any(), "dns-rg", "internal.example.com", "service1.default", privatedns.AAAA).Return(privatedns.RecordSet{}, notFoundErr)
+		mockPrivateDNSClient.EXPECT().CreateOrUpdateRecordSet(gomock.Any(), "dns-rg", "internal.example.com", "service1.default", privatedns.A, privatedns.RecordSet{
+			RecordSetProperties: &privatedns.RecordSetProperties{
+				TTL:      to.Int64Ptr(consts.DNSRecordTTLDefault),
+				Metadata: ownedMetadata,
+				ARecords: &[]privatedns.ARecord{{Ipv4Address: to.StringPtr("10.0.0.4")}},
+			},
+		}, "").Return(nil)
+		assert.NoError(t, az.reconcilePrivateDNSRecords("kubernetes", &svc, lbStatus, true))
+	})
+
+	t.Run("the record owned by another cluster should not be changed", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		recorder := record.NewFakeRecorder(10)
+		az.eventRecorder = recorder
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+			consts.ServiceAnnotationLoadBalancerInternal: consts.TrueAnnotationValue,
+			consts.ServiceAnnotationPrivateDNSZoneID:     zoneID,
+			consts.ServiceAnnotationDNSRecordName:        "api",
+		}, false, 80)
+
+		mockPrivateDNSClient := az.privatednsclient.(*mockprivatednsclient.MockInterface)
+		mockPrivateDNSClient.EXPECT().GetRecordSet(gomock.Any(), "dns-rg", "internal.example.com", "api", privatedns.A).Return(privatedns.RecordSet{
+			Etag: to.StringPtr("1"),
+			RecordSetProperties: &privatedns.RecordSetProperties{
+				Metadata: map[string]*string{
+					consts.DNSRecordServiceMetadataKey:     to.StringPtr("default/service1"),
+					consts.DNSRecordClusterNameMetadataKey: to.StringPtr("another-cluster"),
+				},
+				ARecords: &[]privatedns.ARecord{{Ipv4Address: to.StringPtr("10.1.0.4")}},
+			},
+		}, nil)
+		assert.Error(t, az.reconcilePrivateDNSRecords("kubernetes", &svc, lbStatus, true))
+		assert.Contains(t, <-recorder.Events, "DNSRecordConflict")
+	})
+
+	t.Run("the record should be deleted if the service is not internal", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		recorder := record.NewFakeRecorder(10)
+		az.eventRecorder = recorder
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationPrivateDNSZoneID: zoneID}, false, 80)
+
+		mockPrivateDNSClient := az.privatednsclient.(*mockprivatednsclient.MockInterface)
+		mockPrivateDNSClient.EXPECT().GetRecordSet(gomock.Any(), "dns-rg", "internal.example.com", "service1.default", privatedns.A).Return(privatedns.RecordSet{
+			Etag:                to.StringPtr("1"),
+			RecordSetProperties: &privatedns.RecordSetProperties{Metadata: ownedMetadata},
+		}, nil)
+		mockPrivateDNSClient.EXPECT().GetRecordSet(gomock.Any(), "dns-rg", "internal.example.com", "service1.default", privatedns.AAAA).Return(privatedns.RecordSet{}, notFoundErr)
+		mockPrivateDNSClient.EXPECT().DeleteRecordSet(gomock.Any(), "dns-rg", "internal.example.com", "service1.default", privatedns.A, "1").Return(nil)
+		assert.NoError(t, az.reconcilePrivateDNSRecords("kubernetes", &svc, lbStatus, true))
+		assert.Contains(t, <-recorder.Events, "PrivateDNSRecordIgnored")
+	})
+
+	t.Run("the service should be opted out of the default zone by the empty annotation", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		az.PrivateDNSZoneID = zoneID
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+			consts.ServiceAnnotationLoadBalancerInternal: consts.TrueAnnotationValue,
+			consts.ServiceAnnotationPrivateDNSZoneID:     "",
+		}, false, 80)
+		assert.NoError(t, az.reconcilePrivateDNSRecords("kubernetes", &svc, lbStatus, true))
+	})
+
+	t.Run("an error should be returned if the private DNS zone ID is invalid", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationPrivateDNSZoneID: "internal.example.com"}, false, 80)
+		assert.Error(t, az.reconcilePrivateDNSRecords("kubernetes", &svc, lbStatus, true))
+	})
+}
+
+func TestGetPrivateDNSClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	assert.Equal(t, az.privatednsclient, az.getPrivateDNSClient("subscription2"))
+
+	az.privateDNSClientConfig = &azclients.ClientConfig{SubscriptionID: "subscription", Backoff: &retry.Backoff{Steps: 1}}
+	assert.Equal(t, az.privatednsclient, az.getPrivateDNSClient("Subscription"))
+	client := az.getPrivateDNSClient("subscription2")
+	assert.NotEqual(t, az.privatednsclient, client)
+	assert.Equal(t, client, az.getPrivateDNSClient("subscription2"))
+}
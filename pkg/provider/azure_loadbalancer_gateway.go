@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+var gatewayLoadBalancerFrontendIPConfigIDRE = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.Network/loadBalancers/([^/]+)/frontendIPConfigurations/([^/]+)$`)
+
+// getServiceGatewayLoadBalancerFrontendIPConfigID returns the ID of the frontend IP configuration of the gateway load
+// balancer which the public frontends of the service are chained to, or an empty string if they are not chained.
+// The frontends of the internal services are not chained.
+func getServiceGatewayLoadBalancerFrontendIPConfigID(service *v1.Service) string {
+	if requiresInternalLoadBalancer(service) {
+		return ""
+	}
+	return strings.TrimSpace(service.Annotations[consts.ServiceAnnotationGatewayLoadBalancerFrontendIPConfigID])
+}
+
+// getFrontendIPConfigGatewayLoadBalancerID returns the ID of the gateway load balancer frontend which the frontend
+// IP configuration is chained to.
+func getFrontendIPConfigGatewayLoadBalancerID(config network.FrontendIPConfiguration) string {
+	if config.FrontendIPConfigurationPropertiesFormat == nil || config.GatewayLoadBalancer == nil {
+		return ""
+	}
+	return to.String(config.GatewayLoadBalancer.ID)
+}
+
+// validateGatewayLoadBalancerFrontendIPConfig checks if the frontend IP configuration of the gateway load balancer
+// can be referenced by the public frontends of the service. The gateway load balancer, which may be in another
+// subscription, should be in the same region as the standard load balancer of the cluster.
+func (az *Cloud) validateGatewayLoadBalancerFrontendIPConfig(service *v1.Service, frontendIPConfigID string) error {
+	serviceName := getServiceName(service)
+	matches := gatewayLoadBalancerFrontendIPConfigIDRE.FindStringSubmatch(frontendIPConfigID)
+	if len(matches) != 5 {
+		return fmt.Errorf("validateGatewayLoadBalancerFrontendIPConfig for service(%s): %s is not a valid frontend IP configuration ID", serviceName, frontendIPConfigID)
+	}
+	if !az.useStandardLoadBalancer() {
+		return fmt.Errorf("validateGatewayLoadBalancerFrontendIPConfig for service(%s): the gateway load balancer is only supported with the standard load balancer", serviceName)
+	}
+
+	subscriptionID, resourceGroup, lbName, frontendIPConfigName := matches[1], matches[2], matches[3], matches[4]
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	gatewayLB, rerr := az.getSubscriptionLoadBalancerClient(subscriptionID).Get(ctx, resourceGroup, lbName, "")
+	if rerr != nil {
+		return fmt.Errorf("validateGatewayLoadBalancerFrontendIPConfig for service(%s): failed to get the gateway load balancer %s: %w", serviceName, lbName, rerr.Error())
+	}
+	if gatewayLB.Sku == nil || gatewayLB.Sku.Name != network.LoadBalancerSkuNameGateway {
+		return fmt.Errorf("validateGatewayLoadBalancerFrontendIPConfig for service(%s): the load balancer %s is not a gateway load balancer", serviceName, lbName)
+	}
+	if location := to.String(gatewayLB.Location); !strings.EqualFold(strings.ReplaceAll(location, " ", ""), strings.ReplaceAll(az.Location, " ", "")) {
+		return fmt.Errorf("validateGatewayLoadBalancerFrontendIPConfig for service(%s): the gateway load balancer %s in the region %s can't be referenced by the load balancer in the region %s", serviceName, lbName, location, az.Location)
+	}
+
+	if gatewayLB.LoadBalancerPropertiesFormat != nil && gatewayLB.FrontendIPConfigurations != nil {
+		for _, config := range *gatewayLB.FrontendIPConfigurations {
+			if strings.EqualFold(to.String(config.Name), frontendIPConfigName) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("validateGatewayLoadBalancerFrontendIPConfig for service(%s): the frontend IP configuration %s of the gateway load balancer %s is not found", serviceName, frontendIPConfigName, lbName)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestGetServiceGatewayLoadBalancerFrontendIPConfigID(t *testing.T) {
+	frontendIPConfigID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/gwlb/frontendIPConfigurations/fip"
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationGatewayLoadBalancerFrontendIPConfigID: " " + frontendIPConfigID}, false, 80)
+	assert.Equal(t, frontendIPConfigID, getServiceGatewayLoadBalancerFrontendIPConfigID(&svc))
+
+	// the frontends of the internal services are not chained
+	svc.Annotations[consts.ServiceAnnotationLoadBalancerInternal] = consts.TrueAnnotationValue
+	assert.Empty(t, getServiceGatewayLoadBalancerFrontendIPConfigID(&svc))
+
+	assert.Empty(t, getFrontendIPConfigGatewayLoadBalancerID(network.FrontendIPConfiguration{}))
+	assert.Equal(t, frontendIPConfigID, getFrontendIPConfigGatewayLoadBalancerID(network.FrontendIPConfiguration{
+		FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+			GatewayLoadBalancer: &network.SubResource{ID: to.StringPtr(frontendIPConfigID)},
+		},
+	}))
+}
+
+func TestValidateGatewayLoadBalancerFrontendIPConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	frontendIPConfigID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/gwlb/frontendIPConfigurations/fip"
+	gatewayLB := func(skuName network.LoadBalancerSkuName, location, frontendIPConfigName string) network.LoadBalancer {
+		return network.LoadBalancer{
+			Name:     to.StringPtr("gwlb"),
+			Location: to.StringPtr(location),
+			Sku:      &network.LoadBalancerSku{Name: skuName},
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: to.StringPtr(frontendIPConfigName)}},
+			},
+		}
+	}
+
+	for _, test := range []struct {
+		desc               string
+		frontendIPConfigID string
+		loadBalancerSku    string
+		existingLB         *network.LoadBalancer
+		getErr             *retry.Error
+		expectedErr        bool
+	}{
+		{
+			desc:               "the frontend of the gateway load balancer in the same region should be valid",
+			frontendIPConfigID: frontendIPConfigID,
+			existingLB: func() *network.LoadBalancer {
+				lb := gatewayLB(network.LoadBalancerSkuNameGateway, "West US", "FIP")
+				return &lb
+			}(),
+		},
+		{
+			desc:               "an error should be returned if the ID is invalid",
+			frontendIPConfigID: "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/gwlb",
+			expectedErr:        true,
+		},
+		{
+			desc:               "an error should be returned for the basic load balancer",
+			frontendIPConfigID: frontendIPConfigID,
+			loadBalancerSku:    consts.LoadBalancerSkuBasic,
+			expectedErr:        true,
+		},
+		{
+			desc:               "an error should be returned if the gateway load balancer can't be got",
+			frontendIPConfigID: frontendIPConfigID,
+			getErr:             &retry.Error{HTTPStatusCode: http.StatusNotFound},
+			expectedErr:        true,
+		},
+		{
+			desc:               "an error should be returned if the load balancer is not a gateway load balancer",
+			frontendIPConfigID: frontendIPConfigID,
+			existingLB: func() *network.LoadBalancer {
+				lb := gatewayLB(network.LoadBalancerSkuNameStandard, "westus", "fip")
+				return &lb
+			}(),
+			expectedErr: true,
+		},
+		{
+			desc:               "an error should be returned if the gateway load balancer is in another region",
+			frontendIPConfigID: frontendIPConfigID,
+			existingLB: func() *network.LoadBalancer {
+				lb := gatewayLB(network.LoadBalancerSkuNameGateway, "eastus", "fip")
+				return &lb
+			}(),
+			expectedErr: true,
+		},
+		{
+			desc:               "an error should be returned if the frontend is not found",
+			frontendIPConfigID: frontendIPConfigID,
+			existingLB: func() *network.LoadBalancer {
+				lb := gatewayLB(network.LoadBalancerSkuNameGateway, "westus", "fip2")
+				return &lb
+			}(),
+			expectedErr: true,
+		},
+	} {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+		if test.loadBalancerSku != "" {
+			az.LoadBalancerSku = test.loadBalancerSku
+		}
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		if test.existingLB != nil {
+			mockLBClient.EXPECT().Get(gomock.Any(), "rg", "gwlb", "").Return(*test.existingLB, nil)
+		} else if test.getErr != nil {
+			mockLBClient.EXPECT().Get(gomock.Any(), "rg", "gwlb", "").Return(network.LoadBalancer{}, test.getErr)
+		}
+
+		svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+		err := az.validateGatewayLoadBalancerFrontendIPConfig(&svc, test.frontendIPConfigID)
+		assert.Equal(t, test.expectedErr, err != nil, test.desc)
+	}
+}
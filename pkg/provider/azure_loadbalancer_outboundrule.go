@@ -0,0 +1,523 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	// maxManagedOutboundIPCount is the maximum number of the public IPs created for the managed outbound rule.
+	maxManagedOutboundIPCount = 16
+	// maxOutboundPortsPerIP is the number of the SNAT ports provided by each outbound public IP.
+	maxOutboundPortsPerIP = 64000
+	// defaultOutboundRuleIdleTimeoutInMinutes is the default idle timeout of the managed outbound rule.
+	defaultOutboundRuleIdleTimeoutInMinutes = 30
+	minOutboundRuleIdleTimeoutInMinutes     = 4
+	maxOutboundRuleIdleTimeoutInMinutes     = 120
+)
+
+// validateManagedOutboundRuleConfig checks the managed outbound rule in the cloud config.
+func validateManagedOutboundRuleConfig(config *Config) error {
+	rule := config.ManagedOutboundRule
+	if rule == nil {
+		return nil
+	}
+
+	if !strings.EqualFold(config.LoadBalancerSku, consts.LoadBalancerSkuStandard) {
+		return fmt.Errorf("managedOutboundRule is only supported with the standard load balancer")
+	}
+	if strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypePODIP) {
+		return fmt.Errorf("managedOutboundRule is not supported with the %s backend pool configuration type", consts.LoadBalancerBackendPoolConfigurationTypePODIP)
+	}
+	if config.DisableOutboundSNAT != nil && !*config.DisableOutboundSNAT {
+		return fmt.Errorf("disableOutboundSNAT should not be false when managedOutboundRule is set")
+	}
+
+	hasOutboundIPs := len(rule.OutboundIPIDs) > 0 || len(rule.OutboundIPPrefixIDs) > 0
+	if rule.ManagedOutboundIPCount != 0 && hasOutboundIPs {
+		return fmt.Errorf("managedOutboundRule: managedOutboundIPCount should not be set together with outboundIPIDs or outboundIPPrefixIDs")
+	}
+	if rule.ManagedOutboundIPCount == 0 && !hasOutboundIPs {
+		return fmt.Errorf("managedOutboundRule: one of managedOutboundIPCount, outboundIPIDs and outboundIPPrefixIDs should be set")
+	}
+	if rule.ManagedOutboundIPCount < 0 || rule.ManagedOutboundIPCount > maxManagedOutboundIPCount {
+		return fmt.Errorf("managedOutboundRule: managedOutboundIPCount %d should be between 1 and %d", rule.ManagedOutboundIPCount, maxManagedOutboundIPCount)
+	}
+	for _, pipID := range rule.OutboundIPIDs {
+		if !pipIDRE.MatchString(pipID) {
+			return fmt.Errorf("managedOutboundRule: %s is not a valid public IP ID", pipID)
+		}
+	}
+	for _, pipPrefixID := range rule.OutboundIPPrefixIDs {
+		if !pipPrefixIDRE.MatchString(pipPrefixID) {
+			return fmt.Errorf("managedOutboundRule: %s is not a valid public IP prefix ID", pipPrefixID)
+		}
+	}
+
+	if rule.AllocatedOutboundPorts < 0 || rule.AllocatedOutboundPorts > maxOutboundPortsPerIP || rule.AllocatedOutboundPorts%8 != 0 {
+		return fmt.Errorf("managedOutboundRule: allocatedOutboundPorts %d should be a multiple of 8 between 0 and %d", rule.AllocatedOutboundPorts, maxOutboundPortsPerIP)
+	}
+	if rule.IdleTimeoutInMinutes != 0 &&
+		(rule.IdleTimeoutInMinutes < minOutboundRuleIdleTimeoutInMinutes || rule.IdleTimeoutInMinutes > maxOutboundRuleIdleTimeoutInMinutes) {
+		return fmt.Errorf("managedOutboundRule: idleTimeoutInMinutes %d should be between %d and %d", rule.IdleTimeoutInMinutes, minOutboundRuleIdleTimeoutInMinutes, maxOutboundRuleIdleTimeoutInMinutes)
+	}
+	return nil
+}
+
+// getManagedOutboundRuleName returns the name of the outbound rule managed by the cloud provider.
+func getManagedOutboundRuleName(clusterName string) string {
+	return fmt.Sprintf("%s-outbound-rule", clusterName)
+}
+
+// getManagedOutboundFrontendIPConfigPrefix returns the name prefix of the frontend IP configs
+// referenced by the managed outbound rule.
+func getManagedOutboundFrontendIPConfigPrefix(clusterName string) string {
+	return fmt.Sprintf("%s-outbound-", clusterName)
+}
+
+// getManagedOutboundPIPName returns the name of the index-th public IP created for the managed outbound rule.
+// It is used as the name of the frontend IP config referencing the public IP as well.
+func getManagedOutboundPIPName(clusterName string, index int) string {
+	return fmt.Sprintf("%spip-%d", getManagedOutboundFrontendIPConfigPrefix(clusterName), index)
+}
+
+// reconcileManagedOutboundRule reconciles the outbound rule managed by the cloud provider on the primary
+// standard load balancer, together with the frontend IP configs referenced by it. The outbound rule only
+// covers the IPv4 cluster backend pool, so nothing is done before the backend pool is added to the load
+// balancer. The names of the managed public IPs which are not referenced by the load balancer anymore are
+// returned, and they should be deleted after the load balancer is updated. All of them are removed if the
+// managed outbound rule is not configured.
+func (az *Cloud) reconcileManagedOutboundRule(clusterName string, service *v1.Service, lb *network.LoadBalancer, nodes []*v1.Node) (bool, []string, error) {
+	if lb == nil || lb.LoadBalancerPropertiesFormat == nil {
+		return false, nil, nil
+	}
+	lbName := to.String(lb.Name)
+	if !strings.EqualFold(lbName, az.getAzureLoadBalancerName(clusterName, az.VMSet.GetPrimaryVMSetName(), false)) {
+		return false, nil, nil
+	}
+	if az.ManagedOutboundRule == nil {
+		changed, pipsToDelete := az.removeManagedOutboundRule(clusterName, lb)
+		return changed, pipsToDelete, nil
+	}
+
+	lbResourceGroup := az.getLoadBalancerResourceGroup()
+	backendPoolID := az.getBackendPoolID(lbName, lbResourceGroup, getBackendPoolName(clusterName, false))
+	var foundBackendPool bool
+	if lb.BackendAddressPools != nil {
+		for _, bp := range *lb.BackendAddressPools {
+			if strings.EqualFold(to.String(bp.ID), backendPoolID) {
+				foundBackendPool = true
+				break
+			}
+		}
+	}
+	if !foundBackendPool {
+		klog.V(4).Infof("reconcileManagedOutboundRule: the backend pool %s is not found on the load balancer %s, skipping", backendPoolID, lbName)
+		return false, nil, nil
+	}
+
+	expectedFIPConfigs, err := az.getExpectedManagedOutboundFrontendIPConfigs(clusterName, service)
+	if err != nil {
+		return false, nil, err
+	}
+	if err := az.checkManagedOutboundPorts(service, nodes); err != nil {
+		return false, nil, err
+	}
+
+	// reconcile the frontend IP configs referenced by the managed outbound rule
+	var changed bool
+	var pipsToDelete []string
+	fipConfigPrefix := strings.ToLower(getManagedOutboundFrontendIPConfigPrefix(clusterName))
+	var fipConfigs []network.FrontendIPConfiguration
+	if lb.FrontendIPConfigurations != nil {
+		fipConfigs = *lb.FrontendIPConfigurations
+	}
+	for i := len(fipConfigs) - 1; i >= 0; i-- {
+		fipConfig := fipConfigs[i]
+		fipConfigName := strings.ToLower(to.String(fipConfig.Name))
+		if !strings.HasPrefix(fipConfigName, fipConfigPrefix) {
+			continue
+		}
+		if expected, ok := expectedFIPConfigs[fipConfigName]; ok && equalOutboundFrontendIPConfig(fipConfig, expected) {
+			delete(expectedFIPConfigs, fipConfigName)
+			continue
+		}
+
+		klog.V(2).Infof("reconcileManagedOutboundRule: removing the frontend IP config %s from the load balancer %s", fipConfigName, lbName)
+		fipConfigs = append(fipConfigs[:i], fipConfigs[i+1:]...)
+		changed = true
+		if pipName := az.getManagedOutboundPIPNameFromFrontendIPConfig(clusterName, fipConfig); pipName != "" {
+			pipsToDelete = append(pipsToDelete, pipName)
+		}
+	}
+	for _, fipConfigName := range sets.StringKeySet(expectedFIPConfigs).List() {
+		klog.V(2).Infof("reconcileManagedOutboundRule: adding the frontend IP config %s to the load balancer %s", fipConfigName, lbName)
+		fipConfigs = append(fipConfigs, expectedFIPConfigs[fipConfigName])
+		changed = true
+	}
+	lb.FrontendIPConfigurations = &fipConfigs
+
+	// a managed public IP is reused if its frontend IP config is recreated
+	inUsePIPNames := sets.NewString()
+	for _, fipConfig := range fipConfigs {
+		if pipName := az.getManagedOutboundPIPNameFromFrontendIPConfig(clusterName, fipConfig); pipName != "" {
+			inUsePIPNames.Insert(strings.ToLower(pipName))
+		}
+	}
+	var stalePIPs []string
+	for _, pipName := range pipsToDelete {
+		if !inUsePIPNames.Has(strings.ToLower(pipName)) {
+			stalePIPs = append(stalePIPs, pipName)
+		}
+	}
+
+	// reconcile the managed outbound rule
+	var fipConfigIDs []network.SubResource
+	for _, fipConfig := range fipConfigs {
+		if strings.HasPrefix(strings.ToLower(to.String(fipConfig.Name)), fipConfigPrefix) {
+			fipConfigIDs = append(fipConfigIDs, network.SubResource{
+				ID: to.StringPtr(az.getFrontendIPConfigID(lbName, lbResourceGroup, to.String(fipConfig.Name))),
+			})
+		}
+	}
+	expectedRule := az.getExpectedManagedOutboundRule(clusterName, backendPoolID, fipConfigIDs)
+
+	var outboundRules []network.OutboundRule
+	if lb.OutboundRules != nil {
+		outboundRules = *lb.OutboundRules
+	}
+	var foundRule bool
+	for i := range outboundRules {
+		if !strings.EqualFold(to.String(outboundRules[i].Name), to.String(expectedRule.Name)) {
+			continue
+		}
+		foundRule = true
+		if !equalOutboundRule(outboundRules[i], expectedRule) {
+			klog.V(2).Infof("reconcileManagedOutboundRule: updating the outbound rule %s of the load balancer %s", to.String(expectedRule.Name), lbName)
+			outboundRules[i] = expectedRule
+			changed = true
+		}
+		break
+	}
+	if !foundRule {
+		klog.V(2).Infof("reconcileManagedOutboundRule: adding the outbound rule %s to the load balancer %s", to.String(expectedRule.Name), lbName)
+		outboundRules = append(outboundRules, expectedRule)
+		changed = true
+	}
+	lb.OutboundRules = &outboundRules
+
+	return changed, stalePIPs, nil
+}
+
+// removeManagedOutboundRule removes the managed outbound rule and the frontend IP configs referenced by it
+// from the load balancer after the managed outbound rule is removed from the config. The names of the managed
+// public IPs referenced by the removed frontend IP configs are returned.
+func (az *Cloud) removeManagedOutboundRule(clusterName string, lb *network.LoadBalancer) (bool, []string) {
+	var changed bool
+	lbName := to.String(lb.Name)
+	if lb.OutboundRules != nil {
+		outboundRules := *lb.OutboundRules
+		for i := len(outboundRules) - 1; i >= 0; i-- {
+			if strings.EqualFold(to.String(outboundRules[i].Name), getManagedOutboundRuleName(clusterName)) {
+				klog.V(2).Infof("removeManagedOutboundRule: removing the outbound rule %s from the load balancer %s", to.String(outboundRules[i].Name), lbName)
+				outboundRules = append(outboundRules[:i], outboundRules[i+1:]...)
+				changed = true
+			}
+		}
+		lb.OutboundRules = &outboundRules
+	}
+
+	var pipsToDelete []string
+	if lb.FrontendIPConfigurations != nil {
+		fipConfigPrefix := strings.ToLower(getManagedOutboundFrontendIPConfigPrefix(clusterName))
+		fipConfigs := *lb.FrontendIPConfigurations
+		for i := len(fipConfigs) - 1; i >= 0; i-- {
+			fipConfig := fipConfigs[i]
+			if !strings.HasPrefix(strings.ToLower(to.String(fipConfig.Name)), fipConfigPrefix) {
+				continue
+			}
+			klog.V(2).Infof("removeManagedOutboundRule: removing the frontend IP config %s from the load balancer %s", to.String(fipConfig.Name), lbName)
+			fipConfigs = append(fipConfigs[:i], fipConfigs[i+1:]...)
+			changed = true
+			if pipName := az.getManagedOutboundPIPNameFromFrontendIPConfig(clusterName, fipConfig); pipName != "" {
+				pipsToDelete = append(pipsToDelete, pipName)
+			}
+		}
+		lb.FrontendIPConfigurations = &fipConfigs
+	}
+	return changed, pipsToDelete
+}
+
+// getExpectedManagedOutboundFrontendIPConfigs returns the frontend IP configs expected by the managed outbound rule,
+// keyed by the lower-cased names. The public IPs are created if the count of the managed outbound IPs is set.
+func (az *Cloud) getExpectedManagedOutboundFrontendIPConfigs(clusterName string, service *v1.Service) (map[string]network.FrontendIPConfiguration, error) {
+	ruleConfig := az.ManagedOutboundRule
+	fipConfigPrefix := getManagedOutboundFrontendIPConfigPrefix(clusterName)
+	expectedFIPConfigs := make(map[string]network.FrontendIPConfiguration)
+	addFIPConfig := func(name string, props *network.FrontendIPConfigurationPropertiesFormat) {
+		expectedFIPConfigs[strings.ToLower(name)] = network.FrontendIPConfiguration{
+			Name:                                    to.StringPtr(name),
+			FrontendIPConfigurationPropertiesFormat: props,
+		}
+	}
+
+	for i := 0; i < ruleConfig.ManagedOutboundIPCount; i++ {
+		pipName := getManagedOutboundPIPName(clusterName, i)
+		pip, err := az.ensureManagedOutboundPublicIP(service, clusterName, pipName)
+		if err != nil {
+			return nil, err
+		}
+		addFIPConfig(pipName, &network.FrontendIPConfigurationPropertiesFormat{
+			PublicIPAddress: &network.PublicIPAddress{ID: pip.ID},
+		})
+	}
+	for _, pipID := range ruleConfig.OutboundIPIDs {
+		matches := pipIDRE.FindStringSubmatch(pipID)
+		addFIPConfig(fipConfigPrefix+matches[3], &network.FrontendIPConfigurationPropertiesFormat{
+			PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(pipID)},
+		})
+	}
+	for _, pipPrefixID := range ruleConfig.OutboundIPPrefixIDs {
+		matches := pipPrefixIDRE.FindStringSubmatch(pipPrefixID)
+		addFIPConfig(fipConfigPrefix+matches[3], &network.FrontendIPConfigurationPropertiesFormat{
+			PublicIPPrefix: &network.SubResource{ID: to.StringPtr(pipPrefixID)},
+		})
+	}
+	return expectedFIPConfigs, nil
+}
+
+// ensureManagedOutboundPublicIP creates the public IP for the managed outbound rule if it doesn't exist.
+// The public IP is tagged with the cluster name only, so it would never be taken as one owned by a service.
+func (az *Cloud) ensureManagedOutboundPublicIP(service *v1.Service, clusterName, pipName string) (*network.PublicIPAddress, error) {
+	pip, existsPip, err := az.getPublicIPAddress(az.ResourceGroup, pipName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	if existsPip {
+		return &pip, nil
+	}
+
+	pip = network.PublicIPAddress{
+		Name:     to.StringPtr(pipName),
+		Location: to.StringPtr(az.Location),
+		Sku: &network.PublicIPAddressSku{
+			Name: network.PublicIPAddressSkuNameStandard,
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAllocationMethod: network.IPAllocationMethodStatic,
+			PublicIPAddressVersion:   network.IPVersionIPv4,
+		},
+		Tags: map[string]*string{
+			consts.ClusterNameKey: to.StringPtr(clusterName),
+		},
+	}
+	if az.HasExtendedLocation() {
+		pip.ExtendedLocation = &network.ExtendedLocation{
+			Name: &az.ExtendedLocationName,
+			Type: getExtendedLocationTypeFromString(az.ExtendedLocationType),
+		}
+	} else {
+		zones, err := az.getRegionZonesBackoff(az.Location)
+		if err != nil {
+			return nil, err
+		}
+		if len(zones) > 0 {
+			pip.Zones = &zones
+		}
+	}
+
+	klog.V(2).Infof("ensureManagedOutboundPublicIP: creating the public IP %s/%s", az.ResourceGroup, pipName)
+	if err := az.CreateOrUpdatePIP(service, az.ResourceGroup, pip); err != nil {
+		return nil, err
+	}
+	pip, existsPip, err = az.getPublicIPAddress(az.ResourceGroup, pipName, azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return nil, err
+	}
+	if !existsPip || pip.ID == nil {
+		return nil, fmt.Errorf("ensureManagedOutboundPublicIP: public IP %s/%s not found after creation", az.ResourceGroup, pipName)
+	}
+	return &pip, nil
+}
+
+// getManagedOutboundPIPNameFromFrontendIPConfig returns the name of the public IP created for the managed
+// outbound rule, which is referenced by the frontend IP config. Empty string would be returned if the frontend
+// IP config references any other public IP.
+func (az *Cloud) getManagedOutboundPIPNameFromFrontendIPConfig(clusterName string, fipConfig network.FrontendIPConfiguration) string {
+	if fipConfig.FrontendIPConfigurationPropertiesFormat == nil || fipConfig.PublicIPAddress == nil {
+		return ""
+	}
+	matches := pipIDRE.FindStringSubmatch(to.String(fipConfig.PublicIPAddress.ID))
+	if len(matches) != 4 || !strings.EqualFold(matches[2], az.ResourceGroup) {
+		return ""
+	}
+	pipName := matches[3]
+	if !strings.HasPrefix(strings.ToLower(pipName), strings.ToLower(getManagedOutboundFrontendIPConfigPrefix(clusterName)+"pip-")) {
+		return ""
+	}
+	return pipName
+}
+
+// checkManagedOutboundPorts makes sure that the outbound IPs provide enough SNAT ports for the nodes in the
+// cluster backend pool when the allocated outbound ports are set explicitly.
+func (az *Cloud) checkManagedOutboundPorts(service *v1.Service, nodes []*v1.Node) error {
+	ruleConfig := az.ManagedOutboundRule
+	if ruleConfig.AllocatedOutboundPorts == 0 || nodes == nil {
+		return nil
+	}
+
+	var nodeCount int
+	for _, node := range nodes {
+		shouldExcludeLoadBalancer, err := az.ShouldNodeExcludedFromLoadBalancer(node.Name)
+		if err != nil {
+			return err
+		}
+		if !shouldExcludeLoadBalancer {
+			nodeCount++
+		}
+	}
+
+	ipCount := ruleConfig.ManagedOutboundIPCount + len(ruleConfig.OutboundIPIDs)
+	for _, pipPrefixID := range ruleConfig.OutboundIPPrefixIDs {
+		prefixLength, err := az.getPublicIPPrefixLength(pipPrefixID)
+		if err != nil {
+			return err
+		}
+		ipCount += getPublicIPPrefixCapacity(prefixLength, 32)
+	}
+
+	requiredPorts := int64(ruleConfig.AllocatedOutboundPorts) * int64(nodeCount)
+	availablePorts := int64(maxOutboundPortsPerIP) * int64(ipCount)
+	if requiredPorts > availablePorts {
+		message := fmt.Sprintf("the managed outbound rule requires %d SNAT ports for %d nodes with %d allocated outbound ports each, "+
+			"but only %d SNAT ports are provided by %d outbound IPs", requiredPorts, nodeCount, ruleConfig.AllocatedOutboundPorts, availablePorts, ipCount)
+		az.Event(service, v1.EventTypeWarning, "InsufficientOutboundPorts", message)
+		return fmt.Errorf("checkManagedOutboundPorts: %s", message)
+	}
+	return nil
+}
+
+// getPublicIPPrefixLength returns the prefix length of the public IP prefix. The prefix length can't be changed
+// after the public IP prefix is created, so it is cached in publicIPPrefixLengths by the ID of the prefix.
+func (az *Cloud) getPublicIPPrefixLength(pipPrefixID string) (int32, error) {
+	key := strings.ToLower(pipPrefixID)
+	if prefixLength, ok := az.publicIPPrefixLengths.Load(key); ok {
+		return prefixLength.(int32), nil
+	}
+
+	matches := pipPrefixIDRE.FindStringSubmatch(pipPrefixID)
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	pipPrefix, rerr := az.PublicIPPrefixesClient.Get(ctx, matches[2], matches[3], "")
+	if rerr != nil {
+		klog.Errorf("PublicIPPrefixesClient.Get(%s, %s) failed: %s", matches[2], matches[3], rerr.Error().Error())
+		return 0, rerr.Error()
+	}
+	if pipPrefix.PublicIPPrefixPropertiesFormat == nil || pipPrefix.PrefixLength == nil {
+		return 0, fmt.Errorf("checkManagedOutboundPorts: public IP prefix %s has no prefix length", pipPrefixID)
+	}
+	az.publicIPPrefixLengths.Store(key, *pipPrefix.PrefixLength)
+	return *pipPrefix.PrefixLength, nil
+}
+
+// getExpectedManagedOutboundRule returns the expected managed outbound rule.
+func (az *Cloud) getExpectedManagedOutboundRule(clusterName, backendPoolID string, fipConfigIDs []network.SubResource) network.OutboundRule {
+	ruleConfig := az.ManagedOutboundRule
+	idleTimeoutInMinutes := ruleConfig.IdleTimeoutInMinutes
+	if idleTimeoutInMinutes == 0 {
+		idleTimeoutInMinutes = defaultOutboundRuleIdleTimeoutInMinutes
+	}
+	enableTCPReset := true
+	if ruleConfig.EnableTCPReset != nil {
+		enableTCPReset = *ruleConfig.EnableTCPReset
+	}
+
+	return network.OutboundRule{
+		Name: to.StringPtr(getManagedOutboundRuleName(clusterName)),
+		OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+			AllocatedOutboundPorts:   to.Int32Ptr(ruleConfig.AllocatedOutboundPorts),
+			FrontendIPConfigurations: &fipConfigIDs,
+			BackendAddressPool:       &network.SubResource{ID: to.StringPtr(backendPoolID)},
+			Protocol:                 network.LoadBalancerOutboundRuleProtocolAll,
+			EnableTCPReset:           to.BoolPtr(enableTCPReset),
+			IdleTimeoutInMinutes:     to.Int32Ptr(idleTimeoutInMinutes),
+		},
+	}
+}
+
+// equalOutboundFrontendIPConfig checks if the frontend IP config references the same public IP or public IP prefix as the expected one.
+func equalOutboundFrontendIPConfig(fipConfig, expected network.FrontendIPConfiguration) bool {
+	if fipConfig.FrontendIPConfigurationPropertiesFormat == nil {
+		return false
+	}
+	var pipID, pipPrefixID, expectedPIPID, expectedPIPPrefixID string
+	if fipConfig.PublicIPAddress != nil {
+		pipID = to.String(fipConfig.PublicIPAddress.ID)
+	}
+	if fipConfig.PublicIPPrefix != nil {
+		pipPrefixID = to.String(fipConfig.PublicIPPrefix.ID)
+	}
+	if expected.PublicIPAddress != nil {
+		expectedPIPID = to.String(expected.PublicIPAddress.ID)
+	}
+	if expected.PublicIPPrefix != nil {
+		expectedPIPPrefixID = to.String(expected.PublicIPPrefix.ID)
+	}
+	return strings.EqualFold(pipID, expectedPIPID) && strings.EqualFold(pipPrefixID, expectedPIPPrefixID)
+}
+
+// equalOutboundRule checks if the outbound rule has the same properties as the expected one.
+func equalOutboundRule(rule, expected network.OutboundRule) bool {
+	if rule.OutboundRulePropertiesFormat == nil || expected.OutboundRulePropertiesFormat == nil {
+		return false
+	}
+	props, expectedProps := rule.OutboundRulePropertiesFormat, expected.OutboundRulePropertiesFormat
+	if to.Int32(props.AllocatedOutboundPorts) != to.Int32(expectedProps.AllocatedOutboundPorts) ||
+		to.Int32(props.IdleTimeoutInMinutes) != to.Int32(expectedProps.IdleTimeoutInMinutes) ||
+		to.Bool(props.EnableTCPReset) != to.Bool(expectedProps.EnableTCPReset) ||
+		!strings.EqualFold(string(props.Protocol), string(expectedProps.Protocol)) {
+		return false
+	}
+	if props.BackendAddressPool == nil || !strings.EqualFold(to.String(props.BackendAddressPool.ID), to.String(expectedProps.BackendAddressPool.ID)) {
+		return false
+	}
+
+	fipConfigIDs, expectedFIPConfigIDs := sets.NewString(), sets.NewString()
+	if props.FrontendIPConfigurations != nil {
+		for _, fipConfig := range *props.FrontendIPConfigurations {
+			fipConfigIDs.Insert(strings.ToLower(to.String(fipConfig.ID)))
+		}
+	}
+	if expectedProps.FrontendIPConfigurations != nil {
+		for _, fipConfig := range *expectedProps.FrontendIPConfigurations {
+			expectedFIPConfigIDs.Insert(strings.ToLower(to.String(fipConfig.ID)))
+		}
+	}
+	return fipConfigIDs.Equal(expectedFIPConfigIDs)
+}
@@ -0,0 +1,468 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipprefixclient/mockpublicipprefixclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestValidateManagedOutboundRuleConfig(t *testing.T) {
+	pipID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip1"
+	pipPrefixID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"
+
+	testCases := []struct {
+		desc                string
+		loadBalancerSku     string
+		backendPoolType     string
+		disableOutboundSNAT *bool
+		rule                *ManagedOutboundRuleConfig
+		expectedErr         string
+	}{
+		{
+			desc: "nil rule should be valid",
+		},
+		{
+			desc:            "the count of the managed outbound IPs should be valid",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 2, AllocatedOutboundPorts: 1024, IdleTimeoutInMinutes: 4},
+		},
+		{
+			desc:            "the outbound IPs and prefixes should be valid",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{OutboundIPIDs: []string{pipID}, OutboundIPPrefixIDs: []string{pipPrefixID}},
+		},
+		{
+			desc:        "the basic load balancer should not be supported",
+			rule:        &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1},
+			expectedErr: "managedOutboundRule is only supported with the standard load balancer",
+		},
+		{
+			desc:            "the podIP backend pool type should not be supported",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			rule:            &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1},
+			expectedErr:     "managedOutboundRule is not supported with the podIP backend pool configuration type",
+		},
+		{
+			desc:                "the outbound SNAT of the load balancing rules should not be enabled explicitly",
+			loadBalancerSku:     consts.LoadBalancerSkuStandard,
+			disableOutboundSNAT: to.BoolPtr(false),
+			rule:                &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1},
+			expectedErr:         "disableOutboundSNAT should not be false when managedOutboundRule is set",
+		},
+		{
+			desc:            "the count and the outbound IPs should not be set together",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1, OutboundIPIDs: []string{pipID}},
+			expectedErr:     "managedOutboundIPCount should not be set together with outboundIPIDs or outboundIPPrefixIDs",
+		},
+		{
+			desc:            "one of the count and the outbound IPs should be set",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{AllocatedOutboundPorts: 1024},
+			expectedErr:     "one of managedOutboundIPCount, outboundIPIDs and outboundIPPrefixIDs should be set",
+		},
+		{
+			desc:            "the count should not exceed the limit",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 17},
+			expectedErr:     "managedOutboundIPCount 17 should be between 1 and 16",
+		},
+		{
+			desc:            "the outbound IP ID should be valid",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{OutboundIPIDs: []string{"pip1"}},
+			expectedErr:     "pip1 is not a valid public IP ID",
+		},
+		{
+			desc:            "the outbound IP prefix ID should be valid",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{OutboundIPPrefixIDs: []string{pipID}},
+			expectedErr:     fmt.Sprintf("%s is not a valid public IP prefix ID", pipID),
+		},
+		{
+			desc:            "the allocated outbound ports should be a multiple of 8",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1, AllocatedOutboundPorts: 1001},
+			expectedErr:     "allocatedOutboundPorts 1001 should be a multiple of 8 between 0 and 64000",
+		},
+		{
+			desc:            "the idle timeout should be in the range",
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			rule:            &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1, IdleTimeoutInMinutes: 121},
+			expectedErr:     "idleTimeoutInMinutes 121 should be between 4 and 120",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config := &Config{
+				LoadBalancerSku:                          tc.loadBalancerSku,
+				LoadBalancerBackendPoolConfigurationType: tc.backendPoolType,
+				DisableOutboundSNAT:                      tc.disableOutboundSNAT,
+				ManagedOutboundRule:                      tc.rule,
+			}
+			err := validateManagedOutboundRuleConfig(config)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestReconcileManagedOutboundRule(t *testing.T) {
+	pipIDTemplate := "/subscriptions/subscription/resourceGroups/%s/providers/Microsoft.Network/publicIPAddresses/%s"
+	pipPrefixID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"
+	userPIPID := fmt.Sprintf(pipIDTemplate, "rg1", "pip1")
+	managedPIPID := func(index int) string {
+		return fmt.Sprintf(pipIDTemplate, "rg", getManagedOutboundPIPName(testClusterName, index))
+	}
+	getFIPConfig := func(name, pipID, pipPrefixID string) network.FrontendIPConfiguration {
+		fipConfig := network.FrontendIPConfiguration{
+			Name:                                    to.StringPtr(name),
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+		}
+		if pipID != "" {
+			fipConfig.PublicIPAddress = &network.PublicIPAddress{ID: to.StringPtr(pipID)}
+		}
+		if pipPrefixID != "" {
+			fipConfig.PublicIPPrefix = &network.SubResource{ID: to.StringPtr(pipPrefixID)}
+		}
+		return fipConfig
+	}
+	serviceFIPConfig := getFIPConfig("atest1", fmt.Sprintf(pipIDTemplate, "rg", "testCluster-atest1"), "")
+
+	testCases := []struct {
+		desc                    string
+		lbName                  string
+		rule                    *ManagedOutboundRuleConfig
+		existingFIPConfigs      []network.FrontendIPConfiguration
+		existingOutboundRules   []network.OutboundRule
+		existingPIPs            []string
+		noBackendPool           bool
+		nodeCount               int
+		pipPrefixLength         int32
+		expectedChanged         bool
+		expectedFIPConfigNames  []string
+		expectedPIPsToDelete    []string
+		expectedPIPsToCreate    []string
+		expectedAllocatedPorts  int32
+		expectedIdleTimeout     int32
+		expectedEnableTCPReset  bool
+		expectedNoOutboundRules bool
+		expectedErr             string
+	}{
+		{
+			desc:                    "nothing should be done if the managed outbound rule is not configured",
+			existingFIPConfigs:      []network.FrontendIPConfiguration{serviceFIPConfig},
+			expectedFIPConfigNames:  []string{"atest1"},
+			expectedNoOutboundRules: true,
+		},
+		{
+			desc:                    "nothing should be done for the load balancers other than the primary one",
+			lbName:                  "testCluster-internal",
+			rule:                    &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1},
+			existingFIPConfigs:      []network.FrontendIPConfiguration{serviceFIPConfig},
+			expectedFIPConfigNames:  []string{"atest1"},
+			expectedNoOutboundRules: true,
+		},
+		{
+			desc:                    "nothing should be done if the cluster backend pool doesn't exist",
+			rule:                    &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1},
+			noBackendPool:           true,
+			existingFIPConfigs:      []network.FrontendIPConfiguration{serviceFIPConfig},
+			expectedFIPConfigNames:  []string{"atest1"},
+			expectedNoOutboundRules: true,
+		},
+		{
+			desc:                   "the managed public IPs and the outbound rule should be created",
+			rule:                   &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 2, AllocatedOutboundPorts: 1024, IdleTimeoutInMinutes: 10},
+			existingFIPConfigs:     []network.FrontendIPConfiguration{serviceFIPConfig},
+			existingPIPs:           []string{getManagedOutboundPIPName(testClusterName, 0)},
+			nodeCount:              3,
+			expectedChanged:        true,
+			expectedFIPConfigNames: []string{"atest1", "testCluster-outbound-pip-0", "testCluster-outbound-pip-1"},
+			expectedPIPsToCreate:   []string{getManagedOutboundPIPName(testClusterName, 1)},
+			expectedAllocatedPorts: 1024,
+			expectedIdleTimeout:    10,
+			expectedEnableTCPReset: true,
+		},
+		{
+			desc: "nothing should be changed if the outbound rule is up to date",
+			rule: &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1},
+			existingFIPConfigs: []network.FrontendIPConfiguration{
+				serviceFIPConfig,
+				getFIPConfig(getManagedOutboundPIPName(testClusterName, 0), managedPIPID(0), ""),
+			},
+			existingOutboundRules: []network.OutboundRule{{
+				Name: to.StringPtr("testCluster-outbound-rule"),
+				OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+					AllocatedOutboundPorts: to.Int32Ptr(0),
+					FrontendIPConfigurations: &[]network.SubResource{
+						{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/testCluster/frontendIPConfigurations/testCluster-outbound-pip-0")},
+					},
+					BackendAddressPool:   &network.SubResource{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/testCluster/backendAddressPools/testCluster")},
+					Protocol:             network.LoadBalancerOutboundRuleProtocolAll,
+					EnableTCPReset:       to.BoolPtr(true),
+					IdleTimeoutInMinutes: to.Int32Ptr(30),
+				},
+			}},
+			existingPIPs:           []string{getManagedOutboundPIPName(testClusterName, 0)},
+			expectedFIPConfigNames: []string{"atest1", "testCluster-outbound-pip-0"},
+			expectedIdleTimeout:    30,
+			expectedEnableTCPReset: true,
+		},
+		{
+			desc: "the managed public IPs should be deleted when the count is decreased",
+			rule: &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1, EnableTCPReset: to.BoolPtr(false)},
+			existingFIPConfigs: []network.FrontendIPConfiguration{
+				serviceFIPConfig,
+				getFIPConfig(getManagedOutboundPIPName(testClusterName, 0), managedPIPID(0), ""),
+				getFIPConfig(getManagedOutboundPIPName(testClusterName, 1), managedPIPID(1), ""),
+			},
+			existingPIPs:           []string{getManagedOutboundPIPName(testClusterName, 0)},
+			expectedChanged:        true,
+			expectedFIPConfigNames: []string{"atest1", "testCluster-outbound-pip-0"},
+			expectedPIPsToDelete:   []string{getManagedOutboundPIPName(testClusterName, 1)},
+			expectedIdleTimeout:    30,
+		},
+		{
+			desc: "the managed public IPs should be replaced by the user provided public IPs and prefixes",
+			rule: &ManagedOutboundRuleConfig{OutboundIPIDs: []string{userPIPID}, OutboundIPPrefixIDs: []string{pipPrefixID}, AllocatedOutboundPorts: 8000},
+			existingFIPConfigs: []network.FrontendIPConfiguration{
+				serviceFIPConfig,
+				getFIPConfig(getManagedOutboundPIPName(testClusterName, 0), managedPIPID(0), ""),
+			},
+			nodeCount:              10,
+			pipPrefixLength:        31,
+			expectedChanged:        true,
+			expectedFIPConfigNames: []string{"atest1", "testCluster-outbound-pip1", "testCluster-outbound-prefix1"},
+			expectedPIPsToDelete:   []string{getManagedOutboundPIPName(testClusterName, 0)},
+			expectedAllocatedPorts: 8000,
+			expectedIdleTimeout:    30,
+			expectedEnableTCPReset: true,
+		},
+		{
+			desc:               "an error should be returned if the outbound IPs don't provide enough SNAT ports",
+			rule:               &ManagedOutboundRuleConfig{OutboundIPPrefixIDs: []string{pipPrefixID}, AllocatedOutboundPorts: 32000},
+			existingFIPConfigs: []network.FrontendIPConfiguration{serviceFIPConfig},
+			nodeCount:          5,
+			pipPrefixLength:    31,
+			expectedErr:        "the managed outbound rule requires 160000 SNAT ports for 5 nodes with 32000 allocated outbound ports each, but only 128000 SNAT ports are provided by 2 outbound IPs",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			az.ManagedOutboundRule = tc.rule
+
+			lbName := testClusterName
+			if tc.lbName != "" {
+				lbName = tc.lbName
+			}
+			fipConfigs := make([]network.FrontendIPConfiguration, len(tc.existingFIPConfigs))
+			copy(fipConfigs, tc.existingFIPConfigs)
+			lb := &network.LoadBalancer{
+				Name: to.StringPtr(lbName),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &fipConfigs,
+				},
+			}
+			if !tc.noBackendPool {
+				lb.BackendAddressPools = &[]network.BackendAddressPool{{
+					Name: to.StringPtr(testClusterName),
+					ID:   to.StringPtr(az.getBackendPoolID(lbName, "rg", testClusterName)),
+				}}
+			}
+			if tc.existingOutboundRules != nil {
+				lb.OutboundRules = &tc.existingOutboundRules
+			}
+
+			var nodes []*v1.Node
+			for i := 0; i < tc.nodeCount; i++ {
+				nodes = append(nodes, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node%d", i)}})
+			}
+
+			mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+			for _, pipName := range tc.existingPIPs {
+				mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(network.PublicIPAddress{
+					Name: to.StringPtr(pipName),
+					ID:   to.StringPtr(fmt.Sprintf(pipIDTemplate, "rg", pipName)),
+				}, nil)
+			}
+			for _, pipName := range tc.expectedPIPsToCreate {
+				first := mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: 404})
+				mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", pipName, gomock.Any()).
+					DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, publicIPAddressParameters network.PublicIPAddress) *retry.Error {
+						assert.Equal(t, network.PublicIPAddressSkuNameStandard, publicIPAddressParameters.Sku.Name)
+						assert.Equal(t, network.IPAllocationMethodStatic, publicIPAddressParameters.PublicIPAllocationMethod)
+						assert.Equal(t, testClusterName, to.String(publicIPAddressParameters.Tags[consts.ClusterNameKey]))
+						assert.NotContains(t, publicIPAddressParameters.Tags, consts.ServiceTagKey)
+						return nil
+					}).Times(1)
+				mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(network.PublicIPAddress{
+					Name: to.StringPtr(pipName),
+					ID:   to.StringPtr(fmt.Sprintf(pipIDTemplate, "rg", pipName)),
+				}, nil).After(first)
+			}
+			if tc.pipPrefixLength != 0 {
+				mockPIPPrefixesClient := az.PublicIPPrefixesClient.(*mockpublicipprefixclient.MockInterface)
+				mockPIPPrefixesClient.EXPECT().Get(gomock.Any(), "rg", "prefix1", gomock.Any()).Return(network.PublicIPPrefix{
+					PublicIPPrefixPropertiesFormat: &network.PublicIPPrefixPropertiesFormat{
+						PrefixLength: to.Int32Ptr(tc.pipPrefixLength),
+					},
+				}, nil)
+			}
+
+			service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+			changed, pipsToDelete, err := az.reconcileManagedOutboundRule(testClusterName, &service, lb, nodes)
+			if tc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedChanged, changed)
+			assert.Equal(t, tc.expectedPIPsToDelete, pipsToDelete)
+
+			var fipConfigNames []string
+			for _, fipConfig := range *lb.FrontendIPConfigurations {
+				fipConfigNames = append(fipConfigNames, to.String(fipConfig.Name))
+			}
+			assert.ElementsMatch(t, tc.expectedFIPConfigNames, fipConfigNames)
+
+			if tc.expectedNoOutboundRules {
+				assert.Nil(t, lb.OutboundRules)
+				return
+			}
+			assert.Equal(t, 1, len(*lb.OutboundRules))
+			outboundRule := (*lb.OutboundRules)[0]
+			assert.Equal(t, "testCluster-outbound-rule", to.String(outboundRule.Name))
+			assert.Equal(t, tc.expectedAllocatedPorts, to.Int32(outboundRule.AllocatedOutboundPorts))
+			assert.Equal(t, tc.expectedIdleTimeout, to.Int32(outboundRule.IdleTimeoutInMinutes))
+			assert.Equal(t, tc.expectedEnableTCPReset, to.Bool(outboundRule.EnableTCPReset))
+			assert.Equal(t, az.getBackendPoolID(lbName, "rg", testClusterName), to.String(outboundRule.BackendAddressPool.ID))
+			assert.Equal(t, len(tc.expectedFIPConfigNames)-1, len(*outboundRule.FrontendIPConfigurations))
+		})
+	}
+}
+
+func TestReconcileManagedOutboundRuleRemoved(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	pipIDTemplate := "/subscriptions/subscription/resourceGroups/%s/providers/Microsoft.Network/publicIPAddresses/%s"
+	managedPIPName := getManagedOutboundPIPName(testClusterName, 0)
+	lb := &network.LoadBalancer{
+		Name: to.StringPtr(testClusterName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: to.StringPtr("atest1"),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(fmt.Sprintf(pipIDTemplate, "rg", "testCluster-atest1"))},
+					},
+				},
+				{
+					Name: to.StringPtr(managedPIPName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(fmt.Sprintf(pipIDTemplate, "rg", managedPIPName))},
+					},
+				},
+				{
+					Name: to.StringPtr("testCluster-outbound-pip1"),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(fmt.Sprintf(pipIDTemplate, "rg1", "pip1"))},
+					},
+				},
+			},
+			OutboundRules: &[]network.OutboundRule{
+				{Name: to.StringPtr("testCluster-outbound-rule")},
+				{Name: to.StringPtr("user-outbound-rule")},
+			},
+		},
+	}
+
+	// the managed outbound rule and its frontend IP configs are removed, and only the managed public IPs are deleted
+	service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	changed, pipsToDelete, err := az.reconcileManagedOutboundRule(testClusterName, &service, lb, nil)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{managedPIPName}, pipsToDelete)
+	assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+	assert.Equal(t, "atest1", to.String((*lb.FrontendIPConfigurations)[0].Name))
+	assert.Equal(t, 1, len(*lb.OutboundRules))
+	assert.Equal(t, "user-outbound-rule", to.String((*lb.OutboundRules)[0].Name))
+
+	changed, pipsToDelete, err = az.reconcileManagedOutboundRule(testClusterName, &service, lb, nil)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Empty(t, pipsToDelete)
+}
+
+func TestCheckManagedOutboundPortsCachesPrefixLength(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	pipPrefixID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"
+	az.ManagedOutboundRule = &ManagedOutboundRuleConfig{OutboundIPPrefixIDs: []string{pipPrefixID}, AllocatedOutboundPorts: 32000}
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node0"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+	}
+
+	// the prefix length is only got once
+	mockPIPPrefixesClient := az.PublicIPPrefixesClient.(*mockpublicipprefixclient.MockInterface)
+	mockPIPPrefixesClient.EXPECT().Get(gomock.Any(), "rg", "prefix1", gomock.Any()).Return(network.PublicIPPrefix{
+		PublicIPPrefixPropertiesFormat: &network.PublicIPPrefixPropertiesFormat{
+			PrefixLength: to.Int32Ptr(32),
+		},
+	}, nil).Times(1)
+
+	service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	assert.NoError(t, az.checkManagedOutboundPorts(&service, nodes))
+	nodes = append(nodes, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}})
+	err := az.checkManagedOutboundPorts(&service, nodes)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the managed outbound rule requires 96000 SNAT ports for 3 nodes")
+}
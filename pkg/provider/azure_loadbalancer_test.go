@@ -38,10 +38,14 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipprefixclient/mockpublicipprefixclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
@@ -221,6 +225,40 @@ func TestFindRule(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			msg: "rule names match while floating IPs don't should return false",
+			existingRule: []network.LoadBalancingRule{
+				{
+					Name: to.StringPtr("httpProbe"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+						EnableFloatingIP: to.BoolPtr(true),
+					},
+				},
+			},
+			curRule: network.LoadBalancingRule{
+				Name: to.StringPtr("httpProbe"),
+				LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+					EnableFloatingIP: to.BoolPtr(false),
+				},
+			},
+			expected: false,
+		},
+		{
+			msg: "disabled floating IP should match the unset one",
+			existingRule: []network.LoadBalancingRule{
+				{
+					Name:                              to.StringPtr("httpProbe"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{},
+				},
+			},
+			curRule: network.LoadBalancingRule{
+				Name: to.StringPtr("httpProbe"),
+				LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+					EnableFloatingIP: to.BoolPtr(false),
+				},
+			},
+			expected: true,
+		},
 		{
 			msg: "rule names match while backend ports don't should return false",
 			existingRule: []network.LoadBalancingRule{
@@ -421,6 +459,103 @@ func TestSubnet(t *testing.T) {
 	}
 }
 
+func TestApplyServiceLoadBalancerClass(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerClasses = []LoadBalancerClass{
+		{
+			Name:                  "azure-internal",
+			Internal:              true,
+			InternalSubnet:        "subnet",
+			PublicIPResourceGroup: "rg",
+			Annotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerIdleTimeout: "10",
+			},
+		},
+	}
+
+	for i, c := range []struct {
+		desc                string
+		service             *v1.Service
+		expectedAnnotations map[string]string
+		expectedHandle      bool
+	}{
+		{
+			desc:           "service without load balancer class should be handled as is",
+			service:        &v1.Service{},
+			expectedHandle: true,
+		},
+		{
+			desc: "service with unknown load balancer class should not be handled",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{LoadBalancerClass: to.StringPtr("example.com/other")},
+			},
+			expectedHandle: false,
+		},
+		{
+			desc: "service with known load balancer class should get the annotations of the class",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{LoadBalancerClass: to.StringPtr("azure-internal")},
+			},
+			expectedAnnotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerInternal:       consts.TrueAnnotationValue,
+				consts.ServiceAnnotationLoadBalancerInternalSubnet: "subnet",
+				consts.ServiceAnnotationLoadBalancerResourceGroup:  "rg",
+				consts.ServiceAnnotationLoadBalancerIdleTimeout:    "10",
+			},
+			expectedHandle: true,
+		},
+		{
+			desc: "annotations of the service should take precedence over the load balancer class",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						consts.ServiceAnnotationLoadBalancerInternalSubnet: "subnet1",
+						consts.ServiceAnnotationLoadBalancerIdleTimeout:    "20",
+					},
+				},
+				Spec: v1.ServiceSpec{LoadBalancerClass: to.StringPtr("azure-internal")},
+			},
+			expectedAnnotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerInternal:       consts.TrueAnnotationValue,
+				consts.ServiceAnnotationLoadBalancerInternalSubnet: "subnet1",
+				consts.ServiceAnnotationLoadBalancerResourceGroup:  "rg",
+				consts.ServiceAnnotationLoadBalancerIdleTimeout:    "20",
+			},
+			expectedHandle: true,
+		},
+	} {
+		original := c.service.DeepCopy()
+		service, shouldHandle := az.applyServiceLoadBalancerClass(c.service)
+		assert.Equal(t, c.expectedHandle, shouldHandle, "TestCase[%d]: %s", i, c.desc)
+		assert.Equal(t, c.expectedAnnotations, service.Annotations, "TestCase[%d]: %s", i, c.desc)
+		assert.Equal(t, original, c.service, "TestCase[%d]: %s", i, c.desc)
+	}
+}
+
+func TestLoadBalancerWithUnknownLoadBalancerClass(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	service := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	service.Spec.LoadBalancerClass = to.StringPtr("example.com/other")
+
+	_, exists, err := az.GetLoadBalancer(context.TODO(), testClusterName, &service)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = az.EnsureLoadBalancer(context.TODO(), testClusterName, &service, nil)
+	assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+
+	err = az.UpdateLoadBalancer(context.TODO(), testClusterName, &service, nil)
+	assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+
+	err = az.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &service)
+	assert.NoError(t, err)
+}
+
 func TestEnsureLoadBalancerDeleted(t *testing.T) {
 	const vmCount = 8
 	const availabilitySetCount = 4
@@ -1718,6 +1853,83 @@ func TestIsFrontendIPChanged(t *testing.T) {
 			expectedFlag:  true,
 			expectedError: false,
 		},
+		{
+			desc: "isFrontendIPChanged shall return true if the frontend is not chained to the gateway load balancer of the service",
+			config: network.FrontendIPConfiguration{
+				Name: to.StringPtr("btest1-name"),
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr("/subscriptions/subscription" +
+						"/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pipName")},
+				},
+			},
+			lbFrontendIPConfigName: "btest1-name",
+			service:                getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationGatewayLoadBalancerFrontendIPConfigID: "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/gwlb/frontendIPConfigurations/fip"}, false, 80),
+			loadBalancerIP:         "1.1.1.1",
+			existingPIPs: []network.PublicIPAddress{
+				{
+					Name: to.StringPtr("pipName"),
+					PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+						IPAddress: to.StringPtr("1.1.1.1"),
+					},
+					ID: to.StringPtr("/subscriptions/subscription" +
+						"/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pipName"),
+				},
+			},
+			expectedFlag:  true,
+			expectedError: false,
+		},
+		{
+			desc: "isFrontendIPChanged shall return true if the chain of the frontend is removed from the service",
+			config: network.FrontendIPConfiguration{
+				Name: to.StringPtr("btest1-name"),
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr("/subscriptions/subscription" +
+						"/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pipName")},
+					GatewayLoadBalancer: &network.SubResource{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/gwlb/frontendIPConfigurations/fip")},
+				},
+			},
+			lbFrontendIPConfigName: "btest1-name",
+			service:                getTestService("test1", v1.ProtocolTCP, nil, false, 80),
+			loadBalancerIP:         "1.1.1.1",
+			existingPIPs: []network.PublicIPAddress{
+				{
+					Name: to.StringPtr("pipName"),
+					PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+						IPAddress: to.StringPtr("1.1.1.1"),
+					},
+					ID: to.StringPtr("/subscriptions/subscription" +
+						"/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pipName"),
+				},
+			},
+			expectedFlag:  true,
+			expectedError: false,
+		},
+		{
+			desc: "isFrontendIPChanged shall return false if the frontend is chained to the gateway load balancer of the service",
+			config: network.FrontendIPConfiguration{
+				Name: to.StringPtr("btest1-name"),
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr("/subscriptions/subscription" +
+						"/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pipName")},
+					GatewayLoadBalancer: &network.SubResource{ID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/GWLB/frontendIPConfigurations/fip")},
+				},
+			},
+			lbFrontendIPConfigName: "btest1-name",
+			service:                getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationGatewayLoadBalancerFrontendIPConfigID: "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/gwlb/frontendIPConfigurations/fip"}, false, 80),
+			loadBalancerIP:         "1.1.1.1",
+			existingPIPs: []network.PublicIPAddress{
+				{
+					Name: to.StringPtr("pipName"),
+					PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+						IPAddress: to.StringPtr("1.1.1.1"),
+					},
+					ID: to.StringPtr("/subscriptions/subscription" +
+						"/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pipName"),
+				},
+			},
+			expectedFlag:  false,
+			expectedError: false,
+		},
 	}
 
 	for i, test := range testCases {
@@ -1742,7 +1954,7 @@ func TestIsFrontendIPChanged(t *testing.T) {
 		test.service.Spec.LoadBalancerIP = test.loadBalancerIP
 		test.service.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = test.annotations
 		flag, rerr := az.isFrontendIPChanged("testCluster", test.config,
-			&test.service, test.lbFrontendIPConfigName, &test.existingPIPs)
+			&test.service, test.lbFrontendIPConfigName, &test.existingPIPs, false)
 		if rerr != nil {
 			fmt.Println(rerr.Error())
 		}
@@ -1806,7 +2018,7 @@ func TestDeterminePublicIPName(t *testing.T) {
 				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
 			}
 		}
-		ip, _, err := az.determinePublicIPName("testCluster", &service, nil)
+		ip, _, err := az.determinePublicIPName("testCluster", &service, nil, false)
 		assert.Equal(t, test.expectedIP, ip, "TestCase[%d]: %s", i, test.desc)
 		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
 	}
@@ -1889,6 +2101,16 @@ func TestReconcileLoadBalancerRule(t *testing.T) {
 			expectedProbes:  getDefaultTestProbes("Tcp", ""),
 			expectedRules:   getDefaultInternalIPv6Rules(true),
 		},
+		{
+			desc: "getExpectedLBRules shall return corresponding probe and lbRule (slb with floating IP disabled)",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				consts.ServiceAnnotationDisableLoadBalancerFloatingIP: "true",
+			}, false, 80),
+			loadBalancerSku: "standard",
+			expectedProbes:  getDefaultTestProbes("Tcp", ""),
+			// the same as the internal IPv6 rules, which point to the node ports without floating IP
+			expectedRules: getDefaultInternalIPv6Rules(true),
+		},
 		{
 			desc: "getExpectedLBRules shall return corresponding probe and lbRule (slb with HA enabled)",
 			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
@@ -2161,7 +2383,7 @@ func TestReconcileLoadBalancerRule(t *testing.T) {
 			service.Annotations[consts.BuildHealthProbeAnnotationKeyForPort(firstPort.Port, consts.HealthProbeParamsRequestPath)] = test.probePath
 		}
 		probe, lbrule, err := az.getExpectedLBRules(&test.service,
-			"frontendIPConfigID", "backendPoolID", "lbname")
+			"frontendIPConfigID", "backendPoolID", "lbname", getServiceIPFamilies(&test.service)[0])
 
 		if test.expectedErr {
 			assert.Error(t, err, "TestCase[%d]: %s", i, test.desc)
@@ -2172,6 +2394,172 @@ func TestReconcileLoadBalancerRule(t *testing.T) {
 		}
 	}
 }
+func TestGetExpectedLBRulesWithHealthProbeOfPort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range []struct {
+		desc             string
+		protocol         v1.Protocol
+		annotations      map[string]string
+		expectedProtocol network.ProbeProtocol
+		expectedPort     int32
+		expectedNoProbe  bool
+		expectedErr      bool
+	}{
+		{
+			desc:     "the probe protocol and port of the port should be respected",
+			protocol: v1.ProtocolTCP,
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/port_443_health-probe_protocol": "http",
+				"service.beta.kubernetes.io/port_443_health-probe_port":     "8080",
+			},
+			expectedProtocol: network.ProbeProtocolHTTP,
+			expectedPort:     18080,
+		},
+		{
+			desc:     "the probe port can be set by the name of the port",
+			protocol: v1.ProtocolTCP,
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/port_443_health-probe_port": "port-tcp-8080",
+			},
+			expectedProtocol: network.ProbeProtocolTCP,
+			expectedPort:     18080,
+		},
+		{
+			desc:     "the probe port which is not a port of the service should be used as it is",
+			protocol: v1.ProtocolTCP,
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/port_443_health-probe_port": "9000",
+			},
+			expectedProtocol: network.ProbeProtocolTCP,
+			expectedPort:     9000,
+		},
+		{
+			desc:     "the UDP ports should be probed if the probe of the port is configured",
+			protocol: v1.ProtocolUDP,
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/port_443_health-probe_protocol": "Tcp",
+			},
+			expectedProtocol: network.ProbeProtocolTCP,
+			expectedPort:     10443,
+		},
+		{
+			desc:            "the UDP ports should not be probed by default",
+			protocol:        v1.ProtocolUDP,
+			expectedNoProbe: true,
+		},
+		{
+			desc:     "the probe should be disabled by the no probe rule annotation",
+			protocol: v1.ProtocolTCP,
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/port_443_no_probe_rule": "true",
+			},
+			expectedNoProbe: true,
+		},
+		{
+			desc:     "an event should be sent for the invalid probe protocol",
+			protocol: v1.ProtocolTCP,
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/port_443_health-probe_protocol": "Mongodb",
+			},
+			expectedErr: true,
+		},
+		{
+			desc:     "an event should be sent for the invalid probe port",
+			protocol: v1.ProtocolTCP,
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/port_443_health-probe_port": "port-not-exist",
+			},
+			expectedErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			recorder := record.NewFakeRecorder(10)
+			az.eventRecorder = recorder
+			service := getTestService("test1", test.protocol, test.annotations, false, 443, 8080)
+
+			probes, rules, err := az.getExpectedLBRules(&service, "frontendIPConfigID", "backendPoolID", "lbname", false)
+			if test.expectedErr {
+				assert.Error(t, err)
+				assert.Equal(t, 1, len(recorder.Events))
+				assert.Contains(t, <-recorder.Events, "InvalidHealthProbeConfiguration")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(rules))
+			if test.expectedNoProbe {
+				for _, probe := range probes {
+					assert.NotEqual(t, "atest1-"+string(test.protocol)+"-443", to.String(probe.Name))
+				}
+				assert.Nil(t, rules[0].Probe)
+				return
+			}
+			assert.Equal(t, "atest1-"+string(test.protocol)+"-443", to.String(probes[0].Name))
+			assert.Equal(t, test.expectedProtocol, probes[0].Protocol)
+			assert.Equal(t, test.expectedPort, to.Int32(probes[0].Port))
+		})
+	}
+}
+
+func TestGetExpectedLBRulesWithConsolidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+
+	// the ports probing the same port share one probe
+	service := getTestService("test1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerConsolidateHealthProbes: consts.TrueAnnotationValue,
+		"service.beta.kubernetes.io/port_80_health-probe_port":      "8080",
+		"service.beta.kubernetes.io/port_443_health-probe_port":     "8080",
+	}, false, 80, 443, 8080)
+	probes, rules, err := az.getExpectedLBRules(&service, "frontendIPConfigID", "backendPoolID", "lbname", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(probes))
+	assert.Equal(t, "atest1-TCP-80", to.String(probes[0].Name))
+	assert.Equal(t, 3, len(rules))
+	for _, rule := range rules {
+		assert.True(t, strings.HasSuffix(to.String(rule.Probe.ID), "/probes/atest1-TCP-80"))
+	}
+
+	// the probes are not shared without the annotation
+	delete(service.Annotations, consts.ServiceAnnotationLoadBalancerConsolidateHealthProbes)
+	probes, _, err = az.getExpectedLBRules(&service, "frontendIPConfigID", "backendPoolID", "lbname", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(probes))
+
+	// the ports covering the port range are collapsed into one HA ports rule on the internal load balancer
+	service = getTestService("test1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerInternal:      consts.TrueAnnotationValue,
+		consts.ServiceAnnotationLoadBalancerHAPortsRange: "8000-8002",
+	}, false, 8000, 8001, 8002)
+	probes, rules, err = az.getExpectedLBRules(&service, "frontendIPConfigID", "backendPoolID", "lbname", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(probes))
+	assert.Equal(t, 1, len(rules))
+	assert.Equal(t, network.TransportProtocolAll, rules[0].Protocol)
+	assert.Equal(t, int32(0), to.Int32(rules[0].FrontendPort))
+	assert.Equal(t, 1, az.getExpectedLBRuleCount(&service))
+
+	for _, portRange := range []string{"8000-8003", "8001-8002", "8002-8000", "8000"} {
+		service.Annotations[consts.ServiceAnnotationLoadBalancerHAPortsRange] = portRange
+		_, _, err = az.getExpectedLBRules(&service, "frontendIPConfigID", "backendPoolID", "lbname", false)
+		assert.Error(t, err, portRange)
+		assert.Equal(t, 3, az.getExpectedLBRuleCount(&service))
+	}
+
+	// the port range is ignored on the public load balancer
+	service.Annotations[consts.ServiceAnnotationLoadBalancerHAPortsRange] = "8000-8002"
+	delete(service.Annotations, consts.ServiceAnnotationLoadBalancerInternal)
+	_, rules, err = az.getExpectedLBRules(&service, "frontendIPConfigID", "backendPoolID", "lbname", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(rules))
+	assert.Equal(t, 3, az.getExpectedLBRuleCount(&service))
+}
+
 func getTestProbes(protocol, path string, interval, port, numOfProbe *int32) []network.Probe {
 	return []network.Probe{
 		getTestProbe(protocol, path, interval, port, numOfProbe),
@@ -2890,13 +3278,14 @@ func TestReconcileSecurityGroup(t *testing.T) {
 	defer ctrl.Finish()
 
 	testCases := []struct {
-		desc          string
-		lbIP          *string
-		service       v1.Service
-		existingSgs   map[string]network.SecurityGroup
-		expectedSg    *network.SecurityGroup
-		wantLb        bool
-		expectedError bool
+		desc           string
+		lbIPs          *[]string
+		service        v1.Service
+		existingSgs    map[string]network.SecurityGroup
+		nodePrivateIPs map[string]sets.String
+		expectedSg     *network.SecurityGroup
+		wantLb         bool
+		expectedError  bool
 	}{
 		{
 			desc: "reconcileSecurityGroup shall report error if the sg is shared and no ports in service",
@@ -2946,7 +3335,7 @@ func TestReconcileSecurityGroup(t *testing.T) {
 					},
 				},
 			}},
-			lbIP:   to.StringPtr("1.1.1.1"),
+			lbIPs:  &[]string{"1.1.1.1"},
 			wantLb: true,
 			expectedSg: &network.SecurityGroup{
 				Name: to.StringPtr("nsg"),
@@ -2976,7 +3365,7 @@ func TestReconcileSecurityGroup(t *testing.T) {
 				Name:                          to.StringPtr("nsg"),
 				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
 			}},
-			lbIP:   to.StringPtr("fd00::eef0"),
+			lbIPs:  &[]string{"fd00::eef0"},
 			wantLb: true,
 			expectedSg: &network.SecurityGroup{
 				Name: to.StringPtr("nsg"),
@@ -3001,12 +3390,12 @@ func TestReconcileSecurityGroup(t *testing.T) {
 		},
 		{
 			desc:    "reconcileSecurityGroup shall create sgs with correct destinationPrefix with additional public IPs",
-			service: getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationAdditionalPublicIPs: "2.3.4.5"}, true, 80),
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationAdditionalPublicIPs: "2.3.4.5"}, false, 80),
 			existingSgs: map[string]network.SecurityGroup{"nsg": {
 				Name:                          to.StringPtr("nsg"),
 				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
 			}},
-			lbIP:   to.StringPtr("1.2.3.4"),
+			lbIPs:  &[]string{"1.2.3.4"},
 			wantLb: true,
 			expectedSg: &network.SecurityGroup{
 				Name: to.StringPtr("nsg"),
@@ -3031,9 +3420,9 @@ func TestReconcileSecurityGroup(t *testing.T) {
 		},
 		{
 			desc:    "reconcileSecurityGroup shall not create unwanted security rules if there is service tags",
-			service: getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationAllowedServiceTag: "tag"}, true, 80),
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationAllowedServiceTag: "tag"}, false, 80),
 			wantLb:  true,
-			lbIP:    to.StringPtr("1.1.1.1"),
+			lbIPs:   &[]string{"1.1.1.1"},
 			existingSgs: map[string]network.SecurityGroup{"nsg": {
 				Name: to.StringPtr("nsg"),
 				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
@@ -3073,12 +3462,12 @@ func TestReconcileSecurityGroup(t *testing.T) {
 		},
 		{
 			desc:    "reconcileSecurityGroup shall create shared sgs for service with azure-shared-securityrule annotations",
-			service: getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationSharedSecurityRule: "true"}, true, 80),
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationSharedSecurityRule: "true"}, false, 80),
 			existingSgs: map[string]network.SecurityGroup{"nsg": {
 				Name:                          to.StringPtr("nsg"),
 				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
 			}},
-			lbIP:   to.StringPtr("1.2.3.4"),
+			lbIPs:  &[]string{"1.2.3.4"},
 			wantLb: true,
 			expectedSg: &network.SecurityGroup{
 				Name: to.StringPtr("nsg"),
@@ -3101,10 +3490,58 @@ func TestReconcileSecurityGroup(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:    "reconcileSecurityGroup shall allow the node ports to the node IPs if the floating IP is disabled",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: "true"}, false, 80),
+			existingSgs: map[string]network.SecurityGroup{"nsg": {
+				Name:                          to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+			}},
+			nodePrivateIPs: map[string]sets.String{
+				"node-0": sets.NewString("10.0.0.5", "fd00::5"),
+				"node-1": sets.NewString("10.0.0.4"),
+			},
+			lbIPs:  &[]string{"1.1.1.1"},
+			wantLb: true,
+			expectedSg: &network.SecurityGroup{
+				Name: to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+					SecurityRules: &[]network.SecurityRule{
+						{
+							Name: to.StringPtr("atest1-TCP-80-Internet"),
+							SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+								Protocol:                   network.SecurityRuleProtocol("Tcp"),
+								SourcePortRange:            to.StringPtr("*"),
+								DestinationPortRange:       to.StringPtr("10080"),
+								SourceAddressPrefix:        to.StringPtr("Internet"),
+								DestinationAddressPrefixes: to.StringSlicePtr([]string{"10.0.0.4", "10.0.0.5"}),
+								Access:                     network.SecurityRuleAccess("Allow"),
+								Priority:                   to.Int32Ptr(500),
+								Direction:                  network.SecurityRuleDirection("Inbound"),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:    "reconcileSecurityGroup shall report error if the floating IP is disabled and there are no node IPs",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: "true"}, false, 80),
+			existingSgs: map[string]network.SecurityGroup{"nsg": {
+				Name:                          to.StringPtr("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+			}},
+			lbIPs:         &[]string{"1.1.1.1"},
+			wantLb:        true,
+			expectedError: true,
+		},
 	}
 
 	for i, test := range testCases {
 		az := GetTestCloud(ctrl)
+		if test.nodePrivateIPs != nil {
+			az.nodePrivateIPs = test.nodePrivateIPs
+		}
 		mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
 		mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		if len(test.existingSgs) == 0 {
@@ -3117,7 +3554,7 @@ func TestReconcileSecurityGroup(t *testing.T) {
 				t.Fatalf("TestCase[%d] meets unexpected error: %v", i, err)
 			}
 		}
-		sg, err := az.reconcileSecurityGroup("testCluster", &test.service, test.lbIP, test.wantLb)
+		sg, err := az.reconcileSecurityGroup("testCluster", &test.service, test.lbIPs, test.wantLb)
 		assert.Equal(t, test.expectedSg, sg, "TestCase[%d]: %s", i, test.desc)
 		assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s", i, test.desc)
 	}
@@ -3136,7 +3573,7 @@ func TestReconcileSecurityGroupLoadBalancerSourceRanges(t *testing.T) {
 			SecurityRules: &[]network.SecurityRule{},
 		},
 	}
-	lbIP := to.StringPtr("1.1.1.1")
+	lbIPs := &[]string{"1.1.1.1"}
 	expectedSg := network.SecurityGroup{
 		Name: to.StringPtr("nsg"),
 		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
@@ -3173,7 +3610,7 @@ func TestReconcileSecurityGroupLoadBalancerSourceRanges(t *testing.T) {
 	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
 	mockSGClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any()).Return(existingSg, nil)
 	mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-	sg, err := az.reconcileSecurityGroup("testCluster", &service, lbIP, true)
+	sg, err := az.reconcileSecurityGroup("testCluster", &service, lbIPs, true)
 	assert.NoError(t, err)
 	assert.Equal(t, expectedSg, *sg)
 }
@@ -3891,7 +4328,7 @@ func TestEnsurePublicIPExists(t *testing.T) {
 				return basicPIP, nil
 			}).AnyTimes()
 
-			pip, err := az.ensurePublicIPExists(&service, "pip1", test.inputDNSLabel, "", false, test.foundDNSLabelAnnotation)
+			pip, err := az.ensurePublicIPExists(&service, "pip1", test.inputDNSLabel, "", false, test.foundDNSLabelAnnotation, test.isIPv6)
 			assert.Equal(t, test.expectedError, err != nil, "TestCase[%d]: %s, encountered unexpected error: %v", i, test.desc, err)
 			if test.expectedID != "" {
 				assert.Equal(t, test.expectedID, to.String(pip.ID), "TestCase[%d]: %s", i, test.desc)
@@ -3943,12 +4380,132 @@ func TestEnsurePublicIPExistsWithExtendedLocation(t *testing.T) {
 			assert.Nil(t, publicIPAddressParameters.Zones)
 			return nil
 		}).Times(1)
-	pip, err := az.ensurePublicIPExists(&service, "pip1", "", "", false, false)
+	pip, err := az.ensurePublicIPExists(&service, "pip1", "", "", false, false, false)
 	assert.NotNil(t, pip, "ensurePublicIPExists shall create a new pip"+
 		"with extendedLocation if there is no existed pip")
 	assert.Nil(t, err, "ensurePublicIPExists should create a new pip without errors.")
 }
 
+func TestEnsurePublicIPExistsWithPIPPrefix(t *testing.T) {
+	pipPrefixID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"
+	getTestPIPPrefix := func(version network.IPVersion, prefixLength int32, allocated int) network.PublicIPPrefix {
+		pipPrefix := network.PublicIPPrefix{
+			ID:       to.StringPtr(pipPrefixID),
+			Name:     to.StringPtr("prefix1"),
+			Location: to.StringPtr("westus"),
+			Zones:    &[]string{"1"},
+			PublicIPPrefixPropertiesFormat: &network.PublicIPPrefixPropertiesFormat{
+				PublicIPAddressVersion: version,
+				PrefixLength:           to.Int32Ptr(prefixLength),
+			},
+		}
+		publicIPAddresses := make([]network.ReferencedPublicIPAddress, allocated)
+		pipPrefix.PublicIPAddresses = &publicIPAddresses
+		return pipPrefix
+	}
+
+	testCases := []struct {
+		desc                string
+		annotations         map[string]string
+		defaultPIPPrefixID  string
+		isIPv6              bool
+		existingPIPPrefix   *network.PublicIPPrefix
+		expectedPIPPrefixID *string
+		expectedZones       *[]string
+		expectedErr         string
+	}{
+		{
+			desc:          "the public IP should not be allocated from a prefix if it is not configured",
+			expectedZones: &[]string{"1", "2", "3"},
+		},
+		{
+			desc:                "the public IP should be allocated from the prefix in the annotation",
+			annotations:         map[string]string{consts.ServiceAnnotationPIPPrefixID: pipPrefixID},
+			existingPIPPrefix:   func() *network.PublicIPPrefix { p := getTestPIPPrefix(network.IPVersionIPv4, 28, 15); return &p }(),
+			expectedPIPPrefixID: to.StringPtr(pipPrefixID),
+			expectedZones:       &[]string{"1"},
+		},
+		{
+			desc:                "the public IP should be allocated from the default prefix in the config",
+			defaultPIPPrefixID:  pipPrefixID,
+			existingPIPPrefix:   func() *network.PublicIPPrefix { p := getTestPIPPrefix(network.IPVersionIPv4, 28, 0); return &p }(),
+			expectedPIPPrefixID: to.StringPtr(pipPrefixID),
+			expectedZones:       &[]string{"1"},
+		},
+		{
+			desc:               "the empty annotation should opt out of the default prefix in the config",
+			annotations:        map[string]string{consts.ServiceAnnotationPIPPrefixID: ""},
+			defaultPIPPrefixID: pipPrefixID,
+			expectedZones:      &[]string{"1", "2", "3"},
+		},
+		{
+			desc:              "the IPv6 public IP should not be allocated from an IPv4 prefix",
+			annotations:       map[string]string{consts.ServiceAnnotationPIPPrefixID: pipPrefixID},
+			isIPv6:            true,
+			existingPIPPrefix: func() *network.PublicIPPrefix { p := getTestPIPPrefix(network.IPVersionIPv4, 28, 0); return &p }(),
+			expectedZones:     &[]string{"1", "2", "3"},
+		},
+		{
+			desc:              "an error should be returned if the prefix is exhausted",
+			annotations:       map[string]string{consts.ServiceAnnotationPIPPrefixID: pipPrefixID},
+			existingPIPPrefix: func() *network.PublicIPPrefix { p := getTestPIPPrefix(network.IPVersionIPv4, 28, 16); return &p }(),
+			expectedErr:       "all of its 16 public IPs have been allocated",
+		},
+		{
+			desc:        "an error should be returned if the prefix ID is invalid",
+			annotations: map[string]string{consts.ServiceAnnotationPIPPrefixID: "prefix1"},
+			expectedErr: "prefix1 is not a valid public IP prefix ID",
+		},
+		{
+			desc:        "an error should be returned if the prefix is in another subscription",
+			annotations: map[string]string{consts.ServiceAnnotationPIPPrefixID: "/subscriptions/other/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"},
+			expectedErr: "should be in the subscription subscription",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			az.PublicIPPrefixID = tc.defaultPIPPrefixID
+			service := getTestService("test1", v1.ProtocolTCP, tc.annotations, tc.isIPv6, 80)
+
+			if tc.existingPIPPrefix != nil {
+				mockPIPPrefixesClient := az.PublicIPPrefixesClient.(*mockpublicipprefixclient.MockInterface)
+				mockPIPPrefixesClient.EXPECT().Get(gomock.Any(), "rg", "prefix1", gomock.Any()).Return(*tc.existingPIPPrefix, nil)
+			}
+
+			mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+			first := mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{
+				HTTPStatusCode: 404,
+			})
+			if tc.expectedErr != "" {
+				_, err := az.ensurePublicIPExists(&service, "pip1", "", "", false, false, tc.isIPv6)
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+
+			mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).Return(network.PublicIPAddress{Name: to.StringPtr("pip1")}, nil).After(first)
+			mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).
+				DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, publicIPAddressParameters network.PublicIPAddress) *retry.Error {
+					if tc.expectedPIPPrefixID == nil {
+						assert.Nil(t, publicIPAddressParameters.PublicIPPrefix)
+					} else {
+						assert.Equal(t, tc.expectedPIPPrefixID, publicIPAddressParameters.PublicIPPrefix.ID)
+					}
+					assert.Equal(t, tc.expectedZones, publicIPAddressParameters.Zones)
+					return nil
+				}).Times(1)
+			_, err := az.ensurePublicIPExists(&service, "pip1", "", "", false, false, tc.isIPv6)
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestShouldUpdateLoadBalancer(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -4658,7 +5215,7 @@ func TestRemoveFrontendIPConfigurationFromLoadBalancerDelete(t *testing.T) {
 		mockPLSClient := cloud.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
 		mockPLSClient.EXPECT().List(gomock.Any(), "rg").Return(expectedPLS, nil).MinTimes(1).MaxTimes(1)
 		existingLBs := []network.LoadBalancer{{Name: to.StringPtr("lb")}}
-		err := cloud.removeFrontendIPConfigurationFromLoadBalancer(&lb, existingLBs, fip, "testCluster", &service)
+		err := cloud.removeFrontendIPConfigurationFromLoadBalancer(&lb, existingLBs, []*network.FrontendIPConfiguration{fip}, "testCluster", &service)
 		assert.NoError(t, err)
 	})
 }
@@ -4680,7 +5237,7 @@ func TestRemoveFrontendIPConfigurationFromLoadBalancerUpdate(t *testing.T) {
 		expectedPLS := make([]network.PrivateLinkService, 0)
 		mockPLSClient := cloud.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
 		mockPLSClient.EXPECT().List(gomock.Any(), "rg").Return(expectedPLS, nil).MinTimes(1).MaxTimes(1)
-		err := cloud.removeFrontendIPConfigurationFromLoadBalancer(&lb, []network.LoadBalancer{}, fip, "testCluster", &service)
+		err := cloud.removeFrontendIPConfigurationFromLoadBalancer(&lb, []network.LoadBalancer{}, []*network.FrontendIPConfiguration{fip}, "testCluster", &service)
 		assert.NoError(t, err)
 	})
 }
@@ -4852,8 +5409,8 @@ func TestReconcileZonesForFrontendIPConfigs(t *testing.T) {
 			zoneClient.EXPECT().GetZones(gomock.Any(), gomock.Any()).Return(map[string][]string{}, tc.getZoneError).MaxTimes(1)
 			cloud.ZoneClient = zoneClient
 
-			defaultLBFrontendIPConfigName := cloud.getDefaultFrontendIPConfigName(&tc.service)
-			_, _, dirty, err := cloud.reconcileFrontendIPConfigs("testCluster", &tc.service, &lb, tc.status, true, defaultLBFrontendIPConfigName)
+			defaultLBFrontendIPConfigName := cloud.getDefaultFrontendIPConfigName(&tc.service, false)
+			_, _, dirty, err := cloud.reconcileFrontendIPConfigs("testCluster", &tc.service, &lb, tc.status, true, map[bool]string{false: defaultLBFrontendIPConfigName})
 			if tc.expectedErr == nil {
 				assert.NoError(t, err)
 			} else {
@@ -5178,3 +5735,105 @@ func TestGetClusterFromPIPClusterTags(t *testing.T) {
 		assert.Equal(t, actual, c.expected, "TestCase[%d]: %s", i, c.desc)
 	}
 }
+
+func TestReconcileLBProbesExternalTrafficPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	lbName := "lb"
+	lbFrontendIPConfigID := az.getFrontendIPConfigID(lbName, az.ResourceGroup, "fip")
+	lbBackendPoolID := az.getBackendPoolID(lbName, az.ResourceGroup, testClusterName)
+
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80, 443)
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 32456
+	lb := network.LoadBalancer{Name: &lbName, LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{}}
+
+	// externalTrafficPolicy=Local: a single HTTP probe on the health check node port is shared by all rules
+	localProbes, localRules, err := az.getExpectedLBRules(&svc, lbFrontendIPConfigID, lbBackendPoolID, lbName, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(localProbes))
+	assert.Equal(t, network.ProbeProtocolHTTP, localProbes[0].Protocol)
+	assert.Equal(t, "/healthz", to.String(localProbes[0].RequestPath))
+	assert.Equal(t, int32(32456), to.Int32(localProbes[0].Port))
+	localProbeID := az.getLoadBalancerProbeID(lbName, az.ResourceGroup, to.String(localProbes[0].Name))
+	for _, rule := range localRules {
+		assert.Equal(t, localProbeID, to.String(rule.Probe.ID))
+	}
+	assert.True(t, az.reconcileLBProbes(&lb, &svc, "svc1", true, localProbes))
+	assert.Equal(t, localProbes, *lb.Probes)
+
+	// externalTrafficPolicy=Cluster: the shared probe is replaced by per-port probes on the node ports
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeCluster
+	svc.Spec.HealthCheckNodePort = 0
+	clusterProbes, clusterRules, err := az.getExpectedLBRules(&svc, lbFrontendIPConfigID, lbBackendPoolID, lbName, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(clusterProbes))
+	for i, rule := range clusterRules {
+		assert.Equal(t, svc.Spec.Ports[i].NodePort, to.Int32(clusterProbes[i].Port))
+		assert.Equal(t, az.getLoadBalancerProbeID(lbName, az.ResourceGroup, to.String(clusterProbes[i].Name)), to.String(rule.Probe.ID))
+	}
+	assert.True(t, az.reconcileLBProbes(&lb, &svc, "svc1", true, clusterProbes))
+	assert.Equal(t, 2, len(*lb.Probes))
+	assert.False(t, findProbe(*lb.Probes, localProbes[0]))
+	for _, probe := range clusterProbes {
+		assert.True(t, findProbe(*lb.Probes, probe))
+	}
+
+	// switching back to Local drops the per-port probes again
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 32456
+	assert.True(t, az.reconcileLBProbes(&lb, &svc, "svc1", true, localProbes))
+	assert.Equal(t, localProbes, *lb.Probes)
+}
+
+func TestGetExpectedHAModeLoadBalancingRulePropertiesFloatingIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range []struct {
+		desc                     string
+		annotations              map[string]string
+		backendPoolType          string
+		isIPv6                   bool
+		expectedEnableFloatingIP bool
+	}{
+		{
+			desc:                     "the floating IP of the HA ports rule should be enabled by default",
+			expectedEnableFloatingIP: true,
+		},
+		{
+			desc:        "the floating IP of the HA ports rule should be disabled by the annotation",
+			annotations: map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: consts.TrueAnnotationValue},
+		},
+		{
+			desc:            "the floating IP of the HA ports rule should be disabled with the podIP backend pool type",
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+		},
+		{
+			desc:   "the floating IP of the HA ports rule should be disabled for the internal IPv6 frontend",
+			isIPv6: true,
+		},
+	} {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+		az.LoadBalancerBackendPoolConfigurationType = test.backendPoolType
+		annotations := map[string]string{
+			consts.ServiceAnnotationLoadBalancerInternal:                    consts.TrueAnnotationValue,
+			consts.ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts: consts.TrueAnnotationValue,
+		}
+		for key, value := range test.annotations {
+			annotations[key] = value
+		}
+		svc := getTestService("service1", v1.ProtocolTCP, annotations, test.isIPv6, 80)
+
+		props, err := az.getExpectedHAModeLoadBalancingRuleProperties(&svc, "fip", "pool", test.isIPv6)
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.expectedEnableFloatingIP, to.Bool(props.EnableFloatingIP), test.desc)
+		// the HA ports rule doesn't translate the ports even if the floating IP is disabled
+		assert.Equal(t, int32(0), to.Int32(props.FrontendPort), test.desc)
+		assert.Equal(t, int32(0), to.Int32(props.BackendPort), test.desc)
+		assert.Equal(t, network.TransportProtocolAll, props.Protocol, test.desc)
+	}
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getServiceZones returns the availability zones of the frontend IP configurations or the public IPs requested by
+// the service annotation, and whether the zones are requested. An empty list of zones means non-zonal.
+func (az *Cloud) getServiceZones(service *v1.Service) ([]string, bool, error) {
+	value, found := service.Annotations[consts.ServiceAnnotationLoadBalancerZones]
+	if !found {
+		return nil, false, nil
+	}
+
+	serviceName := getServiceName(service)
+	if !az.useStandardLoadBalancer() {
+		return nil, true, fmt.Errorf("getServiceZones for service(%s): the annotation %s is only supported with the standard load balancer", serviceName, consts.ServiceAnnotationLoadBalancerZones)
+	}
+	if az.HasExtendedLocation() {
+		return nil, true, fmt.Errorf("getServiceZones for service(%s): the annotation %s is not supported in the edge zone %s", serviceName, consts.ServiceAnnotationLoadBalancerZones, az.ExtendedLocationName)
+	}
+
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, consts.LoadBalancerZonesNoZone) {
+		return []string{}, true, nil
+	}
+
+	regionZones, err := az.getRegionZonesBackoff(az.Location)
+	if err != nil {
+		return nil, true, err
+	}
+	if strings.EqualFold(value, consts.LoadBalancerZonesZoneRedundant) {
+		if len(regionZones) == 0 {
+			return nil, true, fmt.Errorf("getServiceZones for service(%s): the region %s doesn't support availability zones", serviceName, az.Location)
+		}
+		return regionZones, true, nil
+	}
+	for _, zone := range regionZones {
+		if strings.EqualFold(zone, value) {
+			return []string{zone}, true, nil
+		}
+	}
+	return nil, true, fmt.Errorf("getServiceZones for service(%s): invalid value %q of the annotation %s, which should be %q, %q or one of the zones [%s] of the region %s",
+		serviceName, value, consts.ServiceAnnotationLoadBalancerZones, consts.LoadBalancerZonesZoneRedundant, consts.LoadBalancerZonesNoZone, strings.Join(regionZones, ","), az.Location)
+}
+
+// areZonesEqual checks if the zones of the resource are the expected ones. Nil and empty zones are both non-zonal.
+func areZonesEqual(zones *[]string, expectedZones []string) bool {
+	var currentZones []string
+	if zones != nil {
+		currentZones = *zones
+	}
+	return sets.NewString(currentZones...).Equal(sets.NewString(expectedZones...))
+}
+
+// reconcileFrontendZones replaces the frontend IP configurations of the service, or the managed public IPs
+// referenced by them, whose zones don't match the ones requested by the service annotation. Azure doesn't support
+// changing the zones in place, so the frontend IP configuration is removed from the load balancer together with the
+// rules referencing it, and the public IP is deleted. They are re-created with the requested zones later in the
+// reconciliation. The frontend IP configurations shared with other services, the public IPs not managed by the
+// service and the public IPs to be retained are not replaced.
+func (az *Cloud) reconcileFrontendZones(clusterName string, service *v1.Service, lb *network.LoadBalancer) error {
+	zones, requested, err := az.getServiceZones(service)
+	if err != nil || !requested {
+		return err
+	}
+	az.checkServiceZonesHaveNodes(service, zones)
+	if lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
+		return nil
+	}
+
+	serviceName := getServiceName(service)
+	isInternal := requiresInternalLoadBalancer(service)
+	configs := append([]network.FrontendIPConfiguration{}, *lb.FrontendIPConfigurations...)
+	for _, config := range configs {
+		// the secondary services sharing the frontend IP configuration don't decide its zones
+		owns, isPrimaryService, err := az.serviceOwnsFrontendIP(config, service, nil)
+		if err != nil {
+			return err
+		}
+		if !owns || !isPrimaryService || config.FrontendIPConfigurationPropertiesFormat == nil {
+			continue
+		}
+
+		var pip *network.PublicIPAddress
+		var pipResourceGroup string
+		currentZones := config.Zones
+		if !isInternal {
+			if config.PublicIPAddress == nil {
+				continue
+			}
+			matches := pipIDRE.FindStringSubmatch(to.String(config.PublicIPAddress.ID))
+			if len(matches) != 4 {
+				continue
+			}
+			pipResourceGroup = matches[2]
+			existingPIP, existsPIP, err := az.getPublicIPAddress(pipResourceGroup, matches[3], azcache.CacheReadTypeDefault)
+			if err != nil {
+				return err
+			}
+			if !existsPIP {
+				continue
+			}
+			pip = &existingPIP
+			currentZones = pip.Zones
+		}
+		if areZonesEqual(currentZones, zones) {
+			continue
+		}
+
+		resourceName := fmt.Sprintf("frontend IP configuration %s", to.String(config.Name))
+		if pip != nil {
+			resourceName = fmt.Sprintf("public IP %s", to.String(pip.Name))
+		}
+		var zonesStr string
+		if currentZones != nil {
+			zonesStr = strings.Join(*currentZones, ",")
+		}
+
+		if pip != nil {
+			owns, isUserAssignedPIP := serviceOwnsPublicIP(service, pip, clusterName)
+			if !owns || isUserAssignedPIP || len(parsePIPServiceTag(to.StringPtr(getServiceFromPIPServiceTags(pip.Tags)))) > 1 {
+				az.Event(service, v1.EventTypeWarning, "SkipReplacingFrontendZones", fmt.Sprintf("The zones of the %s are [%s] instead of [%s], but it is not managed by the service only", resourceName, zonesStr, strings.Join(zones, ",")))
+				continue
+			}
+			// the address of the public IP to be retained is never released by the replacement
+			if az.shouldRetainPublicIP(service) || isRetainedPublicIP(pip) {
+				az.Event(service, v1.EventTypeWarning, "SkipReplacingFrontendZones", fmt.Sprintf("The zones of the %s are [%s] instead of [%s], but it is retained on the deletion of the service", resourceName, zonesStr, strings.Join(zones, ",")))
+				continue
+			}
+		}
+		unsafe, err := az.isFrontendIPConfigUnsafeToDelete(lb, service, config.ID)
+		if err != nil {
+			return err
+		}
+		if unsafe {
+			az.Event(service, v1.EventTypeWarning, "SkipReplacingFrontendZones", fmt.Sprintf("The zones of the %s are [%s] instead of [%s], but the frontend IP configuration is shared with other services or referenced by other rules", resourceName, zonesStr, strings.Join(zones, ",")))
+			continue
+		}
+
+		klog.V(2).Infof("reconcileFrontendZones for service(%s): replacing the %s with zones [%s] by the zones [%s]", serviceName, resourceName, zonesStr, strings.Join(zones, ","))
+		az.Event(service, v1.EventTypeWarning, "ReplacingFrontendZones", fmt.Sprintf("The %s is being replaced to change its zones from [%s] to [%s], the traffic to the service is interrupted until it is re-created", resourceName, zonesStr, strings.Join(zones, ",")))
+		if err := az.removeFrontendIPConfig(service, lb, to.String(config.ID)); err != nil {
+			return err
+		}
+		if pip != nil {
+			if err := az.DeletePublicIP(service, pipResourceGroup, to.String(pip.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkServiceZonesHaveNodes warns if the zonal frontend of the service is in a zone without nodes, in which case
+// the traffic to the service crosses the zones.
+func (az *Cloud) checkServiceZonesHaveNodes(service *v1.Service, zones []string) {
+	if len(zones) != 1 {
+		return
+	}
+	activeZones, err := az.GetActiveZones()
+	if err != nil {
+		klog.V(4).Infof("checkServiceZonesHaveNodes for service(%s): failed to get the active zones: %v", getServiceName(service), err)
+		return
+	}
+	for activeZone := range activeZones {
+		if strings.EqualFold(az.GetZoneID(activeZone), zones[0]) {
+			return
+		}
+	}
+	az.Event(service, v1.EventTypeWarning, "FrontendZoneWithoutNodes", fmt.Sprintf("There are no nodes in the zone %s of the frontend of the service", zones[0]))
+}
+
+// removeFrontendIPConfig removes the frontend IP configuration and the load balancing rules, inbound NAT rules and
+// pools, and outbound rules referencing it from the load balancer, and updates the load balancer. The outbound rules
+// referencing other frontend IP configurations as well are kept without the removed one. The etag of the load balancer is refreshed after the update so that
+// the load balancer can be updated again in the same reconciliation.
+func (az *Cloud) removeFrontendIPConfig(service *v1.Service, lb *network.LoadBalancer, fipConfigID string) error {
+	var fipConfigs []network.FrontendIPConfiguration
+	for _, config := range *lb.FrontendIPConfigurations {
+		if !strings.EqualFold(to.String(config.ID), fipConfigID) {
+			fipConfigs = append(fipConfigs, config)
+		}
+	}
+	lb.FrontendIPConfigurations = &fipConfigs
+
+	if lb.LoadBalancingRules != nil {
+		var rules []network.LoadBalancingRule
+		for _, rule := range *lb.LoadBalancingRules {
+			if rule.LoadBalancingRulePropertiesFormat == nil || rule.FrontendIPConfiguration == nil ||
+				!strings.EqualFold(to.String(rule.FrontendIPConfiguration.ID), fipConfigID) {
+				rules = append(rules, rule)
+			}
+		}
+		lb.LoadBalancingRules = &rules
+	}
+	if lb.InboundNatRules != nil {
+		var natRules []network.InboundNatRule
+		for _, natRule := range *lb.InboundNatRules {
+			if natRule.InboundNatRulePropertiesFormat == nil || natRule.FrontendIPConfiguration == nil ||
+				!strings.EqualFold(to.String(natRule.FrontendIPConfiguration.ID), fipConfigID) {
+				natRules = append(natRules, natRule)
+			}
+		}
+		lb.InboundNatRules = &natRules
+	}
+	if lb.InboundNatPools != nil {
+		var natPools []network.InboundNatPool
+		for _, natPool := range *lb.InboundNatPools {
+			if natPool.InboundNatPoolPropertiesFormat == nil || natPool.FrontendIPConfiguration == nil ||
+				!strings.EqualFold(to.String(natPool.FrontendIPConfiguration.ID), fipConfigID) {
+				natPools = append(natPools, natPool)
+			}
+		}
+		lb.InboundNatPools = &natPools
+	}
+	if lb.OutboundRules != nil {
+		var outboundRules []network.OutboundRule
+		for _, outboundRule := range *lb.OutboundRules {
+			if outboundRule.OutboundRulePropertiesFormat == nil || outboundRule.FrontendIPConfigurations == nil {
+				outboundRules = append(outboundRules, outboundRule)
+				continue
+			}
+			var fipConfigRefs []network.SubResource
+			for _, fipConfigRef := range *outboundRule.FrontendIPConfigurations {
+				if !strings.EqualFold(to.String(fipConfigRef.ID), fipConfigID) {
+					fipConfigRefs = append(fipConfigRefs, fipConfigRef)
+				}
+			}
+			switch {
+			case len(fipConfigRefs) == len(*outboundRule.FrontendIPConfigurations):
+				outboundRules = append(outboundRules, outboundRule)
+			case len(fipConfigRefs) > 0:
+				properties := *outboundRule.OutboundRulePropertiesFormat
+				properties.FrontendIPConfigurations = &fipConfigRefs
+				outboundRule.OutboundRulePropertiesFormat = &properties
+				outboundRules = append(outboundRules, outboundRule)
+			}
+		}
+		lb.OutboundRules = &outboundRules
+	}
+
+	if err := az.CreateOrUpdateLB(service, *lb); err != nil {
+		klog.Errorf("removeFrontendIPConfig for service(%s): failed to update the load balancer %s: %v", getServiceName(service), to.String(lb.Name), err)
+		return err
+	}
+	latestLB, existsLB, err := az.getAzureLoadBalancer(to.String(lb.Name), azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return err
+	}
+	if existsLB {
+		lb.Etag = latestLB.Etag
+	}
+	return nil
+}
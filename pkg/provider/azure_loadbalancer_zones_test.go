@@ -0,0 +1,369 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestGetServiceZones(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range []struct {
+		desc              string
+		annotations       map[string]string
+		sku               string
+		expectedZones     []string
+		expectedRequested bool
+		expectedErr       bool
+	}{
+		{
+			desc:          "the zones should not be requested without the annotation",
+			sku:           consts.LoadBalancerSkuStandard,
+			expectedZones: nil,
+		},
+		{
+			desc:              "the zone-redundant should request all zones of the region",
+			annotations:       map[string]string{consts.ServiceAnnotationLoadBalancerZones: "zone-redundant"},
+			sku:               consts.LoadBalancerSkuStandard,
+			expectedZones:     []string{"1", "2", "3"},
+			expectedRequested: true,
+		},
+		{
+			desc:              "the no-zone should request no zones",
+			annotations:       map[string]string{consts.ServiceAnnotationLoadBalancerZones: "no-zone"},
+			sku:               consts.LoadBalancerSkuStandard,
+			expectedZones:     []string{},
+			expectedRequested: true,
+		},
+		{
+			desc:              "a zone of the region should be requested",
+			annotations:       map[string]string{consts.ServiceAnnotationLoadBalancerZones: " 2 "},
+			sku:               consts.LoadBalancerSkuStandard,
+			expectedZones:     []string{"2"},
+			expectedRequested: true,
+		},
+		{
+			desc:              "an error should be returned if the zone is not in the region",
+			annotations:       map[string]string{consts.ServiceAnnotationLoadBalancerZones: "4"},
+			sku:               consts.LoadBalancerSkuStandard,
+			expectedRequested: true,
+			expectedErr:       true,
+		},
+		{
+			desc:              "an error should be returned for the basic load balancer",
+			annotations:       map[string]string{consts.ServiceAnnotationLoadBalancerZones: "1"},
+			sku:               consts.LoadBalancerSkuBasic,
+			expectedRequested: true,
+			expectedErr:       true,
+		},
+	} {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerSku = test.sku
+		svc := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+		zones, requested, err := az.getServiceZones(&svc)
+		assert.Equal(t, test.expectedErr, err != nil, test.desc)
+		assert.Equal(t, test.expectedRequested, requested, test.desc)
+		if !test.expectedErr {
+			assert.Equal(t, test.expectedZones, zones, test.desc)
+		}
+	}
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.regionZonesMap = map[string][]string{az.Location: {}}
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerZones: "zone-redundant"}, false, 80)
+	_, _, err := az.getServiceZones(&svc)
+	assert.Error(t, err, "the zone-redundant should not be requested in the region without zones")
+}
+
+func TestGetFrontendZonesRequestedByService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerZones: "1"}, false, 80)
+	fipConfig := network.FrontendIPConfiguration{}
+	assert.NoError(t, az.getFrontendZones(&fipConfig, &[]string{"1", "2", "3"}, true, &svc, "atest"))
+	assert.Equal(t, &[]string{"1"}, fipConfig.Zones)
+
+	svc.Annotations[consts.ServiceAnnotationLoadBalancerZones] = consts.LoadBalancerZonesNoZone
+	fipConfig = network.FrontendIPConfiguration{}
+	assert.NoError(t, az.getFrontendZones(&fipConfig, nil, false, &svc, "atest"))
+	assert.Nil(t, fipConfig.Zones)
+}
+
+func TestReconcileFrontendZones(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	getTestLB := func(fipConfig network.FrontendIPConfiguration) *network.LoadBalancer {
+		fipConfig.Name = to.StringPtr("aservice1")
+		fipConfig.ID = to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/frontendIPConfigurations/aservice1")
+		return &network.LoadBalancer{
+			Name: to.StringPtr("lb"),
+			Etag: to.StringPtr("1"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{fipConfig},
+				LoadBalancingRules: &[]network.LoadBalancingRule{
+					{
+						Name: to.StringPtr("aservice1-TCP-80"),
+						LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+							FrontendIPConfiguration: &network.SubResource{ID: fipConfig.ID},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("the internal frontend with the changed zones should be removed", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+		recorder := record.NewFakeRecorder(10)
+		az.eventRecorder = recorder
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+			consts.ServiceAnnotationLoadBalancerInternal: consts.TrueAnnotationValue,
+			consts.ServiceAnnotationLoadBalancerZones:    "1",
+		}, false, 80)
+		lb := getTestLB(network.FrontendIPConfiguration{
+			Zones: &[]string{"1", "2", "3"},
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PrivateIPAddress: to.StringPtr("10.0.0.4"),
+			},
+		})
+
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").DoAndReturn(func(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+			assert.Empty(t, *parameters.FrontendIPConfigurations)
+			assert.Empty(t, *parameters.LoadBalancingRules)
+			return nil
+		})
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "lb", gomock.Any()).Return(network.LoadBalancer{Name: to.StringPtr("lb"), Etag: to.StringPtr("2")}, nil)
+		assert.NoError(t, az.reconcileFrontendZones("kubernetes", &svc, lb))
+		assert.Empty(t, *lb.FrontendIPConfigurations)
+		assert.Equal(t, "2", to.String(lb.Etag))
+		assert.Contains(t, <-recorder.Events, "FrontendZoneWithoutNodes")
+		assert.Contains(t, <-recorder.Events, "ReplacingFrontendZones")
+
+		// nothing is changed if the zones are the expected ones
+		lb = getTestLB(network.FrontendIPConfiguration{
+			Zones: &[]string{"1"},
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PrivateIPAddress: to.StringPtr("10.0.0.4"),
+			},
+		})
+		assert.NoError(t, az.reconcileFrontendZones("kubernetes", &svc, lb))
+		assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+		assert.Contains(t, <-recorder.Events, "FrontendZoneWithoutNodes")
+
+		// the frontend referenced by the outbound rule is not replaced
+		lb = getTestLB(network.FrontendIPConfiguration{
+			Zones: &[]string{"1", "2", "3"},
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PrivateIPAddress: to.StringPtr("10.0.0.4"),
+			},
+		})
+		lb.OutboundRules = &[]network.OutboundRule{
+			{
+				Name: to.StringPtr("outbound"),
+				OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+					FrontendIPConfigurations: &[]network.SubResource{{ID: (*lb.FrontendIPConfigurations)[0].ID}},
+				},
+			},
+		}
+		assert.NoError(t, az.reconcileFrontendZones("kubernetes", &svc, lb))
+		assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+		assert.Contains(t, <-recorder.Events, "FrontendZoneWithoutNodes")
+		assert.Contains(t, <-recorder.Events, "DeletingFrontendIPConfiguration")
+		assert.Contains(t, <-recorder.Events, "SkipReplacingFrontendZones")
+	})
+
+	t.Run("the managed public IP with the changed zones should be deleted", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerZones: "no-zone"}, false, 80)
+		pipID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip"
+		lb := getTestLB(network.FrontendIPConfiguration{
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(pipID)},
+			},
+		})
+		pip := network.PublicIPAddress{
+			Name:  to.StringPtr("pip"),
+			ID:    to.StringPtr(pipID),
+			Zones: &[]string{"1", "2", "3"},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: to.StringPtr("1.2.3.4"),
+			},
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr("default/service1"),
+				consts.ClusterNameKey: to.StringPtr("kubernetes"),
+			},
+		}
+
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+		mockPIPClient.EXPECT().Get(gomock.Any(), "rg", "pip", gomock.Any()).Return(pip, nil)
+		mockPIPClient.EXPECT().Delete(gomock.Any(), "rg", "pip").Return(nil)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").Return(nil)
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "lb", gomock.Any()).Return(network.LoadBalancer{Name: to.StringPtr("lb"), Etag: to.StringPtr("2")}, nil)
+		assert.NoError(t, az.reconcileFrontendZones("kubernetes", &svc, lb))
+		assert.Empty(t, *lb.FrontendIPConfigurations)
+
+		// the public IP shared with other services is not replaced
+		pip.Tags[consts.ServiceTagKey] = to.StringPtr("default/service1,default/service2")
+		mockPIPClient.EXPECT().Get(gomock.Any(), "rg", "pip", gomock.Any()).Return(pip, nil)
+		lb = getTestLB(network.FrontendIPConfiguration{
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(pipID)},
+			},
+		})
+		assert.NoError(t, az.reconcileFrontendZones("kubernetes", &svc, lb))
+		assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+	})
+
+	t.Run("the public IP to be retained should not be replaced", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+		recorder := record.NewFakeRecorder(10)
+		az.eventRecorder = recorder
+		pipID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip"
+		pip := network.PublicIPAddress{
+			Name:                            to.StringPtr("pip"),
+			ID:                              to.StringPtr(pipID),
+			Zones:                           &[]string{"1", "2", "3"},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{IPAddress: to.StringPtr("1.2.3.4")},
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr("default/service1"),
+				consts.ClusterNameKey: to.StringPtr("kubernetes"),
+			},
+		}
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+		mockPIPClient.EXPECT().Get(gomock.Any(), "rg", "pip", gomock.Any()).Return(pip, nil)
+
+		for _, annotations := range []map[string]string{
+			{consts.ServiceAnnotationLoadBalancerZones: "no-zone", consts.ServiceAnnotationPIPRetainOnDelete: consts.TrueAnnotationValue},
+			{consts.ServiceAnnotationLoadBalancerZones: "no-zone"},
+		} {
+			// the annotation takes precedence over the cloud config
+			az.RetainPublicIPOnServiceDeletion = len(annotations) == 1
+			svc := getTestService("service1", v1.ProtocolTCP, annotations, false, 80)
+			lb := getTestLB(network.FrontendIPConfiguration{
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(pipID)},
+				},
+			})
+			assert.NoError(t, az.reconcileFrontendZones("kubernetes", &svc, lb))
+			assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+			assert.Contains(t, <-recorder.Events, "SkipReplacingFrontendZones")
+		}
+	})
+}
+
+func TestRemoveFrontendIPConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	fipConfigID := to.StringPtr("fip")
+	otherFIPConfigID := to.StringPtr("other-fip")
+	lb := &network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{ID: fipConfigID}, {ID: otherFIPConfigID}},
+			LoadBalancingRules: &[]network.LoadBalancingRule{
+				{
+					Name:                              to.StringPtr("rule"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{FrontendIPConfiguration: &network.SubResource{ID: fipConfigID}},
+				},
+			},
+			InboundNatRules: &[]network.InboundNatRule{
+				{
+					Name:                           to.StringPtr("nat"),
+					InboundNatRulePropertiesFormat: &network.InboundNatRulePropertiesFormat{FrontendIPConfiguration: &network.SubResource{ID: fipConfigID}},
+				},
+				{
+					Name:                           to.StringPtr("other-nat"),
+					InboundNatRulePropertiesFormat: &network.InboundNatRulePropertiesFormat{FrontendIPConfiguration: &network.SubResource{ID: otherFIPConfigID}},
+				},
+			},
+			InboundNatPools: &[]network.InboundNatPool{
+				{
+					Name:                           to.StringPtr("nat-pool"),
+					InboundNatPoolPropertiesFormat: &network.InboundNatPoolPropertiesFormat{FrontendIPConfiguration: &network.SubResource{ID: fipConfigID}},
+				},
+			},
+			OutboundRules: &[]network.OutboundRule{
+				{
+					Name:                         to.StringPtr("outbound"),
+					OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{FrontendIPConfigurations: &[]network.SubResource{{ID: fipConfigID}}},
+				},
+				{
+					Name:                         to.StringPtr("shared-outbound"),
+					OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{FrontendIPConfigurations: &[]network.SubResource{{ID: fipConfigID}, {ID: otherFIPConfigID}}},
+				},
+				{
+					Name:                         to.StringPtr("other-outbound"),
+					OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{FrontendIPConfigurations: &[]network.SubResource{{ID: otherFIPConfigID}}},
+				},
+			},
+		},
+	}
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "lb", gomock.Any(), "1").DoAndReturn(func(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+		assert.Equal(t, []network.FrontendIPConfiguration{{ID: otherFIPConfigID}}, *parameters.FrontendIPConfigurations)
+		assert.Empty(t, *parameters.LoadBalancingRules)
+		assert.Equal(t, 1, len(*parameters.InboundNatRules))
+		assert.Equal(t, "other-nat", to.String((*parameters.InboundNatRules)[0].Name))
+		assert.Empty(t, *parameters.InboundNatPools)
+		// the outbound rules referencing other frontend IP configurations are kept without the removed one
+		assert.Equal(t, []network.OutboundRule{
+			{
+				Name:                         to.StringPtr("shared-outbound"),
+				OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{FrontendIPConfigurations: &[]network.SubResource{{ID: otherFIPConfigID}}},
+			},
+			{
+				Name:                         to.StringPtr("other-outbound"),
+				OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{FrontendIPConfigurations: &[]network.SubResource{{ID: otherFIPConfigID}}},
+			},
+		}, *parameters.OutboundRules)
+		return nil
+	})
+	mockLBClient.EXPECT().Get(gomock.Any(), "rg", "lb", gomock.Any()).Return(network.LoadBalancer{Name: to.StringPtr("lb"), Etag: to.StringPtr("2")}, nil)
+	assert.NoError(t, az.removeFrontendIPConfig(&svc, lb, "FIP"))
+	assert.Equal(t, "2", to.String(lb.Etag))
+}
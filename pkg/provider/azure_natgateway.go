@@ -0,0 +1,467 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	// NatGatewayControllerName is the name of the controller reconciling the NAT gateway of the node subnets.
+	NatGatewayControllerName = "nat-gateway"
+
+	// maxNatGatewayOutboundIPCount is the maximum number of the public IPs created for the NAT gateway.
+	maxNatGatewayOutboundIPCount = 16
+	// defaultNatGatewayIdleTimeoutInMinutes is the default idle timeout of the NAT gateway.
+	defaultNatGatewayIdleTimeoutInMinutes = 4
+)
+
+// validateOutboundTypeConfig checks the outbound type and the NAT gateway in the cloud config.
+func validateOutboundTypeConfig(config *Config) error {
+	if config.OutboundType == "" {
+		config.OutboundType = consts.OutboundTypeLoadBalancer
+	}
+	supportedOutboundTypes := sets.NewString(
+		strings.ToLower(consts.OutboundTypeLoadBalancer),
+		strings.ToLower(consts.OutboundTypeNatGateway))
+	if !supportedOutboundTypes.Has(strings.ToLower(config.OutboundType)) {
+		return fmt.Errorf("outboundType %s is not supported, supported values are %v", config.OutboundType, supportedOutboundTypes.List())
+	}
+
+	if !strings.EqualFold(config.OutboundType, consts.OutboundTypeNatGateway) {
+		// the name is kept to remove the NAT gateway after the outbound type is switched back
+		if natGateway := config.NatGateway; natGateway != nil && (natGateway.ManagedOutboundIPCount != 0 ||
+			natGateway.OutboundIPPrefixID != "" || natGateway.IdleTimeoutInMinutes != 0 || len(natGateway.SubnetNames) > 0) {
+			return fmt.Errorf("natGateway should only be set when outboundType is %s, except the name of the NAT gateway to be removed", consts.OutboundTypeNatGateway)
+		}
+		return nil
+	}
+
+	if !strings.EqualFold(config.LoadBalancerSku, consts.LoadBalancerSkuStandard) {
+		return fmt.Errorf("outboundType %s is only supported with the standard load balancer", consts.OutboundTypeNatGateway)
+	}
+	if config.ManagedOutboundRule != nil {
+		return fmt.Errorf("managedOutboundRule should not be set when outboundType is %s", consts.OutboundTypeNatGateway)
+	}
+
+	natGateway := config.NatGateway
+	if natGateway == nil {
+		return nil
+	}
+	if natGateway.ManagedOutboundIPCount != 0 && natGateway.OutboundIPPrefixID != "" {
+		return fmt.Errorf("natGateway: managedOutboundIPCount should not be set together with outboundIPPrefixID")
+	}
+	if natGateway.ManagedOutboundIPCount < 0 || natGateway.ManagedOutboundIPCount > maxNatGatewayOutboundIPCount {
+		return fmt.Errorf("natGateway: managedOutboundIPCount %d should be between 1 and %d", natGateway.ManagedOutboundIPCount, maxNatGatewayOutboundIPCount)
+	}
+	if natGateway.OutboundIPPrefixID != "" && !pipPrefixIDRE.MatchString(natGateway.OutboundIPPrefixID) {
+		return fmt.Errorf("natGateway: %s is not a valid public IP prefix ID", natGateway.OutboundIPPrefixID)
+	}
+	if natGateway.IdleTimeoutInMinutes != 0 &&
+		(natGateway.IdleTimeoutInMinutes < minOutboundRuleIdleTimeoutInMinutes || natGateway.IdleTimeoutInMinutes > maxOutboundRuleIdleTimeoutInMinutes) {
+		return fmt.Errorf("natGateway: idleTimeoutInMinutes %d should be between %d and %d", natGateway.IdleTimeoutInMinutes, minOutboundRuleIdleTimeoutInMinutes, maxOutboundRuleIdleTimeoutInMinutes)
+	}
+	return nil
+}
+
+func (az *Cloud) useNatGatewayOutbound() bool {
+	return strings.EqualFold(az.OutboundType, consts.OutboundTypeNatGateway)
+}
+
+// getNatGatewayConfig returns the NAT gateway config with the defaults applied.
+func (az *Cloud) getNatGatewayConfig() NatGatewayConfig {
+	var natGateway NatGatewayConfig
+	if az.NatGateway != nil {
+		natGateway = *az.NatGateway
+	}
+	if natGateway.Name == "" {
+		natGateway.Name = consts.DefaultNatGatewayName
+	}
+	if natGateway.ManagedOutboundIPCount == 0 && natGateway.OutboundIPPrefixID == "" {
+		natGateway.ManagedOutboundIPCount = 1
+	}
+	if natGateway.IdleTimeoutInMinutes == 0 {
+		natGateway.IdleTimeoutInMinutes = defaultNatGatewayIdleTimeoutInMinutes
+	}
+	if len(natGateway.SubnetNames) == 0 {
+		natGateway.SubnetNames = []string{az.SubnetName}
+	}
+	return natGateway
+}
+
+// getNatGatewayPIPName returns the name of the index-th public IP created for the NAT gateway.
+func getNatGatewayPIPName(natGatewayName string, index int) string {
+	return fmt.Sprintf("%s-pip-%d", natGatewayName, index)
+}
+
+// ShouldReconcileNatGateway returns true if the outbound type is natGateway, or the NAT gateway is kept in the
+// config to be removed after the outbound type is switched back to loadBalancer.
+func (az *Cloud) ShouldReconcileNatGateway() bool {
+	return az.useNatGatewayOutbound() || az.NatGateway != nil
+}
+
+// RunNatGatewayReconciler reconciles the NAT gateway periodically until the context is done, so that the node
+// subnets added to the config and the changes made out of band are picked up. If the outbound type is not
+// natGateway, the NAT gateway created for the cluster is removed instead.
+func (az *Cloud) RunNatGatewayReconciler(ctx context.Context, clusterName string) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if !az.useNatGatewayOutbound() {
+			if err := az.removeNatGateway(clusterName); err != nil {
+				klog.Errorf("RunNatGatewayReconciler: failed to remove the NAT gateway: %v", err)
+			}
+			return
+		}
+		if err := az.reconcileNatGateway(clusterName); err != nil {
+			klog.Errorf("RunNatGatewayReconciler: failed to reconcile the NAT gateway: %v", err)
+		}
+	}, consts.NatGatewayReconcileInterval)
+}
+
+// reconcileNatGateway ensures the NAT gateway with its outbound IPs exists and is associated with the node subnets.
+// The NAT gateway is tagged with the cluster name and the names of the subnets associated with it, so that the
+// subnets removed from the config are disassociated from it. The public IPs created for the NAT gateway which are
+// not needed anymore are deleted after the NAT gateway is updated.
+func (az *Cloud) reconcileNatGateway(clusterName string) error {
+	natGatewayConfig := az.getNatGatewayConfig()
+	natGatewayName := natGatewayConfig.Name
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	natGateway, rerr := az.NatGatewaysClient.Get(ctx, az.ResourceGroup, natGatewayName, "")
+	existsNatGateway, rerr := checkResourceExistsFromError(rerr)
+	if rerr != nil {
+		klog.Errorf("NatGatewaysClient.Get(%s, %s) failed: %s", az.ResourceGroup, natGatewayName, rerr.Error().Error())
+		return rerr.Error()
+	}
+	if owner := getClusterFromPIPClusterTags(natGateway.Tags); existsNatGateway && owner != "" && !strings.EqualFold(owner, clusterName) {
+		return fmt.Errorf("reconcileNatGateway: NAT gateway %s/%s is created for another cluster %s", az.ResourceGroup, natGatewayName, owner)
+	}
+
+	// the subnets removed from the config are disassociated before they are removed from the tags
+	expectedSubnetNames := sets.NewString()
+	for _, subnetName := range natGatewayConfig.SubnetNames {
+		expectedSubnetNames.Insert(strings.ToLower(subnetName))
+	}
+	if existsNatGateway {
+		for _, subnetName := range getNatGatewaySubnetNames(natGateway.Tags).Difference(expectedSubnetNames).List() {
+			if err := az.removeSubnetNatGateway(subnetName, to.String(natGateway.ID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	expectedPIPIDs := sets.NewString()
+	var pipIDs []network.SubResource
+	for i := 0; i < natGatewayConfig.ManagedOutboundIPCount; i++ {
+		pip, err := az.ensureNatGatewayPublicIP(clusterName, getNatGatewayPIPName(natGatewayName, i))
+		if err != nil {
+			return err
+		}
+		expectedPIPIDs.Insert(strings.ToLower(to.String(pip.ID)))
+		pipIDs = append(pipIDs, network.SubResource{ID: pip.ID})
+	}
+	var pipPrefixIDs []network.SubResource
+	if natGatewayConfig.OutboundIPPrefixID != "" {
+		pipPrefixIDs = append(pipPrefixIDs, network.SubResource{ID: to.StringPtr(natGatewayConfig.OutboundIPPrefixID)})
+	}
+
+	var pipsToDelete []string
+	subnetNamesTag := strings.Join(expectedSubnetNames.List(), ",")
+	if !existsNatGateway || !equalNatGateway(natGateway, natGatewayConfig.IdleTimeoutInMinutes, pipIDs, pipPrefixIDs) ||
+		to.String(natGateway.Tags[consts.ClusterNameKey]) != clusterName || to.String(natGateway.Tags[consts.NatGatewaySubnetsTagKey]) != subnetNamesTag {
+		if existsNatGateway && natGateway.NatGatewayPropertiesFormat != nil && natGateway.PublicIPAddresses != nil {
+			for _, pipID := range *natGateway.PublicIPAddresses {
+				if expectedPIPIDs.Has(strings.ToLower(to.String(pipID.ID))) {
+					continue
+				}
+				if pipName := az.getNatGatewayPIPNameFromID(natGatewayName, to.String(pipID.ID)); pipName != "" {
+					pipsToDelete = append(pipsToDelete, pipName)
+				}
+			}
+		}
+
+		natGateway.Name = to.StringPtr(natGatewayName)
+		natGateway.Location = to.StringPtr(az.Location)
+		natGateway.Sku = &network.NatGatewaySku{Name: network.NatGatewaySkuNameStandard}
+		natGateway.NatGatewayPropertiesFormat = &network.NatGatewayPropertiesFormat{
+			IdleTimeoutInMinutes: to.Int32Ptr(natGatewayConfig.IdleTimeoutInMinutes),
+			PublicIPAddresses:    &pipIDs,
+			PublicIPPrefixes:     &pipPrefixIDs,
+		}
+		if natGateway.Tags == nil {
+			natGateway.Tags = make(map[string]*string)
+		}
+		natGateway.Tags[consts.ClusterNameKey] = to.StringPtr(clusterName)
+		natGateway.Tags[consts.NatGatewaySubnetsTagKey] = to.StringPtr(subnetNamesTag)
+		klog.V(2).Infof("reconcileNatGateway: updating the NAT gateway %s/%s", az.ResourceGroup, natGatewayName)
+		if rerr := az.NatGatewaysClient.CreateOrUpdate(ctx, az.ResourceGroup, natGatewayName, natGateway, to.String(natGateway.Etag)); rerr != nil {
+			klog.Errorf("NatGatewaysClient.CreateOrUpdate(%s, %s) failed: %s", az.ResourceGroup, natGatewayName, rerr.Error().Error())
+			return rerr.Error()
+		}
+		natGateway, rerr = az.NatGatewaysClient.Get(ctx, az.ResourceGroup, natGatewayName, "")
+		if rerr != nil {
+			klog.Errorf("NatGatewaysClient.Get(%s, %s) failed: %s", az.ResourceGroup, natGatewayName, rerr.Error().Error())
+			return rerr.Error()
+		}
+	}
+
+	for _, subnetName := range natGatewayConfig.SubnetNames {
+		if err := az.ensureSubnetNatGateway(subnetName, to.String(natGateway.ID)); err != nil {
+			return err
+		}
+	}
+
+	for _, pipName := range pipsToDelete {
+		if err := az.deleteNatGatewayPublicIP(clusterName, pipName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeNatGateway removes the NAT gateway created for the cluster after the outbound type is switched back to
+// loadBalancer. The subnets associated by the cloud provider are disassociated from the NAT gateway before it is
+// deleted, and the public IPs created for it are deleted after. The NAT gateways not tagged with the cluster name
+// are not changed.
+func (az *Cloud) removeNatGateway(clusterName string) error {
+	natGatewayName := az.getNatGatewayConfig().Name
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	natGateway, rerr := az.NatGatewaysClient.Get(ctx, az.ResourceGroup, natGatewayName, "")
+	existsNatGateway, rerr := checkResourceExistsFromError(rerr)
+	if rerr != nil {
+		klog.Errorf("NatGatewaysClient.Get(%s, %s) failed: %s", az.ResourceGroup, natGatewayName, rerr.Error().Error())
+		return rerr.Error()
+	}
+	if !existsNatGateway {
+		return nil
+	}
+	if !strings.EqualFold(getClusterFromPIPClusterTags(natGateway.Tags), clusterName) {
+		klog.V(4).Infof("removeNatGateway: NAT gateway %s/%s is not created for the cluster %s, skipping", az.ResourceGroup, natGatewayName, clusterName)
+		return nil
+	}
+
+	for _, subnetName := range getNatGatewaySubnetNames(natGateway.Tags).List() {
+		if err := az.removeSubnetNatGateway(subnetName, to.String(natGateway.ID)); err != nil {
+			return err
+		}
+	}
+
+	klog.V(2).Infof("removeNatGateway: deleting the NAT gateway %s/%s", az.ResourceGroup, natGatewayName)
+	if rerr := az.NatGatewaysClient.Delete(ctx, az.ResourceGroup, natGatewayName); rerr != nil {
+		klog.Errorf("NatGatewaysClient.Delete(%s, %s) failed: %s", az.ResourceGroup, natGatewayName, rerr.Error().Error())
+		return rerr.Error()
+	}
+
+	if natGateway.NatGatewayPropertiesFormat != nil && natGateway.PublicIPAddresses != nil {
+		for _, pipID := range *natGateway.PublicIPAddresses {
+			if pipName := az.getNatGatewayPIPNameFromID(natGatewayName, to.String(pipID.ID)); pipName != "" {
+				if err := az.deleteNatGatewayPublicIP(clusterName, pipName); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getNatGatewaySubnetNames returns the lower-cased names of the subnets associated by the cloud provider,
+// which are recorded in the tags of the NAT gateway.
+func getNatGatewaySubnetNames(tags map[string]*string) sets.String {
+	subnetNames := sets.NewString()
+	for _, subnetName := range strings.Split(to.String(tags[consts.NatGatewaySubnetsTagKey]), ",") {
+		if subnetName = strings.TrimSpace(subnetName); subnetName != "" {
+			subnetNames.Insert(strings.ToLower(subnetName))
+		}
+	}
+	return subnetNames
+}
+
+// deleteNatGatewayPublicIP deletes the public IP created for the NAT gateway of the cluster. The public IPs
+// not tagged with the cluster name are not deleted.
+func (az *Cloud) deleteNatGatewayPublicIP(clusterName, pipName string) error {
+	pip, existsPip, err := az.getPublicIPAddress(az.ResourceGroup, pipName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return err
+	}
+	if !existsPip {
+		return nil
+	}
+	if !strings.EqualFold(getClusterFromPIPClusterTags(pip.Tags), clusterName) {
+		klog.V(4).Infof("deleteNatGatewayPublicIP: public IP %s/%s is not created for the cluster %s, skipping", az.ResourceGroup, pipName, clusterName)
+		return nil
+	}
+
+	klog.V(2).Infof("deleteNatGatewayPublicIP: deleting the public IP %s/%s", az.ResourceGroup, pipName)
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if rerr := az.PublicIPAddressesClient.Delete(ctx, az.ResourceGroup, pipName); rerr != nil {
+		klog.Errorf("PublicIPAddressesClient.Delete(%s, %s) failed: %s", az.ResourceGroup, pipName, rerr.Error().Error())
+		return rerr.Error()
+	}
+	_ = az.pipCache.Delete(az.getPIPCacheKey(az.ResourceGroup, pipName))
+	return nil
+}
+
+// ensureNatGatewayPublicIP creates the public IP for the NAT gateway if it doesn't exist. The public IP
+// has no zones, so that it can be used by the regional NAT gateway, and it is tagged with the cluster name.
+func (az *Cloud) ensureNatGatewayPublicIP(clusterName, pipName string) (*network.PublicIPAddress, error) {
+	pip, existsPip, err := az.getPublicIPAddress(az.ResourceGroup, pipName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	if existsPip {
+		return &pip, nil
+	}
+
+	pip = network.PublicIPAddress{
+		Name:     to.StringPtr(pipName),
+		Location: to.StringPtr(az.Location),
+		Sku: &network.PublicIPAddressSku{
+			Name: network.PublicIPAddressSkuNameStandard,
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAllocationMethod: network.IPAllocationMethodStatic,
+			PublicIPAddressVersion:   network.IPVersionIPv4,
+		},
+		Tags: map[string]*string{
+			consts.ClusterNameKey: to.StringPtr(clusterName),
+		},
+	}
+	klog.V(2).Infof("ensureNatGatewayPublicIP: creating the public IP %s/%s", az.ResourceGroup, pipName)
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if rerr := az.PublicIPAddressesClient.CreateOrUpdate(ctx, az.ResourceGroup, pipName, pip); rerr != nil {
+		klog.Errorf("PublicIPAddressesClient.CreateOrUpdate(%s, %s) failed: %s", az.ResourceGroup, pipName, rerr.Error().Error())
+		return nil, rerr.Error()
+	}
+	pip, existsPip, err = az.getPublicIPAddress(az.ResourceGroup, pipName, azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return nil, err
+	}
+	if !existsPip || pip.ID == nil {
+		return nil, fmt.Errorf("ensureNatGatewayPublicIP: public IP %s/%s not found after creation", az.ResourceGroup, pipName)
+	}
+	return &pip, nil
+}
+
+// getNatGatewayPIPNameFromID returns the name of the public IP created for the NAT gateway from its ID.
+// Empty string would be returned if the public IP is not created by the cloud provider.
+func (az *Cloud) getNatGatewayPIPNameFromID(natGatewayName, pipID string) string {
+	matches := pipIDRE.FindStringSubmatch(pipID)
+	if len(matches) != 4 || !strings.EqualFold(matches[2], az.ResourceGroup) {
+		return ""
+	}
+	if !strings.HasPrefix(strings.ToLower(matches[3]), strings.ToLower(natGatewayName+"-pip-")) {
+		return ""
+	}
+	return matches[3]
+}
+
+// ensureSubnetNatGateway associates the subnet with the NAT gateway. The subnets associated with
+// other NAT gateways are not changed, and an error would be returned for them.
+func (az *Cloud) ensureSubnetNatGateway(subnetName, natGatewayID string) error {
+	subnet, existsSubnet, err := az.getSubnet(az.VnetName, subnetName)
+	if err != nil {
+		return err
+	}
+	if !existsSubnet {
+		return fmt.Errorf("ensureSubnetNatGateway: subnet %s/%s not found", az.VnetName, subnetName)
+	}
+	if subnet.SubnetPropertiesFormat == nil {
+		subnet.SubnetPropertiesFormat = &network.SubnetPropertiesFormat{}
+	}
+	if subnet.NatGateway != nil {
+		if strings.EqualFold(to.String(subnet.NatGateway.ID), natGatewayID) {
+			return nil
+		}
+		return fmt.Errorf("ensureSubnetNatGateway: subnet %s/%s is associated with another NAT gateway %s", az.VnetName, subnetName, to.String(subnet.NatGateway.ID))
+	}
+
+	vnetResourceGroup := az.ResourceGroup
+	if len(az.VnetResourceGroup) > 0 {
+		vnetResourceGroup = az.VnetResourceGroup
+	}
+	subnet.NatGateway = &network.SubResource{ID: to.StringPtr(natGatewayID)}
+	klog.V(2).Infof("ensureSubnetNatGateway: associating the subnet %s/%s with the NAT gateway %s", az.VnetName, subnetName, natGatewayID)
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if rerr := az.SubnetsClient.CreateOrUpdate(ctx, vnetResourceGroup, az.VnetName, subnetName, subnet); rerr != nil {
+		klog.Errorf("SubnetsClient.CreateOrUpdate(%s, %s, %s) failed: %s", vnetResourceGroup, az.VnetName, subnetName, rerr.Error().Error())
+		return rerr.Error()
+	}
+	return nil
+}
+
+// removeSubnetNatGateway disassociates the subnet in the cluster virtual network from the NAT gateway.
+// The subnets associated with other NAT gateways are not changed.
+func (az *Cloud) removeSubnetNatGateway(subnetName, natGatewayID string) error {
+	subnet, existsSubnet, err := az.getSubnet(az.VnetName, subnetName)
+	if err != nil {
+		return err
+	}
+	if !existsSubnet || subnet.SubnetPropertiesFormat == nil || subnet.NatGateway == nil ||
+		!strings.EqualFold(to.String(subnet.NatGateway.ID), natGatewayID) {
+		return nil
+	}
+
+	vnetResourceGroup := az.ResourceGroup
+	if len(az.VnetResourceGroup) > 0 {
+		vnetResourceGroup = az.VnetResourceGroup
+	}
+	subnet.NatGateway = nil
+	klog.V(2).Infof("removeSubnetNatGateway: disassociating the subnet %s/%s from the NAT gateway %s", az.VnetName, subnetName, natGatewayID)
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if rerr := az.SubnetsClient.CreateOrUpdate(ctx, vnetResourceGroup, az.VnetName, subnetName, subnet); rerr != nil {
+		klog.Errorf("SubnetsClient.CreateOrUpdate(%s, %s, %s) failed: %s", vnetResourceGroup, az.VnetName, subnetName, rerr.Error().Error())
+		return rerr.Error()
+	}
+	return nil
+}
+
+// equalNatGateway checks if the NAT gateway has the expected idle timeout, public IPs and public IP prefixes.
+func equalNatGateway(natGateway network.NatGateway, idleTimeoutInMinutes int32, pipIDs, pipPrefixIDs []network.SubResource) bool {
+	if natGateway.NatGatewayPropertiesFormat == nil || to.Int32(natGateway.IdleTimeoutInMinutes) != idleTimeoutInMinutes {
+		return false
+	}
+
+	toIDSet := func(subResources *[]network.SubResource) sets.String {
+		ids := sets.NewString()
+		if subResources != nil {
+			for _, subResource := range *subResources {
+				ids.Insert(strings.ToLower(to.String(subResource.ID)))
+			}
+		}
+		return ids
+	}
+	return toIDSet(natGateway.PublicIPAddresses).Equal(toIDSet(&pipIDs)) &&
+		toIDSet(natGateway.PublicIPPrefixes).Equal(toIDSet(&pipPrefixIDs))
+}
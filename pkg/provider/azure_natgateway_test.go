@@ -0,0 +1,496 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/natgatewayclient/mocknatgatewayclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestValidateOutboundTypeConfig(t *testing.T) {
+	pipPrefixID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"
+
+	testCases := []struct {
+		desc                 string
+		outboundType         string
+		loadBalancerSku      string
+		natGateway           *NatGatewayConfig
+		managedOutboundRule  *ManagedOutboundRuleConfig
+		expectedOutboundType string
+		expectedErr          string
+	}{
+		{
+			desc:                 "the outbound type should default to loadBalancer",
+			expectedOutboundType: consts.OutboundTypeLoadBalancer,
+		},
+		{
+			desc:                 "the NAT gateway should be valid without any settings",
+			outboundType:         consts.OutboundTypeNatGateway,
+			loadBalancerSku:      consts.LoadBalancerSkuStandard,
+			expectedOutboundType: consts.OutboundTypeNatGateway,
+		},
+		{
+			desc:                 "the NAT gateway with a public IP prefix should be valid",
+			outboundType:         consts.OutboundTypeNatGateway,
+			loadBalancerSku:      consts.LoadBalancerSkuStandard,
+			natGateway:           &NatGatewayConfig{OutboundIPPrefixID: pipPrefixID, IdleTimeoutInMinutes: 10},
+			expectedOutboundType: consts.OutboundTypeNatGateway,
+		},
+		{
+			desc:         "an unknown outbound type should not be supported",
+			outboundType: "userDefinedRouting",
+			expectedErr:  "outboundType userDefinedRouting is not supported",
+		},
+		{
+			desc:        "the NAT gateway should not be set with the loadBalancer outbound type",
+			natGateway:  &NatGatewayConfig{ManagedOutboundIPCount: 1},
+			expectedErr: "natGateway should only be set when outboundType is natGateway",
+		},
+		{
+			desc:                 "the name of the NAT gateway to be removed should be kept with the loadBalancer outbound type",
+			natGateway:           &NatGatewayConfig{Name: "nat-gateway"},
+			expectedOutboundType: consts.OutboundTypeLoadBalancer,
+		},
+		{
+			desc:         "the NAT gateway should only work with the standard load balancer",
+			outboundType: consts.OutboundTypeNatGateway,
+			expectedErr:  "outboundType natGateway is only supported with the standard load balancer",
+		},
+		{
+			desc:                "the NAT gateway should not be set together with the managed outbound rule",
+			outboundType:        consts.OutboundTypeNatGateway,
+			loadBalancerSku:     consts.LoadBalancerSkuStandard,
+			managedOutboundRule: &ManagedOutboundRuleConfig{ManagedOutboundIPCount: 1},
+			expectedErr:         "managedOutboundRule should not be set when outboundType is natGateway",
+		},
+		{
+			desc:            "the count and the prefix should not be set together",
+			outboundType:    consts.OutboundTypeNatGateway,
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			natGateway:      &NatGatewayConfig{ManagedOutboundIPCount: 1, OutboundIPPrefixID: pipPrefixID},
+			expectedErr:     "managedOutboundIPCount should not be set together with outboundIPPrefixID",
+		},
+		{
+			desc:            "the count should not exceed the limit",
+			outboundType:    consts.OutboundTypeNatGateway,
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			natGateway:      &NatGatewayConfig{ManagedOutboundIPCount: 17},
+			expectedErr:     "managedOutboundIPCount 17 should be between 1 and 16",
+		},
+		{
+			desc:            "the prefix ID should be valid",
+			outboundType:    consts.OutboundTypeNatGateway,
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			natGateway:      &NatGatewayConfig{OutboundIPPrefixID: "prefix1"},
+			expectedErr:     "prefix1 is not a valid public IP prefix ID",
+		},
+		{
+			desc:            "the idle timeout should be in the range",
+			outboundType:    consts.OutboundTypeNatGateway,
+			loadBalancerSku: consts.LoadBalancerSkuStandard,
+			natGateway:      &NatGatewayConfig{IdleTimeoutInMinutes: 2},
+			expectedErr:     "idleTimeoutInMinutes 2 should be between 4 and 120",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config := &Config{
+				OutboundType:        tc.outboundType,
+				LoadBalancerSku:     tc.loadBalancerSku,
+				NatGateway:          tc.natGateway,
+				ManagedOutboundRule: tc.managedOutboundRule,
+			}
+			err := validateOutboundTypeConfig(config)
+			if tc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOutboundType, config.OutboundType)
+		})
+	}
+}
+
+func TestReconcileNatGateway(t *testing.T) {
+	pipIDTemplate := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/%s"
+	pipPrefixID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix1"
+	natGatewayID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/natGateways/kubernetes-nat-gateway"
+	getNatGateway := func(idleTimeoutInMinutes int32, pipNames []string, pipPrefixIDs []string) network.NatGateway {
+		var pips, pipPrefixes []network.SubResource
+		for _, pipName := range pipNames {
+			pips = append(pips, network.SubResource{ID: to.StringPtr(fmt.Sprintf(pipIDTemplate, pipName))})
+		}
+		for _, pipPrefixID := range pipPrefixIDs {
+			pipPrefixes = append(pipPrefixes, network.SubResource{ID: to.StringPtr(pipPrefixID)})
+		}
+		return network.NatGateway{
+			ID:   to.StringPtr(natGatewayID),
+			Name: to.StringPtr("kubernetes-nat-gateway"),
+			NatGatewayPropertiesFormat: &network.NatGatewayPropertiesFormat{
+				IdleTimeoutInMinutes: to.Int32Ptr(idleTimeoutInMinutes),
+				PublicIPAddresses:    &pips,
+				PublicIPPrefixes:     &pipPrefixes,
+			},
+			Tags: map[string]*string{
+				consts.ClusterNameKey:          to.StringPtr(testClusterName),
+				consts.NatGatewaySubnetsTagKey: to.StringPtr("subnet"),
+			},
+		}
+	}
+
+	testCases := []struct {
+		desc                 string
+		natGatewayConfig     *NatGatewayConfig
+		existingNatGateway   *network.NatGateway
+		existingPIPs         []string
+		subnetNatGatewayID   *string
+		skipSubnet           bool
+		expectedPIPsToCreate []string
+		expectedNatGateway   *network.NatGateway
+		expectedPIPsToDelete []string
+		expectSubnetUpdate   bool
+		expectedErr          string
+	}{
+		{
+			desc:                 "the NAT gateway with a managed public IP should be created and associated with the subnet",
+			expectedPIPsToCreate: []string{"kubernetes-nat-gateway-pip-0"},
+			expectedNatGateway: func() *network.NatGateway {
+				n := getNatGateway(4, []string{"kubernetes-nat-gateway-pip-0"}, nil)
+				return &n
+			}(),
+			expectSubnetUpdate: true,
+		},
+		{
+			desc: "nothing should be changed if the NAT gateway is up to date",
+			existingNatGateway: func() *network.NatGateway {
+				n := getNatGateway(4, []string{"kubernetes-nat-gateway-pip-0"}, nil)
+				return &n
+			}(),
+			existingPIPs:       []string{"kubernetes-nat-gateway-pip-0"},
+			subnetNatGatewayID: to.StringPtr(natGatewayID),
+		},
+		{
+			desc:             "the managed public IPs should be replaced by the public IP prefix",
+			natGatewayConfig: &NatGatewayConfig{OutboundIPPrefixID: pipPrefixID, IdleTimeoutInMinutes: 10},
+			existingNatGateway: func() *network.NatGateway {
+				n := getNatGateway(4, []string{"kubernetes-nat-gateway-pip-0", "pip1"}, nil)
+				return &n
+			}(),
+			subnetNatGatewayID:   to.StringPtr(natGatewayID),
+			expectedNatGateway:   func() *network.NatGateway { n := getNatGateway(10, nil, []string{pipPrefixID}); return &n }(),
+			expectedPIPsToDelete: []string{"kubernetes-nat-gateway-pip-0"},
+		},
+		{
+			desc: "an error should be returned if the NAT gateway is created for another cluster",
+			existingNatGateway: func() *network.NatGateway {
+				n := getNatGateway(4, []string{"kubernetes-nat-gateway-pip-0"}, nil)
+				n.Tags[consts.ClusterNameKey] = to.StringPtr("other")
+				return &n
+			}(),
+			skipSubnet:  true,
+			expectedErr: "NAT gateway rg/kubernetes-nat-gateway is created for another cluster other",
+		},
+		{
+			desc: "the NAT gateway not created by the cloud provider should be tagged",
+			existingNatGateway: func() *network.NatGateway {
+				n := getNatGateway(4, []string{"kubernetes-nat-gateway-pip-0"}, nil)
+				n.Tags = nil
+				return &n
+			}(),
+			existingPIPs:       []string{"kubernetes-nat-gateway-pip-0"},
+			subnetNatGatewayID: to.StringPtr(natGatewayID),
+			expectedNatGateway: func() *network.NatGateway {
+				n := getNatGateway(4, []string{"kubernetes-nat-gateway-pip-0"}, nil)
+				return &n
+			}(),
+		},
+		{
+			desc: "an error should be returned if the subnet is associated with another NAT gateway",
+			existingNatGateway: func() *network.NatGateway {
+				n := getNatGateway(4, []string{"kubernetes-nat-gateway-pip-0"}, nil)
+				return &n
+			}(),
+			existingPIPs:       []string{"kubernetes-nat-gateway-pip-0"},
+			subnetNatGatewayID: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/natGateways/other"),
+			expectedErr:        "subnet vnet/subnet is associated with another NAT gateway",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			az.OutboundType = consts.OutboundTypeNatGateway
+			az.NatGateway = tc.natGatewayConfig
+
+			mockNatGatewaysClient := az.NatGatewaysClient.(*mocknatgatewayclient.MockInterface)
+			if tc.existingNatGateway != nil {
+				mockNatGatewaysClient.EXPECT().Get(gomock.Any(), "rg", "kubernetes-nat-gateway", gomock.Any()).Return(*tc.existingNatGateway, nil)
+			} else {
+				mockNatGatewaysClient.EXPECT().Get(gomock.Any(), "rg", "kubernetes-nat-gateway", gomock.Any()).Return(network.NatGateway{}, &retry.Error{HTTPStatusCode: 404}).Times(1)
+			}
+			if tc.expectedNatGateway != nil {
+				mockNatGatewaysClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "kubernetes-nat-gateway", gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, resourceGroupName, natGatewayName string, parameters network.NatGateway, etag string) *retry.Error {
+						assert.Equal(t, network.NatGatewaySkuNameStandard, parameters.Sku.Name)
+						assert.Equal(t, testClusterName, to.String(parameters.Tags[consts.ClusterNameKey]))
+						assert.Equal(t, "subnet", to.String(parameters.Tags[consts.NatGatewaySubnetsTagKey]))
+						assert.True(t, equalNatGateway(parameters, to.Int32(tc.expectedNatGateway.IdleTimeoutInMinutes), *tc.expectedNatGateway.PublicIPAddresses, *tc.expectedNatGateway.PublicIPPrefixes))
+						return nil
+					}).Times(1)
+				mockNatGatewaysClient.EXPECT().Get(gomock.Any(), "rg", "kubernetes-nat-gateway", gomock.Any()).Return(*tc.expectedNatGateway, nil)
+			}
+
+			mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+			for _, pipName := range tc.existingPIPs {
+				mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(network.PublicIPAddress{
+					Name: to.StringPtr(pipName),
+					ID:   to.StringPtr(fmt.Sprintf(pipIDTemplate, pipName)),
+				}, nil)
+			}
+			for _, pipName := range tc.expectedPIPsToCreate {
+				first := mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: 404})
+				mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", pipName, gomock.Any()).
+					DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, publicIPAddressParameters network.PublicIPAddress) *retry.Error {
+						assert.Equal(t, network.PublicIPAddressSkuNameStandard, publicIPAddressParameters.Sku.Name)
+						assert.Nil(t, publicIPAddressParameters.Zones)
+						assert.Equal(t, testClusterName, to.String(publicIPAddressParameters.Tags[consts.ClusterNameKey]))
+						return nil
+					}).Times(1)
+				mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(network.PublicIPAddress{
+					Name: to.StringPtr(pipName),
+					ID:   to.StringPtr(fmt.Sprintf(pipIDTemplate, pipName)),
+				}, nil).After(first)
+			}
+			for _, pipName := range tc.expectedPIPsToDelete {
+				mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", pipName, gomock.Any()).Return(network.PublicIPAddress{
+					Name: to.StringPtr(pipName),
+					Tags: map[string]*string{consts.ClusterNameKey: to.StringPtr(testClusterName)},
+				}, nil)
+				mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", pipName).Return(nil).Times(1)
+			}
+
+			mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+			subnet := network.Subnet{
+				Name:                   to.StringPtr("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{},
+			}
+			if tc.subnetNatGatewayID != nil {
+				subnet.NatGateway = &network.SubResource{ID: tc.subnetNatGatewayID}
+			}
+			if !tc.skipSubnet {
+				mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).Return(subnet, nil).Times(1)
+			}
+			if tc.expectSubnetUpdate {
+				mockSubnetsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).
+					DoAndReturn(func(ctx context.Context, resourceGroupName, virtualNetworkName, subnetName string, subnetParameters network.Subnet) *retry.Error {
+						assert.Equal(t, natGatewayID, to.String(subnetParameters.NatGateway.ID))
+						return nil
+					}).Times(1)
+			}
+
+			err := az.reconcileNatGateway(testClusterName)
+			if tc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestReconcileNatGatewayRemovesSubnets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.OutboundType = consts.OutboundTypeNatGateway
+	natGatewayID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/natGateways/kubernetes-nat-gateway"
+	pipID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/kubernetes-nat-gateway-pip-0"
+	natGateway := network.NatGateway{
+		ID:   to.StringPtr(natGatewayID),
+		Name: to.StringPtr("kubernetes-nat-gateway"),
+		NatGatewayPropertiesFormat: &network.NatGatewayPropertiesFormat{
+			IdleTimeoutInMinutes: to.Int32Ptr(4),
+			PublicIPAddresses:    &[]network.SubResource{{ID: to.StringPtr(pipID)}},
+			PublicIPPrefixes:     &[]network.SubResource{},
+		},
+		Tags: map[string]*string{
+			consts.ClusterNameKey:          to.StringPtr(testClusterName),
+			consts.NatGatewaySubnetsTagKey: to.StringPtr("subnet,subnet2"),
+		},
+	}
+
+	mockNatGatewaysClient := az.NatGatewaysClient.(*mocknatgatewayclient.MockInterface)
+	mockNatGatewaysClient.EXPECT().Get(gomock.Any(), "rg", "kubernetes-nat-gateway", gomock.Any()).Return(natGateway, nil).Times(2)
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "kubernetes-nat-gateway-pip-0", gomock.Any()).Return(network.PublicIPAddress{
+		Name: to.StringPtr("kubernetes-nat-gateway-pip-0"),
+		ID:   to.StringPtr(pipID),
+	}, nil)
+
+	// the subnet removed from the config is disassociated from the NAT gateway before it is removed from the tags,
+	// and the subnets associated out of band are not changed
+	natGatewaySubnet := func(name string) network.Subnet {
+		return network.Subnet{
+			Name: to.StringPtr(name),
+			SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+				NatGateway: &network.SubResource{ID: to.StringPtr(natGatewayID)},
+			},
+		}
+	}
+	mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet2", gomock.Any()).Return(natGatewaySubnet("subnet2"), nil)
+	subnetUpdate := mockSubnetsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "vnet", "subnet2", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, resourceGroupName, virtualNetworkName, subnetName string, subnetParameters network.Subnet) *retry.Error {
+			assert.Nil(t, subnetParameters.NatGateway)
+			return nil
+		}).Times(1)
+	mockNatGatewaysClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "kubernetes-nat-gateway", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, resourceGroupName, natGatewayName string, parameters network.NatGateway, etag string) *retry.Error {
+			assert.Equal(t, "subnet", to.String(parameters.Tags[consts.NatGatewaySubnetsTagKey]))
+			return nil
+		}).After(subnetUpdate)
+	mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).Return(natGatewaySubnet("subnet"), nil)
+
+	assert.NoError(t, az.reconcileNatGateway(testClusterName))
+}
+
+func TestRemoveNatGateway(t *testing.T) {
+	natGatewayID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/natGateways/nat-gateway"
+	pipIDTemplate := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/%s"
+
+	for _, tc := range []struct {
+		desc             string
+		existsNatGateway bool
+		clusterName      *string
+		expectRemoval    bool
+	}{
+		{
+			desc: "nothing should be done if the NAT gateway doesn't exist",
+		},
+		{
+			desc:             "the NAT gateway without the cluster tag should not be changed",
+			existsNatGateway: true,
+		},
+		{
+			desc:             "the NAT gateway created for another cluster should not be changed",
+			existsNatGateway: true,
+			clusterName:      to.StringPtr("other"),
+		},
+		{
+			desc:             "the NAT gateway should be removed together with its subnet associations and managed public IPs",
+			existsNatGateway: true,
+			clusterName:      to.StringPtr(testClusterName),
+			expectRemoval:    true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			az.OutboundType = consts.OutboundTypeLoadBalancer
+			az.NatGateway = &NatGatewayConfig{Name: "nat-gateway"}
+
+			mockNatGatewaysClient := az.NatGatewaysClient.(*mocknatgatewayclient.MockInterface)
+			if !tc.existsNatGateway {
+				mockNatGatewaysClient.EXPECT().Get(gomock.Any(), "rg", "nat-gateway", gomock.Any()).Return(network.NatGateway{}, &retry.Error{HTTPStatusCode: 404})
+				assert.NoError(t, az.removeNatGateway(testClusterName))
+				return
+			}
+
+			natGateway := network.NatGateway{
+				ID:   to.StringPtr(natGatewayID),
+				Name: to.StringPtr("nat-gateway"),
+				NatGatewayPropertiesFormat: &network.NatGatewayPropertiesFormat{
+					PublicIPAddresses: &[]network.SubResource{
+						{ID: to.StringPtr(fmt.Sprintf(pipIDTemplate, "nat-gateway-pip-0"))},
+						{ID: to.StringPtr(fmt.Sprintf(pipIDTemplate, "nat-gateway-pip-1"))},
+						{ID: to.StringPtr(fmt.Sprintf(pipIDTemplate, "pip1"))},
+					},
+				},
+				Tags: map[string]*string{consts.NatGatewaySubnetsTagKey: to.StringPtr("subnet")},
+			}
+			if tc.clusterName != nil {
+				natGateway.Tags[consts.ClusterNameKey] = tc.clusterName
+			}
+			mockNatGatewaysClient.EXPECT().Get(gomock.Any(), "rg", "nat-gateway", gomock.Any()).Return(natGateway, nil)
+			if tc.expectRemoval {
+				mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+				mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).Return(network.Subnet{
+					Name: to.StringPtr("subnet"),
+					SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+						NatGateway: &network.SubResource{ID: to.StringPtr(natGatewayID)},
+					},
+				}, nil)
+				subnetUpdate := mockSubnetsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).
+					DoAndReturn(func(ctx context.Context, resourceGroupName, virtualNetworkName, subnetName string, subnetParameters network.Subnet) *retry.Error {
+						assert.Nil(t, subnetParameters.NatGateway)
+						return nil
+					}).Times(1)
+				natGatewayDeletion := mockNatGatewaysClient.EXPECT().Delete(gomock.Any(), "rg", "nat-gateway").Return(nil).After(subnetUpdate)
+
+				// only the public IPs created for the NAT gateway of the cluster are deleted
+				mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+				mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "nat-gateway-pip-0", gomock.Any()).Return(network.PublicIPAddress{
+					Name: to.StringPtr("nat-gateway-pip-0"),
+					Tags: map[string]*string{consts.ClusterNameKey: to.StringPtr(testClusterName)},
+				}, nil)
+				mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", "nat-gateway-pip-0").Return(nil).After(natGatewayDeletion)
+				mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "nat-gateway-pip-1", gomock.Any()).Return(network.PublicIPAddress{
+					Name: to.StringPtr("nat-gateway-pip-1"),
+				}, nil)
+			}
+
+			assert.NoError(t, az.removeNatGateway(testClusterName))
+		})
+	}
+}
+
+func TestShouldReconcileNatGateway(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	assert.False(t, az.ShouldReconcileNatGateway())
+	az.NatGateway = &NatGatewayConfig{}
+	assert.True(t, az.ShouldReconcileNatGateway())
+	az.NatGateway = nil
+	az.OutboundType = consts.OutboundTypeNatGateway
+	assert.True(t, az.ShouldReconcileNatGateway())
+}
@@ -0,0 +1,699 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+const (
+	// OrphanedResourceGCControllerName is the name of the controller deleting the orphaned load balancer resources.
+	OrphanedResourceGCControllerName = "orphaned-resource-gc"
+
+	orphanedResourceTypeFrontendIPConfiguration = "frontendIPConfigurations"
+	orphanedResourceTypeLoadBalancingRule       = "loadBalancingRules"
+	orphanedResourceTypeProbe                   = "probes"
+	orphanedResourceTypeSecurityRule            = "securityRules"
+)
+
+var (
+	// serviceResourcePrefixRE matches the names of the frontend IP configurations and rules created for the services,
+	// which are prefixed with "a" and the first 31 hexadecimal digits of the service UID.
+	serviceResourcePrefixRE = regexp.MustCompile(`(?i)^a[0-9a-f]{31}`)
+
+	// serviceCleanupTagAnnotations are the annotations required to clean up the services, keyed by the tags recording
+	// them on the public IPs and private link services owned by the services.
+	serviceCleanupTagAnnotations = map[string]string{
+		consts.DNSZoneIDTagKey:                consts.ServiceAnnotationDNSZoneID,
+		consts.DNSRecordNameTagKey:            consts.ServiceAnnotationDNSRecordName,
+		consts.PrivateDNSZoneIDTagKey:         consts.ServiceAnnotationPrivateDNSZoneID,
+		consts.CrossRegionBackendPoolIDTagKey: consts.ServiceAnnotationCrossRegionBackendPoolID,
+		consts.PIPRetainOnDeleteTagKey:        consts.ServiceAnnotationPIPRetainOnDelete,
+	}
+
+	orphanedResourceTypes = []string{
+		planResourceTypeLoadBalancer,
+		orphanedResourceTypeFrontendIPConfiguration,
+		orphanedResourceTypeLoadBalancingRule,
+		orphanedResourceTypeProbe,
+		planResourceTypePublicIPAddress,
+		orphanedResourceTypeSecurityRule,
+		planResourceTypePrivateLinkService,
+	}
+)
+
+// validateOrphanedResourceGCConfig checks the orphaned resource gc config in the cloud config.
+func validateOrphanedResourceGCConfig(config *Config) error {
+	if config.OrphanedResourceGC == nil {
+		return nil
+	}
+	if config.OrphanedResourceGC.IntervalInSeconds < 0 {
+		return fmt.Errorf("orphanedResourceGC.intervalInSeconds %d should not be negative", config.OrphanedResourceGC.IntervalInSeconds)
+	}
+	if config.OrphanedResourceGC.GracePeriodInSeconds < 0 {
+		return fmt.Errorf("orphanedResourceGC.gracePeriodInSeconds %d should not be negative", config.OrphanedResourceGC.GracePeriodInSeconds)
+	}
+	return nil
+}
+
+// OrphanedResourceGC finds the load balancer resources left in Azure by the deleted services, which happens if a
+// service is deleted while the cloud controller manager is down or the deletion fails. The orphaned resources are
+// reported by the events and metrics, and deleted if they stay orphaned for longer than the grace period.
+type OrphanedResourceGC struct {
+	cloud         *Cloud
+	clusterName   string
+	serviceLister corelisters.ServiceLister
+	nodeLister    corelisters.NodeLister
+	cacheSynced   []cache.InformerSynced
+	interval      time.Duration
+	gracePeriod   time.Duration
+	dryRun        bool
+
+	// firstSeen records when the orphaned resources were found for the first time, keyed by orphanedResources.key.
+	firstSeen map[string]time.Time
+	now       func() time.Time
+}
+
+// NewOrphanedResourceGC creates the OrphanedResourceGC from the orphaned resource gc config of the cloud.
+func NewOrphanedResourceGC(az *Cloud, clusterName string, serviceInformer coreinformers.ServiceInformer, nodeInformer coreinformers.NodeInformer) *OrphanedResourceGC {
+	gc := &OrphanedResourceGC{
+		cloud:         az,
+		clusterName:   clusterName,
+		serviceLister: serviceInformer.Lister(),
+		nodeLister:    nodeInformer.Lister(),
+		cacheSynced:   []cache.InformerSynced{serviceInformer.Informer().HasSynced, nodeInformer.Informer().HasSynced},
+		interval:      consts.DefaultOrphanedResourceGCInterval,
+		gracePeriod:   consts.DefaultOrphanedResourceGCGracePeriod,
+		firstSeen:     make(map[string]time.Time),
+		now:           time.Now,
+	}
+
+	if config := az.OrphanedResourceGC; config != nil {
+		if config.IntervalInSeconds > 0 {
+			gc.interval = time.Duration(config.IntervalInSeconds) * time.Second
+		}
+		if config.GracePeriodInSeconds > 0 {
+			gc.gracePeriod = time.Duration(config.GracePeriodInSeconds) * time.Second
+		}
+		gc.dryRun = config.DryRun
+	}
+	return gc
+}
+
+// Run collects the orphaned resources periodically until the context is done.
+func (gc *OrphanedResourceGC) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+
+	klog.Infof("Starting %s controller, interval: %v, grace period: %v, dry run: %t", OrphanedResourceGCControllerName, gc.interval, gc.gracePeriod, gc.dryRun)
+	defer klog.Infof("Shutting down %s controller", OrphanedResourceGCControllerName)
+
+	if !cache.WaitForNamedCacheSync(OrphanedResourceGCControllerName, ctx.Done(), gc.cacheSynced...) {
+		return
+	}
+
+	wait.UntilWithContext(ctx, gc.collect, gc.interval)
+}
+
+// orphanedResources are the resources left in Azure by a deleted service, or a load balancer
+// without any frontend IP configuration, or a public IP of the deleted services which is not in use.
+type orphanedResources struct {
+	// key identifies the orphaned resources across the collections.
+	key string
+	// service stands for the deleted service, and it owns the orphaned resources in the same way as the deleted one.
+	service *v1.Service
+	// resources are the names of the orphaned resources keyed by their types.
+	resources map[string][]string
+	// loadBalancer is set if the orphaned resource is a load balancer without any frontend IP configuration.
+	loadBalancer *network.LoadBalancer
+	// publicIP is set if the orphaned resource is a public IP of the deleted services which is not in use.
+	publicIP *network.PublicIPAddress
+	// ipFamilies are the IP families of the orphaned resources keyed by isIPv6, and the value is true if the family
+	// is known to be the primary one of the deleted service, whose resources are named without the IP family suffix.
+	ipFamilies map[bool]bool
+}
+
+func (o *orphanedResources) add(resourceType, name string) {
+	o.resources[resourceType] = append(o.resources[resourceType], name)
+}
+
+func (o *orphanedResources) String() string {
+	var result []string
+	for _, resourceType := range orphanedResourceTypes {
+		for _, name := range o.resources[resourceType] {
+			result = append(result, fmt.Sprintf("%s/%s", resourceType, name))
+		}
+	}
+	return strings.Join(result, ", ")
+}
+
+// setServiceName sets the name of the deleted service from the tags of its resources if it is unknown.
+func (o *orphanedResources) setServiceName(serviceName string) {
+	if o.service.Namespace != "" {
+		return
+	}
+	parts := strings.SplitN(serviceName, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return
+	}
+	o.service.Namespace, o.service.Name = parts[0], parts[1]
+}
+
+// addIPFamily records the IP family of the orphaned resources.
+func (o *orphanedResources) addIPFamily(isIPv6, isPrimary bool) {
+	if o.ipFamilies == nil {
+		o.ipFamilies = make(map[bool]bool)
+	}
+	o.ipFamilies[isIPv6] = o.ipFamilies[isIPv6] || isPrimary
+}
+
+// addIPFamilyOfName records the IP families from the name of the frontend IP configuration or rule, which is suffixed
+// with the secondary IP family of the dual-stack service. It returns false if the name has no IP family suffix.
+func (o *orphanedResources) addIPFamilyOfName(name string) bool {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, strings.ToLower("-"+consts.IPVersionIPv6String)):
+		o.addIPFamily(true, false)
+		o.addIPFamily(false, true)
+	case strings.HasSuffix(name, strings.ToLower("-"+consts.IPVersionIPv4String)):
+		o.addIPFamily(false, false)
+		o.addIPFamily(true, true)
+	default:
+		return false
+	}
+	return true
+}
+
+// setIPFamilies sets the IP families of the deleted service, so that the resources of both families of the
+// dual-stack service are cleaned up. The primary family is IPv4 unless it is known to be IPv6.
+func (o *orphanedResources) setIPFamilies() {
+	if len(o.ipFamilies) == 0 {
+		return
+	}
+	_, hasIPv4 := o.ipFamilies[false]
+	_, hasIPv6 := o.ipFamilies[true]
+	isPrimaryIPv6 := !o.ipFamilies[false] && (o.ipFamilies[true] || !hasIPv4)
+	families := map[bool]v1.IPFamily{false: v1.IPv4Protocol, true: v1.IPv6Protocol}
+	o.service.Spec.IPFamilies = []v1.IPFamily{families[isPrimaryIPv6]}
+	if hasIPv4 && hasIPv6 {
+		o.service.Spec.IPFamilies = append(o.service.Spec.IPFamilies, families[!isPrimaryIPv6])
+		policy := v1.IPFamilyPolicyRequireDualStack
+		o.service.Spec.IPFamilyPolicy = &policy
+	}
+}
+
+// setCleanupAnnotations restores the annotations required to clean up the deleted service from the tags of its
+// public IP or private link service.
+func (o *orphanedResources) setCleanupAnnotations(tags map[string]*string) {
+	for tagKey, annotation := range serviceCleanupTagAnnotations {
+		found, key := findKeyInMapCaseInsensitive(tags, tagKey)
+		if !found || to.String(tags[key]) == "" {
+			continue
+		}
+		if o.service.Annotations == nil {
+			o.service.Annotations = make(map[string]string)
+		}
+		if _, found := o.service.Annotations[annotation]; !found {
+			o.service.Annotations[annotation] = to.String(tags[key])
+		}
+	}
+}
+
+// addServiceCleanupTags adds the tags recording the annotations required to clean up the service to the tags to be
+// reconciled if the resource is owned by the service alone, and deletes the ones of the annotations removed from the
+// service from the current tags. The tags of the resources shared by multiple services are kept as they are. It
+// returns true if any of the current tags is deleted.
+func addServiceCleanupTags(service *v1.Service, ownedAlone bool, currentTags, configTags map[string]*string) bool {
+	deleted := false
+	for tagKey, annotation := range serviceCleanupTagAnnotations {
+		found, key := findKeyInMapCaseInsensitive(currentTags, tagKey)
+		if !ownedAlone {
+			if found {
+				configTags[key] = currentTags[key]
+			}
+			continue
+		}
+		if value := strings.TrimSpace(service.Annotations[annotation]); value != "" {
+			configTags[tagKey] = to.StringPtr(value)
+		} else if found {
+			delete(currentTags, key)
+			deleted = true
+		}
+	}
+	return deleted
+}
+
+// getServiceResourcePrefix returns the service UID based prefix of the name of the frontend IP configuration or rule.
+func getServiceResourcePrefix(name string) (string, bool) {
+	prefix := serviceResourcePrefixRE.FindString(name)
+	return strings.ToLower(prefix), prefix != ""
+}
+
+// newOrphanedServiceStub returns a service which owns the frontend IP configurations and rules with the prefix.
+// Its name is the prefix until it is known from the tags of the public IPs or private link services, and its IP
+// families and the annotations required to clean it up are restored from the orphaned resources found later.
+func newOrphanedServiceStub(prefix string, isInternal bool) *v1.Service {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: prefix,
+			// the rule prefix of the service is "a" followed by the UID without dashes truncated to 32 characters
+			UID: types.UID(strings.TrimPrefix(prefix, "a")),
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+		},
+	}
+	if isInternal {
+		service.Annotations = map[string]string{consts.ServiceAnnotationLoadBalancerInternal: consts.TrueAnnotationValue}
+	}
+	return service
+}
+
+// collect finds the orphaned resources, reports them and deletes the ones orphaned for longer than the grace period.
+func (gc *OrphanedResourceGC) collect(ctx context.Context) {
+	orphans, err := gc.findOrphanedResources(ctx)
+	if err != nil {
+		klog.Errorf("%s: failed to find the orphaned resources: %v", OrphanedResourceGCControllerName, err)
+		return
+	}
+
+	now := gc.now()
+	firstSeen := make(map[string]time.Time)
+	counts := make(map[string]int)
+	for _, orphan := range orphans {
+		seen, found := gc.firstSeen[orphan.key]
+		if !found {
+			seen = now
+		}
+		firstSeen[orphan.key] = seen
+		for resourceType, names := range orphan.resources {
+			counts[resourceType] += len(names)
+		}
+
+		message := fmt.Sprintf("found orphaned resources of the deleted service %s since %s: %s", getServiceName(orphan.service), seen.Format(time.RFC3339), orphan)
+		klog.Warningf("%s: %s", OrphanedResourceGCControllerName, message)
+		gc.event(orphan, v1.EventTypeWarning, "OrphanedResources", message)
+
+		if gc.dryRun || now.Sub(seen) < gc.gracePeriod {
+			continue
+		}
+		if err := gc.deleteOrphanedResources(ctx, orphan); err != nil {
+			message = fmt.Sprintf("failed to delete orphaned resources %s: %v", orphan, err)
+			klog.Errorf("%s: %s", OrphanedResourceGCControllerName, message)
+			gc.event(orphan, v1.EventTypeWarning, "DeleteOrphanedResourcesFailed", message)
+			continue
+		}
+
+		message = fmt.Sprintf("deleted orphaned resources %s", orphan)
+		klog.Infof("%s: %s", OrphanedResourceGCControllerName, message)
+		gc.event(orphan, v1.EventTypeNormal, "DeletedOrphanedResources", message)
+		for resourceType, names := range orphan.resources {
+			metrics.CountDeletedOrphanedResources(resourceType, len(names))
+		}
+		delete(firstSeen, orphan.key)
+	}
+	gc.firstSeen = firstSeen
+
+	for _, resourceType := range orphanedResourceTypes {
+		metrics.SetOrphanedResourceCount(resourceType, counts[resourceType])
+	}
+}
+
+// event records the event on the deleted service if its name is known.
+func (gc *OrphanedResourceGC) event(orphan *orphanedResources, eventType, reason, message string) {
+	if orphan.service.Namespace == "" {
+		return
+	}
+	gc.cloud.Event(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      orphan.service.Name,
+			Namespace: orphan.service.Namespace,
+		},
+	}, eventType, reason, message)
+}
+
+// deleteOrphanedResources deletes the orphaned resources in the same way as the deletion of the services does.
+func (gc *OrphanedResourceGC) deleteOrphanedResources(ctx context.Context, orphan *orphanedResources) error {
+	switch {
+	case orphan.loadBalancer != nil:
+		vmSetName := gc.cloud.mapLoadBalancerNameToVMSet(to.String(orphan.loadBalancer.Name), gc.clusterName)
+		if rerr := gc.cloud.safeDeleteLoadBalancer(*orphan.loadBalancer, gc.clusterName, vmSetName, orphan.service); rerr != nil {
+			return rerr.Error()
+		}
+		return nil
+	case orphan.publicIP != nil:
+		if gc.cloud.shouldRetainPublicIP(orphan.service) {
+			pip := *orphan.publicIP
+			serviceTag := getServiceFromPIPServiceTags(pip.Tags)
+			if _, err := bindServicesToPIP(&pip, nil, true); err != nil {
+				return err
+			}
+			retainPublicIP(&pip, serviceTag, gc.clusterName)
+			return gc.cloud.CreateOrUpdatePIP(orphan.service, gc.cloud.getPublicIPAddressResourceGroup(orphan.service), pip)
+		}
+		return gc.cloud.safeDeletePublicIP(orphan.service, gc.cloud.getPublicIPAddressResourceGroup(orphan.service), orphan.publicIP, nil)
+	default:
+		return gc.cloud.EnsureLoadBalancerDeleted(ctx, gc.clusterName, orphan.service)
+	}
+}
+
+// findOrphanedResources returns the resources of the cluster which are not owned by any existing LoadBalancer service.
+func (gc *OrphanedResourceGC) findOrphanedResources(ctx context.Context) ([]*orphanedResources, error) {
+	services, err := gc.serviceLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	livePrefixes, liveNames := sets.NewString(), sets.NewString()
+	// the public IPs are listed in the resource groups of the cluster, the services, the load balancer classes
+	// and the public IPs of the frontend IP configurations
+	pipResourceGroups := sets.NewString(strings.ToLower(gc.cloud.ResourceGroup))
+	for _, loadBalancerClass := range gc.cloud.LoadBalancerClasses {
+		if loadBalancerClass.PublicIPResourceGroup != "" {
+			pipResourceGroups.Insert(strings.ToLower(loadBalancerClass.PublicIPResourceGroup))
+		}
+	}
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		service, shouldHandle := gc.cloud.applyServiceLoadBalancerClass(service)
+		if !shouldHandle {
+			continue
+		}
+		livePrefixes.Insert(strings.ToLower(gc.cloud.getRulePrefix(service)))
+		liveNames.Insert(strings.ToLower(getServiceName(service)))
+		pipResourceGroups.Insert(strings.ToLower(gc.cloud.getPublicIPAddressResourceGroup(service)))
+	}
+	isOrphaned := func(name string) (string, bool) {
+		prefix, found := getServiceResourcePrefix(name)
+		return prefix, found && !livePrefixes.Has(prefix)
+	}
+
+	var result []*orphanedResources
+	orphans := make(map[string]*orphanedResources)
+	getOrphan := func(key string, newService func() *v1.Service) *orphanedResources {
+		if orphan, found := orphans[key]; found {
+			return orphan
+		}
+		orphan := &orphanedResources{key: key, service: newService(), resources: make(map[string][]string)}
+		orphans[key] = orphan
+		result = append(result, orphan)
+		return orphan
+	}
+	getServiceOrphan := func(prefix string, isInternal bool) *orphanedResources {
+		return getOrphan(prefix, func() *v1.Service {
+			service := newOrphanedServiceStub(prefix, isInternal)
+			// the private IPs allocated from the pools are released by the UID of the deleted service
+			if uid, found := gc.cloud.privateIPPoolAllocator.getServiceUID(prefix); found {
+				service.UID = uid
+			}
+			return service
+		})
+	}
+
+	// the orphaned services owning the frontend IP configurations, keyed by the IDs of the configurations and their public IPs
+	fipOwners := make(map[string]*orphanedResources)
+	pipOwners := make(map[string]*orphanedResources)
+	// the public IPs of the frontend IP configurations named without the IP family suffix, which are of the primary
+	// IP family of the deleted services
+	primaryPIPIDs := sets.NewString()
+
+	lbs, err := gc.listManagedLoadBalancers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range lbs {
+		lb := lbs[i]
+		lbName := to.String(lb.Name)
+		isInternal := isInternalLoadBalancer(&lb)
+		if lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil || len(*lb.FrontendIPConfigurations) == 0 {
+			orphan := getOrphan(fmt.Sprintf("%s/%s", planResourceTypeLoadBalancer, strings.ToLower(lbName)), func() *v1.Service {
+				return &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: lbName}}
+			})
+			orphan.loadBalancer = &lb
+			orphan.add(planResourceTypeLoadBalancer, lbName)
+			continue
+		}
+
+		for _, fip := range *lb.FrontendIPConfigurations {
+			if fip.FrontendIPConfigurationPropertiesFormat != nil && fip.PublicIPAddress != nil {
+				if resourceGroup := getResourceGroupFromID(to.String(fip.PublicIPAddress.ID)); resourceGroup != "" {
+					pipResourceGroups.Insert(strings.ToLower(resourceGroup))
+				}
+			}
+			prefix, orphaned := isOrphaned(to.String(fip.Name))
+			if !orphaned || gc.isFrontendIPConfigInUse(fip, livePrefixes) {
+				continue
+			}
+			orphan := getServiceOrphan(prefix, isInternal)
+			orphan.add(orphanedResourceTypeFrontendIPConfiguration, fmt.Sprintf("%s/%s", lbName, to.String(fip.Name)))
+			fipOwners[strings.ToLower(to.String(fip.ID))] = orphan
+			isPrimary := !orphan.addIPFamilyOfName(to.String(fip.Name))
+			if isPrimary && isInternal && fip.FrontendIPConfigurationPropertiesFormat != nil && fip.PrivateIPAddressVersion != "" {
+				orphan.addIPFamily(fip.PrivateIPAddressVersion == network.IPVersionIPv6, true)
+			}
+			if fip.FrontendIPConfigurationPropertiesFormat != nil && fip.PublicIPAddress != nil && fip.PublicIPAddress.ID != nil {
+				pipOwners[strings.ToLower(to.String(fip.PublicIPAddress.ID))] = orphan
+				if isPrimary {
+					primaryPIPIDs.Insert(strings.ToLower(to.String(fip.PublicIPAddress.ID)))
+				}
+			}
+		}
+		if lb.LoadBalancingRules != nil {
+			for _, rule := range *lb.LoadBalancingRules {
+				if prefix, orphaned := isOrphaned(to.String(rule.Name)); orphaned {
+					orphan := getServiceOrphan(prefix, isInternal)
+					orphan.add(orphanedResourceTypeLoadBalancingRule, fmt.Sprintf("%s/%s", lbName, to.String(rule.Name)))
+					orphan.addIPFamilyOfName(to.String(rule.Name))
+				}
+			}
+		}
+		if lb.Probes != nil {
+			for _, probe := range *lb.Probes {
+				if prefix, orphaned := isOrphaned(to.String(probe.Name)); orphaned {
+					orphan := getServiceOrphan(prefix, isInternal)
+					orphan.add(orphanedResourceTypeProbe, fmt.Sprintf("%s/%s", lbName, to.String(probe.Name)))
+					orphan.addIPFamilyOfName(to.String(probe.Name))
+				}
+			}
+		}
+		// the backend pools of the podIP backend pool type are named after the services, and the IPv6 ones are
+		// always suffixed with the IP family
+		if lb.BackendAddressPools != nil {
+			for _, backendPool := range *lb.BackendAddressPools {
+				if prefix, orphaned := isOrphaned(to.String(backendPool.Name)); orphaned {
+					if orphan, found := orphans[prefix]; found {
+						orphan.addIPFamily(isBackendPoolIPv6(to.String(backendPool.Name)), false)
+					}
+				}
+			}
+		}
+	}
+
+	sg, rerr := gc.cloud.SecurityGroupsClient.Get(ctx, gc.cloud.SecurityGroupResourceGroup, gc.cloud.SecurityGroupName, "")
+	exists, rerr := checkResourceExistsFromError(rerr)
+	if rerr != nil {
+		return nil, rerr.Error()
+	}
+	if exists && sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+		for _, rule := range *sg.SecurityRules {
+			if prefix, orphaned := isOrphaned(to.String(rule.Name)); orphaned {
+				orphan := getServiceOrphan(prefix, false)
+				orphan.add(orphanedResourceTypeSecurityRule, fmt.Sprintf("%s/%s", to.String(sg.Name), to.String(rule.Name)))
+				orphan.addIPFamilyOfName(to.String(rule.Name))
+			}
+		}
+	}
+
+	var pips []network.PublicIPAddress
+	for _, resourceGroup := range pipResourceGroups.List() {
+		resourceGroupPIPs, rerr := gc.cloud.PublicIPAddressesClient.List(ctx, resourceGroup)
+		if rerr != nil && !rerr.IsNotFound() {
+			return nil, rerr.Error()
+		}
+		pips = append(pips, resourceGroupPIPs...)
+	}
+	for i := range pips {
+		pip := pips[i]
+		serviceTag := getServiceFromPIPServiceTags(pip.Tags)
+		serviceNames := parsePIPServiceTag(&serviceTag)
+		if len(serviceNames) == 0 || !strings.EqualFold(getClusterFromPIPClusterTags(pip.Tags), gc.clusterName) {
+			continue
+		}
+		inUse := false
+		for _, serviceName := range serviceNames {
+			if liveNames.Has(strings.ToLower(serviceName)) {
+				inUse = true
+				break
+			}
+		}
+		if inUse {
+			continue
+		}
+
+		if orphan, found := pipOwners[strings.ToLower(to.String(pip.ID))]; found {
+			orphan.setServiceName(serviceNames[0])
+			orphan.setCleanupAnnotations(pip.Tags)
+			gc.setPublicIPResourceGroup(orphan, &pip)
+			if pip.PublicIPAddressPropertiesFormat != nil && pip.PublicIPAddressVersion != "" {
+				orphan.addIPFamily(pip.PublicIPAddressVersion == network.IPVersionIPv6, primaryPIPIDs.Has(strings.ToLower(to.String(pip.ID))))
+			}
+			orphan.add(planResourceTypePublicIPAddress, to.String(pip.Name))
+			continue
+		}
+		// the public IP referenced by other resources is not deleted
+		if pip.PublicIPAddressPropertiesFormat != nil && pip.IPConfiguration != nil {
+			continue
+		}
+		orphan := getOrphan(fmt.Sprintf("%s/%s", planResourceTypePublicIPAddress, strings.ToLower(to.String(pip.ID))), func() *v1.Service {
+			return &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer}}
+		})
+		orphan.setServiceName(serviceNames[0])
+		orphan.setCleanupAnnotations(pip.Tags)
+		gc.setPublicIPResourceGroup(orphan, &pip)
+		orphan.publicIP = &pip
+		orphan.add(planResourceTypePublicIPAddress, to.String(pip.Name))
+	}
+
+	plsList, rerr := gc.cloud.PrivateLinkServiceClient.List(ctx, gc.cloud.PrivateLinkServiceResourceGroup)
+	if rerr != nil && !rerr.IsNotFound() {
+		return nil, rerr.Error()
+	}
+	for i := range plsList {
+		pls := plsList[i]
+		owner := getPrivateLinkServiceOwner(&pls)
+		if !isManagedPrivateLinkSerivce(&pls, gc.clusterName) || liveNames.Has(strings.ToLower(owner)) ||
+			pls.PrivateLinkServiceProperties == nil || pls.LoadBalancerFrontendIPConfigurations == nil {
+			continue
+		}
+		// the private link service is deleted with its frontend IP configuration
+		for _, fip := range *pls.LoadBalancerFrontendIPConfigurations {
+			if orphan, found := fipOwners[strings.ToLower(to.String(fip.ID))]; found {
+				orphan.setServiceName(owner)
+				orphan.setCleanupAnnotations(pls.Tags)
+				orphan.add(planResourceTypePrivateLinkService, to.String(pls.Name))
+				break
+			}
+		}
+	}
+
+	for _, orphan := range result {
+		if orphan.loadBalancer == nil && orphan.publicIP == nil {
+			orphan.setIPFamilies()
+		}
+	}
+	return result, nil
+}
+
+// setPublicIPResourceGroup makes the deleted service own the public IP in a resource group other than the one of
+// the cluster, in the same way as the annotation service.beta.kubernetes.io/azure-load-balancer-resource-group does.
+func (gc *OrphanedResourceGC) setPublicIPResourceGroup(orphan *orphanedResources, pip *network.PublicIPAddress) {
+	resourceGroup := getResourceGroupFromID(to.String(pip.ID))
+	if resourceGroup == "" || strings.EqualFold(resourceGroup, gc.cloud.ResourceGroup) {
+		return
+	}
+	if orphan.service.Annotations == nil {
+		orphan.service.Annotations = make(map[string]string)
+	}
+	orphan.service.Annotations[consts.ServiceAnnotationLoadBalancerResourceGroup] = resourceGroup
+}
+
+// getResourceGroupFromID returns the resource group of the Azure resource ID, or an empty string if it is malformed.
+func getResourceGroupFromID(resourceID string) string {
+	matches := azureResourceGroupNameRE.FindStringSubmatch(resourceID)
+	if len(matches) != 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+// isFrontendIPConfigInUse returns true if the frontend IP configuration is shared with the existing services.
+func (gc *OrphanedResourceGC) isFrontendIPConfigInUse(fip network.FrontendIPConfiguration, livePrefixes sets.String) bool {
+	if fip.FrontendIPConfigurationPropertiesFormat == nil || fip.LoadBalancingRules == nil {
+		return false
+	}
+	for _, rule := range *fip.LoadBalancingRules {
+		ruleID := to.String(rule.ID)
+		ruleName := ruleID[strings.LastIndex(ruleID, "/")+1:]
+		if prefix, found := getServiceResourcePrefix(ruleName); found && livePrefixes.Has(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// listManagedLoadBalancers lists the load balancers of the cluster, which are named after
+// the cluster, the VMSets of the nodes or the multiple standard load balancer configurations.
+func (gc *OrphanedResourceGC) listManagedLoadBalancers(ctx context.Context) ([]network.LoadBalancer, error) {
+	allLBs, rerr := gc.cloud.LoadBalancerClient.List(ctx, gc.cloud.getLoadBalancerResourceGroup())
+	if rerr != nil {
+		if rerr.IsNotFound() {
+			return nil, nil
+		}
+		return nil, rerr.Error()
+	}
+
+	vmSetNames := sets.NewString()
+	nodes, err := gc.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) > 0 {
+		agentPoolVMSetNames, err := gc.cloud.VMSet.GetAgentPoolVMSetNames(nodes)
+		if err != nil {
+			return nil, err
+		}
+		if agentPoolVMSetNames != nil {
+			for _, vmSetName := range *agentPoolVMSetNames {
+				vmSetNames.Insert(strings.ToLower(vmSetName))
+			}
+		}
+	}
+
+	var lbs []network.LoadBalancer
+	for _, lb := range allLBs {
+		lbName := to.String(lb.Name)
+		vmSetName := gc.cloud.mapLoadBalancerNameToVMSet(lbName, gc.clusterName)
+		if strings.EqualFold(strings.TrimSuffix(lbName, consts.InternalLoadBalancerNameSuffix), gc.clusterName) ||
+			vmSetNames.Has(strings.ToLower(vmSetName)) ||
+			gc.cloud.getMultipleStandardLoadBalancerConfiguration(vmSetName) != nil {
+			lbs = append(lbs, lb)
+		}
+	}
+	return lbs, nil
+}
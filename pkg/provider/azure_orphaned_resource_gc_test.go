@@ -0,0 +1,681 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	cloudprovider "k8s.io/cloud-provider"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	liveServiceUID     = "aaaaaaaa-0000-0000-0000-000000000001"
+	liveServicePrefix  = "aaaaaaaaa00000000000000000000000"
+	orphanedServiceUID = "bbbbbbbb-0000-0000-0000-000000000002"
+	orphanedPrefix     = "abbbbbbbb00000000000000000000000"
+)
+
+func newTestOrphanedResourceGC(az *Cloud, services ...*v1.Service) *OrphanedResourceGC {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	serviceInformer := factory.Core().V1().Services()
+	for _, service := range services {
+		_ = serviceInformer.Informer().GetIndexer().Add(service)
+	}
+	return NewOrphanedResourceGC(az, testClusterName, serviceInformer, factory.Core().V1().Nodes())
+}
+
+func newTestOrphanedResourceGCService(name, uid string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID(uid),
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+		},
+	}
+}
+
+func TestValidateOrphanedResourceGCConfig(t *testing.T) {
+	for _, testCase := range []struct {
+		desc        string
+		config      *OrphanedResourceGCConfig
+		expectedErr bool
+	}{
+		{
+			desc: "nil config should be valid",
+		},
+		{
+			desc:   "positive values should be valid",
+			config: &OrphanedResourceGCConfig{IntervalInSeconds: 60, GracePeriodInSeconds: 60},
+		},
+		{
+			desc:        "negative interval should be rejected",
+			config:      &OrphanedResourceGCConfig{IntervalInSeconds: -1},
+			expectedErr: true,
+		},
+		{
+			desc:        "negative grace period should be rejected",
+			config:      &OrphanedResourceGCConfig{GracePeriodInSeconds: -1},
+			expectedErr: true,
+		},
+	} {
+		t.Run(testCase.desc, func(t *testing.T) {
+			err := validateOrphanedResourceGCConfig(&Config{OrphanedResourceGC: testCase.config})
+			assert.Equal(t, testCase.expectedErr, err != nil)
+		})
+	}
+}
+
+func TestNewOrphanedResourceGC(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	gc := newTestOrphanedResourceGC(az)
+	assert.Equal(t, consts.DefaultOrphanedResourceGCInterval, gc.interval)
+	assert.Equal(t, consts.DefaultOrphanedResourceGCGracePeriod, gc.gracePeriod)
+	assert.False(t, gc.dryRun)
+
+	az.OrphanedResourceGC = &OrphanedResourceGCConfig{IntervalInSeconds: 60, GracePeriodInSeconds: 120, DryRun: true}
+	gc = newTestOrphanedResourceGC(az)
+	assert.Equal(t, time.Minute, gc.interval)
+	assert.Equal(t, 2*time.Minute, gc.gracePeriod)
+	assert.True(t, gc.dryRun)
+}
+
+func TestFindOrphanedResources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	liveService := newTestOrphanedResourceGCService("live", liveServiceUID)
+	assert.Equal(t, liveServicePrefix, cloudprovider.DefaultLoadBalancerName(liveService))
+	assert.Equal(t, orphanedPrefix, cloudprovider.DefaultLoadBalancerName(newTestOrphanedResourceGCService("orphaned", orphanedServiceUID)))
+	gc := newTestOrphanedResourceGC(az, liveService)
+
+	lbID := fmt.Sprintf("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/%s", testClusterName)
+	orphanedPIPID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/orphaned-pip"
+	orphanedFIPID := fmt.Sprintf("%s/frontendIPConfigurations/%s", lbID, orphanedPrefix)
+	lbs := []network.LoadBalancer{
+		{
+			Name: to.StringPtr(testClusterName),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{
+						Name:                                    to.StringPtr(liveServicePrefix),
+						ID:                                      to.StringPtr(fmt.Sprintf("%s/frontendIPConfigurations/%s", lbID, liveServicePrefix)),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+					},
+					{
+						Name: to.StringPtr(orphanedPrefix),
+						ID:   to.StringPtr(orphanedFIPID),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(orphanedPIPID)},
+						},
+					},
+				},
+				LoadBalancingRules: &[]network.LoadBalancingRule{
+					{Name: to.StringPtr(liveServicePrefix + "-TCP-80")},
+					{Name: to.StringPtr(orphanedPrefix + "-TCP-80")},
+				},
+				Probes: &[]network.Probe{
+					{Name: to.StringPtr(orphanedPrefix + "-TCP-80")},
+				},
+			},
+		},
+		{
+			Name:                         to.StringPtr(testClusterName + consts.InternalLoadBalancerNameSuffix),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+		},
+		{
+			Name: to.StringPtr("unmanaged"),
+		},
+	}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return(lbs, nil)
+
+	sg := network.SecurityGroup{
+		Name: to.StringPtr("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{Name: to.StringPtr(liveServicePrefix + "-TCP-80-Internet")},
+				{Name: to.StringPtr(orphanedPrefix + "-TCP-80-Internet")},
+				{Name: to.StringPtr("custom-rule")},
+			},
+		},
+	}
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", "").Return(sg, nil)
+
+	pips := []network.PublicIPAddress{
+		{
+			Name: to.StringPtr("orphaned-pip"),
+			ID:   to.StringPtr(orphanedPIPID),
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr("default/orphaned"),
+				consts.ClusterNameKey: to.StringPtr(testClusterName),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPConfiguration: &network.IPConfiguration{ID: to.StringPtr(orphanedFIPID)},
+			},
+		},
+		{
+			Name: to.StringPtr("unused-pip"),
+			ID:   to.StringPtr("unused-pip-id"),
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr("default/deleted"),
+				consts.ClusterNameKey: to.StringPtr(testClusterName),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+		},
+		{
+			Name: to.StringPtr("live-pip"),
+			ID:   to.StringPtr("live-pip-id"),
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr("default/live,default/deleted"),
+				consts.ClusterNameKey: to.StringPtr(testClusterName),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+		},
+		{
+			Name: to.StringPtr("other-cluster-pip"),
+			ID:   to.StringPtr("other-cluster-pip-id"),
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr("default/deleted"),
+				consts.ClusterNameKey: to.StringPtr("other"),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+		},
+		{
+			Name: to.StringPtr("user-pip"),
+			ID:   to.StringPtr("user-pip-id"),
+		},
+	}
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(pips, nil)
+
+	plsList := []network.PrivateLinkService{
+		{
+			Name: to.StringPtr("orphaned-pls"),
+			Tags: map[string]*string{
+				consts.ClusterNameTagKey:  to.StringPtr(testClusterName),
+				consts.OwnerServiceTagKey: to.StringPtr("default/orphaned"),
+			},
+			PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+				LoadBalancerFrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{ID: to.StringPtr(orphanedFIPID)},
+				},
+			},
+		},
+	}
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), "rg").Return(plsList, nil)
+
+	orphans, err := gc.findOrphanedResources(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(orphans))
+
+	assert.Equal(t, orphanedPrefix, orphans[0].key)
+	assert.Equal(t, "default", orphans[0].service.Namespace)
+	assert.Equal(t, "orphaned", orphans[0].service.Name)
+	assert.Equal(t, orphanedPrefix, cloudprovider.DefaultLoadBalancerName(orphans[0].service))
+	assert.Nil(t, orphans[0].loadBalancer)
+	assert.Nil(t, orphans[0].publicIP)
+	assert.Equal(t, map[string][]string{
+		orphanedResourceTypeFrontendIPConfiguration: {testClusterName + "/" + orphanedPrefix},
+		orphanedResourceTypeLoadBalancingRule:       {testClusterName + "/" + orphanedPrefix + "-TCP-80"},
+		orphanedResourceTypeProbe:                   {testClusterName + "/" + orphanedPrefix + "-TCP-80"},
+		orphanedResourceTypeSecurityRule:            {"nsg/" + orphanedPrefix + "-TCP-80-Internet"},
+		planResourceTypePublicIPAddress:             {"orphaned-pip"},
+		planResourceTypePrivateLinkService:          {"orphaned-pls"},
+	}, orphans[0].resources)
+
+	assert.Equal(t, "loadBalancers/testcluster-internal", orphans[1].key)
+	assert.Equal(t, testClusterName+consts.InternalLoadBalancerNameSuffix, to.String(orphans[1].loadBalancer.Name))
+	assert.Equal(t, map[string][]string{planResourceTypeLoadBalancer: {testClusterName + consts.InternalLoadBalancerNameSuffix}}, orphans[1].resources)
+
+	assert.Equal(t, "publicIPAddresses/unused-pip-id", orphans[2].key)
+	assert.Equal(t, "deleted", orphans[2].service.Name)
+	assert.Equal(t, "unused-pip", to.String(orphans[2].publicIP.Name))
+	assert.Equal(t, map[string][]string{planResourceTypePublicIPAddress: {"unused-pip"}}, orphans[2].resources)
+}
+
+func TestFindOrphanedResourcesInOtherResourceGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerClasses = []LoadBalancerClass{{Name: "azure-public", PublicIPResourceGroup: "class-rg"}}
+	liveService := newTestOrphanedResourceGCService("live", liveServiceUID)
+	liveService.Annotations = map[string]string{consts.ServiceAnnotationLoadBalancerResourceGroup: "Service-RG"}
+	gc := newTestOrphanedResourceGC(az, liveService)
+
+	lbID := fmt.Sprintf("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/%s", testClusterName)
+	orphanedPIPID := "/subscriptions/subscription/resourceGroups/fip-rg/providers/Microsoft.Network/publicIPAddresses/orphaned-pip"
+	lbs := []network.LoadBalancer{
+		{
+			Name: to.StringPtr(testClusterName),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{
+						Name: to.StringPtr(orphanedPrefix),
+						ID:   to.StringPtr(fmt.Sprintf("%s/frontendIPConfigurations/%s", lbID, orphanedPrefix)),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(orphanedPIPID)},
+						},
+					},
+				},
+			},
+		},
+	}
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return(lbs, nil)
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", "").Return(network.SecurityGroup{}, notFound)
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), "rg").Return(nil, notFound)
+
+	tags := map[string]*string{
+		consts.ServiceTagKey:  to.StringPtr("default/orphaned"),
+		consts.ClusterNameKey: to.StringPtr(testClusterName),
+	}
+	unusedPIP := network.PublicIPAddress{
+		Name:                            to.StringPtr("unused-pip"),
+		ID:                              to.StringPtr("/subscriptions/subscription/resourceGroups/class-rg/providers/Microsoft.Network/publicIPAddresses/unused-pip"),
+		Tags:                            tags,
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+	}
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil)
+	mockPIPClient.EXPECT().List(gomock.Any(), "service-rg").Return(nil, notFound)
+	mockPIPClient.EXPECT().List(gomock.Any(), "class-rg").Return([]network.PublicIPAddress{unusedPIP}, nil)
+	mockPIPClient.EXPECT().List(gomock.Any(), "fip-rg").Return([]network.PublicIPAddress{
+		{
+			Name:                            to.StringPtr("orphaned-pip"),
+			ID:                              to.StringPtr(orphanedPIPID),
+			Tags:                            tags,
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+		},
+	}, nil)
+
+	orphans, err := gc.findOrphanedResources(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(orphans))
+
+	// the deleted service owns the public IP of its frontend IP configuration in the other resource group
+	assert.Equal(t, orphanedPrefix, orphans[0].key)
+	assert.Equal(t, "fip-rg", orphans[0].service.Annotations[consts.ServiceAnnotationLoadBalancerResourceGroup])
+	assert.Equal(t, []string{"orphaned-pip"}, orphans[0].resources[planResourceTypePublicIPAddress])
+
+	// the unused public IP is deleted from its resource group
+	assert.Equal(t, "unused-pip", to.String(orphans[1].publicIP.Name))
+	mockPIPClient.EXPECT().Delete(gomock.Any(), "class-rg", "unused-pip").Return(nil)
+	assert.NoError(t, gc.deleteOrphanedResources(context.TODO(), orphans[1]))
+}
+
+func TestCollectOrphanedResources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	gc := newTestOrphanedResourceGC(az)
+	now := time.Now()
+	gc.now = func() time.Time { return now }
+
+	lbs := []network.LoadBalancer{
+		{
+			Name:                         to.StringPtr(testClusterName),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+		},
+	}
+	pips := []network.PublicIPAddress{
+		{
+			Name: to.StringPtr("unused-pip"),
+			ID:   to.StringPtr("unused-pip-id"),
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr("default/deleted"),
+				consts.ClusterNameKey: to.StringPtr(testClusterName),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+		},
+	}
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return(lbs, nil).Times(4)
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", "").Return(network.SecurityGroup{}, notFound).Times(4)
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(pips, nil).Times(4)
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), "rg").Return(nil, notFound).Times(4)
+
+	// the orphaned resources are only reported within the grace period
+	gc.collect(context.TODO())
+	assert.Equal(t, 2, len(gc.firstSeen))
+
+	// the orphaned resources are not deleted in the dry run mode
+	now = now.Add(gc.gracePeriod)
+	gc.dryRun = true
+	gc.collect(context.TODO())
+	assert.Equal(t, 2, len(gc.firstSeen))
+
+	// the orphaned resources are deleted after the grace period
+	gc.dryRun = false
+	mockLBClient.EXPECT().Delete(gomock.Any(), "rg", testClusterName).Return(nil)
+	mockPIPClient.EXPECT().Delete(gomock.Any(), "rg", "unused-pip").Return(nil)
+	gc.collect(context.TODO())
+	assert.Equal(t, 0, len(gc.firstSeen))
+
+	// the grace period restarts for the resources found again
+	gc.collect(context.TODO())
+	assert.Equal(t, map[string]time.Time{
+		"loadBalancers/testcluster":       now,
+		"publicIPAddresses/unused-pip-id": now,
+	}, gc.firstSeen)
+}
+
+func TestDeleteOrphanedResourcesRetainsPublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.RetainPublicIPOnServiceDeletion = true
+	gc := newTestOrphanedResourceGC(az)
+	orphan := &orphanedResources{
+		service: &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer}},
+		publicIP: &network.PublicIPAddress{
+			Name: to.StringPtr("unused-pip"),
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr("default/deleted"),
+				consts.ClusterNameKey: to.StringPtr(testClusterName),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+		},
+	}
+
+	// the public IP is untagged from the deleted service and retained instead of deleted
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "unused-pip", gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+		assert.Empty(t, getServiceFromPIPServiceTags(parameters.Tags))
+		assert.Equal(t, testClusterName, getClusterFromPIPClusterTags(parameters.Tags))
+		assert.Equal(t, "default/deleted", to.String(parameters.Tags[consts.RetainedServiceKey]))
+		return nil
+	})
+	assert.NoError(t, gc.deleteOrphanedResources(context.TODO(), orphan))
+}
+
+func TestFindOrphanedResourcesDualStack(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	gc := newTestOrphanedResourceGC(az)
+
+	lbID := fmt.Sprintf("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/%s", testClusterName)
+	pipIDs := map[bool]string{
+		false: "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/orphaned-pip",
+		true:  "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/orphaned-pip-IPv6",
+	}
+	lbs := []network.LoadBalancer{
+		{
+			Name: to.StringPtr(testClusterName),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{
+						Name: to.StringPtr(orphanedPrefix),
+						ID:   to.StringPtr(fmt.Sprintf("%s/frontendIPConfigurations/%s", lbID, orphanedPrefix)),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(pipIDs[false])},
+						},
+					},
+					{
+						Name: to.StringPtr(orphanedPrefix + "-IPv6"),
+						ID:   to.StringPtr(fmt.Sprintf("%s/frontendIPConfigurations/%s-IPv6", lbID, orphanedPrefix)),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PublicIPAddress: &network.PublicIPAddress{ID: to.StringPtr(pipIDs[true])},
+						},
+					},
+				},
+				LoadBalancingRules: &[]network.LoadBalancingRule{
+					{Name: to.StringPtr(orphanedPrefix + "-TCP-80")},
+					{Name: to.StringPtr(orphanedPrefix + "-TCP-80-IPv6")},
+				},
+				BackendAddressPools: &[]network.BackendAddressPool{
+					{Name: to.StringPtr(testClusterName)},
+					{Name: to.StringPtr(orphanedPrefix)},
+					{Name: to.StringPtr(orphanedPrefix + "-IPv6")},
+				},
+			},
+		},
+	}
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return(lbs, nil)
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", "").Return(network.SecurityGroup{}, notFound)
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), "rg").Return(nil, notFound)
+
+	var pips []network.PublicIPAddress
+	for _, isIPv6 := range []bool{false, true} {
+		version := network.IPVersionIPv4
+		if isIPv6 {
+			version = network.IPVersionIPv6
+		}
+		pipID := pipIDs[isIPv6]
+		pips = append(pips, network.PublicIPAddress{
+			Name: to.StringPtr(pipID[strings.LastIndex(pipID, "/")+1:]),
+			ID:   to.StringPtr(pipID),
+			Tags: map[string]*string{
+				consts.ServiceTagKey:           to.StringPtr("default/orphaned"),
+				consts.ClusterNameKey:          to.StringPtr(testClusterName),
+				consts.DNSZoneIDTagKey:         to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/dnszones/example.com"),
+				consts.DNSRecordNameTagKey:     to.StringPtr("www"),
+				consts.PIPRetainOnDeleteTagKey: to.StringPtr("true"),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{PublicIPAddressVersion: version},
+		})
+	}
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(pips, nil)
+
+	orphans, err := gc.findOrphanedResources(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(orphans))
+	service := orphans[0].service
+	assert.Equal(t, "orphaned", service.Name)
+	assert.Equal(t, []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}, service.Spec.IPFamilies)
+	assert.Equal(t, []string{"orphaned-pip", "orphaned-pip-IPv6"}, orphans[0].resources[planResourceTypePublicIPAddress])
+
+	// the deleted service owns the resources of both IP families
+	for isIPv6, fipName := range map[bool]string{false: orphanedPrefix, true: orphanedPrefix + "-IPv6"} {
+		assert.Equal(t, fipName, az.getDefaultFrontendIPConfigName(service, isIPv6))
+		assert.Equal(t, fipName, az.getServiceBackendPoolName(testClusterName, service, isIPv6))
+		assert.Equal(t, strings.TrimPrefix(fipName, orphanedPrefix), getIPFamilySuffix(service, isIPv6))
+	}
+
+	// the annotations required to clean up the deleted service are restored from the tags of its public IPs
+	assert.Equal(t, map[string]string{
+		consts.ServiceAnnotationDNSZoneID:         "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/dnszones/example.com",
+		consts.ServiceAnnotationDNSRecordName:     "www",
+		consts.ServiceAnnotationPIPRetainOnDelete: "true",
+	}, service.Annotations)
+	assert.True(t, az.shouldRetainPublicIP(service))
+}
+
+func TestFindOrphanedResourcesInternalIPv6(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.privateIPPoolAllocator.restore(map[string]types.UID{"fd00::10": orphanedServiceUID}, nil)
+	gc := newTestOrphanedResourceGC(az)
+
+	lbID := fmt.Sprintf("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/%s%s", testClusterName, consts.InternalLoadBalancerNameSuffix)
+	fipID := fmt.Sprintf("%s/frontendIPConfigurations/%s", lbID, orphanedPrefix)
+	lbs := []network.LoadBalancer{
+		{
+			Name: to.StringPtr(testClusterName + consts.InternalLoadBalancerNameSuffix),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{
+						Name: to.StringPtr(orphanedPrefix),
+						ID:   to.StringPtr(fipID),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PrivateIPAddress:        to.StringPtr("fd00::10"),
+							PrivateIPAddressVersion: network.IPVersionIPv6,
+						},
+					},
+				},
+			},
+		},
+	}
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return(lbs, nil)
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", "").Return(network.SecurityGroup{}, notFound)
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil)
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PrivateLinkService{
+		{
+			Name: to.StringPtr("orphaned-pls"),
+			Tags: map[string]*string{
+				consts.ClusterNameTagKey:      to.StringPtr(testClusterName),
+				consts.OwnerServiceTagKey:     to.StringPtr("default/orphaned"),
+				consts.PrivateDNSZoneIDTagKey: to.StringPtr("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/privateDnsZones/example.internal"),
+			},
+			PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+				LoadBalancerFrontendIPConfigurations: &[]network.FrontendIPConfiguration{{ID: to.StringPtr(fipID)}},
+			},
+		},
+	}, nil)
+
+	orphans, err := gc.findOrphanedResources(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(orphans))
+	service := orphans[0].service
+	assert.Equal(t, []v1.IPFamily{v1.IPv6Protocol}, service.Spec.IPFamilies)
+	assert.Nil(t, service.Spec.IPFamilyPolicy)
+	assert.Equal(t, "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/privateDnsZones/example.internal", az.getServicePrivateDNSZoneID(service))
+	// the deleted service is identified by its UID allocated the private IP from the pool
+	assert.Equal(t, types.UID(orphanedServiceUID), service.UID)
+	assert.Equal(t, orphanedPrefix, cloudprovider.DefaultLoadBalancerName(service))
+}
+
+func TestAddIPFamilyOfName(t *testing.T) {
+	for _, testCase := range []struct {
+		desc               string
+		names              []string
+		expectedIPFamilies []v1.IPFamily
+	}{
+		{
+			desc:  "names without the suffix should not change the IP families",
+			names: []string{orphanedPrefix, orphanedPrefix + "-TCP-80"},
+		},
+		{
+			desc:               "IPv6 suffix should make IPv4 the primary family",
+			names:              []string{orphanedPrefix + "-TCP-80-IPv6"},
+			expectedIPFamilies: []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol},
+		},
+		{
+			desc:               "IPv4 suffix should make IPv6 the primary family",
+			names:              []string{orphanedPrefix, orphanedPrefix + "-ipv4"},
+			expectedIPFamilies: []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol},
+		},
+	} {
+		t.Run(testCase.desc, func(t *testing.T) {
+			orphan := &orphanedResources{service: newOrphanedServiceStub(orphanedPrefix, false)}
+			for _, name := range testCase.names {
+				orphan.addIPFamilyOfName(name)
+			}
+			orphan.setIPFamilies()
+			assert.Equal(t, testCase.expectedIPFamilies, orphan.service.Spec.IPFamilies)
+		})
+	}
+}
+
+func TestAddServiceCleanupTags(t *testing.T) {
+	service := newTestOrphanedResourceGCService("svc", orphanedServiceUID)
+	service.Annotations = map[string]string{
+		consts.ServiceAnnotationDNSZoneID:     "zone-id",
+		consts.ServiceAnnotationDNSRecordName: " www ",
+	}
+
+	for _, testCase := range []struct {
+		desc               string
+		ownedAlone         bool
+		currentTags        map[string]*string
+		expectedTags       map[string]*string
+		expectedConfigTags map[string]*string
+		expectedDeleted    bool
+	}{
+		{
+			desc:         "the annotations should be recorded on the resource owned by the service alone",
+			ownedAlone:   true,
+			currentTags:  map[string]*string{"k8s-azure-pip-retain-on-delete": to.StringPtr("true")},
+			expectedTags: map[string]*string{},
+			expectedConfigTags: map[string]*string{
+				consts.DNSZoneIDTagKey:     to.StringPtr("zone-id"),
+				consts.DNSRecordNameTagKey: to.StringPtr("www"),
+			},
+			expectedDeleted: true,
+		},
+		{
+			desc:               "the tags of the shared resource should be kept",
+			currentTags:        map[string]*string{consts.CrossRegionBackendPoolIDTagKey: to.StringPtr("pool-id")},
+			expectedTags:       map[string]*string{consts.CrossRegionBackendPoolIDTagKey: to.StringPtr("pool-id")},
+			expectedConfigTags: map[string]*string{consts.CrossRegionBackendPoolIDTagKey: to.StringPtr("pool-id")},
+		},
+	} {
+		t.Run(testCase.desc, func(t *testing.T) {
+			configTags := make(map[string]*string)
+			deleted := addServiceCleanupTags(service, testCase.ownedAlone, testCase.currentTags, configTags)
+			assert.Equal(t, testCase.expectedDeleted, deleted)
+			assert.Equal(t, testCase.expectedTags, testCase.currentTags)
+			assert.Equal(t, testCase.expectedConfigTags, configTags)
+		})
+	}
+}
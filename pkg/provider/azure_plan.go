@@ -0,0 +1,958 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-07-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationsecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/dnsclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednsclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	planResourceTypeLoadBalancer             = "loadBalancers"
+	planResourceTypePublicIPAddress          = "publicIPAddresses"
+	planResourceTypeSecurityGroup            = "networkSecurityGroups"
+	planResourceTypePrivateLinkService       = "privateLinkServices"
+	planResourceTypeSubnet                   = "subnets"
+	planResourceTypeInterface                = "networkInterfaces"
+	planResourceTypeVirtualMachineScaleSet   = "virtualMachineScaleSets"
+	planResourceTypeVirtualMachineScaleSetVM = "virtualMachineScaleSetVMs"
+	planResourceTypeApplicationSecurityGroup = "applicationSecurityGroups"
+	planResourceTypeDNSRecordSet             = "dnsZones"
+	planResourceTypePrivateDNSRecordSet      = "privateDnsZones"
+
+	// planPropertiesKind is the kind of the diff of the properties which are not child resources.
+	planPropertiesKind = "properties"
+	// planTagsKind is the kind of the diff of the tags.
+	planTagsKind = "tags"
+
+	planEventBufferSize = 100
+)
+
+// PlanAction is the action the reconciliation would take on an Azure resource.
+type PlanAction string
+
+const (
+	// PlanActionCreate means the resource would be created.
+	PlanActionCreate PlanAction = "Create"
+	// PlanActionUpdate means the resource would be updated.
+	PlanActionUpdate PlanAction = "Update"
+	// PlanActionDelete means the resource would be deleted.
+	PlanActionDelete PlanAction = "Delete"
+)
+
+// PlanDiff lists the added, removed and changed items of one kind in an Azure resource. The kind is either
+// "properties", "tags", or the name of a collection of child resources, e.g. "frontendIPConfigurations",
+// "loadBalancingRules", "probes" and "securityRules", whose items are identified by their names.
+type PlanDiff struct {
+	Kind    string   `json:"kind"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// ResourcePlan is the change the reconciliation would make to an Azure resource.
+type ResourcePlan struct {
+	ResourceType  string     `json:"resourceType"`
+	ResourceGroup string     `json:"resourceGroup"`
+	Name          string     `json:"name"`
+	Action        PlanAction `json:"action"`
+	Diffs         []PlanDiff `json:"diffs,omitempty"`
+}
+
+// ServicePlan is the result of the dry run of the reconciliation of a service.
+type ServicePlan struct {
+	// Service is the namespace/name of the service.
+	Service string `json:"service"`
+	// Resources are the Azure resources which would be changed.
+	Resources []ResourcePlan `json:"resources,omitempty"`
+	// Events are the events which would be recorded on the service.
+	Events []string `json:"events,omitempty"`
+	// Error is the error the reconciliation would fail with.
+	Error string `json:"error,omitempty"`
+}
+
+// LoadBalancerPlanner computes the changes the reconciliation of the services would make to their load balancers,
+// public IPs, security groups, private link services and DNS records. It reads the resources from Azure, but the
+// writes are recorded instead of being sent, so nothing is changed in Azure.
+type LoadBalancerPlanner struct {
+	cloud    *Cloud
+	recorder *planRecorder
+	events   *record.FakeRecorder
+	nodes    []*v1.Node
+}
+
+// NewLoadBalancerPlanner creates a LoadBalancerPlanner from the cloud config and the nodes of the cluster.
+func NewLoadBalancerPlanner(config *Config, nodes []*v1.Node) (*LoadBalancerPlanner, error) {
+	az, err := NewCloudWithoutFeatureGatesFromConfig(config, false, false)
+	if err != nil {
+		return nil, err
+	}
+	az.ipv6DualStackEnabled = true
+
+	for _, node := range nodes {
+		az.updateNodeCaches(nil, node)
+	}
+	return newLoadBalancerPlanner(az, nodes), nil
+}
+
+// newLoadBalancerPlanner replaces the clients writing the resources of the cloud with the ones recording the writes.
+func newLoadBalancerPlanner(az *Cloud, nodes []*v1.Node) *LoadBalancerPlanner {
+	recorder := &planRecorder{subscriptionID: az.SubscriptionID, entries: make(map[string]*planEntry)}
+	az.LoadBalancerClient = &planLoadBalancerClient{Interface: az.LoadBalancerClient, recorder: recorder}
+	az.PublicIPAddressesClient = &planPublicIPClient{Interface: az.PublicIPAddressesClient, recorder: recorder}
+	az.SecurityGroupsClient = &planSecurityGroupClient{Interface: az.SecurityGroupsClient, recorder: recorder}
+	az.PrivateLinkServiceClient = &planPrivateLinkServiceClient{Interface: az.PrivateLinkServiceClient, recorder: recorder}
+	az.SubnetsClient = &planSubnetClient{Interface: az.SubnetsClient, recorder: recorder}
+	az.InterfacesClient = &planInterfaceClient{Interface: az.InterfacesClient, recorder: recorder}
+	az.VirtualMachineScaleSetsClient = &planVMSSClient{Interface: az.VirtualMachineScaleSetsClient, recorder: recorder}
+	az.VirtualMachineScaleSetVMsClient = &planVMSSVMClient{Interface: az.VirtualMachineScaleSetVMsClient, recorder: recorder}
+	az.ApplicationSecurityGroupsClient = &planApplicationSecurityGroupClient{Interface: az.ApplicationSecurityGroupsClient, recorder: recorder}
+	az.DNSClient = &planDNSClient{Interface: az.DNSClient, recorder: recorder}
+	az.privatednsclient = &planPrivateDNSClient{Interface: az.privatednsclient, recorder: recorder}
+	az.planRecorder = recorder
+
+	events := record.NewFakeRecorder(planEventBufferSize)
+	az.eventRecorder = events
+
+	return &LoadBalancerPlanner{
+		cloud:    az,
+		recorder: recorder,
+		events:   events,
+		nodes:    nodes,
+	}
+}
+
+// PlanService runs the reconciliation of the service without changing anything in Azure, and returns the changes
+// it would make. Each service is planned against the current state of the resources in Azure.
+func (p *LoadBalancerPlanner) PlanService(ctx context.Context, clusterName string, service *v1.Service) (*ServicePlan, error) {
+	if err := p.reset(); err != nil {
+		return nil, err
+	}
+
+	plan := &ServicePlan{Service: getServiceName(service)}
+	if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil {
+		if err := p.cloud.EnsureLoadBalancerDeleted(ctx, clusterName, service); err != nil {
+			plan.Error = err.Error()
+		}
+	} else if _, err := p.cloud.EnsureLoadBalancer(ctx, clusterName, service, p.nodes); err != nil {
+		plan.Error = err.Error()
+	}
+
+	resources, err := p.recorder.plan()
+	if err != nil {
+		return nil, err
+	}
+	plan.Resources = resources
+
+	for len(p.events.Events) > 0 {
+		plan.Events = append(plan.Events, <-p.events.Events)
+	}
+	return plan, nil
+}
+
+// reset drops the recorded writes and the cached resources which may contain them.
+func (p *LoadBalancerPlanner) reset() (err error) {
+	p.recorder.reset()
+	p.cloud.privateIPPoolAllocator.reset()
+
+	if p.cloud.lbCache, err = p.cloud.newLBCache(); err != nil {
+		return err
+	}
+	if p.cloud.nsgCache, err = p.cloud.newNSGCache(); err != nil {
+		return err
+	}
+	if p.cloud.pipCache, err = p.cloud.newPIPCache(); err != nil {
+		return err
+	}
+	if p.cloud.plsCache, err = p.cloud.newPLSCache(); err != nil {
+		return err
+	}
+	if p.cloud.asgCache, err = p.cloud.newApplicationSecurityGroupCache(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// planEntry records the original and the desired state of a resource written during the plan.
+// The original is a snapshot of the resource got from Azure in the form of its JSON, and it is nil if the
+// resource doesn't exist. A nil desired means the resource is deleted.
+type planEntry struct {
+	resourceType  string
+	resourceGroup string
+	name          string
+	original      map[string]interface{}
+	desired       interface{}
+}
+
+// planRecorder records the writes to the resources.
+type planRecorder struct {
+	lock           sync.Mutex
+	subscriptionID string
+	entries        map[string]*planEntry
+	keys           []string
+}
+
+func getPlanEntryKey(resourceType, resourceGroup, name string) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s/%s", resourceType, resourceGroup, name))
+}
+
+func (r *planRecorder) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.entries = make(map[string]*planEntry)
+	r.keys = nil
+}
+
+// resourceID returns the ID of the network resource created during the plan.
+func (r *planRecorder) resourceID(resourceType, resourceGroup, name string) *string {
+	return to.StringPtr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/%s/%s", r.subscriptionID, resourceGroup, resourceType, name))
+}
+
+// lookup returns the desired state of the resource if it has been written during the plan.
+func (r *planRecorder) lookup(resourceType, resourceGroup, name string) (desired interface{}, found bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entry, found := r.entries[getPlanEntryKey(resourceType, resourceGroup, name)]
+	if !found {
+		return nil, false
+	}
+	return entry.desired, true
+}
+
+// created returns the desired state of the resources of the type created in the resource group during the plan.
+func (r *planRecorder) created(resourceType, resourceGroup string) []interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []interface{}
+	for _, key := range r.keys {
+		entry := r.entries[key]
+		if strings.EqualFold(entry.resourceType, resourceType) && strings.EqualFold(entry.resourceGroup, resourceGroup) &&
+			entry.original == nil && entry.desired != nil {
+			result = append(result, entry.desired)
+		}
+	}
+	return result
+}
+
+// record records the desired state of the resource, or its deletion if desired is nil. The original state
+// is got from Azure when the resource is written for the first time.
+func (r *planRecorder) record(resourceType, resourceGroup, name string, desired interface{}, getOriginal func() (interface{}, *retry.Error)) *retry.Error {
+	key := getPlanEntryKey(resourceType, resourceGroup, name)
+
+	r.lock.Lock()
+	entry, found := r.entries[key]
+	r.lock.Unlock()
+	if !found {
+		original, rerr := getOriginal()
+		exists, err := checkResourceExistsFromError(rerr)
+		if err != nil {
+			return err
+		}
+		entry = &planEntry{
+			resourceType:  resourceType,
+			resourceGroup: resourceGroup,
+			name:          name,
+		}
+		// the original is kept as a snapshot since the returned resource may share the pointers with the cached one
+		if exists {
+			snapshot, marshalErr := planResourceToMap(original)
+			if marshalErr != nil {
+				return retry.NewError(false, marshalErr)
+			}
+			entry.original = snapshot
+		}
+	}
+
+	klog.V(2).Infof("planRecorder: recording the write of %s %s/%s", resourceType, resourceGroup, name)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, found := r.entries[key]; !found {
+		r.entries[key] = entry
+		r.keys = append(r.keys, key)
+	}
+	entry.desired = desired
+	return nil
+}
+
+// plan returns the changes of the resources written during the plan.
+func (r *planRecorder) plan() ([]ResourcePlan, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []ResourcePlan
+	for _, key := range r.keys {
+		entry := r.entries[key]
+		resourcePlan := ResourcePlan{
+			ResourceType:  entry.resourceType,
+			ResourceGroup: entry.resourceGroup,
+			Name:          entry.name,
+		}
+		switch {
+		case entry.original == nil && entry.desired == nil:
+			continue
+		case entry.original == nil:
+			resourcePlan.Action = PlanActionCreate
+		case entry.desired == nil:
+			resourcePlan.Action = PlanActionDelete
+		default:
+			resourcePlan.Action = PlanActionUpdate
+		}
+
+		if entry.desired != nil {
+			diffs, err := diffPlanResources(entry.original, entry.desired)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compare %s %s/%s: %w", entry.resourceType, entry.resourceGroup, entry.name, err)
+			}
+			if len(diffs) == 0 && resourcePlan.Action == PlanActionUpdate {
+				continue
+			}
+			resourcePlan.Diffs = diffs
+		}
+		result = append(result, resourcePlan)
+	}
+	return result, nil
+}
+
+// diffPlanResources compares the writable parts of the resources, which are the ones kept by their JSON marshalers.
+func diffPlanResources(original, desired interface{}) ([]PlanDiff, error) {
+	originalMap, err := planResourceToMap(original)
+	if err != nil {
+		return nil, err
+	}
+	desiredMap, err := planResourceToMap(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []PlanDiff
+	if diff := diffPlanMaps(planTagsKind, getPlanMap(originalMap, "tags"), getPlanMap(desiredMap, "tags")); diff != nil {
+		diffs = append(diffs, *diff)
+	}
+
+	// the properties are flattened with the other top level fields, e.g. sku and zones
+	originalProperties, err := planResourceToMap(getPlanMap(originalMap, "properties"))
+	if err != nil {
+		return nil, err
+	}
+	desiredProperties, err := planResourceToMap(getPlanMap(desiredMap, "properties"))
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []string{"id", "name", "etag", "type", "tags", "properties"} {
+		delete(originalMap, field)
+		delete(desiredMap, field)
+	}
+	for field, value := range originalMap {
+		originalProperties[field] = value
+	}
+	for field, value := range desiredMap {
+		desiredProperties[field] = value
+	}
+
+	propertiesDiff := PlanDiff{Kind: planPropertiesKind}
+	var childDiffs []PlanDiff
+	for _, field := range getPlanMapKeys(originalProperties, desiredProperties) {
+		originalValue, desiredValue := originalProperties[field], desiredProperties[field]
+		originalChildren, isOriginalNamed := getPlanNamedChildren(originalValue)
+		desiredChildren, isDesiredNamed := getPlanNamedChildren(desiredValue)
+		if isOriginalNamed && isDesiredNamed {
+			if diff := diffPlanMaps(field, originalChildren, desiredChildren); diff != nil {
+				childDiffs = append(childDiffs, *diff)
+			}
+			continue
+		}
+
+		switch {
+		case originalValue == nil && desiredValue != nil:
+			propertiesDiff.Added = append(propertiesDiff.Added, field)
+		case originalValue != nil && desiredValue == nil:
+			propertiesDiff.Removed = append(propertiesDiff.Removed, field)
+		case !reflect.DeepEqual(originalValue, desiredValue):
+			propertiesDiff.Changed = append(propertiesDiff.Changed, field)
+		}
+	}
+	if len(propertiesDiff.Added)+len(propertiesDiff.Removed)+len(propertiesDiff.Changed) > 0 {
+		diffs = append(diffs, propertiesDiff)
+	}
+
+	return append(diffs, childDiffs...), nil
+}
+
+// diffPlanMaps compares the values of the maps by their keys, and returns nil if there is no difference.
+func diffPlanMaps(kind string, original, desired map[string]interface{}) *PlanDiff {
+	diff := PlanDiff{Kind: kind}
+	for _, key := range getPlanMapKeys(original, desired) {
+		originalValue, inOriginal := original[key]
+		desiredValue, inDesired := desired[key]
+		switch {
+		case !inOriginal:
+			diff.Added = append(diff.Added, key)
+		case !inDesired:
+			diff.Removed = append(diff.Removed, key)
+		case !reflect.DeepEqual(originalValue, desiredValue):
+			diff.Changed = append(diff.Changed, key)
+		}
+	}
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) == 0 {
+		return nil
+	}
+	return &diff
+}
+
+// planResourceToMap converts the resource to its JSON form, or copies it if it is already in that form.
+func planResourceToMap(resource interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if resource == nil {
+		return result, nil
+	}
+	if m, ok := resource.(map[string]interface{}); ok {
+		for key, value := range m {
+			result[key] = value
+		}
+		return result, nil
+	}
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func getPlanMap(m map[string]interface{}, field string) map[string]interface{} {
+	if value, ok := m[field].(map[string]interface{}); ok {
+		return value
+	}
+	return make(map[string]interface{})
+}
+
+func getPlanMapKeys(maps ...map[string]interface{}) []string {
+	keys := make(map[string]bool)
+	for _, m := range maps {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+	result := make([]string, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// getPlanNamedChildren returns the child resources keyed by their names without the IDs if the
+// value is a collection of child resources, or false if it is not. Nil is an empty collection.
+func getPlanNamedChildren(value interface{}) (map[string]interface{}, bool) {
+	result := make(map[string]interface{})
+	if value == nil {
+		return result, true
+	}
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return result, ok
+	}
+	for _, item := range items {
+		child, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := child["name"].(string)
+		if !ok {
+			return nil, false
+		}
+		delete(child, "id")
+		delete(child, "etag")
+		result[name] = child
+	}
+	return result, true
+}
+
+func planNotFoundError(resourceType, resourceGroup, name string) *retry.Error {
+	return retry.GetError(&http.Response{StatusCode: http.StatusNotFound}, fmt.Errorf("%s %s/%s is deleted in the plan", resourceType, resourceGroup, name))
+}
+
+// wrapPlanLoadBalancerClient makes the load balancer client of another subscription record the writes during the plan.
+func (az *Cloud) wrapPlanLoadBalancerClient(client loadbalancerclient.Interface) loadbalancerclient.Interface {
+	if az.planRecorder == nil {
+		return client
+	}
+	return &planLoadBalancerClient{Interface: client, recorder: az.planRecorder}
+}
+
+// wrapPlanDNSClient makes the DNS client of another subscription record the writes during the plan.
+func (az *Cloud) wrapPlanDNSClient(client dnsclient.Interface) dnsclient.Interface {
+	if az.planRecorder == nil {
+		return client
+	}
+	return &planDNSClient{Interface: client, recorder: az.planRecorder}
+}
+
+// wrapPlanPrivateDNSClient makes the private DNS client of another subscription record the writes during the plan.
+func (az *Cloud) wrapPlanPrivateDNSClient(client privatednsclient.Interface) privatednsclient.Interface {
+	if az.planRecorder == nil {
+		return client
+	}
+	return &planPrivateDNSClient{Interface: client, recorder: az.planRecorder}
+}
+
+// getPlanRecordSetName returns the name of the record set in the form of its ID within the resource group.
+func getPlanRecordSetName(zoneName, relativeRecordSetName, recordType string) string {
+	return fmt.Sprintf("%s/%s/%s", zoneName, recordType, relativeRecordSetName)
+}
+
+// planLoadBalancerClient reads the load balancers from Azure and records the writes to them.
+type planLoadBalancerClient struct {
+	loadbalancerclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planLoadBalancerClient) Get(ctx context.Context, resourceGroupName string, loadBalancerName string, expand string) (network.LoadBalancer, *retry.Error) {
+	if desired, found := c.recorder.lookup(planResourceTypeLoadBalancer, resourceGroupName, loadBalancerName); found {
+		if desired == nil {
+			return network.LoadBalancer{}, planNotFoundError(planResourceTypeLoadBalancer, resourceGroupName, loadBalancerName)
+		}
+		return desired.(network.LoadBalancer), nil
+	}
+	return c.Interface.Get(ctx, resourceGroupName, loadBalancerName, expand)
+}
+
+func (c *planLoadBalancerClient) List(ctx context.Context, resourceGroupName string) ([]network.LoadBalancer, *retry.Error) {
+	lbs, rerr := c.Interface.List(ctx, resourceGroupName)
+	if rerr != nil {
+		return nil, rerr
+	}
+	result := make([]network.LoadBalancer, 0, len(lbs))
+	for _, lb := range lbs {
+		desired, found := c.recorder.lookup(planResourceTypeLoadBalancer, resourceGroupName, to.String(lb.Name))
+		if !found {
+			result = append(result, lb)
+		} else if desired != nil {
+			result = append(result, desired.(network.LoadBalancer))
+		}
+	}
+	for _, desired := range c.recorder.created(planResourceTypeLoadBalancer, resourceGroupName) {
+		result = append(result, desired.(network.LoadBalancer))
+	}
+	return result, nil
+}
+
+func (c *planLoadBalancerClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+	if parameters.ID == nil {
+		parameters.ID = c.recorder.resourceID(planResourceTypeLoadBalancer, resourceGroupName, loadBalancerName)
+	}
+	return c.recorder.record(planResourceTypeLoadBalancer, resourceGroupName, loadBalancerName, parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, loadBalancerName, "")
+	})
+}
+
+func (c *planLoadBalancerClient) CreateOrUpdateBackendPools(ctx context.Context, resourceGroupName string, loadBalancerName string, backendPoolName string, parameters network.BackendAddressPool, etag string) *retry.Error {
+	lb, rerr := c.Get(ctx, resourceGroupName, loadBalancerName, "")
+	if rerr != nil {
+		return rerr
+	}
+	backendPools := make([]network.BackendAddressPool, 0)
+	if lb.LoadBalancerPropertiesFormat != nil && lb.BackendAddressPools != nil {
+		for _, backendPool := range *lb.BackendAddressPools {
+			if !strings.EqualFold(to.String(backendPool.Name), backendPoolName) {
+				backendPools = append(backendPools, backendPool)
+			}
+		}
+	} else {
+		lb.LoadBalancerPropertiesFormat = &network.LoadBalancerPropertiesFormat{}
+	}
+	lb.BackendAddressPools = &backendPools
+	*lb.BackendAddressPools = append(*lb.BackendAddressPools, parameters)
+	return c.CreateOrUpdate(ctx, resourceGroupName, loadBalancerName, lb, etag)
+}
+
+func (c *planLoadBalancerClient) Delete(ctx context.Context, resourceGroupName string, loadBalancerName string) *retry.Error {
+	return c.recorder.record(planResourceTypeLoadBalancer, resourceGroupName, loadBalancerName, nil, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, loadBalancerName, "")
+	})
+}
+
+func (c *planLoadBalancerClient) DeleteLBBackendPool(ctx context.Context, resourceGroupName, loadBalancerName, backendPoolName string) *retry.Error {
+	lb, rerr := c.Get(ctx, resourceGroupName, loadBalancerName, "")
+	if rerr != nil {
+		return rerr
+	}
+	if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return nil
+	}
+	backendPools := make([]network.BackendAddressPool, 0)
+	for _, backendPool := range *lb.BackendAddressPools {
+		if !strings.EqualFold(to.String(backendPool.Name), backendPoolName) {
+			backendPools = append(backendPools, backendPool)
+		}
+	}
+	lb.BackendAddressPools = &backendPools
+	return c.CreateOrUpdate(ctx, resourceGroupName, loadBalancerName, lb, "")
+}
+
+// planPublicIPClient reads the public IPs from Azure and records the writes to them.
+type planPublicIPClient struct {
+	publicipclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planPublicIPClient) Get(ctx context.Context, resourceGroupName string, publicIPAddressName string, expand string) (network.PublicIPAddress, *retry.Error) {
+	if desired, found := c.recorder.lookup(planResourceTypePublicIPAddress, resourceGroupName, publicIPAddressName); found {
+		if desired == nil {
+			return network.PublicIPAddress{}, planNotFoundError(planResourceTypePublicIPAddress, resourceGroupName, publicIPAddressName)
+		}
+		return desired.(network.PublicIPAddress), nil
+	}
+	return c.Interface.Get(ctx, resourceGroupName, publicIPAddressName, expand)
+}
+
+func (c *planPublicIPClient) List(ctx context.Context, resourceGroupName string) ([]network.PublicIPAddress, *retry.Error) {
+	pips, rerr := c.Interface.List(ctx, resourceGroupName)
+	if rerr != nil {
+		return nil, rerr
+	}
+	result := make([]network.PublicIPAddress, 0, len(pips))
+	for _, pip := range pips {
+		desired, found := c.recorder.lookup(planResourceTypePublicIPAddress, resourceGroupName, to.String(pip.Name))
+		if !found {
+			result = append(result, pip)
+		} else if desired != nil {
+			result = append(result, desired.(network.PublicIPAddress))
+		}
+	}
+	for _, desired := range c.recorder.created(planResourceTypePublicIPAddress, resourceGroupName) {
+		result = append(result, desired.(network.PublicIPAddress))
+	}
+	return result, nil
+}
+
+func (c *planPublicIPClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+	if parameters.ID == nil {
+		parameters.ID = c.recorder.resourceID(planResourceTypePublicIPAddress, resourceGroupName, publicIPAddressName)
+	}
+	return c.recorder.record(planResourceTypePublicIPAddress, resourceGroupName, publicIPAddressName, parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, publicIPAddressName, "")
+	})
+}
+
+func (c *planPublicIPClient) Delete(ctx context.Context, resourceGroupName string, publicIPAddressName string) *retry.Error {
+	return c.recorder.record(planResourceTypePublicIPAddress, resourceGroupName, publicIPAddressName, nil, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, publicIPAddressName, "")
+	})
+}
+
+// planSecurityGroupClient reads the security groups from Azure and records the writes to them.
+type planSecurityGroupClient struct {
+	securitygroupclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planSecurityGroupClient) Get(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, expand string) (network.SecurityGroup, *retry.Error) {
+	if desired, found := c.recorder.lookup(planResourceTypeSecurityGroup, resourceGroupName, networkSecurityGroupName); found {
+		if desired == nil {
+			return network.SecurityGroup{}, planNotFoundError(planResourceTypeSecurityGroup, resourceGroupName, networkSecurityGroupName)
+		}
+		return desired.(network.SecurityGroup), nil
+	}
+	return c.Interface.Get(ctx, resourceGroupName, networkSecurityGroupName, expand)
+}
+
+func (c *planSecurityGroupClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, parameters network.SecurityGroup, etag string) *retry.Error {
+	return c.recorder.record(planResourceTypeSecurityGroup, resourceGroupName, networkSecurityGroupName, parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, networkSecurityGroupName, "")
+	})
+}
+
+func (c *planSecurityGroupClient) Delete(ctx context.Context, resourceGroupName string, networkSecurityGroupName string) *retry.Error {
+	return c.recorder.record(planResourceTypeSecurityGroup, resourceGroupName, networkSecurityGroupName, nil, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, networkSecurityGroupName, "")
+	})
+}
+
+// planApplicationSecurityGroupClient reads the application security groups from Azure and records the writes to them.
+type planApplicationSecurityGroupClient struct {
+	applicationsecuritygroupclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planApplicationSecurityGroupClient) Get(ctx context.Context, resourceGroupName string, applicationSecurityGroupName string, expand string) (network.ApplicationSecurityGroup, *retry.Error) {
+	if desired, found := c.recorder.lookup(planResourceTypeApplicationSecurityGroup, resourceGroupName, applicationSecurityGroupName); found {
+		if desired == nil {
+			return network.ApplicationSecurityGroup{}, planNotFoundError(planResourceTypeApplicationSecurityGroup, resourceGroupName, applicationSecurityGroupName)
+		}
+		return desired.(network.ApplicationSecurityGroup), nil
+	}
+	return c.Interface.Get(ctx, resourceGroupName, applicationSecurityGroupName, expand)
+}
+
+func (c *planApplicationSecurityGroupClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, applicationSecurityGroupName string, parameters network.ApplicationSecurityGroup, etag string) *retry.Error {
+	return c.recorder.record(planResourceTypeApplicationSecurityGroup, resourceGroupName, applicationSecurityGroupName, parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, applicationSecurityGroupName, "")
+	})
+}
+
+func (c *planApplicationSecurityGroupClient) Delete(ctx context.Context, resourceGroupName string, applicationSecurityGroupName string) *retry.Error {
+	return c.recorder.record(planResourceTypeApplicationSecurityGroup, resourceGroupName, applicationSecurityGroupName, nil, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, applicationSecurityGroupName, "")
+	})
+}
+
+// planPrivateLinkServiceClient reads the private link services from Azure and records the writes to them.
+type planPrivateLinkServiceClient struct {
+	privatelinkserviceclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planPrivateLinkServiceClient) Get(ctx context.Context, resourceGroupName string, privateLinkServiceName string, expand string) (network.PrivateLinkService, *retry.Error) {
+	if desired, found := c.recorder.lookup(planResourceTypePrivateLinkService, resourceGroupName, privateLinkServiceName); found {
+		if desired == nil {
+			return network.PrivateLinkService{}, planNotFoundError(planResourceTypePrivateLinkService, resourceGroupName, privateLinkServiceName)
+		}
+		return desired.(network.PrivateLinkService), nil
+	}
+	return c.Interface.Get(ctx, resourceGroupName, privateLinkServiceName, expand)
+}
+
+func (c *planPrivateLinkServiceClient) List(ctx context.Context, resourceGroupName string) ([]network.PrivateLinkService, *retry.Error) {
+	plsList, rerr := c.Interface.List(ctx, resourceGroupName)
+	if rerr != nil {
+		return nil, rerr
+	}
+	result := make([]network.PrivateLinkService, 0, len(plsList))
+	for _, pls := range plsList {
+		desired, found := c.recorder.lookup(planResourceTypePrivateLinkService, resourceGroupName, to.String(pls.Name))
+		if !found {
+			result = append(result, pls)
+		} else if desired != nil {
+			result = append(result, desired.(network.PrivateLinkService))
+		}
+	}
+	for _, desired := range c.recorder.created(planResourceTypePrivateLinkService, resourceGroupName) {
+		result = append(result, desired.(network.PrivateLinkService))
+	}
+	return result, nil
+}
+
+func (c *planPrivateLinkServiceClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, privateLinkServiceName string, privateLinkService network.PrivateLinkService, etag string) *retry.Error {
+	if privateLinkService.ID == nil {
+		privateLinkService.ID = c.recorder.resourceID(planResourceTypePrivateLinkService, resourceGroupName, privateLinkServiceName)
+	}
+	return c.recorder.record(planResourceTypePrivateLinkService, resourceGroupName, privateLinkServiceName, privateLinkService, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, privateLinkServiceName, "")
+	})
+}
+
+func (c *planPrivateLinkServiceClient) Delete(ctx context.Context, resourceGroupName string, privateLinkServiceName string) *retry.Error {
+	return c.recorder.record(planResourceTypePrivateLinkService, resourceGroupName, privateLinkServiceName, nil, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, privateLinkServiceName, "")
+	})
+}
+
+func (c *planPrivateLinkServiceClient) DeletePEConnection(ctx context.Context, resourceGroupName string, privateLinkServiceName string, privateEndpointConnectionName string) *retry.Error {
+	pls, rerr := c.Get(ctx, resourceGroupName, privateLinkServiceName, "")
+	if rerr != nil {
+		return rerr
+	}
+	if pls.PrivateLinkServiceProperties == nil || pls.PrivateEndpointConnections == nil {
+		return nil
+	}
+	connections := make([]network.PrivateEndpointConnection, 0)
+	for _, connection := range *pls.PrivateEndpointConnections {
+		if !strings.EqualFold(to.String(connection.Name), privateEndpointConnectionName) {
+			connections = append(connections, connection)
+		}
+	}
+	pls.PrivateEndpointConnections = &connections
+	return c.CreateOrUpdate(ctx, resourceGroupName, privateLinkServiceName, pls, "")
+}
+
+// planSubnetClient reads the subnets from Azure and records the writes to them.
+type planSubnetClient struct {
+	subnetclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planSubnetClient) Get(ctx context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, expand string) (network.Subnet, *retry.Error) {
+	name := fmt.Sprintf("%s/%s", virtualNetworkName, subnetName)
+	if desired, found := c.recorder.lookup(planResourceTypeSubnet, resourceGroupName, name); found {
+		if desired == nil {
+			return network.Subnet{}, planNotFoundError(planResourceTypeSubnet, resourceGroupName, name)
+		}
+		return desired.(network.Subnet), nil
+	}
+	return c.Interface.Get(ctx, resourceGroupName, virtualNetworkName, subnetName, expand)
+}
+
+func (c *planSubnetClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, virtualNetworkName string, subnetName string, subnetParameters network.Subnet) *retry.Error {
+	return c.recorder.record(planResourceTypeSubnet, resourceGroupName, fmt.Sprintf("%s/%s", virtualNetworkName, subnetName), subnetParameters, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, virtualNetworkName, subnetName, "")
+	})
+}
+
+func (c *planSubnetClient) Delete(ctx context.Context, resourceGroupName string, virtualNetworkName string, subnetName string) *retry.Error {
+	return c.recorder.record(planResourceTypeSubnet, resourceGroupName, fmt.Sprintf("%s/%s", virtualNetworkName, subnetName), nil, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, virtualNetworkName, subnetName, "")
+	})
+}
+
+// planInterfaceClient records the writes to the network interfaces joining or leaving the backend pools.
+type planInterfaceClient struct {
+	interfaceclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planInterfaceClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, networkInterfaceName string, parameters network.Interface) *retry.Error {
+	return c.recorder.record(planResourceTypeInterface, resourceGroupName, networkInterfaceName, parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, networkInterfaceName, "")
+	})
+}
+
+func (c *planInterfaceClient) Delete(ctx context.Context, resourceGroupName string, networkInterfaceName string) *retry.Error {
+	return c.recorder.record(planResourceTypeInterface, resourceGroupName, networkInterfaceName, nil, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, networkInterfaceName, "")
+	})
+}
+
+// planVMSSClient records the writes to the scale sets joining or leaving the backend pools.
+type planVMSSClient struct {
+	vmssclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planVMSSClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, VMScaleSetName string, parameters compute.VirtualMachineScaleSet) *retry.Error {
+	return c.recorder.record(planResourceTypeVirtualMachineScaleSet, resourceGroupName, VMScaleSetName, parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, VMScaleSetName)
+	})
+}
+
+// planVMSSVMClient records the writes to the scale set VMs joining or leaving the backend pools.
+type planVMSSVMClient struct {
+	vmssvmclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planVMSSVMClient) Update(ctx context.Context, resourceGroupName string, VMScaleSetName string, instanceID string, parameters compute.VirtualMachineScaleSetVM, source string) *retry.Error {
+	return c.recorder.record(planResourceTypeVirtualMachineScaleSetVM, resourceGroupName, fmt.Sprintf("%s/%s", VMScaleSetName, instanceID), parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.Get(ctx, resourceGroupName, VMScaleSetName, instanceID, "")
+	})
+}
+
+func (c *planVMSSVMClient) UpdateVMs(ctx context.Context, resourceGroupName string, VMScaleSetName string, instances map[string]compute.VirtualMachineScaleSetVM, source string, batchSize int) *retry.Error {
+	instanceIDs := make([]string, 0, len(instances))
+	for instanceID := range instances {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+	for _, instanceID := range instanceIDs {
+		if rerr := c.Update(ctx, resourceGroupName, VMScaleSetName, instanceID, instances[instanceID], source); rerr != nil {
+			return rerr
+		}
+	}
+	return nil
+}
+
+// planDNSClient reads the record sets of the DNS zones from Azure and records the writes to them.
+type planDNSClient struct {
+	dnsclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planDNSClient) GetRecordSet(ctx context.Context, resourceGroupName, zoneName, relativeRecordSetName string, recordType dns.RecordType) (dns.RecordSet, *retry.Error) {
+	name := getPlanRecordSetName(zoneName, relativeRecordSetName, string(recordType))
+	if desired, found := c.recorder.lookup(planResourceTypeDNSRecordSet, resourceGroupName, name); found {
+		if desired == nil {
+			return dns.RecordSet{}, planNotFoundError(planResourceTypeDNSRecordSet, resourceGroupName, name)
+		}
+		return desired.(dns.RecordSet), nil
+	}
+	return c.Interface.GetRecordSet(ctx, resourceGroupName, zoneName, relativeRecordSetName, recordType)
+}
+
+func (c *planDNSClient) CreateOrUpdateRecordSet(ctx context.Context, resourceGroupName, zoneName, relativeRecordSetName string, recordType dns.RecordType, parameters dns.RecordSet, etag string) *retry.Error {
+	return c.recorder.record(planResourceTypeDNSRecordSet, resourceGroupName, getPlanRecordSetName(zoneName, relativeRecordSetName, string(recordType)), parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.GetRecordSet(ctx, resourceGroupName, zoneName, relativeRecordSetName, recordType)
+	})
+}
+
+func (c *planDNSClient) DeleteRecordSet(ctx context.Context, resourceGroupName, zoneName, relativeRecordSetName string, recordType dns.RecordType, etag string) *retry.Error {
+	return c.recorder.record(planResourceTypeDNSRecordSet, resourceGroupName, getPlanRecordSetName(zoneName, relativeRecordSetName, string(recordType)), nil, func() (interface{}, *retry.Error) {
+		return c.Interface.GetRecordSet(ctx, resourceGroupName, zoneName, relativeRecordSetName, recordType)
+	})
+}
+
+// planPrivateDNSClient reads the record sets of the private DNS zones from Azure and records the writes to them.
+type planPrivateDNSClient struct {
+	privatednsclient.Interface
+	recorder *planRecorder
+}
+
+func (c *planPrivateDNSClient) GetRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType) (privatedns.RecordSet, *retry.Error) {
+	name := getPlanRecordSetName(privateZoneName, relativeRecordSetName, string(recordType))
+	if desired, found := c.recorder.lookup(planResourceTypePrivateDNSRecordSet, resourceGroupName, name); found {
+		if desired == nil {
+			return privatedns.RecordSet{}, planNotFoundError(planResourceTypePrivateDNSRecordSet, resourceGroupName, name)
+		}
+		return desired.(privatedns.RecordSet), nil
+	}
+	return c.Interface.GetRecordSet(ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+}
+
+func (c *planPrivateDNSClient) CreateOrUpdateRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, parameters privatedns.RecordSet, etag string) *retry.Error {
+	return c.recorder.record(planResourceTypePrivateDNSRecordSet, resourceGroupName, getPlanRecordSetName(privateZoneName, relativeRecordSetName, string(recordType)), parameters, func() (interface{}, *retry.Error) {
+		return c.Interface.GetRecordSet(ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+	})
+}
+
+func (c *planPrivateDNSClient) DeleteRecordSet(ctx context.Context, resourceGroupName, privateZoneName, relativeRecordSetName string, recordType privatedns.RecordType, etag string) *retry.Error {
+	return c.recorder.record(planResourceTypePrivateDNSRecordSet, resourceGroupName, getPlanRecordSetName(privateZoneName, relativeRecordSetName, string(recordType)), nil, func() (interface{}, *retry.Error) {
+		return c.Interface.GetRecordSet(ctx, resourceGroupName, privateZoneName, relativeRecordSetName, recordType)
+	})
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/dns/mgmt/2018-05-01/dns"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/dnsclient/mockdnsclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestDiffPlanResources(t *testing.T) {
+	original := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Etag: to.StringPtr("etag"),
+		Tags: map[string]*string{
+			"removed": to.StringPtr("value"),
+			"changed": to.StringPtr("old"),
+		},
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: to.StringPtr("frontend"),
+					ID:   to.StringPtr("frontendID"),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: to.StringPtr("10.0.0.4"),
+					},
+				},
+			},
+			Probes: &[]network.Probe{
+				{
+					Name: to.StringPtr("probe"),
+					ID:   to.StringPtr("probeID"),
+				},
+			},
+		},
+	}
+	desired := network.LoadBalancer{
+		Name: to.StringPtr("lb"),
+		Tags: map[string]*string{
+			"changed": to.StringPtr("new"),
+			"added":   to.StringPtr("value"),
+		},
+		Sku: &network.LoadBalancerSku{Name: network.LoadBalancerSkuNameStandard},
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: to.StringPtr("frontend"),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: to.StringPtr("10.0.0.5"),
+					},
+				},
+			},
+			LoadBalancingRules: &[]network.LoadBalancingRule{
+				{
+					Name: to.StringPtr("rule"),
+				},
+			},
+		},
+	}
+
+	diffs, err := diffPlanResources(original, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []PlanDiff{
+		{Kind: planTagsKind, Added: []string{"added"}, Removed: []string{"removed"}, Changed: []string{"changed"}},
+		{Kind: planPropertiesKind, Added: []string{"sku"}},
+		{Kind: "frontendIPConfigurations", Changed: []string{"frontend"}},
+		{Kind: "loadBalancingRules", Added: []string{"rule"}},
+		{Kind: "probes", Removed: []string{"probe"}},
+	}, diffs)
+
+	diffs, err = diffPlanResources(original, original)
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	diffs, err = diffPlanResources(nil, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []PlanDiff{
+		{Kind: planTagsKind, Added: []string{"added", "changed"}},
+		{Kind: planPropertiesKind, Added: []string{"sku"}},
+		{Kind: "frontendIPConfigurations", Added: []string{"frontend"}},
+		{Kind: "loadBalancingRules", Added: []string{"rule"}},
+	}, diffs)
+}
+
+func TestPlanRecorder(t *testing.T) {
+	recorder := &planRecorder{subscriptionID: "subscription", entries: make(map[string]*planEntry)}
+	notFound := func() (interface{}, *retry.Error) {
+		return nil, &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}
+	}
+	existing := network.PublicIPAddress{Name: to.StringPtr("existing"), Tags: map[string]*string{"a": to.StringPtr("b")}}
+	getExisting := func() (interface{}, *retry.Error) {
+		return existing, nil
+	}
+
+	assert.Nil(t, recorder.record(planResourceTypePublicIPAddress, "rg", "created", network.PublicIPAddress{Name: to.StringPtr("created")}, notFound))
+	assert.Nil(t, recorder.record(planResourceTypePublicIPAddress, "rg", "createdAndDeleted", network.PublicIPAddress{}, notFound))
+	assert.Nil(t, recorder.record(planResourceTypePublicIPAddress, "rg", "createdAndDeleted", nil, notFound))
+	assert.Nil(t, recorder.record(planResourceTypePublicIPAddress, "rg", "unchanged", existing, getExisting))
+	assert.Nil(t, recorder.record(planResourceTypePublicIPAddress, "rg", "deleted", nil, getExisting))
+	assert.Nil(t, recorder.record(planResourceTypePublicIPAddress, "rg", "updated", network.PublicIPAddress{Name: to.StringPtr("existing")}, getExisting))
+	rerr := recorder.record(planResourceTypePublicIPAddress, "rg", "failed", nil, func() (interface{}, *retry.Error) {
+		return nil, &retry.Error{HTTPStatusCode: http.StatusInternalServerError}
+	})
+	assert.NotNil(t, rerr)
+
+	desired, found := recorder.lookup(planResourceTypePublicIPAddress, "RG", "Created")
+	assert.True(t, found)
+	assert.Equal(t, network.PublicIPAddress{Name: to.StringPtr("created")}, desired)
+	_, found = recorder.lookup(planResourceTypePublicIPAddress, "rg", "failed")
+	assert.False(t, found)
+	assert.Equal(t, []interface{}{network.PublicIPAddress{Name: to.StringPtr("created")}}, recorder.created(planResourceTypePublicIPAddress, "rg"))
+
+	plan, err := recorder.plan()
+	assert.NoError(t, err)
+	assert.Equal(t, []ResourcePlan{
+		{
+			ResourceType:  planResourceTypePublicIPAddress,
+			ResourceGroup: "rg",
+			Name:          "created",
+			Action:        PlanActionCreate,
+		},
+		{
+			ResourceType:  planResourceTypePublicIPAddress,
+			ResourceGroup: "rg",
+			Name:          "deleted",
+			Action:        PlanActionDelete,
+		},
+		{
+			ResourceType:  planResourceTypePublicIPAddress,
+			ResourceGroup: "rg",
+			Name:          "updated",
+			Action:        PlanActionUpdate,
+			Diffs:         []PlanDiff{{Kind: planTagsKind, Removed: []string{"a"}}},
+		},
+	}, plan)
+
+	recorder.reset()
+	plan, err = recorder.plan()
+	assert.NoError(t, err)
+	assert.Empty(t, plan)
+}
+
+func TestPlanLoadBalancerClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	existingLB := network.LoadBalancer{
+		Name:                         to.StringPtr("existing"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+	mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{existingLB}, nil).AnyTimes()
+	mockLBClient.EXPECT().Get(gomock.Any(), "rg", "existing", gomock.Any()).Return(existingLB, nil).Times(1)
+	mockLBClient.EXPECT().Get(gomock.Any(), "rg", "new", gomock.Any()).Return(network.LoadBalancer{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(1)
+
+	recorder := &planRecorder{subscriptionID: "subscription", entries: make(map[string]*planEntry)}
+	client := &planLoadBalancerClient{Interface: mockLBClient, recorder: recorder}
+
+	ctx := context.Background()
+	assert.Nil(t, client.CreateOrUpdate(ctx, "rg", "new", network.LoadBalancer{Name: to.StringPtr("new")}, ""))
+	lb, rerr := client.Get(ctx, "rg", "new", "")
+	assert.Nil(t, rerr)
+	assert.Equal(t, "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/new", to.String(lb.ID))
+
+	assert.Nil(t, client.CreateOrUpdateBackendPools(ctx, "rg", "new", "pool", network.BackendAddressPool{Name: to.StringPtr("pool")}, ""))
+	lb, rerr = client.Get(ctx, "rg", "new", "")
+	assert.Nil(t, rerr)
+	assert.Equal(t, 1, len(*lb.BackendAddressPools))
+
+	assert.Nil(t, client.Delete(ctx, "rg", "existing"))
+	_, rerr = client.Get(ctx, "rg", "existing", "")
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+
+	lbs, rerr := client.List(ctx, "rg")
+	assert.Nil(t, rerr)
+	assert.Equal(t, 1, len(lbs))
+	assert.Equal(t, "new", to.String(lbs[0].Name))
+
+	plan, err := recorder.plan()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(plan))
+	assert.Equal(t, PlanActionCreate, plan[0].Action)
+	assert.Equal(t, PlanActionDelete, plan[1].Action)
+}
+
+func TestPlanDNSClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDNSClient := mockdnsclient.NewMockInterface(ctrl)
+	mockDNSClient.EXPECT().GetRecordSet(gomock.Any(), "rg", "contoso.com", "www", dns.A).Return(dns.RecordSet{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(1)
+	mockDNSClient.EXPECT().GetRecordSet(gomock.Any(), "rg", "contoso.com", "www", dns.AAAA).Return(dns.RecordSet{RecordSetProperties: &dns.RecordSetProperties{}}, nil).Times(1)
+
+	recorder := &planRecorder{subscriptionID: "subscription", entries: make(map[string]*planEntry)}
+	client := &planDNSClient{Interface: mockDNSClient, recorder: recorder}
+
+	ctx := context.Background()
+	assert.Nil(t, client.CreateOrUpdateRecordSet(ctx, "rg", "contoso.com", "www", dns.A, dns.RecordSet{RecordSetProperties: &dns.RecordSetProperties{TTL: to.Int64Ptr(300)}}, ""))
+	recordSet, rerr := client.GetRecordSet(ctx, "rg", "contoso.com", "www", dns.A)
+	assert.Nil(t, rerr)
+	assert.Equal(t, int64(300), to.Int64(recordSet.TTL))
+
+	assert.Nil(t, client.DeleteRecordSet(ctx, "rg", "contoso.com", "www", dns.AAAA, ""))
+	_, rerr = client.GetRecordSet(ctx, "rg", "contoso.com", "www", dns.AAAA)
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+
+	plan, err := recorder.plan()
+	assert.NoError(t, err)
+	assert.Equal(t, []ResourcePlan{
+		{ResourceType: "dnsZones", ResourceGroup: "rg", Name: "contoso.com/A/www", Action: PlanActionCreate, Diffs: []PlanDiff{{Kind: planPropertiesKind, Added: []string{"TTL"}}}},
+		{ResourceType: "dnsZones", ResourceGroup: "rg", Name: "contoso.com/AAAA/www", Action: PlanActionDelete},
+	}, plan)
+}
+
+func TestPlanSubscriptionClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// the clients of the other subscriptions created during the plan record the writes
+	az := GetTestCloud(ctrl)
+	az.loadBalancerClientConfig = &azclients.ClientConfig{SubscriptionID: "subscription"}
+	az.dnsClientConfig = &azclients.ClientConfig{SubscriptionID: "subscription"}
+	az.privateDNSClientConfig = &azclients.ClientConfig{SubscriptionID: "subscription"}
+	newLoadBalancerPlanner(az, nil)
+
+	assert.IsType(t, &planLoadBalancerClient{}, az.getSubscriptionLoadBalancerClient("subscription"))
+	assert.IsType(t, &planLoadBalancerClient{}, az.getSubscriptionLoadBalancerClient("another"))
+	assert.IsType(t, &planDNSClient{}, az.getDNSClient("another"))
+	assert.IsType(t, &planPrivateDNSClient{}, az.getPrivateDNSClient("another"))
+}
+
+func TestPlanService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	mockLBBackendPool := az.LoadBalancerBackendPool.(*MockBackendPool)
+	mockLBBackendPool.EXPECT().ReconcileBackendPools(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, false, nil).AnyTimes()
+	mockLBBackendPool.EXPECT().EnsureHostsInPool(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	// no write is expected on any of the clients
+	mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	mockLBClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return(nil, nil).AnyTimes()
+	mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any()).Return(network.LoadBalancer{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).AnyTimes()
+	az.LoadBalancerClient = mockLBClient
+	mockPIPClient := mockpublicipclient.NewMockInterface(ctrl)
+	mockPIPClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return(nil, nil).AnyTimes()
+	mockPIPClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any()).Return(network.PublicIPAddress{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).AnyTimes()
+	az.PublicIPAddressesClient = mockPIPClient
+	mockSGClient := mocksecuritygroupclient.NewMockInterface(ctrl)
+	mockSGClient.EXPECT().Get(gomock.Any(), az.SecurityGroupResourceGroup, az.SecurityGroupName, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, networkSecurityGroupName, expand string) (network.SecurityGroup, *retry.Error) {
+			return *getTestSecurityGroup(az), nil
+		}).AnyTimes()
+	az.SecurityGroupsClient = mockSGClient
+
+	planner := newLoadBalancerPlanner(az, nil)
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+	for i := 0; i < 2; i++ {
+		plan, err := planner.PlanService(context.Background(), testClusterName, &service)
+		assert.NoError(t, err)
+		assert.Empty(t, plan.Error)
+		assert.Equal(t, "default/service", plan.Service)
+
+		resources := make(map[string]ResourcePlan)
+		for _, resource := range plan.Resources {
+			resources[resource.ResourceType] = resource
+		}
+		assert.Equal(t, 3, len(resources))
+
+		lbPlan := resources[planResourceTypeLoadBalancer]
+		assert.Equal(t, testClusterName, lbPlan.Name)
+		assert.Equal(t, PlanActionCreate, lbPlan.Action)
+		assert.Contains(t, lbPlan.Diffs, PlanDiff{Kind: "loadBalancingRules", Added: []string{"aservice-TCP-80"}})
+		assert.Contains(t, lbPlan.Diffs, PlanDiff{Kind: "probes", Added: []string{"aservice-TCP-80"}})
+		assert.Contains(t, lbPlan.Diffs, PlanDiff{Kind: "frontendIPConfigurations", Added: []string{"aservice"}})
+
+		pipPlan := resources[planResourceTypePublicIPAddress]
+		assert.Equal(t, "testCluster-aservice", pipPlan.Name)
+		assert.Equal(t, PlanActionCreate, pipPlan.Action)
+
+		sgPlan := resources[planResourceTypeSecurityGroup]
+		assert.Equal(t, PlanActionUpdate, sgPlan.Action)
+		assert.Equal(t, []PlanDiff{{Kind: "securityRules", Added: []string{"aservice-TCP-80-Internet"}}}, sgPlan.Diffs)
+	}
+
+	service.Spec.Type = v1.ServiceTypeClusterIP
+	plan, err := planner.PlanService(context.Background(), testClusterName, &service)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Error)
+	assert.Empty(t, plan.Resources)
+}
@@ -0,0 +1,659 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// azureReservedAddressCount is the number of the addresses at the beginning of each subnet reserved by Azure,
+// and the last address of the subnet is reserved as well.
+const azureReservedAddressCount = 4
+
+// validatePrivateIPPoolConfigs checks the private IP pools, and a subnet can only have one pool per IP family.
+func validatePrivateIPPoolConfigs(config *Config) error {
+	pools := sets.NewString()
+	for _, pool := range config.PrivateIPPools {
+		if pool.SubnetName == "" {
+			return fmt.Errorf("the subnet name of the private IP pool %s should not be empty", pool.CIDR)
+		}
+		_, cidr, err := net.ParseCIDR(pool.CIDR)
+		if err != nil {
+			return fmt.Errorf("the CIDR %q of the private IP pool of the subnet %s is invalid: %w", pool.CIDR, pool.SubnetName, err)
+		}
+		for _, excludedIP := range pool.ExcludedIPs {
+			if parseIPOrCIDR(excludedIP) == nil {
+				return fmt.Errorf("the excluded IP %q of the private IP pool of the subnet %s is not an IP or a CIDR", excludedIP, pool.SubnetName)
+			}
+		}
+		if pool.ReleaseCooldownInSeconds < 0 {
+			return fmt.Errorf("the releaseCooldownInSeconds %d of the private IP pool of the subnet %s should not be negative", pool.ReleaseCooldownInSeconds, pool.SubnetName)
+		}
+
+		key := fmt.Sprintf("%s/%t", strings.ToLower(pool.SubnetName), cidr.IP.To4() == nil)
+		if pools.Has(key) {
+			return fmt.Errorf("the subnet %s has more than one private IP pool of the same IP family", pool.SubnetName)
+		}
+		pools.Insert(key)
+	}
+	return nil
+}
+
+// parseIPOrCIDR parses the address or the CIDR into a network, and the address is a network of itself.
+func parseIPOrCIDR(s string) *net.IPNet {
+	if _, cidr, err := net.ParseCIDR(s); err == nil {
+		return cidr
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// getPrivateIPPool returns the private IP pool of the subnet and the IP family, or nil if there isn't one.
+func (az *Cloud) getPrivateIPPool(subnetName string, isIPv6 bool) (*PrivateIPPoolConfig, *net.IPNet) {
+	for i, pool := range az.PrivateIPPools {
+		if !strings.EqualFold(pool.SubnetName, subnetName) {
+			continue
+		}
+		if _, cidr, err := net.ParseCIDR(pool.CIDR); err == nil && (cidr.IP.To4() == nil) == isIPv6 {
+			return &az.PrivateIPPools[i], cidr
+		}
+	}
+	return nil, nil
+}
+
+// isPrivateIPInPool checks if the address is in the private IP pool of the subnet.
+func (az *Cloud) isPrivateIPInPool(subnetName, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	_, cidr := az.getPrivateIPPool(subnetName, ip.To4() == nil)
+	return cidr != nil && cidr.Contains(ip)
+}
+
+// allocatePoolPrivateIP allocates a static private IP to the frontend of the internal service from the private IP
+// pool of the subnet, and records the allocated addresses on the service. The address allocated to the service
+// before is allocated again if it is still available. It returns an empty string if the subnet has no pool.
+func (az *Cloud) allocatePoolPrivateIP(service *v1.Service, subnetName string, subnet network.Subnet, isIPv6 bool) (string, error) {
+	pool, cidr := az.getPrivateIPPool(subnetName, isIPv6)
+	if pool == nil {
+		return "", nil
+	}
+	serviceName := getServiceName(service)
+	if err := az.initPrivateIPPoolAllocator(); err != nil {
+		return "", err
+	}
+
+	// the addresses of the frontends of the load balancers are in use
+	lbs, err := az.ListLB(service)
+	if err != nil {
+		return "", err
+	}
+	inUse := sets.NewString()
+	for _, lb := range lbs {
+		if lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
+			continue
+		}
+		for _, fip := range *lb.FrontendIPConfigurations {
+			if fip.FrontendIPConfigurationPropertiesFormat == nil {
+				continue
+			}
+			if ip := net.ParseIP(to.String(fip.PrivateIPAddress)); ip != nil {
+				inUse.Insert(ip.String())
+			}
+		}
+	}
+
+	// the addresses recorded on other services are in use even if their frontends are not created yet
+	if az.serviceLister != nil {
+		services, err := az.serviceLister.List(labels.Everything())
+		if err != nil {
+			return "", err
+		}
+		for _, other := range services {
+			if other.UID != service.UID {
+				inUse.Insert(getServicePoolPrivateIPs(other)...)
+			}
+		}
+	}
+
+	excluded := getSubnetReservedAddresses(subnet)
+	for _, excludedIP := range pool.ExcludedIPs {
+		if excludedNet := parseIPOrCIDR(excludedIP); excludedNet != nil {
+			excluded = append(excluded, excludedNet)
+		}
+	}
+
+	cooldown := consts.DefaultPrivateIPPoolReleaseCooldown
+	if pool.ReleaseCooldownInSeconds > 0 {
+		cooldown = time.Duration(pool.ReleaseCooldownInSeconds) * time.Second
+	}
+
+	address, err := az.privateIPPoolAllocator.allocate(service.UID, cidr, excluded, inUse, getServicePoolPrivateIPs(service), cooldown)
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate the private IP of the service %s from the pool of the subnet %s: %w", serviceName, subnetName, err)
+	}
+	klog.V(2).Infof("allocatePoolPrivateIP(%s): allocated the private IP %s from the pool %s of the subnet %s", serviceName, address, pool.CIDR, subnetName)
+	az.recordPoolPrivateIPs(service)
+	az.savePrivateIPPoolReleases()
+	return address, nil
+}
+
+// releasePoolPrivateIPs releases the private IPs of the deleted service, which are not allocated to other services
+// until the cool-down of the pools ends.
+func (az *Cloud) releasePoolPrivateIPs(service *v1.Service, addresses []string) {
+	if len(az.PrivateIPPools) == 0 {
+		return
+	}
+	if err := az.initPrivateIPPoolAllocator(); err != nil {
+		klog.Warningf("releasePoolPrivateIPs(%s): %v", getServiceName(service), err)
+	}
+
+	poolAddresses := az.getPoolPrivateIPs(append(append([]string{}, addresses...), getServicePoolPrivateIPs(service)...))
+	if released := az.privateIPPoolAllocator.release(service.UID, poolAddresses, true); len(released) > 0 {
+		klog.V(2).Infof("releasePoolPrivateIPs(%s): released the private IPs %v", getServiceName(service), released)
+		az.savePrivateIPPoolReleases()
+	}
+	az.recordPoolPrivateIPs(service)
+}
+
+// releaseUnusedPoolPrivateIPs releases the private IPs allocated to the service which no longer uses them, because
+// it is switched to a public service or it sets the private IP of the IP family by spec.loadBalancerIP.
+func (az *Cloud) releaseUnusedPoolPrivateIPs(service *v1.Service) {
+	if len(az.PrivateIPPools) == 0 {
+		return
+	}
+	if err := az.initPrivateIPPoolAllocator(); err != nil {
+		klog.Warningf("releaseUnusedPoolPrivateIPs(%s): %v", getServiceName(service), err)
+		return
+	}
+
+	isInternal := requiresInternalLoadBalancer(service)
+	var unused []string
+	for _, address := range sets.NewString(append(az.privateIPPoolAllocator.getAllocations(service.UID), getServicePoolPrivateIPs(service)...)...).List() {
+		if !isInternal || getServiceLoadBalancerIP(service, net.ParseIP(address).To4() == nil) != "" {
+			unused = append(unused, address)
+		}
+	}
+	if len(unused) == 0 {
+		return
+	}
+	if released := az.privateIPPoolAllocator.release(service.UID, az.getPoolPrivateIPs(unused), false); len(released) > 0 {
+		klog.V(2).Infof("releaseUnusedPoolPrivateIPs(%s): released the private IPs %v", getServiceName(service), released)
+		az.savePrivateIPPoolReleases()
+	}
+	az.recordPoolPrivateIPs(service)
+}
+
+// getPoolPrivateIPs returns the addresses in the private IP pools.
+func (az *Cloud) getPoolPrivateIPs(addresses []string) []string {
+	var poolAddresses []string
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+		for _, pool := range az.PrivateIPPools {
+			if _, cidr, err := net.ParseCIDR(pool.CIDR); err == nil && cidr.Contains(ip) {
+				poolAddresses = append(poolAddresses, ip.String())
+				break
+			}
+		}
+	}
+	return poolAddresses
+}
+
+// getPrivateIPPoolMaxReleaseCooldown returns the longest cool-down of the private IP pools.
+func (az *Cloud) getPrivateIPPoolMaxReleaseCooldown() time.Duration {
+	var maxCooldown time.Duration
+	for _, pool := range az.PrivateIPPools {
+		cooldown := consts.DefaultPrivateIPPoolReleaseCooldown
+		if pool.ReleaseCooldownInSeconds > 0 {
+			cooldown = time.Duration(pool.ReleaseCooldownInSeconds) * time.Second
+		}
+		if cooldown > maxCooldown {
+			maxCooldown = cooldown
+		}
+	}
+	return maxCooldown
+}
+
+// initPrivateIPPoolAllocator restores the allocations from the annotations of the services and the releases from
+// the config map once after the cloud controller manager starts, so that the addresses allocated or released before
+// are not allocated to other services.
+func (az *Cloud) initPrivateIPPoolAllocator() error {
+	if az.KubeClient == nil || az.privateIPPoolAllocator.isInitialized() {
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	services, err := az.KubeClient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the services to restore the private IP pool allocations: %w", err)
+	}
+	allocations := make(map[string]types.UID)
+	for i := range services.Items {
+		service := &services.Items[i]
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		service, shouldHandle := az.applyServiceLoadBalancerClass(service)
+		if !shouldHandle || !requiresInternalLoadBalancer(service) {
+			continue
+		}
+		for _, address := range az.getPoolPrivateIPs(getServicePoolPrivateIPs(service)) {
+			allocations[address] = service.UID
+		}
+	}
+
+	releases := make(map[string]privateIPPoolRelease)
+	configMap, err := az.KubeClient.CoreV1().ConfigMaps(consts.PrivateIPPoolReleasesConfigMapNamespace).Get(ctx, consts.PrivateIPPoolReleasesConfigMapName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get the config map of the private IP pool releases: %w", err)
+	}
+	if err == nil && configMap.Data[consts.PrivateIPPoolReleasesConfigMapKey] != "" {
+		if err := json.Unmarshal([]byte(configMap.Data[consts.PrivateIPPoolReleasesConfigMapKey]), &releases); err != nil {
+			klog.Warningf("initPrivateIPPoolAllocator: failed to parse the private IP pool releases, ignoring them: %v", err)
+			releases = make(map[string]privateIPPoolRelease)
+		}
+	}
+
+	az.privateIPPoolAllocator.restore(allocations, releases)
+	return nil
+}
+
+// savePrivateIPPoolReleases records the releases in the cool-down on the config map, so that they are kept after
+// the cloud controller manager restarts.
+func (az *Cloud) savePrivateIPPoolReleases() {
+	if az.KubeClient == nil {
+		return
+	}
+
+	data, err := json.Marshal(az.privateIPPoolAllocator.getReleases(az.getPrivateIPPoolMaxReleaseCooldown()))
+	if err != nil {
+		klog.Errorf("savePrivateIPPoolReleases: failed to marshal the releases: %v", err)
+		return
+	}
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	configMaps := az.KubeClient.CoreV1().ConfigMaps(consts.PrivateIPPoolReleasesConfigMapNamespace)
+	configMap, err := configMaps.Get(ctx, consts.PrivateIPPoolReleasesConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: consts.PrivateIPPoolReleasesConfigMapName, Namespace: consts.PrivateIPPoolReleasesConfigMapNamespace},
+			Data:       map[string]string{consts.PrivateIPPoolReleasesConfigMapKey: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+			klog.Warningf("savePrivateIPPoolReleases: failed to create the config map of the releases: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		klog.Warningf("savePrivateIPPoolReleases: failed to get the config map of the releases: %v", err)
+		return
+	}
+	if configMap.Data[consts.PrivateIPPoolReleasesConfigMapKey] == string(data) {
+		return
+	}
+	configMap = configMap.DeepCopy()
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[consts.PrivateIPPoolReleasesConfigMapKey] = string(data)
+	if _, err := configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		klog.Warningf("savePrivateIPPoolReleases: failed to update the config map of the releases: %v", err)
+	}
+}
+
+// getServicePoolPrivateIPs returns the private IPs allocated from the pools recorded on the service.
+func getServicePoolPrivateIPs(service *v1.Service) []string {
+	var addresses []string
+	for _, address := range strings.Split(service.Annotations[consts.ServiceAnnotationPrivateIPPoolAddresses], ",") {
+		if ip := net.ParseIP(strings.TrimSpace(address)); ip != nil {
+			addresses = append(addresses, ip.String())
+		}
+	}
+	return addresses
+}
+
+// recordPoolPrivateIPs records the private IPs allocated to the service on its annotation, so that they are kept
+// after the cloud controller manager restarts.
+func (az *Cloud) recordPoolPrivateIPs(service *v1.Service) {
+	if az.KubeClient == nil {
+		return
+	}
+
+	addresses := strings.Join(az.privateIPPoolAllocator.getAllocations(service.UID), ",")
+	if addresses == service.Annotations[consts.ServiceAnnotationPrivateIPPoolAddresses] {
+		return
+	}
+	serviceName := getServiceName(service)
+	// the annotation is removed after the addresses are released
+	var annotation interface{}
+	if addresses != "" {
+		annotation = addresses
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{consts.ServiceAnnotationPrivateIPPoolAddresses: annotation},
+		},
+	})
+	if err != nil {
+		klog.Errorf("recordPoolPrivateIPs(%s): failed to marshal the annotation patch: %v", serviceName, err)
+		return
+	}
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if _, err := az.KubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		klog.Warningf("recordPoolPrivateIPs(%s): failed to record the private IPs %s: %v", serviceName, addresses, err)
+	}
+}
+
+// getSubnetReservedAddresses returns the addresses of the subnet reserved by Azure.
+func getSubnetReservedAddresses(subnet network.Subnet) []*net.IPNet {
+	if subnet.SubnetPropertiesFormat == nil {
+		return nil
+	}
+
+	var reserved []*net.IPNet
+	for _, prefix := range *collectionOrSingle(subnet.AddressPrefixes, subnet.AddressPrefix) {
+		_, cidr, err := net.ParseCIDR(prefix)
+		if err != nil {
+			continue
+		}
+		ip := cidr.IP
+		for i := 0; i < azureReservedAddressCount; i++ {
+			reserved = append(reserved, parseIPOrCIDR(ip.String()))
+			ip = nextIP(ip)
+		}
+		reserved = append(reserved, parseIPOrCIDR(lastIP(cidr).String()))
+	}
+	return reserved
+}
+
+// nextIP returns the address after the given one.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// lastIP returns the last address of the network.
+func lastIP(cidr *net.IPNet) net.IP {
+	last := make(net.IP, len(cidr.IP))
+	for i := range cidr.IP {
+		last[i] = cidr.IP[i] | ^cidr.Mask[i]
+	}
+	return last
+}
+
+// privateIPPoolAllocator tracks the private IPs allocated from the pools. The allocations are serialized, and an
+// allocated address is not allocated to other services before it is released, so the concurrent reconciliations of
+// the services don't get the same address even before their frontends are created.
+type privateIPPoolAllocator struct {
+	lock sync.Mutex
+	// initialized is set after the allocations and the releases are restored.
+	initialized bool
+	// allocations are the UIDs of the services which the addresses are allocated to, keyed by the address.
+	allocations map[string]types.UID
+	// releases records when and by which service the addresses are released, keyed by the address.
+	releases map[string]privateIPPoolRelease
+	// now returns the current time, which is replaced in the tests.
+	now func() time.Time
+}
+
+type privateIPPoolRelease struct {
+	ServiceUID types.UID `json:"serviceUID"`
+	ReleasedAt time.Time `json:"releasedAt"`
+}
+
+// allocate returns an available address in the CIDR for the service, which is the one allocated to the service
+// before, one of the preferred addresses, or the first one available. An address is not available if it is
+// excluded, in use, allocated to another service, or released by another service during the cool-down.
+func (a *privateIPPoolAllocator) allocate(serviceUID types.UID, cidr *net.IPNet, excluded []*net.IPNet, inUse sets.String, preferred []string, cooldown time.Duration) (string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.init()
+
+	now := a.now()
+	isAvailable := func(ip net.IP) bool {
+		if !cidr.Contains(ip) || inUse.Has(ip.String()) {
+			return false
+		}
+		for _, excludedNet := range excluded {
+			if excludedNet.Contains(ip) {
+				return false
+			}
+		}
+		if uid, found := a.allocations[ip.String()]; found && uid != serviceUID {
+			return false
+		}
+		if release, found := a.releases[ip.String()]; found && release.ServiceUID != serviceUID && now.Sub(release.ReleasedAt) < cooldown {
+			return false
+		}
+		return true
+	}
+	allocate := func(ip net.IP) string {
+		// the service has one address per IP family, and the other ones, e.g. in the pool of the previous
+		// subnet of the service, are released
+		for address, uid := range a.allocations {
+			if uid == serviceUID && address != ip.String() && (net.ParseIP(address).To4() == nil) == (ip.To4() == nil) {
+				delete(a.allocations, address)
+				a.releases[address] = privateIPPoolRelease{ServiceUID: serviceUID, ReleasedAt: now}
+			}
+		}
+		a.allocations[ip.String()] = serviceUID
+		delete(a.releases, ip.String())
+		return ip.String()
+	}
+
+	var candidates []string
+	for address, uid := range a.allocations {
+		if uid == serviceUID {
+			candidates = append(candidates, address)
+		}
+	}
+	sort.Strings(candidates)
+	for _, address := range append(candidates, preferred...) {
+		if ip := net.ParseIP(address); ip != nil && isAvailable(ip) {
+			return allocate(ip), nil
+		}
+	}
+
+	ip := cidr.IP
+	for cidr.Contains(ip) {
+		skipped := false
+		for _, excludedNet := range excluded {
+			// the excluded range is skipped at once, which may be large in the IPv6 pools
+			if excludedNet.Contains(ip) {
+				ip = lastIP(excludedNet)
+				skipped = true
+				break
+			}
+		}
+		if !skipped && isAvailable(ip) {
+			return allocate(ip), nil
+		}
+		next := nextIP(ip)
+		if next.IsUnspecified() {
+			break
+		}
+		ip = next
+	}
+	return "", fmt.Errorf("no private IP is available in the pool %s", cidr.String())
+}
+
+// release drops the given allocations of the service and records the released addresses, including the ones which
+// may be allocated before the cloud controller manager restarts. All allocations of the service are released if all
+// is set.
+func (a *privateIPPoolAllocator) release(serviceUID types.UID, addresses []string, all bool) []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.init()
+
+	released := sets.NewString(addresses...)
+	if all {
+		for address, uid := range a.allocations {
+			if uid == serviceUID {
+				released.Insert(address)
+			}
+		}
+	}
+	now := a.now()
+	for _, address := range released.List() {
+		if uid, found := a.allocations[address]; found && uid != serviceUID {
+			released.Delete(address)
+			continue
+		}
+		delete(a.allocations, address)
+		a.releases[address] = privateIPPoolRelease{ServiceUID: serviceUID, ReleasedAt: now}
+	}
+	return released.List()
+}
+
+// getAllocations returns the addresses allocated to the service.
+func (a *privateIPPoolAllocator) getAllocations(serviceUID types.UID) []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var addresses []string
+	for address, uid := range a.allocations {
+		if uid == serviceUID {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// getServiceUID returns the UID of the service which any address is allocated to and whose rule prefix is the given
+// one, so that the addresses of a deleted service are released by the orphaned resource gc.
+func (a *privateIPPoolAllocator) getServiceUID(rulePrefix string) (types.UID, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, uid := range a.allocations {
+		if strings.EqualFold(cloudprovider.DefaultLoadBalancerName(&v1.Service{ObjectMeta: metav1.ObjectMeta{UID: uid}}), rulePrefix) {
+			return uid, true
+		}
+	}
+	return "", false
+}
+
+// getReleases drops the releases older than the cool-down and returns the other ones.
+func (a *privateIPPoolAllocator) getReleases(cooldown time.Duration) map[string]privateIPPoolRelease {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.init()
+
+	now := a.now()
+	releases := make(map[string]privateIPPoolRelease)
+	for address, release := range a.releases {
+		if now.Sub(release.ReleasedAt) >= cooldown {
+			delete(a.releases, address)
+			continue
+		}
+		releases[address] = release
+	}
+	return releases
+}
+
+// restore adds the allocations and the releases recorded before the cloud controller manager restarts, unless they
+// have been restored. The addresses allocated or released since the start are kept.
+func (a *privateIPPoolAllocator) restore(allocations map[string]types.UID, releases map[string]privateIPPoolRelease) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.init()
+	if a.initialized {
+		return
+	}
+
+	for address, release := range releases {
+		if _, found := a.allocations[address]; !found {
+			if _, found := a.releases[address]; !found {
+				a.releases[address] = release
+			}
+		}
+	}
+	for address, uid := range allocations {
+		if _, found := a.allocations[address]; !found {
+			a.allocations[address] = uid
+			delete(a.releases, address)
+		}
+	}
+	a.initialized = true
+}
+
+func (a *privateIPPoolAllocator) isInitialized() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.initialized
+}
+
+// reset drops all allocations and releases.
+func (a *privateIPPoolAllocator) reset() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.allocations = nil
+	a.releases = nil
+	a.initialized = false
+}
+
+func (a *privateIPPoolAllocator) init() {
+	if a.allocations == nil {
+		a.allocations = make(map[string]types.UID)
+	}
+	if a.releases == nil {
+		a.releases = make(map[string]privateIPPoolRelease)
+	}
+	if a.now == nil {
+		a.now = time.Now
+	}
+}
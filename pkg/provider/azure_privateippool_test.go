@@ -0,0 +1,307 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestValidatePrivateIPPoolConfigs(t *testing.T) {
+	for _, test := range []struct {
+		desc        string
+		pools       []PrivateIPPoolConfig
+		expectedErr bool
+	}{
+		{
+			desc: "the pools should be optional",
+		},
+		{
+			desc: "the pools of different IP families should be allowed in a subnet",
+			pools: []PrivateIPPoolConfig{
+				{SubnetName: "subnet", CIDR: "10.0.0.128/25", ExcludedIPs: []string{"10.0.0.130", "10.0.0.192/28"}},
+				{SubnetName: "subnet", CIDR: "fd00::/120"},
+			},
+		},
+		{
+			desc:        "an error should be returned if the subnet name is empty",
+			pools:       []PrivateIPPoolConfig{{CIDR: "10.0.0.128/25"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "an error should be returned if the CIDR is invalid",
+			pools:       []PrivateIPPoolConfig{{SubnetName: "subnet", CIDR: "10.0.0.128"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "an error should be returned if the excluded IP is invalid",
+			pools:       []PrivateIPPoolConfig{{SubnetName: "subnet", CIDR: "10.0.0.128/25", ExcludedIPs: []string{"invalid"}}},
+			expectedErr: true,
+		},
+		{
+			desc:        "an error should be returned if the cool-down is negative",
+			pools:       []PrivateIPPoolConfig{{SubnetName: "subnet", CIDR: "10.0.0.128/25", ReleaseCooldownInSeconds: -1}},
+			expectedErr: true,
+		},
+		{
+			desc: "an error should be returned if a subnet has two pools of the same IP family",
+			pools: []PrivateIPPoolConfig{
+				{SubnetName: "subnet", CIDR: "10.0.0.128/25"},
+				{SubnetName: "Subnet", CIDR: "10.0.1.0/24"},
+			},
+			expectedErr: true,
+		},
+	} {
+		err := validatePrivateIPPoolConfigs(&Config{PrivateIPPools: test.pools})
+		assert.Equal(t, test.expectedErr, err != nil, test.desc)
+	}
+}
+
+func TestPrivateIPPoolAllocator(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/29")
+	excluded := []*net.IPNet{parseIPOrCIDR("10.0.0.0/31"), parseIPOrCIDR("10.0.0.3"), parseIPOrCIDR("10.0.0.7")}
+	now := time.Now()
+	allocator := &privateIPPoolAllocator{now: func() time.Time { return now }}
+
+	// the excluded and in-use addresses are skipped
+	address, err := allocator.allocate("uid1", cidr, excluded, sets.NewString("10.0.0.2"), nil, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.4", address)
+	// the address allocated to the service is allocated again
+	address, err = allocator.allocate("uid1", cidr, excluded, sets.NewString("10.0.0.2"), nil, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.4", address)
+	// the address allocated to another service is not allocated before its frontend is created
+	address, err = allocator.allocate("uid2", cidr, excluded, sets.NewString("10.0.0.2"), []string{"10.0.0.4"}, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", address)
+
+	// the released address is not allocated to other services during the cool-down
+	assert.Equal(t, []string{"10.0.0.4"}, allocator.release("uid1", nil, true))
+	address, err = allocator.allocate("uid3", cidr, excluded, sets.NewString("10.0.0.2"), nil, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.6", address)
+	_, err = allocator.allocate("uid4", cidr, excluded, sets.NewString("10.0.0.2"), nil, time.Hour)
+	assert.Error(t, err)
+	// but the service releasing it can get it back
+	address, err = allocator.allocate("uid1", cidr, excluded, sets.NewString("10.0.0.2"), []string{"10.0.0.4"}, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.4", address)
+	allocator.release("uid1", nil, true)
+
+	now = now.Add(time.Hour)
+	address, err = allocator.allocate("uid4", cidr, excluded, sets.NewString("10.0.0.2"), nil, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.4", address)
+	assert.Equal(t, []string{"10.0.0.4"}, allocator.getAllocations("uid4"))
+
+	// the concurrent allocations get different addresses
+	_, cidr, _ = net.ParseCIDR("fd00::/112")
+	allocator.reset()
+	var wg sync.WaitGroup
+	addresses := make([]string, 10)
+	for i := range addresses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			addresses[i], _ = allocator.allocate(types.UID(fmt.Sprintf("uid%d", i)), cidr, nil, sets.NewString(), nil, time.Hour)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, len(addresses), sets.NewString(addresses...).Len())
+}
+
+func TestAllocatePoolPrivateIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.PrivateIPPools = []PrivateIPPoolConfig{{SubnetName: "subnet", CIDR: "10.0.0.0/28", ExcludedIPs: []string{"10.0.0.5"}}}
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	az.KubeClient = fake.NewSimpleClientset(&svc)
+	subnet := network.Subnet{SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr("10.0.0.0/24")}}
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{{
+		Name: to.StringPtr("kubernetes-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{PrivateIPAddress: to.StringPtr("10.0.0.4")},
+			}},
+		},
+	}}, nil)
+
+	// the addresses reserved by Azure, in use or excluded are skipped
+	address, err := az.allocatePoolPrivateIP(&svc, "subnet", subnet, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.6", address)
+	updatedService, err := az.KubeClient.CoreV1().Services("default").Get(context.TODO(), "service1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.6", updatedService.Annotations[consts.ServiceAnnotationPrivateIPPoolAddresses])
+	assert.True(t, az.isPrivateIPInPool("Subnet", "10.0.0.6"))
+	assert.False(t, az.isPrivateIPInPool("subnet", "10.0.1.6"))
+
+	// the subnet without a pool of the IP family allocates the dynamic address
+	address, err = az.allocatePoolPrivateIP(&svc, "subnet", subnet, true)
+	assert.NoError(t, err)
+	assert.Empty(t, address)
+
+	// the recorded address is released when the service is deleted
+	az.releasePoolPrivateIPs(updatedService, nil)
+	assert.Empty(t, az.privateIPPoolAllocator.getAllocations(svc.UID))
+	assert.Contains(t, az.privateIPPoolAllocator.releases, "10.0.0.6")
+}
+
+func TestPrivateIPPoolAllocatorRestore(t *testing.T) {
+	now := time.Now()
+	allocator := &privateIPPoolAllocator{now: func() time.Time { return now }}
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/29")
+
+	// the addresses allocated since the start are kept
+	address, err := allocator.allocate("uid1", cidr, nil, sets.NewString(), nil, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0", address)
+	allocator.restore(map[string]types.UID{"10.0.0.0": "uid2", "10.0.0.1": "uid2"}, map[string]privateIPPoolRelease{
+		"10.0.0.2": {ServiceUID: "uid3", ReleasedAt: now.Add(-time.Minute)},
+		"10.0.0.3": {ServiceUID: "uid3", ReleasedAt: now.Add(-2 * time.Hour)},
+	})
+	assert.True(t, allocator.isInitialized())
+	assert.Equal(t, []string{"10.0.0.0"}, allocator.getAllocations("uid1"))
+	assert.Equal(t, []string{"10.0.0.1"}, allocator.getAllocations("uid2"))
+
+	// the releases are restored only once
+	allocator.restore(map[string]types.UID{"10.0.0.4": "uid4"}, nil)
+	assert.Empty(t, allocator.getAllocations("uid4"))
+
+	// the releases out of the cool-down are dropped
+	assert.Equal(t, map[string]privateIPPoolRelease{"10.0.0.2": {ServiceUID: "uid3", ReleasedAt: now.Add(-time.Minute)}}, allocator.getReleases(time.Hour))
+	address, err = allocator.allocate("uid4", cidr, nil, sets.NewString(), nil, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.3", address)
+
+	// only the given addresses are released unless all of them are
+	assert.Equal(t, []string{"10.0.0.1"}, allocator.release("uid2", []string{"10.0.0.1", "10.0.0.3"}, false))
+	assert.Equal(t, []string{"10.0.0.3"}, allocator.getAllocations("uid4"))
+}
+
+func TestInitPrivateIPPoolAllocator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.PrivateIPPools = []PrivateIPPoolConfig{{SubnetName: "subnet", CIDR: "10.0.0.0/28"}}
+	svc := getInternalTestService("service1", 80)
+	// the addresses of another service are recorded before the restart, and its frontend is not created yet
+	other := getInternalTestService("service2", 80)
+	other.Annotations[consts.ServiceAnnotationPrivateIPPoolAddresses] = "10.0.0.4"
+	releases, _ := json.Marshal(map[string]privateIPPoolRelease{"10.0.0.5": {ServiceUID: "service3", ReleasedAt: time.Now()}})
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: consts.PrivateIPPoolReleasesConfigMapName, Namespace: consts.PrivateIPPoolReleasesConfigMapNamespace},
+		Data:       map[string]string{consts.PrivateIPPoolReleasesConfigMapKey: string(releases)},
+	}
+	az.KubeClient = fake.NewSimpleClientset(&svc, &other, configMap)
+	subnet := network.Subnet{SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr("10.0.0.0/24")}}
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil)
+
+	// the address allocated to another service and the one released during the cool-down are skipped
+	address, err := az.allocatePoolPrivateIP(&svc, "subnet", subnet, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.6", address)
+	assert.Equal(t, []string{"10.0.0.4"}, az.privateIPPoolAllocator.getAllocations(other.UID))
+
+	// the releases are recorded on the config map
+	az.releasePoolPrivateIPs(&other, nil)
+	configMap, err = az.KubeClient.CoreV1().ConfigMaps(consts.PrivateIPPoolReleasesConfigMapNamespace).Get(context.TODO(), consts.PrivateIPPoolReleasesConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	savedReleases := make(map[string]privateIPPoolRelease)
+	assert.NoError(t, json.Unmarshal([]byte(configMap.Data[consts.PrivateIPPoolReleasesConfigMapKey]), &savedReleases))
+	assert.Equal(t, sets.NewString("10.0.0.4", "10.0.0.5"), sets.StringKeySet(savedReleases))
+	assert.Equal(t, types.UID("service2"), savedReleases["10.0.0.4"].ServiceUID)
+	updatedService, err := az.KubeClient.CoreV1().Services("default").Get(context.TODO(), "service2", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, updatedService.Annotations, consts.ServiceAnnotationPrivateIPPoolAddresses)
+}
+
+func TestReleaseUnusedPoolPrivateIPs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range []struct {
+		desc             string
+		internal         bool
+		loadBalancerIP   string
+		expectedReleased bool
+	}{
+		{
+			desc:     "the addresses of the internal service should be kept",
+			internal: true,
+		},
+		{
+			desc:             "the addresses of the service switched to public should be released",
+			expectedReleased: true,
+		},
+		{
+			desc:             "the address should be released if the service sets the private IP of the IP family",
+			internal:         true,
+			loadBalancerIP:   "10.0.0.10",
+			expectedReleased: true,
+		},
+		{
+			desc:           "the address should be kept if the service sets the private IP of the other IP family",
+			internal:       true,
+			loadBalancerIP: "fd00::10",
+		},
+	} {
+		az := GetTestCloud(ctrl)
+		az.PrivateIPPools = []PrivateIPPoolConfig{{SubnetName: "subnet", CIDR: "10.0.0.0/28"}}
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationPrivateIPPoolAddresses: "10.0.0.4"}, false, 80)
+		if test.internal {
+			svc.Annotations[consts.ServiceAnnotationLoadBalancerInternal] = consts.TrueAnnotationValue
+		}
+		svc.Spec.LoadBalancerIP = test.loadBalancerIP
+		az.KubeClient = fake.NewSimpleClientset(&svc)
+
+		az.releaseUnusedPoolPrivateIPs(&svc)
+		_, released := az.privateIPPoolAllocator.releases["10.0.0.4"]
+		assert.Equal(t, test.expectedReleased, released, test.desc)
+		updatedService, err := az.KubeClient.CoreV1().Services("default").Get(context.TODO(), "service1", metav1.GetOptions{})
+		assert.NoError(t, err, test.desc)
+		_, recorded := updatedService.Annotations[consts.ServiceAnnotationPrivateIPPoolAddresses]
+		assert.Equal(t, !test.expectedReleased, recorded, test.desc)
+	}
+}
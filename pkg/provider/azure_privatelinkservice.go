@@ -509,11 +509,14 @@ func (az *Cloud) reconcilePLSTags(
 	} else {
 		configTags[consts.OwnerServiceTagKey] = &serviceName
 	}
+	// the owner service records the annotations required to clean up the service
+	ownedAlone := strings.EqualFold(to.String(configTags[consts.OwnerServiceTagKey]), serviceName)
+	deleted := addServiceCleanupTags(service, ownedAlone, existingPLS.Tags, configTags)
 
 	tags, changed := az.reconcileTags(existingPLS.Tags, configTags)
 	existingPLS.Tags = tags
 
-	return changed
+	return changed || deleted
 }
 
 func getPLSSubnetName(service *v1.Service) *string {
@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// shouldRetainPublicIP checks if the dynamically created public IP of the service is retained instead of deleted
+// when the service no longer needs it. The service annotation takes precedence over the default of the cluster.
+func (az *Cloud) shouldRetainPublicIP(service *v1.Service) bool {
+	if _, found := service.Annotations[consts.ServiceAnnotationPIPRetainOnDelete]; found {
+		return getBoolValueFromServiceAnnotations(service, consts.ServiceAnnotationPIPRetainOnDelete)
+	}
+	return az.RetainPublicIPOnServiceDeletion
+}
+
+// isRetainedPublicIP checks if the public IP is retained after the deletion of its service and not reclaimed yet.
+func isRetainedPublicIP(pip *network.PublicIPAddress) bool {
+	if pip == nil || pip.Tags == nil {
+		return false
+	}
+	found, _ := findKeyInMapCaseInsensitive(pip.Tags, consts.RetainedServiceKey)
+	return found
+}
+
+// retainPublicIP tags the public IP no longer used by any service as retained by the service, so that it is kept
+// until a service of the cluster reclaims it. The cluster name tag is kept for the ownership checks.
+func retainPublicIP(pip *network.PublicIPAddress, serviceName, clusterName string) {
+	if pip.Tags == nil {
+		pip.Tags = make(map[string]*string)
+	}
+	if found, key := findKeyInMapCaseInsensitive(pip.Tags, consts.RetainedServiceKey); found {
+		delete(pip.Tags, key)
+	}
+	pip.Tags[consts.RetainedServiceKey] = to.StringPtr(serviceName)
+	if getClusterFromPIPClusterTags(pip.Tags) == "" {
+		pip.Tags[consts.ClusterNameKey] = to.StringPtr(clusterName)
+	}
+}
+
+// reclaimRetainedPublicIP removes the retained tag from the public IP reclaimed by a service.
+func reclaimRetainedPublicIP(pip *network.PublicIPAddress) bool {
+	if pip == nil || pip.Tags == nil {
+		return false
+	}
+	found, key := findKeyInMapCaseInsensitive(pip.Tags, consts.RetainedServiceKey)
+	if found {
+		delete(pip.Tags, key)
+	}
+	return found
+}
+
+// serviceRequestsPublicIP checks if the service requests the public IP by its name or address.
+func serviceRequestsPublicIP(service *v1.Service, pip *network.PublicIPAddress) bool {
+	if name := service.Annotations[consts.ServiceAnnotationPIPName]; name != "" && strings.EqualFold(name, to.String(pip.Name)) {
+		return true
+	}
+	return pip.PublicIPAddressPropertiesFormat != nil && to.String(pip.IPAddress) != "" &&
+		strings.EqualFold(to.String(pip.IPAddress), service.Spec.LoadBalancerIP)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestRetainedPublicIP(clusterName string) network.PublicIPAddress {
+	return network.PublicIPAddress{
+		Name: to.StringPtr("pip1"),
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress:                to.StringPtr("1.2.3.4"),
+			PublicIPAllocationMethod: network.IPAllocationMethodStatic,
+		},
+		Tags: map[string]*string{
+			consts.ServiceTagKey:      to.StringPtr(""),
+			consts.ClusterNameKey:     to.StringPtr(clusterName),
+			consts.RetainedServiceKey: to.StringPtr("default/deleted"),
+		},
+	}
+}
+
+func TestShouldRetainPublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	assert.False(t, az.shouldRetainPublicIP(&svc))
+
+	az.RetainPublicIPOnServiceDeletion = true
+	assert.True(t, az.shouldRetainPublicIP(&svc))
+
+	// the annotation overrides the default of the cluster
+	svc.Annotations = map[string]string{consts.ServiceAnnotationPIPRetainOnDelete: "false"}
+	assert.False(t, az.shouldRetainPublicIP(&svc))
+	az.RetainPublicIPOnServiceDeletion = false
+	svc.Annotations[consts.ServiceAnnotationPIPRetainOnDelete] = "True"
+	assert.True(t, az.shouldRetainPublicIP(&svc))
+}
+
+func TestServiceOwnsRetainedPublicIP(t *testing.T) {
+	for _, test := range []struct {
+		desc           string
+		annotations    map[string]string
+		loadBalancerIP string
+		clusterName    string
+		expectedOwns   bool
+	}{
+		{
+			desc:        "the retained public IP should not be owned by the service not requesting it",
+			clusterName: "kubernetes",
+		},
+		{
+			desc:         "the retained public IP should be owned by the service requesting it by name",
+			annotations:  map[string]string{consts.ServiceAnnotationPIPName: "PIP1"},
+			clusterName:  "kubernetes",
+			expectedOwns: true,
+		},
+		{
+			desc:           "the retained public IP should be owned by the service requesting it by address",
+			loadBalancerIP: "1.2.3.4",
+			clusterName:    "kubernetes",
+			expectedOwns:   true,
+		},
+		{
+			desc:        "the retained public IP should not be owned by the service of another cluster",
+			annotations: map[string]string{consts.ServiceAnnotationPIPName: "pip1"},
+			clusterName: "another",
+		},
+	} {
+		svc := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+		svc.Spec.LoadBalancerIP = test.loadBalancerIP
+		pip := getTestRetainedPublicIP("kubernetes")
+
+		owns, isUserAssignedPIP := serviceOwnsPublicIP(&svc, &pip, test.clusterName)
+		assert.Equal(t, test.expectedOwns, owns, test.desc)
+		assert.False(t, isUserAssignedPIP, test.desc)
+	}
+}
+
+func TestGetPublicIPUpdatesRetainsPublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range []struct {
+		desc             string
+		annotations      map[string]string
+		serviceTag       string
+		retainByDefault  bool
+		expectedDeleted  bool
+		expectedRetained bool
+	}{
+		{
+			desc:            "the public IP should be deleted if it is not retained",
+			serviceTag:      "default/service1",
+			expectedDeleted: true,
+		},
+		{
+			desc:             "the public IP should be retained by the annotation",
+			annotations:      map[string]string{consts.ServiceAnnotationPIPRetainOnDelete: "true"},
+			serviceTag:       "default/service1",
+			expectedRetained: true,
+		},
+		{
+			desc:             "the public IP should be retained by the default of the cluster",
+			serviceTag:       "default/service1",
+			retainByDefault:  true,
+			expectedRetained: true,
+		},
+		{
+			desc:            "the annotation should override the default of the cluster",
+			annotations:     map[string]string{consts.ServiceAnnotationPIPRetainOnDelete: "false"},
+			serviceTag:      "default/service1",
+			retainByDefault: true,
+			expectedDeleted: true,
+		},
+		{
+			desc:        "the public IP used by other services should be neither retained nor deleted",
+			annotations: map[string]string{consts.ServiceAnnotationPIPRetainOnDelete: "true"},
+			serviceTag:  "default/service1,default/service2",
+		},
+	} {
+		az := GetTestCloud(ctrl)
+		az.RetainPublicIPOnServiceDeletion = test.retainByDefault
+		svc := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+		pip := network.PublicIPAddress{
+			Name: to.StringPtr("pip1"),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: to.StringPtr("1.2.3.4"),
+			},
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  to.StringPtr(test.serviceTag),
+				consts.ClusterNameKey: to.StringPtr("kubernetes"),
+			},
+		}
+
+		_, pipsToBeDeleted, _, pipsToBeUpdated, err := az.getPublicIPUpdates("kubernetes", &svc, []network.PublicIPAddress{pip}, false, false, map[bool]string{}, "default/service1", serviceIPTagRequest{}, map[bool]bool{})
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.expectedDeleted, len(pipsToBeDeleted) == 1, test.desc)
+		assert.Equal(t, !test.expectedDeleted, len(pipsToBeUpdated) == 1, test.desc)
+		if len(pipsToBeUpdated) == 1 {
+			assert.Equal(t, test.expectedRetained, isRetainedPublicIP(pipsToBeUpdated[0]), test.desc)
+			assert.Equal(t, "kubernetes", getClusterFromPIPClusterTags(pipsToBeUpdated[0].Tags), test.desc)
+		}
+		if test.expectedRetained {
+			assert.Empty(t, getServiceFromPIPServiceTags(pipsToBeUpdated[0].Tags), test.desc)
+			assert.Equal(t, "default/service1", to.String(pipsToBeUpdated[0].Tags[consts.RetainedServiceKey]), test.desc)
+		}
+	}
+
+	// the retained public IP requested by a service is not deleted even if its IP tags don't match
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationPIPName: "pip1"}, false, 80)
+	ipTagRequest := serviceIPTagRequest{IPTagsRequestedByAnnotation: true, IPTags: &[]network.IPTag{{IPTagType: to.StringPtr("tag"), Tag: to.StringPtr("value")}}}
+	_, pipsToBeDeleted, _, _, err := az.getPublicIPUpdates("kubernetes", &svc, []network.PublicIPAddress{getTestRetainedPublicIP("kubernetes")}, true, false, map[bool]string{false: "pip1"}, "default/service1", ipTagRequest, map[bool]bool{false: true})
+	assert.NoError(t, err)
+	assert.Empty(t, pipsToBeDeleted)
+}
+
+func TestEnsurePublicIPExistsReclaimsRetainedPublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range []struct {
+		desc          string
+		annotations   map[string]string
+		clusterName   string
+		expectedError bool
+	}{
+		{
+			desc:        "the retained public IP should be reclaimed by the service requesting it by name",
+			annotations: map[string]string{consts.ServiceAnnotationPIPName: "pip1"},
+			clusterName: "kubernetes",
+		},
+		{
+			desc:        "the retained public IP of the default name should be reclaimed by the service retaining it",
+			clusterName: "kubernetes",
+		},
+		{
+			desc:          "an error should be returned if the public IP is retained by another cluster",
+			annotations:   map[string]string{consts.ServiceAnnotationPIPName: "pip1"},
+			clusterName:   "another",
+			expectedError: true,
+		},
+	} {
+		az := GetTestCloud(ctrl)
+		svc := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+		mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName, publicIPAddressName, expand string) (network.PublicIPAddress, *retry.Error) {
+			return getTestRetainedPublicIP("kubernetes"), nil
+		}).AnyTimes()
+		var updatedPIP network.PublicIPAddress
+		if !test.expectedError {
+			mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+				updatedPIP = parameters
+				return nil
+			})
+		}
+
+		_, err := az.ensurePublicIPExists(&svc, "pip1", "", test.clusterName, false, false, false)
+		assert.Equal(t, test.expectedError, err != nil, test.desc)
+		if !test.expectedError {
+			assert.False(t, isRetainedPublicIP(&updatedPIP), test.desc)
+			assert.Equal(t, "default/service1", getServiceFromPIPServiceTags(updatedPIP.Tags), test.desc)
+			assert.Equal(t, "kubernetes", getClusterFromPIPClusterTags(updatedPIP.Tags), test.desc)
+		}
+	}
+}
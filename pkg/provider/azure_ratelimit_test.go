@@ -189,5 +189,8 @@ func TestInitializeCloudProviderRateLimitConfig(t *testing.T) {
 	assert.Equal(t, config.StorageAccountRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.DiskRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.SnapshotRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.NatGatewayRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.DNSRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.ApplicationSecurityGroupRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.AttachDetachDiskRateLimit, &testAttachDetachDiskDefaultRateLimitConfig)
 }
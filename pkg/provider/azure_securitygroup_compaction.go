@@ -0,0 +1,352 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const compactedSecurityRuleNamePrefix = "compacted-"
+
+// serviceSecurityRuleNameRE matches the names of the security rules of a single service, which are prefixed with the
+// default load balancer name of the service, i.e. "a" followed by the first 31 characters of its UID.
+var serviceSecurityRuleNameRE = regexp.MustCompile(`^a[0-9a-fA-F]{31}-`)
+
+// securityRuleCompactionKey is what the security rules merged into a compacted rule have in common.
+type securityRuleCompactionKey struct {
+	protocol             string
+	destinationPortRange string
+	sourceAddressPrefix  string
+	isIPv6               bool
+}
+
+func isCompactedSecurityRule(rule network.SecurityRule) bool {
+	return strings.HasPrefix(strings.ToLower(to.String(rule.Name)), compactedSecurityRuleNamePrefix)
+}
+
+// isManagedSecurityRule checks if the security rule is created by the cloud provider for the services, so its
+// priority can be changed when the rules are compacted.
+func isManagedSecurityRule(rule network.SecurityRule) bool {
+	return serviceSecurityRuleNameRE.MatchString(to.String(rule.Name)) || allowsConsolidation(rule) || isCompactedSecurityRule(rule)
+}
+
+// getSecurityRuleCompactionKey returns the key and the destination IPs of the security rule if it can be merged
+// with the other rules of the same key. Only the inbound allow rules of the services or the compacted rules with a
+// single protocol, destination port and source, and the destinations of the IPs of the same family are compactable.
+func getSecurityRuleCompactionKey(rule network.SecurityRule) (securityRuleCompactionKey, []string, bool) {
+	var key securityRuleCompactionKey
+	if rule.SecurityRulePropertiesFormat == nil ||
+		(!serviceSecurityRuleNameRE.MatchString(to.String(rule.Name)) && !isCompactedSecurityRule(rule)) {
+		return key, nil, false
+	}
+	if rule.Access != network.SecurityRuleAccessAllow || rule.Direction != network.SecurityRuleDirectionInbound {
+		return key, nil, false
+	}
+	if to.String(rule.SourcePortRange) != "*" || len(to.StringSlice(rule.SourcePortRanges)) > 0 ||
+		to.String(rule.DestinationPortRange) == "" || len(to.StringSlice(rule.DestinationPortRanges)) > 0 ||
+		to.String(rule.SourceAddressPrefix) == "" || len(to.StringSlice(rule.SourceAddressPrefixes)) > 0 ||
+		(rule.DestinationApplicationSecurityGroups != nil && len(*rule.DestinationApplicationSecurityGroups) > 0) {
+		return key, nil, false
+	}
+
+	destinations := *collectionOrSingle(rule.DestinationAddressPrefixes, rule.DestinationAddressPrefix)
+	if len(destinations) == 0 {
+		return key, nil, false
+	}
+	ips := make([]string, 0, len(destinations))
+	for i, destination := range destinations {
+		ip := net.ParseIP(destination)
+		if ip == nil {
+			return key, nil, false
+		}
+		isIPv6 := ip.To4() == nil
+		if i > 0 && isIPv6 != key.isIPv6 {
+			return key, nil, false
+		}
+		key.isIPv6 = isIPv6
+		ips = append(ips, ip.String())
+	}
+
+	key.protocol = strings.ToLower(string(rule.Protocol))
+	key.destinationPortRange = to.String(rule.DestinationPortRange)
+	key.sourceAddressPrefix = to.String(rule.SourceAddressPrefix)
+	return key, ips, true
+}
+
+// newCompactedSecurityRule returns the rule allowing the traffic of the key to the destination IPs.
+func newCompactedSecurityRule(key securityRuleCompactionKey, protocol network.SecurityRuleProtocol, destinations []string, priority *int32) network.SecurityRule {
+	var ipFamilySuffix string
+	if key.isIPv6 {
+		ipFamilySuffix = "-" + consts.IPVersionIPv6String
+	}
+	name := fmt.Sprintf("%s%s-%s-%s%s", compactedSecurityRuleNamePrefix, protocol, key.destinationPortRange, strings.Replace(key.sourceAddressPrefix, "/", "_", -1), ipFamilySuffix)
+
+	sortedDestinations := append([]string{}, destinations...)
+	sort.Strings(sortedDestinations)
+	return network.SecurityRule{
+		Name: to.StringPtr(name),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Priority:                   priority,
+			Protocol:                   protocol,
+			SourcePortRange:            to.StringPtr("*"),
+			DestinationPortRange:       to.StringPtr(key.destinationPortRange),
+			SourceAddressPrefix:        to.StringPtr(key.sourceAddressPrefix),
+			DestinationAddressPrefixes: &sortedDestinations,
+			Access:                     network.SecurityRuleAccessAllow,
+			Direction:                  network.SecurityRuleDirectionInbound,
+		},
+	}
+}
+
+// compactSecurityRules computes the minimal set of the security rules of all services sharing the security group.
+// The compactable rules of the same key are merged into one compacted rule whose destinations are the IPs of all of
+// them, and the priorities of the rules of the services are renumbered. The result only depends on the rules, so it
+// is the same when the changes of a service are re-applied onto the security group.
+func compactSecurityRules(rules []network.SecurityRule) ([]network.SecurityRule, error) {
+	keyRules := make(map[securityRuleCompactionKey][]int)
+	for i, rule := range rules {
+		if key, _, ok := getSecurityRuleCompactionKey(rule); ok {
+			keyRules[key] = append(keyRules[key], i)
+		}
+	}
+
+	compactedRules := make([]network.SecurityRule, 0, len(rules))
+	compactedKeys := make(map[securityRuleCompactionKey]bool)
+	for _, rule := range rules {
+		key, _, ok := getSecurityRuleCompactionKey(rule)
+		// a single rule of a service is kept as it is
+		if !ok || (len(keyRules[key]) < 2 && !isCompactedSecurityRule(rule)) {
+			compactedRules = append(compactedRules, rule)
+			continue
+		}
+		if compactedKeys[key] {
+			continue
+		}
+		compactedKeys[key] = true
+
+		destinations := sets.NewString()
+		for _, i := range keyRules[key] {
+			_, ips, _ := getSecurityRuleCompactionKey(rules[i])
+			destinations.Insert(ips...)
+		}
+		compactedRules = append(compactedRules, newCompactedSecurityRule(key, rule.Protocol, destinations.List(), nil))
+	}
+
+	return renumberSecurityRules(compactedRules)
+}
+
+// renumberSecurityRules gives the rules of the services the priorities from the minimum one in the order of their
+// names, with the allow rules before the deny rules. The priorities of the other rules are kept and skipped.
+func renumberSecurityRules(rules []network.SecurityRule) ([]network.SecurityRule, error) {
+	usedPriorities := sets.NewInt32()
+	var managedIndexes []int
+	for i, rule := range rules {
+		if isManagedSecurityRule(rule) {
+			managedIndexes = append(managedIndexes, i)
+		} else if rule.SecurityRulePropertiesFormat != nil && rule.Priority != nil {
+			usedPriorities.Insert(*rule.Priority)
+		}
+	}
+	sort.SliceStable(managedIndexes, func(i, j int) bool {
+		ruleI, ruleJ := rules[managedIndexes[i]], rules[managedIndexes[j]]
+		isDenyI, isDenyJ := ruleI.Access == network.SecurityRuleAccessDeny, ruleJ.Access == network.SecurityRuleAccessDeny
+		if isDenyI != isDenyJ {
+			return !isDenyI
+		}
+		return strings.ToLower(to.String(ruleI.Name)) < strings.ToLower(to.String(ruleJ.Name))
+	})
+
+	renumberedRules := append([]network.SecurityRule{}, rules...)
+	var priority int32 = consts.LoadBalancerMinimumPriority
+	for _, i := range managedIndexes {
+		for usedPriorities.Has(priority) {
+			priority++
+		}
+		if priority >= consts.LoadBalancerMaximumPriority {
+			return nil, errSecurityGroupPrioritiesExhausted
+		}
+
+		properties := *renumberedRules[i].SecurityRulePropertiesFormat
+		properties.Priority = to.Int32Ptr(priority)
+		renumberedRules[i].SecurityRulePropertiesFormat = &properties
+		priority++
+	}
+	return renumberedRules, nil
+}
+
+// getServiceSecurityRuleIPs returns the IPs of the service which may be the destinations of its security rules,
+// including the ones in its status which are replaced by the reconciliation.
+func getServiceSecurityRuleIPs(service *v1.Service, destinationIPAddresses map[bool][]string) sets.String {
+	ips := sets.NewString()
+	for _, addresses := range destinationIPAddresses {
+		for _, address := range addresses {
+			if ip := net.ParseIP(address); ip != nil {
+				ips.Insert(ip.String())
+			}
+		}
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ip := net.ParseIP(ingress.IP); ip != nil {
+			ips.Insert(ip.String())
+		}
+	}
+	return ips
+}
+
+// getServiceSecurityRulePorts returns the protocols and destination ports of the security rules of the service in the
+// form of "<protocol>/<port>", which are the ports of the backends, e.g. the node ports if the floating IP is disabled.
+func (az *Cloud) getServiceSecurityRulePorts(service *v1.Service) (sets.String, error) {
+	ports := sets.NewString()
+	for _, port := range service.Spec.Ports {
+		_, securityProto, _, err := getProtocolsFromKubernetesProtocol(port.Protocol)
+		if err != nil {
+			return nil, err
+		}
+		destinationPort, err := az.getServicePortBackendPort(service, port)
+		if err != nil {
+			// the named target ports are not known without the EndpointSlices, e.g. when the service is deleted
+			klog.Warningf("getServiceSecurityRulePorts: failed to get the backend port of port %s of service %s, using the service port: %v", port.Name, getServiceName(service), err)
+			destinationPort = port.Port
+		}
+		ports.Insert(fmt.Sprintf("%s/%d", strings.ToLower(string(*securityProto)), destinationPort))
+	}
+	return ports, nil
+}
+
+// reconcileCompactedSecurityRules keeps the destinations of the service in the compacted rules up to date. The IPs
+// of the service are removed from the compacted rules of its protocols and ports which don't expect them, and the
+// expected rules whose compacted rules exist are merged into them instead of being added on their own. The compacted
+// rules of the other ports are not changed, since they may be the ones of the services sharing the frontend IPs. It
+// returns the rules, the expected rules which are not merged, and whether the rules are changed.
+func reconcileCompactedSecurityRules(servicePorts sets.String, rules, expectedRules []network.SecurityRule, serviceIPs sets.String) ([]network.SecurityRule, []network.SecurityRule, bool) {
+	hasCompactedRules := false
+	for _, rule := range rules {
+		if isCompactedSecurityRule(rule) {
+			hasCompactedRules = true
+			break
+		}
+	}
+	if !hasCompactedRules {
+		return rules, expectedRules, false
+	}
+
+	expectedDestinations := make(map[securityRuleCompactionKey]sets.String)
+	for _, rule := range expectedRules {
+		if key, ips, ok := getSecurityRuleCompactionKey(rule); ok {
+			if expectedDestinations[key] == nil {
+				expectedDestinations[key] = sets.NewString()
+			}
+			expectedDestinations[key].Insert(ips...)
+		}
+	}
+
+	var dirty bool
+	compactedKeys := make(map[securityRuleCompactionKey]bool)
+	updatedRules := make([]network.SecurityRule, 0, len(rules))
+	for _, rule := range rules {
+		key, ips, ok := getSecurityRuleCompactionKey(rule)
+		if !ok || !isCompactedSecurityRule(rule) {
+			updatedRules = append(updatedRules, rule)
+			continue
+		}
+		compactedKeys[key] = true
+
+		destinations := sets.NewString(ips...)
+		if servicePorts.Has(fmt.Sprintf("%s/%s", key.protocol, key.destinationPortRange)) {
+			for _, ip := range ips {
+				if serviceIPs.Has(ip) && !expectedDestinations[key].Has(ip) {
+					destinations.Delete(ip)
+				}
+			}
+		}
+		destinations.Insert(expectedDestinations[key].UnsortedList()...)
+		if destinations.Equal(sets.NewString(ips...)) {
+			updatedRules = append(updatedRules, rule)
+			continue
+		}
+
+		dirty = true
+		if destinations.Len() == 0 {
+			continue
+		}
+		updatedRules = append(updatedRules, newCompactedSecurityRule(key, rule.Protocol, destinations.List(), rule.Priority))
+	}
+
+	// the rules of the service merged into the compacted rules are removed
+	var remainingExpectedRules []network.SecurityRule
+	mergedRuleNames := sets.NewString()
+	for _, rule := range expectedRules {
+		if key, _, ok := getSecurityRuleCompactionKey(rule); ok && compactedKeys[key] {
+			mergedRuleNames.Insert(strings.ToLower(to.String(rule.Name)))
+			continue
+		}
+		remainingExpectedRules = append(remainingExpectedRules, rule)
+	}
+	if mergedRuleNames.Len() > 0 {
+		rules, updatedRules = updatedRules, make([]network.SecurityRule, 0, len(updatedRules))
+		for _, rule := range rules {
+			if mergedRuleNames.Has(strings.ToLower(to.String(rule.Name))) {
+				dirty = true
+				continue
+			}
+			updatedRules = append(updatedRules, rule)
+		}
+	}
+	return updatedRules, remainingExpectedRules, dirty
+}
+
+// getDenyRuleMinimumPriority returns the minimum priority of the deny rule, which is after the compacted rules
+// allowing the traffic to its destinations, so that the traffic allowed by them is not denied.
+func getDenyRuleMinimumPriority(rules []network.SecurityRule, denyRule network.SecurityRule) int32 {
+	var minimum int32 = consts.LoadBalancerMinimumPriority
+	if denyRule.SecurityRulePropertiesFormat == nil || denyRule.Access != network.SecurityRuleAccessDeny {
+		return minimum
+	}
+
+	destinations := sets.NewString()
+	for _, destination := range *collectionOrSingle(denyRule.DestinationAddressPrefixes, denyRule.DestinationAddressPrefix) {
+		if ip := net.ParseIP(destination); ip != nil {
+			destinations.Insert(ip.String())
+		}
+	}
+	for _, rule := range rules {
+		if !isCompactedSecurityRule(rule) || rule.SecurityRulePropertiesFormat == nil || rule.Priority == nil || *rule.Priority < minimum {
+			continue
+		}
+		key, ips, ok := getSecurityRuleCompactionKey(rule)
+		if !ok || !strings.EqualFold(key.protocol, string(denyRule.Protocol)) || key.destinationPortRange != to.String(denyRule.DestinationPortRange) {
+			continue
+		}
+		if destinations.HasAny(ips...) {
+			minimum = *rule.Priority + 1
+		}
+	}
+	return minimum
+}
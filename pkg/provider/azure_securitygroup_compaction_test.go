@@ -0,0 +1,267 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestCompactionService(index int, ip string, ports ...int32) v1.Service {
+	svc := getTestService(fmt.Sprintf("service%d", index), v1.ProtocolTCP, nil, false, ports...)
+	svc.UID = types.UID(fmt.Sprintf("%08x-0000-0000-0000-000000000000", index))
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: ip}}
+	return svc
+}
+
+func getTestServiceSecurityRule(name, port, source, destination string, priority int32) network.SecurityRule {
+	return network.SecurityRule{
+		Name: to.StringPtr(name),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Priority:                 to.Int32Ptr(priority),
+			Protocol:                 network.SecurityRuleProtocolTCP,
+			SourcePortRange:          to.StringPtr("*"),
+			DestinationPortRange:     to.StringPtr(port),
+			SourceAddressPrefix:      to.StringPtr(source),
+			DestinationAddressPrefix: to.StringPtr(destination),
+			Access:                   network.SecurityRuleAccessAllow,
+			Direction:                network.SecurityRuleDirectionInbound,
+		},
+	}
+}
+
+func TestCompactSecurityRules(t *testing.T) {
+	rules := []network.SecurityRule{
+		getTestServiceSecurityRule("a0000000100000000000000000000000-TCP-80-Internet", "80", "Internet", "1.2.3.4", 4000),
+		getTestServiceSecurityRule("a0000000200000000000000000000000-TCP-80-Internet", "80", "Internet", "1.2.3.5", 501),
+		getTestServiceSecurityRule("a0000000200000000000000000000000-TCP-443-Internet", "443", "Internet", "1.2.3.5", 502),
+		getTestServiceSecurityRule("a0000000300000000000000000000000-TCP-80-Internet", "80", "Internet", "*", 503),
+		getTestServiceSecurityRule("user-rule", "22", "10.0.0.0/8", "*", 500),
+	}
+	deny := getTestServiceSecurityRule("a0000000100000000000000000000000-TCP-80-deny_all", "80", "*", "1.2.3.4", 4001)
+	deny.Access = network.SecurityRuleAccessDeny
+	rules = append(rules, deny)
+
+	compactedRules, err := compactSecurityRules(rules)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(compactedRules))
+
+	priorities := make(map[string]int32)
+	for _, rule := range compactedRules {
+		priorities[to.String(rule.Name)] = to.Int32(rule.Priority)
+	}
+	// the priority of the rule not managed by the cloud provider is kept and skipped
+	assert.Equal(t, map[string]int32{
+		"user-rule": 500,
+		"a0000000200000000000000000000000-TCP-443-Internet": 501,
+		"a0000000300000000000000000000000-TCP-80-Internet":  502,
+		"compacted-Tcp-80-Internet":                         503,
+		"a0000000100000000000000000000000-TCP-80-deny_all":  504,
+	}, priorities)
+	_, compactedRule, found := findSecurityRuleByName(compactedRules, "compacted-Tcp-80-Internet")
+	assert.True(t, found)
+	assert.Equal(t, []string{"1.2.3.4", "1.2.3.5"}, *compactedRule.DestinationAddressPrefixes)
+	// the existing rules are not mutated
+	assert.Equal(t, int32(502), to.Int32(rules[2].Priority))
+
+	// the compaction is idempotent
+	recompactedRules, err := compactSecurityRules(compactedRules)
+	assert.NoError(t, err)
+	assert.Equal(t, compactedRules, recompactedRules)
+
+	// the new rule of the same key is merged into the compacted rule
+	newRule := getTestServiceSecurityRule("a0000000400000000000000000000000-TCP-80-Internet", "80", "Internet", "1.2.3.6", 0)
+	newRule.Priority = nil
+	recompactedRules, err = compactSecurityRules(append(compactedRules, newRule))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(recompactedRules))
+	_, compactedRule, _ = findSecurityRuleByName(recompactedRules, "compacted-Tcp-80-Internet")
+	assert.Equal(t, []string{"1.2.3.4", "1.2.3.5", "1.2.3.6"}, *compactedRule.DestinationAddressPrefixes)
+
+	// an error is returned if the rules can't be renumbered
+	var manyRules []network.SecurityRule
+	for i := 0; i < consts.LoadBalancerMaximumPriority-consts.LoadBalancerMinimumPriority+1; i++ {
+		manyRules = append(manyRules, getTestServiceSecurityRule(fmt.Sprintf("a0000000100000000000000000000000-TCP-%d-Internet", i), fmt.Sprintf("%d", i), "Internet", "1.2.3.4", 0))
+	}
+	_, err = compactSecurityRules(manyRules)
+	assert.Equal(t, errSecurityGroupPrioritiesExhausted, err)
+}
+
+func TestReconcileCompactedSecurityRules(t *testing.T) {
+	compactedRule := newCompactedSecurityRule(securityRuleCompactionKey{protocol: "tcp", destinationPortRange: "80", sourceAddressPrefix: "Internet"}, network.SecurityRuleProtocolTCP, []string{"1.2.3.4", "1.2.3.5"}, to.Int32Ptr(500))
+	otherCompactedRule := newCompactedSecurityRule(securityRuleCompactionKey{protocol: "tcp", destinationPortRange: "443", sourceAddressPrefix: "Internet"}, network.SecurityRuleProtocolTCP, []string{"1.2.3.4"}, to.Int32Ptr(501))
+	rules := []network.SecurityRule{compactedRule, otherCompactedRule}
+
+	for _, test := range []struct {
+		desc                 string
+		servicePort          int32
+		rules                []network.SecurityRule
+		expectedRules        []network.SecurityRule
+		serviceIPs           sets.String
+		expectedDestinations map[string][]string
+		expectedRemaining    int
+		expectedDirty        bool
+	}{
+		{
+			desc:                 "the rules should not be changed if the destinations are expected",
+			rules:                rules,
+			expectedRules:        []network.SecurityRule{getTestServiceSecurityRule("a0000000100000000000000000000000-TCP-80-Internet", "80", "Internet", "1.2.3.4", 0)},
+			serviceIPs:           sets.NewString("1.2.3.4"),
+			expectedDestinations: map[string][]string{"compacted-Tcp-80-Internet": {"1.2.3.4", "1.2.3.5"}, "compacted-Tcp-443-Internet": {"1.2.3.4"}},
+		},
+		{
+			desc:                 "the old IP of the service should be replaced by the new one",
+			rules:                rules,
+			expectedRules:        []network.SecurityRule{getTestServiceSecurityRule("a0000000100000000000000000000000-TCP-80-Internet", "80", "Internet", "1.2.3.6", 0)},
+			serviceIPs:           sets.NewString("1.2.3.4", "1.2.3.6"),
+			expectedDestinations: map[string][]string{"compacted-Tcp-80-Internet": {"1.2.3.5", "1.2.3.6"}, "compacted-Tcp-443-Internet": {"1.2.3.4"}},
+			expectedDirty:        true,
+		},
+		{
+			desc:                 "the rule of the service with another source should not be merged",
+			rules:                rules,
+			expectedRules:        []network.SecurityRule{getTestServiceSecurityRule("a0000000100000000000000000000000-TCP-80-10.0.0.0_8", "80", "10.0.0.0/8", "1.2.3.4", 0)},
+			serviceIPs:           sets.NewString("1.2.3.4"),
+			expectedDestinations: map[string][]string{"compacted-Tcp-80-Internet": {"1.2.3.5"}, "compacted-Tcp-443-Internet": {"1.2.3.4"}},
+			expectedRemaining:    1,
+			expectedDirty:        true,
+		},
+		{
+			desc:                 "the compacted rule should be removed if it has no destinations",
+			servicePort:          443,
+			rules:                []network.SecurityRule{otherCompactedRule},
+			serviceIPs:           sets.NewString("1.2.3.4"),
+			expectedDestinations: map[string][]string{},
+			expectedDirty:        true,
+		},
+	} {
+		if test.servicePort == 0 {
+			test.servicePort = 80
+		}
+		updatedRules, remainingRules, dirty := reconcileCompactedSecurityRules(sets.NewString(fmt.Sprintf("tcp/%d", test.servicePort)), test.rules, test.expectedRules, test.serviceIPs)
+		assert.Equal(t, test.expectedDirty, dirty, test.desc)
+		assert.Equal(t, test.expectedRemaining, len(remainingRules), test.desc)
+		destinations := make(map[string][]string)
+		for _, rule := range updatedRules {
+			destinations[to.String(rule.Name)] = *rule.DestinationAddressPrefixes
+			// the priorities are kept
+			assert.NotNil(t, rule.Priority, test.desc)
+		}
+		assert.Equal(t, test.expectedDestinations, destinations, test.desc)
+	}
+}
+
+func TestGetServiceSecurityRulePorts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range []struct {
+		desc            string
+		backendPoolType string
+		annotations     map[string]string
+		expectedPorts   []string
+	}{
+		{
+			desc:          "the service ports should be returned by default",
+			expectedPorts: []string{"tcp/80"},
+		},
+		{
+			desc:          "the node ports should be returned if the floating IP is disabled",
+			annotations:   map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: consts.TrueAnnotationValue},
+			expectedPorts: []string{"tcp/10080"},
+		},
+		{
+			desc:            "the target ports should be returned with the podIP backend pool type",
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			expectedPorts:   []string{"tcp/8080"},
+		},
+	} {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerBackendPoolConfigurationType = test.backendPoolType
+		svc := getTestService("service1", v1.ProtocolTCP, test.annotations, false, 80)
+		svc.Spec.Ports[0].TargetPort = intstr.FromInt(8080)
+		ports, err := az.getServiceSecurityRulePorts(&svc)
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.expectedPorts, ports.List(), test.desc)
+	}
+}
+
+func TestReconcileSecurityRulesWithCompaction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.EnableSecurityRuleCompaction = true
+	az.MaximumSecurityRuleCount = 2
+
+	var rules []network.SecurityRule
+	for i := 1; i <= 2; i++ {
+		svc := getTestCompactionService(i, fmt.Sprintf("1.2.3.%d", i), 80)
+		rules = append(rules, getTestServiceSecurityRule(az.getSecurityRuleName(&svc, svc.Spec.Ports[0], "Internet", false), "80", "Internet", fmt.Sprintf("1.2.3.%d", i), int32(499+i)))
+	}
+	sg := network.SecurityGroup{SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{SecurityRules: &rules}}
+
+	// the rule of the new service exceeds the maximum number of rules
+	svc := getTestCompactionService(3, "1.2.3.3", 80)
+	destinationIPAddresses := map[bool][]string{false: {"1.2.3.3"}}
+	sourceAddressPrefixes := map[bool][]string{false: {"Internet"}}
+	expectedRules, err := az.getExpectedSecurityRules(true, svc.Spec.Ports, []string{"Internet"}, &svc, []string{"1.2.3.3"}, nil, false, nil)
+	assert.NoError(t, err)
+	dirty, updatedRules, err := az.reconcileSecurityRules(sg, &svc, "service3", true, expectedRules, svc.Spec.Ports, sourceAddressPrefixes, destinationIPAddresses)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Equal(t, 1, len(updatedRules))
+	assert.Equal(t, "compacted-Tcp-80-Internet", to.String(updatedRules[0].Name))
+	assert.Equal(t, []string{"1.2.3.1", "1.2.3.2", "1.2.3.3"}, *updatedRules[0].DestinationAddressPrefixes)
+	assert.Equal(t, int32(500), to.Int32(updatedRules[0].Priority))
+
+	// the reconciliation of the service is idempotent
+	sg.SecurityRules = &updatedRules
+	expectedRules, err = az.getExpectedSecurityRules(true, svc.Spec.Ports, []string{"Internet"}, &svc, []string{"1.2.3.3"}, nil, false, nil)
+	assert.NoError(t, err)
+	dirty, _, err = az.reconcileSecurityRules(sg, &svc, "service3", true, expectedRules, svc.Spec.Ports, sourceAddressPrefixes, destinationIPAddresses)
+	assert.NoError(t, err)
+	assert.False(t, dirty)
+
+	// the IP of the deleted service is removed from the compacted rule
+	dirty, updatedRules, err = az.reconcileSecurityRules(sg, &svc, "service3", false, nil, svc.Spec.Ports, sourceAddressPrefixes, destinationIPAddresses)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Equal(t, []string{"1.2.3.1", "1.2.3.2"}, *updatedRules[0].DestinationAddressPrefixes)
+
+	// the error is returned if the priorities are exhausted and the compaction is disabled
+	az.EnableSecurityRuleCompaction = false
+	var manyRules []network.SecurityRule
+	for i := consts.LoadBalancerMinimumPriority; i < consts.LoadBalancerMaximumPriority; i++ {
+		manyRules = append(manyRules, getTestServiceSecurityRule(fmt.Sprintf("rule-%d", i), fmt.Sprintf("%d", i), "Internet", "*", int32(i)))
+	}
+	sg.SecurityRules = &manyRules
+	_, _, err = az.reconcileSecurityRules(sg, &svc, "service3", true, expectedRules, svc.Spec.Ports, sourceAddressPrefixes, destinationIPAddresses)
+	assert.ErrorIs(t, err, errSecurityGroupPrioritiesExhausted)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+var (
+	// rawErrorRE matches the raw error in the message of retry.Error.Error()
+	rawErrorRE = regexp.MustCompile(`RawError: (\{.*\})`)
+	// invalidReasonCharsRE matches the characters which are not allowed in the reason of the conditions
+	invalidReasonCharsRE = regexp.MustCompile(`[^A-Za-z0-9_,:]`)
+)
+
+// updateServiceStatus records the result of the reconciliation of the service in its status. The condition
+// LoadBalancerReady reports whether the reconciliation succeeds and the reason it fails with. If the failure is
+// specific to some ports of the service, the condition LoadBalancerPortsError is set, and the errors are recorded
+// in the ports of the load balancer ingresses.
+func (az *Cloud) updateServiceStatus(ctx context.Context, service *v1.Service, reconcileErr error) {
+	if az.KubeClient == nil {
+		return
+	}
+
+	service, _ = az.applyServiceLoadBalancerClass(service)
+	serviceName := getServiceName(service)
+	status := az.getServiceStatusWithResult(service, reconcileErr)
+	if equality.Semantic.DeepEqual(service.Status, status) {
+		return
+	}
+
+	statusPatch := map[string]interface{}{"conditions": status.Conditions}
+	// the load balancer status is patched by the service controller after the reconciliation succeeds
+	if reconcileErr != nil && !equality.Semantic.DeepEqual(service.Status.LoadBalancer, status.LoadBalancer) {
+		statusPatch["loadBalancer"] = status.LoadBalancer
+	}
+	patch, err := json.Marshal(map[string]interface{}{"status": statusPatch})
+	if err != nil {
+		klog.Errorf("updateServiceStatus(%s): failed to marshal the status patch: %v", serviceName, err)
+		return
+	}
+	if _, err := az.KubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status"); err != nil {
+		klog.Warningf("updateServiceStatus(%s): failed to patch the status: %v", serviceName, err)
+	}
+}
+
+// getServiceStatusWithResult returns the status of the service updated with the result of the reconciliation.
+func (az *Cloud) getServiceStatusWithResult(service *v1.Service, reconcileErr error) v1.ServiceStatus {
+	status := *service.Status.DeepCopy()
+
+	if reconcileErr == nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               consts.ServiceConditionLoadBalancerReady,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: service.Generation,
+			Reason:             consts.ServiceConditionReasonLoadBalancerReconciled,
+			Message:            "the load balancer resources of the service are reconciled",
+		})
+		meta.RemoveStatusCondition(&status.Conditions, v1.LoadBalancerPortsError)
+		// the ports of the ingresses are reset by the service controller with the status returned by the reconciliation
+		return status
+	}
+
+	reason := getServiceErrorReason(reconcileErr)
+	message := reconcileErr.Error()
+	if len(message) > consts.ServiceConditionMessageMaxLength {
+		message = message[:consts.ServiceConditionMessageMaxLength]
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               consts.ServiceConditionLoadBalancerReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: service.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+
+	failedPorts := az.getFailedServicePorts(service, reconcileErr)
+	if len(failedPorts) == 0 {
+		meta.RemoveStatusCondition(&status.Conditions, v1.LoadBalancerPortsError)
+		for i := range status.LoadBalancer.Ingress {
+			status.LoadBalancer.Ingress[i].Ports = nil
+		}
+		return status
+	}
+
+	var failedPortNames []string
+	for _, port := range failedPorts {
+		failedPortNames = append(failedPortNames, fmt.Sprintf("%s/%d", port.Protocol, port.Port))
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               v1.LoadBalancerPortsError,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: service.Generation,
+		Reason:             reason,
+		Message:            fmt.Sprintf("failed to reconcile the load balancer resources of the ports %s", strings.Join(failedPortNames, ", ")),
+	})
+
+	portError := fmt.Sprintf("%s/%s", consts.ServicePortErrorDomain, reason)
+	for i := range status.LoadBalancer.Ingress {
+		var ports []v1.PortStatus
+		for _, port := range service.Spec.Ports {
+			portStatus := v1.PortStatus{Port: port.Port, Protocol: port.Protocol}
+			for _, failedPort := range failedPorts {
+				if failedPort.Port == port.Port && failedPort.Protocol == port.Protocol {
+					portStatus.Error = &portError
+					break
+				}
+			}
+			ports = append(ports, portStatus)
+		}
+		status.LoadBalancer.Ingress[i].Ports = ports
+	}
+	return status
+}
+
+// getServiceErrorReason returns the reason of the reconciliation error, which is the error code of Azure if
+// the error is returned by Azure.
+func getServiceErrorReason(err error) string {
+	if errors.Is(err, errSecurityGroupPrioritiesExhausted) {
+		return consts.ServiceConditionReasonSecurityRulePrioritiesExhausted
+	}
+
+	// retry.Error.Error() wraps the raw error, but the chain may be broken by the callers formatting the error
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if code := (&retry.Error{RawError: e}).ServiceErrorCode(); code != "" {
+			return sanitizeConditionReason(code)
+		}
+	}
+	if matches := rawErrorRE.FindStringSubmatch(err.Error()); len(matches) == 2 {
+		if code := (&retry.Error{RawError: errors.New(matches[1])}).ServiceErrorCode(); code != "" {
+			return sanitizeConditionReason(code)
+		}
+	}
+	return consts.ServiceConditionReasonLoadBalancerReconcileFailed
+}
+
+// sanitizeConditionReason drops the characters which are not allowed in the reason of the conditions.
+func sanitizeConditionReason(reason string) string {
+	reason = strings.TrimLeft(invalidReasonCharsRE.ReplaceAllString(reason, ""), "0123456789_,:")
+	reason = strings.TrimRight(reason, ",:")
+	if reason == "" {
+		return consts.ServiceConditionReasonLoadBalancerReconcileFailed
+	}
+	return reason
+}
+
+// getFailedServicePorts returns the ports of the service whose load balancing rules or security rules are
+// referred to by the reconciliation error.
+func (az *Cloud) getFailedServicePorts(service *v1.Service, err error) []v1.ServicePort {
+	message := err.Error()
+	prefix := regexp.QuoteMeta(az.getRulePrefix(service))
+
+	var failedPorts []v1.ServicePort
+	for _, port := range service.Spec.Ports {
+		// the names of the load balancing rules and the security rules start with <prefix>-<protocol>-<port>
+		ruleNameRE := regexp.MustCompile(fmt.Sprintf(`(?i)(%s|shared)-%s-%d([^0-9]|$)`, prefix, port.Protocol, port.Port))
+		if ruleNameRE.MatchString(message) {
+			failedPorts = append(failedPorts, port)
+		}
+	}
+	return failedPorts
+}
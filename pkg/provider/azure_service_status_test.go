@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestGetServiceErrorReason(t *testing.T) {
+	rawErr := errors.New(`{"error":{"code":"RulesPerLoadBalancerLimitReached","message":"too many rules"}}`)
+	rerr := &retry.Error{HTTPStatusCode: http.StatusBadRequest, RawError: rawErr}
+
+	for _, test := range []struct {
+		desc     string
+		err      error
+		expected string
+	}{
+		{
+			desc:     "the error code of Azure should be returned",
+			err:      rerr.Error(),
+			expected: "RulesPerLoadBalancerLimitReached",
+		},
+		{
+			desc:     "the error code of Azure should be returned if the error is formatted by the callers",
+			err:      fmt.Errorf("ensure(default/svc): lb(lb) - updating: %v", rerr.Error()),
+			expected: "RulesPerLoadBalancerLimitReached",
+		},
+		{
+			desc:     "the exhausted priorities should be reported",
+			err:      fmt.Errorf("failed to add the security rule rule: %w", errSecurityGroupPrioritiesExhausted),
+			expected: consts.ServiceConditionReasonSecurityRulePrioritiesExhausted,
+		},
+		{
+			desc:     "the default reason should be returned if there is no error code",
+			err:      errors.New("failed to get subnet"),
+			expected: consts.ServiceConditionReasonLoadBalancerReconcileFailed,
+		},
+	} {
+		assert.Equal(t, test.expected, getServiceErrorReason(test.err), test.desc)
+	}
+}
+
+func TestGetServiceStatusWithResult(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80, 8080)
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+
+	// the failure of a port is recorded in the ingresses
+	err := fmt.Errorf("failed to add the security rule aservice1-TCP-8080-Internet: %w", errSecurityGroupPrioritiesExhausted)
+	status := az.getServiceStatusWithResult(&svc, err)
+	ready := meta.FindStatusCondition(status.Conditions, consts.ServiceConditionLoadBalancerReady)
+	assert.Equal(t, metav1.ConditionFalse, ready.Status)
+	assert.Equal(t, consts.ServiceConditionReasonSecurityRulePrioritiesExhausted, ready.Reason)
+	assert.Equal(t, err.Error(), ready.Message)
+	portsError := meta.FindStatusCondition(status.Conditions, v1.LoadBalancerPortsError)
+	assert.Equal(t, metav1.ConditionTrue, portsError.Status)
+	assert.Equal(t, "failed to reconcile the load balancer resources of the ports TCP/8080", portsError.Message)
+	ports := status.LoadBalancer.Ingress[0].Ports
+	assert.Equal(t, 2, len(ports))
+	assert.Nil(t, ports[0].Error)
+	assert.Equal(t, "service.beta.kubernetes.io/SecurityRulePrioritiesExhausted", *ports[1].Error)
+	// the status of the service should not be changed
+	assert.Empty(t, svc.Status.Conditions)
+
+	// the errors of the ports are cleared if the failure is not specific to the ports
+	svc.Status = status
+	status = az.getServiceStatusWithResult(&svc, errors.New("failed to get subnet"))
+	ready = meta.FindStatusCondition(status.Conditions, consts.ServiceConditionLoadBalancerReady)
+	assert.Equal(t, consts.ServiceConditionReasonLoadBalancerReconcileFailed, ready.Reason)
+	assert.Nil(t, meta.FindStatusCondition(status.Conditions, v1.LoadBalancerPortsError))
+	assert.Nil(t, status.LoadBalancer.Ingress[0].Ports)
+
+	// the service is ready after the reconciliation succeeds
+	status = az.getServiceStatusWithResult(&svc, nil)
+	ready = meta.FindStatusCondition(status.Conditions, consts.ServiceConditionLoadBalancerReady)
+	assert.Equal(t, metav1.ConditionTrue, ready.Status)
+	assert.Equal(t, consts.ServiceConditionReasonLoadBalancerReconciled, ready.Reason)
+	assert.Nil(t, meta.FindStatusCondition(status.Conditions, v1.LoadBalancerPortsError))
+}
+
+func TestUpdateServiceStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+	client := fake.NewSimpleClientset(&svc)
+	az.KubeClient = client
+
+	az.updateServiceStatus(context.TODO(), &svc, fmt.Errorf("failed to add the security rule aservice1-TCP-80-Internet: %w", errSecurityGroupPrioritiesExhausted))
+	updated, err := client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.True(t, meta.IsStatusConditionFalse(updated.Status.Conditions, consts.ServiceConditionLoadBalancerReady))
+	assert.True(t, meta.IsStatusConditionTrue(updated.Status.Conditions, v1.LoadBalancerPortsError))
+	assert.Equal(t, "1.2.3.4", updated.Status.LoadBalancer.Ingress[0].IP)
+	assert.NotNil(t, updated.Status.LoadBalancer.Ingress[0].Ports[0].Error)
+
+	az.updateServiceStatus(context.TODO(), updated, nil)
+	updated, err = client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.True(t, meta.IsStatusConditionTrue(updated.Status.Conditions, consts.ServiceConditionLoadBalancerReady))
+	assert.Nil(t, meta.FindStatusCondition(updated.Status.Conditions, v1.LoadBalancerPortsError))
+
+	// nothing is patched if the status is not changed
+	client.ClearActions()
+	az.updateServiceStatus(context.TODO(), updated, nil)
+	assert.Empty(t, client.Actions())
+}
@@ -54,6 +54,8 @@ var (
 	nicIDRE            = regexp.MustCompile(`(?i)/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Network/networkInterfaces/(.+)/ipConfigurations/(?:.*)`)
 	vmIDRE             = regexp.MustCompile(`(?i)/subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Compute/virtualMachines/(.+)`)
 	vmasIDRE           = regexp.MustCompile(`/subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Compute/availabilitySets/(.+)`)
+	pipPrefixIDRE      = regexp.MustCompile(`(?i)^/subscriptions/(.+)/resourceGroups/(.+)/providers/Microsoft.Network/publicIPPrefixes/([^/]+)$`)
+	pipIDRE            = regexp.MustCompile(`(?i)^/subscriptions/(.+)/resourceGroups/(.+)/providers/Microsoft.Network/publicIPAddresses/([^/]+)$`)
 )
 
 // getStandardMachineID returns the full identifier of a virtual machine.
@@ -94,6 +96,15 @@ func (az *Cloud) getBackendPoolID(lbName, rgName, backendPoolName string) string
 		backendPoolName)
 }
 
+// returns the full identifier of the virtual network of the cluster.
+func (az *Cloud) getVirtualNetworkID() string {
+	vnetResourceGroup := az.ResourceGroup
+	if len(az.VnetResourceGroup) > 0 {
+		vnetResourceGroup = az.VnetResourceGroup
+	}
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s", az.SubscriptionID, vnetResourceGroup, az.VnetName)
+}
+
 // returns the full identifier of a loadbalancer probe.
 func (az *Cloud) getLoadBalancerProbeID(lbName, rgName, lbRuleName string) string {
 	return fmt.Sprintf(
@@ -270,18 +281,36 @@ func isInternalLoadBalancer(lb *network.LoadBalancer) bool {
 // This means:
 // clusters moving from IPv4 to dualstack will require no changes
 // clusters moving from IPv6 to dualstack will require no changes as the IPv4 backend pool will created with <clusterName>
-func getBackendPoolName(clusterName string, service *v1.Service) string {
-	IPv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
-	if IPv6 {
-		return fmt.Sprintf("%v-IPv6", clusterName)
+func getBackendPoolName(clusterName string, isIPv6 bool) string {
+	if isIPv6 {
+		return fmt.Sprintf("%v-%v", clusterName, consts.IPVersionIPv6String)
 	}
 
 	return clusterName
 }
 
-func (az *Cloud) getLoadBalancerRuleName(service *v1.Service, protocol v1.Protocol, port int32) string {
+// getBackendPoolNames returns the names of the IPv4 and IPv6 backend pools, keyed by isIPv6.
+func getBackendPoolNames(clusterName string) map[bool]string {
+	return map[bool]string{
+		false: getBackendPoolName(clusterName, false),
+		true:  getBackendPoolName(clusterName, true),
+	}
+}
+
+// getServiceBackendPoolName returns the name of the backend pool that the load balancing rules of the service refer to.
+// The backend pools are shared by all the services of the cluster, except for the podIP backend pool configuration
+// type, in which each service has its own backend pools since the pod IPs of the services are different.
+func (az *Cloud) getServiceBackendPoolName(clusterName string, service *v1.Service, isIPv6 bool) string {
+	if az.isLBBackendPoolTypePodIP() {
+		return getBackendPoolName(az.getRulePrefix(service), isIPv6)
+	}
+	return getBackendPoolName(clusterName, isIPv6)
+}
+
+func (az *Cloud) getLoadBalancerRuleName(service *v1.Service, protocol v1.Protocol, port int32, isIPv6 bool) string {
 	prefix := az.getRulePrefix(service)
-	ruleName := fmt.Sprintf("%s-%s-%d", prefix, protocol, port)
+	ipFamilySuffix := getIPFamilySuffix(service, isIPv6)
+	ruleName := fmt.Sprintf("%s-%s-%d%s", prefix, protocol, port, ipFamilySuffix)
 	subnet := subnet(service)
 	if subnet == nil {
 		return ruleName
@@ -293,21 +322,22 @@ func (az *Cloud) getLoadBalancerRuleName(service *v1.Service, protocol v1.Protoc
 		subnetSegment = subnetSegment[:consts.LoadBalancerRuleNameMaxLength-len(ruleName)-1]
 	}
 
-	return fmt.Sprintf("%s-%s-%s-%d", prefix, subnetSegment, protocol, port)
+	return fmt.Sprintf("%s-%s-%s-%d%s", prefix, subnetSegment, protocol, port, ipFamilySuffix)
 }
 
-func (az *Cloud) getloadbalancerHAmodeRuleName(service *v1.Service) string {
-	return az.getLoadBalancerRuleName(service, service.Spec.Ports[0].Protocol, service.Spec.Ports[0].Port)
+func (az *Cloud) getloadbalancerHAmodeRuleName(service *v1.Service, isIPv6 bool) string {
+	return az.getLoadBalancerRuleName(service, service.Spec.Ports[0].Protocol, service.Spec.Ports[0].Port, isIPv6)
 }
 
-func (az *Cloud) getSecurityRuleName(service *v1.Service, port v1.ServicePort, sourceAddrPrefix string) string {
+func (az *Cloud) getSecurityRuleName(service *v1.Service, port v1.ServicePort, sourceAddrPrefix string, isIPv6 bool) string {
+	ipFamilySuffix := getIPFamilySuffix(service, isIPv6)
 	if useSharedSecurityRule(service) {
 		safePrefix := strings.Replace(sourceAddrPrefix, "/", "_", -1)
-		return fmt.Sprintf("shared-%s-%d-%s", port.Protocol, port.Port, safePrefix)
+		return fmt.Sprintf("shared-%s-%d-%s%s", port.Protocol, port.Port, safePrefix, ipFamilySuffix)
 	}
 	safePrefix := strings.Replace(sourceAddrPrefix, "/", "_", -1)
 	rulePrefix := az.getRulePrefix(service)
-	return fmt.Sprintf("%s-%s-%d-%s", rulePrefix, port.Protocol, port.Port, safePrefix)
+	return fmt.Sprintf("%s-%s-%d-%s%s", rulePrefix, port.Protocol, port.Port, safePrefix, ipFamilySuffix)
 }
 
 // This returns a human-readable version of the Service used to tag some resources.
@@ -321,8 +351,9 @@ func (az *Cloud) getRulePrefix(service *v1.Service) string {
 	return az.GetLoadBalancerName(context.TODO(), "", service)
 }
 
-func (az *Cloud) getPublicIPName(clusterName string, service *v1.Service) string {
-	return fmt.Sprintf("%s-%s", clusterName, az.GetLoadBalancerName(context.TODO(), clusterName, service))
+func (az *Cloud) getPublicIPName(clusterName string, service *v1.Service, isIPv6 bool) string {
+	pipName := fmt.Sprintf("%s-%s", clusterName, az.GetLoadBalancerName(context.TODO(), clusterName, service))
+	return getResourceByIPFamily(pipName, service, isIPv6)
 }
 
 func (az *Cloud) serviceOwnsRule(service *v1.Service, rule string) bool {
@@ -384,35 +415,67 @@ func (az *Cloud) serviceOwnsFrontendIP(fip network.FrontendIPConfiguration, serv
 	return strings.EqualFold(*fip.PrivateIPAddress, loadBalancerIP), isPrimaryService, nil
 }
 
-func (az *Cloud) getDefaultFrontendIPConfigName(service *v1.Service) string {
+// isFrontendIPConfigIPv6 checks if the frontend IP config owned by the service is of the IPv6 family.
+// The private IP address version is checked first, then the IP family suffix of the config name.
+// The configs shared by spec.loadBalancerIP are of the family of that IP, and the other ones
+// are of the primary IP family of the service.
+func (az *Cloud) isFrontendIPConfigIPv6(fip network.FrontendIPConfiguration, service *v1.Service) bool {
+	if fip.FrontendIPConfigurationPropertiesFormat != nil && fip.PrivateIPAddressVersion != "" {
+		return strings.EqualFold(string(fip.PrivateIPAddressVersion), string(network.IPVersionIPv6))
+	}
+
+	fipName := strings.ToLower(to.String(fip.Name))
+	if strings.HasSuffix(fipName, strings.ToLower(fmt.Sprintf("-%s", consts.IPVersionIPv6String))) {
+		return true
+	}
+	if strings.HasSuffix(fipName, strings.ToLower(fmt.Sprintf("-%s", consts.IPVersionIPv4String))) {
+		return false
+	}
+
+	baseName := az.GetLoadBalancerName(context.TODO(), "", service)
+	if !strings.HasPrefix(to.String(fip.Name), baseName) && service.Spec.LoadBalancerIP != "" {
+		return utilnet.IsIPv6String(service.Spec.LoadBalancerIP)
+	}
+	return getServiceIPFamilies(service)[0]
+}
+
+func (az *Cloud) getDefaultFrontendIPConfigName(service *v1.Service, isIPv6 bool) string {
 	baseName := az.GetLoadBalancerName(context.TODO(), "", service)
+	ipFamilySuffix := getIPFamilySuffix(service, isIPv6)
 	subnetName := subnet(service)
 	if subnetName != nil {
 		ipcName := fmt.Sprintf("%s-%s", baseName, *subnetName)
 
 		// Azure lb front end configuration name must not exceed 80 characters
-		if len(ipcName) > consts.FrontendIPConfigNameMaxLength {
-			ipcName = ipcName[:consts.FrontendIPConfigNameMaxLength]
+		maxLength := consts.FrontendIPConfigNameMaxLength - len(ipFamilySuffix)
+		if len(ipcName) > maxLength {
+			ipcName = ipcName[:maxLength]
 			// Cutting the string may result in char like "-" as the string end.
 			// If the last char is not a letter or '_', replace it with "_".
 			if !unicode.IsLetter(rune(ipcName[len(ipcName)-1:][0])) && ipcName[len(ipcName)-1:] != "_" {
 				ipcName = ipcName[:len(ipcName)-1] + "_"
 			}
 		}
-		return ipcName
+		return ipcName + ipFamilySuffix
 	}
-	return baseName
+	return baseName + ipFamilySuffix
 }
 
+var errSecurityGroupPrioritiesExhausted = errors.New("securityGroup priorities are exhausted")
+
 // This returns the next available rule priority level for a given set of security rules.
 func getNextAvailablePriority(rules []network.SecurityRule) (int32, error) {
-	var smallest int32 = consts.LoadBalancerMinimumPriority
+	return getNextAvailablePriorityFrom(rules, consts.LoadBalancerMinimumPriority)
+}
+
+// getNextAvailablePriorityFrom returns the next available rule priority level which is not less than the given one.
+func getNextAvailablePriorityFrom(rules []network.SecurityRule, smallest int32) (int32, error) {
 	var spread int32 = 1
 
 outer:
 	for smallest < consts.LoadBalancerMaximumPriority {
 		for _, rule := range rules {
-			if *rule.Priority == smallest {
+			if rule.SecurityRulePropertiesFormat != nil && to.Int32(rule.Priority) == smallest {
 				smallest += spread
 				continue outer
 			}
@@ -421,7 +484,7 @@ outer:
 		return smallest, nil
 	}
 
-	return -1, fmt.Errorf("securityGroup priorities are exhausted")
+	return -1, errSecurityGroupPrioritiesExhausted
 }
 
 var polyTable = crc32.MakeTable(crc32.Koopman)
@@ -870,8 +933,19 @@ func (as *availabilitySet) getPrimaryInterfaceWithVMSet(nodeName, vmSetName stri
 		// need to check the vmSet name when using multiple standard LBs
 		needCheck = true
 
-		// ensure the vm that is supposed to share the primary SLB in the backendpool of the primary SLB
-		if machine.AvailabilitySet != nil {
+		// ensure the vm is in the backendpool of the SLB whose configuration contains its vmSet
+		if lbConfig := as.getMultipleStandardLoadBalancerConfiguration(vmSetName); lbConfig != nil {
+			vmasName := ""
+			if machine.AvailabilitySet != nil {
+				vmasName, _ = getLastSegment(to.String(machine.AvailabilitySet.ID), "/")
+			}
+			if !lbConfig.hasNodePool(vmasName) {
+				klog.V(3).Infof("GetPrimaryInterface: nic (%s) is not in the node pools of the load balancer configuration %s", nicName, lbConfig.Name)
+				return network.Interface{}, "", errNotInVMSet
+			}
+			needCheck = false
+		} else if machine.AvailabilitySet != nil {
+			// ensure the vm that is supposed to share the primary SLB in the backendpool of the primary SLB
 			vmasName, _ := getLastSegment(to.String(machine.AvailabilitySet.ID), "/")
 			if strings.EqualFold(as.GetPrimaryVMSetName(), vmSetName) &&
 				as.getVMSetNamesSharingPrimarySLB().Has(strings.ToLower(vmasName)) {
@@ -913,7 +987,7 @@ func (as *availabilitySet) getPrimaryInterfaceWithVMSet(nodeName, vmSetName stri
 func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.NodeName, backendPoolID string, vmSetName string) (string, string, string, *compute.VirtualMachineScaleSetVM, error) {
 	vmName := mapNodeNameToVMName(nodeName)
 	serviceName := getServiceName(service)
-	nic, _, err := as.getPrimaryInterfaceWithVMSet(vmName, vmSetName)
+	nic, vmasID, err := as.getPrimaryInterfaceWithVMSet(vmName, vmSetName)
 	if err != nil {
 		if errors.Is(err, errNotInVMSet) {
 			klog.V(3).Infof("EnsureHostInPool skips node %s because it is not in the vmSet %s", nodeName, vmSetName)
@@ -930,7 +1004,7 @@ func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.
 	}
 
 	var primaryIPConfig *network.InterfaceIPConfiguration
-	ipv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
+	ipv6 := isBackendPoolIPv6(backendPoolID)
 	if !as.Cloud.ipv6DualStackEnabled && !ipv6 {
 		primaryIPConfig, err = getPrimaryIPConfig(nic)
 		if err != nil {
@@ -982,7 +1056,23 @@ func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.
 			})
 
 		primaryIPConfig.LoadBalancerBackendAddressPools = &newBackendPools
+	}
+
+	// the IP configuration joins the application security group which the security rules target
+	var asgChanged bool
+	if as.useApplicationSecurityGroups() {
+		vmasName, err := getAvailabilitySetNameByID(vmasID)
+		if err != nil {
+			return "", "", "", nil, fmt.Errorf("EnsureHostInPool: failed to parse the VMAS ID %s: %w", vmasID, err)
+		}
+		asgID, err := as.ensureNodeApplicationSecurityGroup(backendPoolID, vmasName)
+		if err != nil {
+			return "", "", "", nil, err
+		}
+		asgChanged = reconcileInterfaceIPConfigApplicationSecurityGroup(primaryIPConfig, asgID, true)
+	}
 
+	if !foundPool || asgChanged {
 		nicName := *nic.Name
 		klog.V(3).Infof("nicupdate(%s): nic(%s) - updating", serviceName, nicName)
 		err := as.CreateOrUpdateInterface(service, nic)
@@ -1123,6 +1213,8 @@ func (as *availabilitySet) EnsureBackendPoolDeleted(service *v1.Service, backend
 						}
 					}
 					newIPConfigs[j].LoadBalancerBackendAddressPools = &newLBAddressPools
+					asgID := as.getApplicationSecurityGroupIDToLeave(backendPoolID, vmasName, len(newLBAddressPools))
+					reconcileInterfaceIPConfigApplicationSecurityGroup(&newIPConfigs[j], asgID, false)
 				}
 			}
 			nic.IPConfigurations = &newIPConfigs
@@ -365,6 +365,8 @@ func TestGetLoadBalancingRuleName(t *testing.T) {
 		isInternal    bool
 		useStandardLB bool
 		port          int32
+		ipFamilies    []v1.IPFamily
+		isIPv6        bool
 	}{
 		{
 			description:   "internal lb should have subnet name on the rule name",
@@ -411,6 +413,35 @@ func TestGetLoadBalancingRuleName(t *testing.T) {
 			port:          9000,
 			expected:      "a257b965551374ad2b091ef3f07043ad-TCP-9000",
 		},
+		{
+			description:   "rule of the primary IP family of a dual-stack service should not have suffix",
+			isInternal:    false,
+			useStandardLB: true,
+			protocol:      v1.ProtocolTCP,
+			port:          9000,
+			ipFamilies:    []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol},
+			expected:      "a257b965551374ad2b091ef3f07043ad-TCP-9000",
+		},
+		{
+			description:   "rule of the secondary IP family of a dual-stack service should have IP family suffix",
+			isInternal:    false,
+			useStandardLB: true,
+			protocol:      v1.ProtocolTCP,
+			port:          9000,
+			ipFamilies:    []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol},
+			isIPv6:        true,
+			expected:      "a257b965551374ad2b091ef3f07043ad-TCP-9000-IPv6",
+		},
+		{
+			description:   "internal rule of the secondary IP family of a dual-stack service should have IP family suffix",
+			subnetName:    "shortsubnet",
+			isInternal:    true,
+			useStandardLB: true,
+			protocol:      v1.ProtocolTCP,
+			port:          9000,
+			ipFamilies:    []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol},
+			expected:      "a257b965551374ad2b091ef3f07043ad-shortsubnet-TCP-9000-IPv4",
+		},
 	}
 
 	for _, c := range cases {
@@ -421,8 +452,9 @@ func TestGetLoadBalancingRuleName(t *testing.T) {
 		}
 		svc.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = c.subnetName
 		svc.Annotations[consts.ServiceAnnotationLoadBalancerInternal] = strconv.FormatBool(c.isInternal)
+		svc.Spec.IPFamilies = c.ipFamilies
 
-		loadbalancerRuleName := az.getLoadBalancerRuleName(svc, c.protocol, c.port)
+		loadbalancerRuleName := az.getLoadBalancerRuleName(svc, c.protocol, c.port, c.isIPv6)
 		assert.Equal(t, c.expected, loadbalancerRuleName, c.description)
 	}
 }
@@ -504,7 +536,7 @@ func TestGetFrontendIPConfigName(t *testing.T) {
 			svc.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = c.subnetName
 			svc.Annotations[consts.ServiceAnnotationLoadBalancerInternal] = strconv.FormatBool(c.isInternal)
 
-			ipconfigName := az.getDefaultFrontendIPConfigName(svc)
+			ipconfigName := az.getDefaultFrontendIPConfigName(svc, false)
 			assert.Equal(t, c.expected, ipconfigName, c)
 		})
 	}
@@ -889,25 +921,25 @@ func TestGetIPConfigByIPFamily(t *testing.T) {
 func TestGetBackendPoolName(t *testing.T) {
 	testcases := []struct {
 		name             string
-		service          v1.Service
+		isIPv6           bool
 		clusterName      string
 		expectedPoolName string
 	}{
 		{
 			name:             "GetBackendPoolName should return <clusterName>-IPv6",
-			service:          getTestService("test1", v1.ProtocolTCP, nil, true, 80),
+			isIPv6:           true,
 			clusterName:      "azure",
 			expectedPoolName: "azure-IPv6",
 		},
 		{
 			name:             "GetBackendPoolName should return <clusterName>",
-			service:          getTestService("test1", v1.ProtocolTCP, nil, false, 80),
+			isIPv6:           false,
 			clusterName:      "azure",
 			expectedPoolName: "azure",
 		},
 	}
 	for _, test := range testcases {
-		backPoolName := getBackendPoolName(test.clusterName, &test.service)
+		backPoolName := getBackendPoolName(test.clusterName, test.isIPv6)
 		assert.Equal(t, test.expectedPoolName, backPoolName, test.name)
 	}
 }
@@ -1394,8 +1426,9 @@ func TestStandardEnsureHostInPool(t *testing.T) {
 			vmSetName:         "myAvailabilitySet",
 		},
 		{
-			name:           "EnsureHostInPool should report error if service.Spec.ClusterIP is ipv6 but node don't have IPv6 address",
+			name:           "EnsureHostInPool should report error if the backend pool is IPv6 but node don't have IPv6 address",
 			service:        &v1.Service{Spec: v1.ServiceSpec{ClusterIP: "2001:0db8:85a3:0000:0000:8a2e:0370:7334"}},
+			backendPoolID:  backendAddressPoolID + "-IPv6",
 			nodeName:       "vm4",
 			nicName:        "nic4",
 			nicID:          "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic4",
@@ -1562,7 +1595,7 @@ func TestStandardEnsureHostsInPool(t *testing.T) {
 			vmSetName: "availabilityset-1",
 		},
 		{
-			name: "EnsureHostsInPool should report error if service.Spec.ClusterIP is ipv6 but node don't have IPv6 address",
+			name: "EnsureHostsInPool should report error if the backend pool is IPv6 but node don't have IPv6 address",
 			service: &v1.Service{
 				ObjectMeta: meta.ObjectMeta{
 					Name:      "svc",
@@ -1581,11 +1614,11 @@ func TestStandardEnsureHostsInPool(t *testing.T) {
 				},
 			},
 			nicName:        "nic5",
-			backendPoolID:  backendAddressPoolID,
+			backendPoolID:  backendAddressPoolID + "-IPv6",
 			nicID:          "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic5",
 			vmSetName:      "myAvailabilitySet",
 			expectedErr:    true,
-			expectedErrMsg: fmt.Errorf("ensure(default/svc): backendPoolID(%s) - failed to ensure host in pool: %w", backendAddressPoolID, fmt.Errorf("failed to determine the ipconfig(IPv6=true). nicname=%q", "nic5")),
+			expectedErrMsg: fmt.Errorf("ensure(default/svc): backendPoolID(%s) - failed to ensure host in pool: %w", backendAddressPoolID+"-IPv6", fmt.Errorf("failed to determine the ipconfig(IPv6=true). nicname=%q", "nic5")),
 		},
 	}
 
@@ -236,11 +236,10 @@ func getServiceAdditionalPublicIPs(service *v1.Service) ([]string, error) {
 	return result, nil
 }
 
-func getNodePrivateIPAddress(service *v1.Service, node *v1.Node) string {
-	isIPV6SVC := utilnet.IsIPv6String(service.Spec.ClusterIP)
+func getNodePrivateIPAddress(node *v1.Node, isIPv6 bool) string {
 	for _, nodeAddress := range node.Status.Addresses {
 		if strings.EqualFold(string(nodeAddress.Type), string(v1.NodeInternalIP)) &&
-			utilnet.IsIPv6String(nodeAddress.Address) == isIPV6SVC {
+			utilnet.IsIPv6String(nodeAddress.Address) == isIPv6 {
 			klog.V(6).Infof("getNodePrivateIPAddress: node %s, ip %s", node.Name, nodeAddress.Address)
 			return nodeAddress.Address
 		}
@@ -266,12 +265,15 @@ func isLBBackendPoolTypeIPConfig(service *v1.Service, lb *network.LoadBalancer,
 		klog.V(4).Infof("isLBBackendPoolTypeIPConfig: no backend pools in the LB %s", to.String(lb.Name))
 		return false
 	}
-	lbBackendPoolName := getBackendPoolName(clusterName, service)
+	lbBackendPoolNames := getBackendPoolNames(clusterName)
 	for _, bp := range *lb.BackendAddressPools {
-		if strings.EqualFold(to.String(bp.Name), lbBackendPoolName) {
-			return bp.BackendAddressPoolPropertiesFormat != nil &&
+		for _, lbBackendPoolName := range lbBackendPoolNames {
+			if strings.EqualFold(to.String(bp.Name), lbBackendPoolName) &&
+				bp.BackendAddressPoolPropertiesFormat != nil &&
 				bp.BackendIPConfigurations != nil &&
-				len(*bp.BackendIPConfigurations) != 0
+				len(*bp.BackendIPConfigurations) != 0 {
+				return true
+			}
 		}
 	}
 	return false
@@ -300,3 +302,93 @@ func sameContentInSlices(s1 []string, s2 []string) bool {
 	}
 	return true
 }
+
+// getServiceIPFamilies returns the IP families of the service with the primary one first,
+// where true stands for IPv6 and false for IPv4. The families are read from spec.ipFamilies,
+// and the family of spec.clusterIP is used if spec.ipFamilies is not set.
+func getServiceIPFamilies(service *v1.Service) []bool {
+	var ipFamilies []bool
+	for _, ipFamily := range service.Spec.IPFamilies {
+		if ipFamily != v1.IPv4Protocol && ipFamily != v1.IPv6Protocol {
+			continue
+		}
+		isIPv6 := ipFamily == v1.IPv6Protocol
+		if len(ipFamilies) > 0 && ipFamilies[0] == isIPv6 {
+			continue
+		}
+		ipFamilies = append(ipFamilies, isIPv6)
+	}
+	if len(ipFamilies) == 0 {
+		ipFamilies = append(ipFamilies, utilnet.IsIPv6String(service.Spec.ClusterIP))
+	}
+
+	return ipFamilies
+}
+
+// isServiceIPFamilyEnabled checks if the given IP family is enabled on the service.
+func isServiceIPFamilyEnabled(service *v1.Service, isIPv6 bool) bool {
+	for _, ipFamily := range getServiceIPFamilies(service) {
+		if ipFamily == isIPv6 {
+			return true
+		}
+	}
+	return false
+}
+
+// getIPFamilySuffix returns the name suffix of the resources of the given IP family of the service.
+// The resources of the primary IP family are not suffixed, so they are kept untouched when the
+// service is switched between single-stack and dual-stack. The resources of the secondary IP family
+// are suffixed with "-IPv4" or "-IPv6".
+func getIPFamilySuffix(service *v1.Service, isIPv6 bool) string {
+	if isIPv6 == getServiceIPFamilies(service)[0] {
+		return ""
+	}
+	if isIPv6 {
+		return fmt.Sprintf("-%s", consts.IPVersionIPv6String)
+	}
+	return fmt.Sprintf("-%s", consts.IPVersionIPv4String)
+}
+
+// getResourceByIPFamily returns the name of the resource for the given IP family of the service.
+func getResourceByIPFamily(resource string, service *v1.Service, isIPv6 bool) string {
+	return resource + getIPFamilySuffix(service, isIPv6)
+}
+
+// getServiceLoadBalancerIP returns spec.loadBalancerIP of the service if it belongs to the given IP family.
+func getServiceLoadBalancerIP(service *v1.Service, isIPv6 bool) string {
+	loadBalancerIP := service.Spec.LoadBalancerIP
+	if loadBalancerIP != "" && utilnet.IsIPv6String(loadBalancerIP) == isIPv6 {
+		return loadBalancerIP
+	}
+	return ""
+}
+
+// getIngressIPByIPFamily returns the first ingress IP of the given IP family in the load balancer status.
+func getIngressIPByIPFamily(status *v1.LoadBalancerStatus, isIPv6 bool) string {
+	if status == nil {
+		return ""
+	}
+	for _, ingress := range status.Ingress {
+		if ingress.IP != "" && utilnet.IsIPv6String(ingress.IP) == isIPv6 {
+			return ingress.IP
+		}
+	}
+	return ""
+}
+
+// isBackendPoolIPv6 checks if the backend pool, given by its name or ID, is the IPv6 one.
+func isBackendPoolIPv6(backendPool string) bool {
+	return strings.HasSuffix(strings.ToLower(backendPool), strings.ToLower(fmt.Sprintf("-%s", consts.IPVersionIPv6String)))
+}
+
+// isLBBackendPoolsExisting checks if the backend pool is one of the managed IPv4 and IPv6
+// backend pools, and returns the IP family of the matched one.
+func isLBBackendPoolsExisting(lbBackendPoolNames map[bool]string, bpName *string) (found, isIPv6 bool) {
+	if strings.EqualFold(to.String(bpName), lbBackendPoolNames[false]) {
+		return true, false
+	}
+	if strings.EqualFold(to.String(bpName), lbBackendPoolNames[true]) {
+		return true, true
+	}
+	return false, false
+}
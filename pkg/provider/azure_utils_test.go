@@ -255,3 +255,101 @@ func TestGetServiceAdditionalPublicIPs(t *testing.T) {
 		})
 	}
 }
+
+func TestGetServiceIPFamilies(t *testing.T) {
+	for _, testCase := range []struct {
+		description         string
+		service             *v1.Service
+		expectedIPFamilies  []bool
+		expectedIPv4Suffix  string
+		expectedIPv6Suffix  string
+		expectedIPv6Enabled bool
+	}{
+		{
+			description:        "service without ipFamilies should use the IP family of the cluster IP",
+			service:            &v1.Service{Spec: v1.ServiceSpec{ClusterIP: "10.0.0.1"}},
+			expectedIPFamilies: []bool{false},
+			expectedIPv6Suffix: "-IPv6",
+		},
+		{
+			description:         "IPv6 service without ipFamilies should use the IP family of the cluster IP",
+			service:             &v1.Service{Spec: v1.ServiceSpec{ClusterIP: "fd00::1"}},
+			expectedIPFamilies:  []bool{true},
+			expectedIPv4Suffix:  "-IPv4",
+			expectedIPv6Enabled: true,
+		},
+		{
+			description: "dual-stack service should return the primary IP family first",
+			service: &v1.Service{Spec: v1.ServiceSpec{
+				ClusterIP:  "10.0.0.1",
+				IPFamilies: []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol},
+			}},
+			expectedIPFamilies:  []bool{false, true},
+			expectedIPv6Suffix:  "-IPv6",
+			expectedIPv6Enabled: true,
+		},
+		{
+			description: "IPv6 primary dual-stack service should return the primary IP family first",
+			service: &v1.Service{Spec: v1.ServiceSpec{
+				ClusterIP:  "fd00::1",
+				IPFamilies: []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol},
+			}},
+			expectedIPFamilies:  []bool{true, false},
+			expectedIPv4Suffix:  "-IPv4",
+			expectedIPv6Enabled: true,
+		},
+		{
+			description: "duplicated and unknown ipFamilies should be ignored",
+			service: &v1.Service{Spec: v1.ServiceSpec{
+				IPFamilies: []v1.IPFamily{v1.IPv4Protocol, "unknown", v1.IPv4Protocol},
+			}},
+			expectedIPFamilies: []bool{false},
+			expectedIPv6Suffix: "-IPv6",
+		},
+	} {
+		t.Run(testCase.description, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedIPFamilies, getServiceIPFamilies(testCase.service))
+			assert.Equal(t, testCase.expectedIPv4Suffix, getIPFamilySuffix(testCase.service, false))
+			assert.Equal(t, testCase.expectedIPv6Suffix, getIPFamilySuffix(testCase.service, true))
+			assert.Equal(t, testCase.expectedIPv6Enabled, isServiceIPFamilyEnabled(testCase.service, true))
+		})
+	}
+}
+
+func TestGetIngressIPByIPFamily(t *testing.T) {
+	status := &v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{
+			{Hostname: "foo"},
+			{IP: "1.2.3.4"},
+			{IP: "fd00::1"},
+		},
+	}
+	assert.Equal(t, "1.2.3.4", getIngressIPByIPFamily(status, false))
+	assert.Equal(t, "fd00::1", getIngressIPByIPFamily(status, true))
+	assert.Equal(t, "", getIngressIPByIPFamily(nil, true))
+
+	service := &v1.Service{Spec: v1.ServiceSpec{LoadBalancerIP: "fd00::1"}}
+	assert.Equal(t, "", getServiceLoadBalancerIP(service, false))
+	assert.Equal(t, "fd00::1", getServiceLoadBalancerIP(service, true))
+}
+
+func TestIsLBBackendPoolsExisting(t *testing.T) {
+	lbBackendPoolNames := map[bool]string{
+		false: "kubernetes",
+		true:  "kubernetes-IPv6",
+	}
+	for _, testCase := range []struct {
+		bpName         string
+		expectedFound  bool
+		expectedIsIPv6 bool
+	}{
+		{bpName: "kubernetes", expectedFound: true},
+		{bpName: "Kubernetes-ipv6", expectedFound: true, expectedIsIPv6: true},
+		{bpName: "other"},
+	} {
+		found, isIPv6 := isLBBackendPoolsExisting(lbBackendPoolNames, to.StringPtr(testCase.bpName))
+		assert.Equal(t, testCase.expectedFound, found, testCase.bpName)
+		assert.Equal(t, testCase.expectedIsIPv6, isIPv6, testCase.bpName)
+		assert.Equal(t, testCase.expectedIsIPv6, isBackendPoolIPv6(testCase.bpName), testCase.bpName)
+	}
+}
@@ -33,7 +33,6 @@ import (
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
-	utilnet "k8s.io/utils/net"
 
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
@@ -1012,8 +1011,14 @@ func (ss *ScaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 		// need to check the vmSet name when using multiple standard LBs
 		needCheck = true
 
-		// ensure the vm that is supposed to share the primary SLB in the backendpool of the primary SLB
-		if strings.EqualFold(ss.GetPrimaryVMSetName(), vmSetNameOfLB) &&
+		// ensure the vm is in the backendpool of the SLB whose configuration contains its vmSet
+		if lbConfig := ss.getMultipleStandardLoadBalancerConfiguration(vmSetNameOfLB); lbConfig != nil {
+			if !lbConfig.hasNodePool(vm.VMSSName) {
+				klog.V(3).Infof("EnsureHostInPool skips node %s because it is not in the node pools of the load balancer configuration %s", vmName, lbConfig.Name)
+				return "", "", "", nil, nil
+			}
+			needCheck = false
+		} else if strings.EqualFold(ss.GetPrimaryVMSetName(), vmSetNameOfLB) &&
 			ss.getVMSetNamesSharingPrimarySLB().Has(strings.ToLower(vm.VMSSName)) {
 			klog.V(4).Infof("EnsureHostInPool: the vm %s in the vmSet %s is supposed to share the primary SLB",
 				nodeName, vm.VMSSName)
@@ -1040,7 +1045,7 @@ func (ss *ScaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 	}
 
 	var primaryIPConfiguration *compute.VirtualMachineScaleSetIPConfiguration
-	ipv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
+	ipv6 := isBackendPoolIPv6(backendPoolID)
 	// Find primary network interface configuration.
 	if !ss.Cloud.ipv6DualStackEnabled && !ipv6 {
 		// Find primary IP configuration.
@@ -1049,9 +1054,9 @@ func (ss *ScaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 			return "", "", "", nil, err
 		}
 	} else {
-		// For IPv6 or dualstack service, we need to pick the right IP configuration based on the cluster ip family
+		// For IPv6 or dualstack service, we need to pick the right IP configuration based on the family of the backend pool
 		// IPv6 configuration is only supported as non-primary, so we need to fetch the ip configuration where the
-		// privateIPAddressVersion matches the clusterIP family
+		// privateIPAddressVersion matches the backend pool family
 		primaryIPConfiguration, err = ss.getConfigForScaleSetByIPFamily(primaryNetworkInterfaceConfiguration, vmName, ipv6)
 		if err != nil {
 			return "", "", "", nil, err
@@ -1071,38 +1076,48 @@ func (ss *ScaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 		}
 	}
 
-	// The backendPoolID has already been found from existing LoadBalancerBackendAddressPools.
-	if foundPool {
-		return "", "", "", nil, nil
-	}
-
-	if ss.useStandardLoadBalancer() && len(newBackendPools) > 0 {
-		// Although standard load balancer supports backends from multiple scale
-		// sets, the same network interface couldn't be added to more than one load balancer of
-		// the same type. Omit those nodes (e.g. masters) so Azure ARM won't complain
-		// about this.
-		newBackendPoolsIDs := make([]string, 0, len(newBackendPools))
-		for _, pool := range newBackendPools {
-			if pool.ID != nil {
-				newBackendPoolsIDs = append(newBackendPoolsIDs, *pool.ID)
+	if !foundPool {
+		if ss.useStandardLoadBalancer() && len(newBackendPools) > 0 {
+			// Although standard load balancer supports backends from multiple scale
+			// sets, the same network interface couldn't be added to more than one load balancer of
+			// the same type. Omit those nodes (e.g. masters) so Azure ARM won't complain
+			// about this.
+			newBackendPoolsIDs := make([]string, 0, len(newBackendPools))
+			for _, pool := range newBackendPools {
+				if pool.ID != nil {
+					newBackendPoolsIDs = append(newBackendPoolsIDs, *pool.ID)
+				}
+			}
+			isSameLB, oldLBName, err := isBackendPoolOnSameLB(backendPoolID, newBackendPoolsIDs)
+			if err != nil {
+				return "", "", "", nil, err
+			}
+			if !isSameLB {
+				klog.V(4).Infof("Node %q has already been added to LB %q, omit adding it to a new one", nodeName, oldLBName)
+				return "", "", "", nil, nil
 			}
 		}
-		isSameLB, oldLBName, err := isBackendPoolOnSameLB(backendPoolID, newBackendPoolsIDs)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-		if !isSameLB {
-			klog.V(4).Infof("Node %q has already been added to LB %q, omit adding it to a new one", nodeName, oldLBName)
-			return "", "", "", nil, nil
-		}
+
+		// Compose a new vmssVM with added backendPoolID.
+		newBackendPools = append(newBackendPools,
+			compute.SubResource{
+				ID: to.StringPtr(backendPoolID),
+			})
+		primaryIPConfiguration.LoadBalancerBackendAddressPools = &newBackendPools
+	}
+
+	// the IP configuration joins the application security group which the security rules target
+	asgID, err := ss.ensureNodeApplicationSecurityGroup(backendPoolID, vm.VMSSName)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	asgChanged := reconcileVMSSIPConfigApplicationSecurityGroup(primaryIPConfiguration, asgID, true)
+
+	// The backendPoolID has already been found from existing LoadBalancerBackendAddressPools.
+	if foundPool && !asgChanged {
+		return "", "", "", nil, nil
 	}
 
-	// Compose a new vmssVM with added backendPoolID.
-	newBackendPools = append(newBackendPools,
-		compute.SubResource{
-			ID: to.StringPtr(backendPoolID),
-		})
-	primaryIPConfiguration.LoadBalancerBackendAddressPools = &newBackendPools
 	newVM := &compute.VirtualMachineScaleSetVM{
 		Location: &vm.Location,
 		VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{
@@ -1163,6 +1178,10 @@ func (ss *ScaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, back
 				vmssNamesMap[vmssName] = true
 			}
 		}
+	} else if lbConfig := ss.getMultipleStandardLoadBalancerConfiguration(vmSetNameOfLB); lbConfig != nil {
+		for _, nodePool := range lbConfig.NodePools {
+			vmssNamesMap[nodePool] = true
+		}
 	} else {
 		vmssNamesMap[vmSetNameOfLB] = true
 	}
@@ -1191,7 +1210,7 @@ func (ss *ScaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, back
 			return err
 		}
 		var primaryIPConfig *compute.VirtualMachineScaleSetIPConfiguration
-		ipv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
+		ipv6 := isBackendPoolIPv6(backendPoolID)
 		// Find primary network interface configuration.
 		if !ss.Cloud.ipv6DualStackEnabled && !ipv6 {
 			// Find primary IP configuration.
@@ -1218,37 +1237,47 @@ func (ss *ScaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, back
 				break
 			}
 		}
-		if found {
-			continue
-		}
 
-		if ss.useStandardLoadBalancer() && len(loadBalancerBackendAddressPools) > 0 {
-			// Although standard load balancer supports backends from multiple scale
-			// sets, the same network interface couldn't be added to more than one load balancer of
-			// the same type. Omit those nodes (e.g. masters) so Azure ARM won't complain
-			// about this.
-			newBackendPoolsIDs := make([]string, 0, len(loadBalancerBackendAddressPools))
-			for _, pool := range loadBalancerBackendAddressPools {
-				if pool.ID != nil {
-					newBackendPoolsIDs = append(newBackendPoolsIDs, *pool.ID)
+		if !found {
+			if ss.useStandardLoadBalancer() && len(loadBalancerBackendAddressPools) > 0 {
+				// Although standard load balancer supports backends from multiple scale
+				// sets, the same network interface couldn't be added to more than one load balancer of
+				// the same type. Omit those nodes (e.g. masters) so Azure ARM won't complain
+				// about this.
+				newBackendPoolsIDs := make([]string, 0, len(loadBalancerBackendAddressPools))
+				for _, pool := range loadBalancerBackendAddressPools {
+					if pool.ID != nil {
+						newBackendPoolsIDs = append(newBackendPoolsIDs, *pool.ID)
+					}
+				}
+				isSameLB, oldLBName, err := isBackendPoolOnSameLB(backendPoolID, newBackendPoolsIDs)
+				if err != nil {
+					return err
+				}
+				if !isSameLB {
+					klog.V(4).Infof("VMSS %q has already been added to LB %q, omit adding it to a new one", vmssName, oldLBName)
+					return nil
 				}
 			}
-			isSameLB, oldLBName, err := isBackendPoolOnSameLB(backendPoolID, newBackendPoolsIDs)
-			if err != nil {
-				return err
-			}
-			if !isSameLB {
-				klog.V(4).Infof("VMSS %q has already been added to LB %q, omit adding it to a new one", vmssName, oldLBName)
-				return nil
-			}
+
+			// Compose a new vmss with added backendPoolID.
+			loadBalancerBackendAddressPools = append(loadBalancerBackendAddressPools,
+				compute.SubResource{
+					ID: to.StringPtr(backendPoolID),
+				})
+			primaryIPConfig.LoadBalancerBackendAddressPools = &loadBalancerBackendAddressPools
+		}
+
+		// the new instances join the application security group which the security rules target
+		asgID, err := ss.ensureNodeApplicationSecurityGroup(backendPoolID, vmssName)
+		if err != nil {
+			return err
+		}
+		asgChanged := reconcileVMSSIPConfigApplicationSecurityGroup(primaryIPConfig, asgID, true)
+		if found && !asgChanged {
+			continue
 		}
 
-		// Compose a new vmss with added backendPoolID.
-		loadBalancerBackendAddressPools = append(loadBalancerBackendAddressPools,
-			compute.SubResource{
-				ID: to.StringPtr(backendPoolID),
-			})
-		primaryIPConfig.LoadBalancerBackendAddressPools = &loadBalancerBackendAddressPools
 		newVMSS := compute.VirtualMachineScaleSet{
 			Location: vmss.Location,
 			VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
@@ -1442,6 +1471,8 @@ func (ss *ScaleSet) ensureBackendPoolDeletedFromNode(nodeName, backendPoolID str
 
 	// Compose a new vmssVM with added backendPoolID.
 	primaryIPConfiguration.LoadBalancerBackendAddressPools = &newBackendPools
+	asgID := ss.getApplicationSecurityGroupIDToLeave(backendPoolID, vm.VMSSName, len(newBackendPools))
+	reconcileVMSSIPConfigApplicationSecurityGroup(primaryIPConfiguration, asgID, false)
 	newVM := &compute.VirtualMachineScaleSetVM{
 		Location: &vm.Location,
 		VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{
@@ -1740,6 +1771,8 @@ func (ss *ScaleSet) EnsureBackendPoolDeletedFromVMSets(vmssNamesMap map[string]b
 		vmssUpdaters = append(vmssUpdaters, func() error {
 			// Compose a new vmss with added backendPoolID.
 			primaryIPConfig.LoadBalancerBackendAddressPools = &newBackendPools
+			asgID := ss.getApplicationSecurityGroupIDToLeave(backendPoolID, vmssName, len(newBackendPools))
+			reconcileVMSSIPConfigApplicationSecurityGroup(primaryIPConfig, asgID, false)
 			newVMSS := compute.VirtualMachineScaleSet{
 				Location: vmss.Location,
 				VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
@@ -37,12 +37,13 @@ import (
 )
 
 var (
-	vmCacheTTLDefaultInSeconds           = 60
-	loadBalancerCacheTTLDefaultInSeconds = 120
-	nsgCacheTTLDefaultInSeconds          = 120
-	routeTableCacheTTLDefaultInSeconds   = 120
-	publicIPCacheTTLDefaultInSeconds     = 120
-	plsCacheTTLDefaultInSeconds          = 120
+	vmCacheTTLDefaultInSeconds                       = 60
+	loadBalancerCacheTTLDefaultInSeconds             = 120
+	nsgCacheTTLDefaultInSeconds                      = 120
+	routeTableCacheTTLDefaultInSeconds               = 120
+	publicIPCacheTTLDefaultInSeconds                 = 120
+	plsCacheTTLDefaultInSeconds                      = 120
+	applicationSecurityGroupCacheTTLDefaultInSeconds = 120
 
 	azureNodeProviderIDRE    = regexp.MustCompile(`^azure:///subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Compute/(?:.*)`)
 	azureResourceGroupNameRE = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(.+)/providers/(?:.*)`)